@@ -0,0 +1,100 @@
+package main
+
+import (
+	"flag"
+	"log"
+
+	"anywebsites/internal/config"
+	"anywebsites/internal/database"
+	"anywebsites/internal/models"
+	"anywebsites/internal/services"
+	"anywebsites/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+// 把仍保存在 contents.content 列中的正文迁移到 STORAGE_BACKEND 配置的 blob 存储
+func main() {
+	batchSize := flag.Int("batch", 100, "每批迁移的内容数量")
+	dryRun := flag.Bool("dry-run", false, "只统计需要迁移的内容，不做修改")
+	flag.Parse()
+
+	cfg := config.Load()
+
+	if err := database.Connect(cfg); err != nil {
+		log.Fatal("Failed to connect to database:", err)
+	}
+	if err := storage.Init(cfg); err != nil {
+		log.Fatal("Failed to initialize content storage:", err)
+	}
+	if storage.Store == nil {
+		log.Fatal("STORAGE_BACKEND is database, nothing to migrate")
+	}
+
+	var total int64
+	if err := database.DB.Model(&models.Content{}).
+		Where("COALESCE(storage_key, '') = '' AND COALESCE(file_path, '') = ''").
+		Count(&total).Error; err != nil {
+		log.Fatal("Failed to count contents:", err)
+	}
+	log.Printf("Found %d content bodies stored in the database", total)
+	if *dryRun || total == 0 {
+		return
+	}
+
+	migrated, failed := 0, 0
+	lastID := uuid.Nil
+	for {
+		var contents []models.Content
+		if err := database.DB.
+			Where("COALESCE(storage_key, '') = '' AND COALESCE(file_path, '') = '' AND id > ?", lastID).
+			Order("id").
+			Limit(*batchSize).
+			Find(&contents).Error; err != nil {
+			log.Fatal("Failed to load contents:", err)
+		}
+		if len(contents) == 0 {
+			break
+		}
+
+		for _, content := range contents {
+			lastID = content.ID
+			key := services.ContentBodyKey(content.ID)
+
+			// 先写入存储再更新数据库，中途失败时正文仍保留在数据库中
+			if err := storage.Store.Put(key, []byte(content.Content)); err != nil {
+				log.Printf("Failed to store body of %s: %v", content.ID, err)
+				failed++
+				continue
+			}
+
+			// 读取后内容被修改过时跳过，下次运行再迁移
+			result := database.DB.Model(&models.Content{}).
+				Where("id = ? AND COALESCE(storage_key, '') = '' AND updated_at = ?", content.ID, content.UpdatedAt).
+				Updates(map[string]interface{}{
+					"storage_key":  key,
+					"content":      "",
+					"content_hash": models.HashBody(content.Content),
+					"file_size":    int64(len(content.Content)),
+				})
+			if result.Error != nil {
+				log.Printf("Failed to update %s: %v", content.ID, result.Error)
+				failed++
+				continue
+			}
+			if result.RowsAffected == 0 {
+				log.Printf("Content %s changed during migration, skipped", content.ID)
+				failed++
+				continue
+			}
+			migrated++
+		}
+
+		log.Printf("Migrated %d/%d content bodies", migrated, total)
+	}
+
+	log.Printf("Migration finished: %d migrated, %d failed", migrated, failed)
+	if failed > 0 {
+		log.Fatal("Some content bodies were not migrated, re-run the command to retry")
+	}
+}
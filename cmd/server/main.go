@@ -1,13 +1,20 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"anywebsites/internal/api"
 	"anywebsites/internal/config"
 	"anywebsites/internal/database"
 	"anywebsites/internal/services"
+	"anywebsites/internal/storage"
 )
 
 func main() {
@@ -24,12 +31,26 @@ func main() {
 		log.Fatal("Failed to migrate database:", err)
 	}
 
+	// 初始化 JWT 签名密钥，HS256 使用默认或过短的密钥时拒绝启动
+	jwtKeyService, err := services.NewJWTKeyService(cfg.JWT)
+	if err != nil {
+		log.Fatal("Invalid JWT configuration:", err)
+	}
+	if err := jwtKeyService.Start(); err != nil {
+		log.Fatal("Failed to load JWT signing keys:", err)
+	}
+	defer jwtKeyService.Stop()
+
+	// 初始化内容正文存储
+	if err := storage.Init(cfg); err != nil {
+		log.Fatal("Failed to initialize content storage:", err)
+	}
+
 	// 初始化系统设置服务
 	settingsService := services.NewSettingsService()
 
 	// 初始化 GeoIP 服务
-	geoipPath := "data/geoip/GeoLite2-City.mmdb"
-	geoipService, err := services.NewGeoIPService(geoipPath)
+	geoipService, err := services.NewGeoIPServiceFromConfig(cfg.GeoIP)
 	if err != nil {
 		log.Printf("Warning: Failed to initialize GeoIP service: %v", err)
 		log.Printf("Geographic location features will be limited")
@@ -39,13 +60,26 @@ func main() {
 		defer geoipService.Close()
 	}
 
+	// 启动访问统计写入管道
+	analyticsPipeline := services.NewAnalyticsPipeline(cfg, geoipService)
+	analyticsPipeline.Start()
+
+	// 启动 API 调用次数的批量写入
+	apiUsageRecorder := services.NewAPIUsageRecorder()
+	apiUsageRecorder.Start()
+
+	// 启动访问统计按天汇总服务
+	rollupService := services.NewAnalyticsRollupService(cfg, settingsService)
+	go rollupService.Start()
+	defer rollupService.Stop()
+
 	// 启动清理服务
-	cleanupService := services.NewCleanupService()
+	cleanupService := services.NewCleanupService(settingsService)
 	go cleanupService.Start()
 	defer cleanupService.Stop()
 
 	// 设置路由
-	r := api.SetupRoutes(cfg, geoipService)
+	r := api.SetupRoutes(cfg, geoipService, analyticsPipeline, apiUsageRecorder)
 
 	// 从数据库加载服务器配置
 	serverHost := cfg.Server.Host // 默认使用静态配置的主机
@@ -67,8 +101,32 @@ func main() {
 
 	// 启动服务器
 	addr := serverHost + ":" + serverPort
-	log.Printf("Server starting on %s", addr)
-	if err := r.Run(addr); err != nil {
-		log.Fatal("Failed to start server:", err)
+	server := &http.Server{Addr: addr, Handler: r}
+	// Shutdown 不会取消请求的 Context，关闭时先结束实时访问推送，避免长连接拖住关闭
+	server.RegisterOnShutdown(analyticsPipeline.LiveViews().Close)
+	go func() {
+		log.Printf("Server starting on %s", addr)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal("Failed to start server:", err)
+		}
+	}()
+
+	// 等待退出信号，停止接收请求后写完缓冲区中的访问统计和 API 调用次数
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	log.Println("Shutting down server...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Server shutdown error: %v", err)
+	}
+
+	if analyticsPipeline.Close(10 * time.Second) {
+		log.Println("Analytics pipeline drained")
+	}
+	if apiUsageRecorder.Close(5 * time.Second) {
+		log.Println("API usage flushed")
 	}
 }
@@ -1,6 +1,9 @@
 package api
 
 import (
+	"errors"
+	"html/template"
+	"log"
 	"math/rand"
 	"net/http"
 	"strconv"
@@ -8,30 +11,56 @@ import (
 
 	"anywebsites/internal/auth"
 	"anywebsites/internal/database"
+	"anywebsites/internal/middleware"
 	"anywebsites/internal/models"
 	"anywebsites/internal/services"
+	"anywebsites/internal/utils"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
 type AdminHandler struct {
-	geoipService *services.GeoIPService
-	planService  *services.PlanService
+	geoipService    *services.GeoIPService
+	analytics       *services.AnalyticsPipeline
+	planService     *services.PlanService
+	revisionService *services.RevisionService
+	storageService  *services.StorageService
+	apiKeyService   *services.APIKeyService
+	exportService   *services.AnalyticsExportService
+	sessionService  *services.SessionService
+	twoFactor       *services.TwoFactorService
+	sso             *services.OIDCService
 }
 
-func NewAdminHandler(geoipService *services.GeoIPService) *AdminHandler {
+// adminChallengeCookie 管理后台登录第二步使用的 Cookie，保存密码验证通过后签发的挑战 Token
+const adminChallengeCookie = "admin_mfa"
+
+func NewAdminHandler(geoipService *services.GeoIPService, analytics *services.AnalyticsPipeline, apiKeyService *services.APIKeyService, twoFactor *services.TwoFactorService, sso *services.OIDCService) *AdminHandler {
 	return &AdminHandler{
-		geoipService: geoipService,
-		planService:  services.NewPlanService(),
+		geoipService:    geoipService,
+		analytics:       analytics,
+		planService:     services.NewPlanService(),
+		revisionService: services.NewRevisionService(),
+		storageService:  services.NewStorageService(),
+		apiKeyService:   apiKeyService,
+		exportService:   services.NewAnalyticsExportService(),
+		sessionService:  services.NewSessionService(),
+		twoFactor:       twoFactor,
+		sso:             sso,
 	}
 }
 
 // LoginPage 显示登录页面
 func (h *AdminHandler) LoginPage(c *gin.Context) {
-	c.HTML(http.StatusOK, "login.html", gin.H{
-		"Title": "管理员登录",
-	})
+	h.renderLogin(c, http.StatusOK, gin.H{})
+}
+
+// renderLogin 渲染登录页面，启用单点登录时显示 SSO 登录入口
+func (h *AdminHandler) renderLogin(c *gin.Context, status int, data gin.H) {
+	data["Title"] = "管理员登录"
+	data["SSOEnabled"] = h.sso != nil && h.sso.Enabled()
+	c.HTML(status, "login.html", data)
 }
 
 // Login 处理登录
@@ -40,8 +69,7 @@ func (h *AdminHandler) Login(c *gin.Context) {
 	password := c.PostForm("password")
 
 	if username == "" || password == "" {
-		c.HTML(http.StatusBadRequest, "login.html", gin.H{
-			"Title":    "管理员登录",
+		h.renderLogin(c, http.StatusBadRequest, gin.H{
 			"Error":    "用户名和密码不能为空",
 			"Username": username,
 		})
@@ -51,8 +79,7 @@ func (h *AdminHandler) Login(c *gin.Context) {
 	// 验证用户
 	var user models.User
 	if err := database.DB.Where("username = ? AND is_active = ?", username, true).First(&user).Error; err != nil {
-		c.HTML(http.StatusUnauthorized, "login.html", gin.H{
-			"Title":    "管理员登录",
+		h.renderLogin(c, http.StatusUnauthorized, gin.H{
 			"Error":    "用户名或密码错误",
 			"Username": username,
 		})
@@ -60,35 +87,277 @@ func (h *AdminHandler) Login(c *gin.Context) {
 	}
 
 	if !auth.CheckPassword(password, user.Password) {
-		c.HTML(http.StatusUnauthorized, "login.html", gin.H{
-			"Title":    "管理员登录",
+		h.renderLogin(c, http.StatusUnauthorized, gin.H{
 			"Error":    "用户名或密码错误",
 			"Username": username,
 		})
 		return
 	}
 
-	// 生成 JWT Token
-	token, err := auth.GenerateToken(user.ID, user.Username, user.IsAdmin)
+	h.completeLogin(c, &user)
+}
+
+// completeLogin 第一步验证（密码或单点登录）通过后，需要两步验证时先签发登录挑战，验证码通过后再创建会话
+func (h *AdminHandler) completeLogin(c *gin.Context, user *models.User) {
+	if h.twoFactor.Required(user) {
+		challenge, err := h.twoFactor.CreateChallenge(user)
+		if err != nil {
+			h.renderLogin(c, http.StatusInternalServerError, gin.H{
+				"Error": "登录失败，请重试",
+			})
+			return
+		}
+		c.SetCookie(adminChallengeCookie, challenge.MFAToken, challenge.ExpiresIn, "/admin/login", "", utils.IsSecureRequest(c), true)
+		c.Redirect(http.StatusFound, "/admin/login/2fa")
+		return
+	}
+
+	h.startAdminSession(c, user, nil)
+}
+
+// LoginTwoFactorPage 显示登录第二步页面，被强制启用两步验证的管理员在这里绑定验证器
+func (h *AdminHandler) LoginTwoFactorPage(c *gin.Context) {
+	token, err := c.Cookie(adminChallengeCookie)
+	if err != nil || token == "" {
+		c.Redirect(http.StatusFound, "/admin/login")
+		return
+	}
+
+	user, err := h.twoFactor.ChallengeUser(token)
+	if err != nil {
+		h.restartAdminLogin(c, "验证已过期，请重新登录")
+		return
+	}
+
+	data := gin.H{"Title": "两步验证"}
+	if !user.TOTPEnabled {
+		setup, err := h.twoFactor.ChallengeSetup(token)
+		if err != nil {
+			h.restartAdminLogin(c, twoFactorErrorMessage(err))
+			return
+		}
+		setTwoFactorSetup(data, setup)
+	}
+	c.HTML(http.StatusOK, "login-2fa.html", data)
+}
+
+// LoginTwoFactor 处理登录第二步
+func (h *AdminHandler) LoginTwoFactor(c *gin.Context) {
+	token, err := c.Cookie(adminChallengeCookie)
+	if err != nil || token == "" {
+		c.Redirect(http.StatusFound, "/admin/login")
+		return
+	}
+
+	user, recoveryCodes, err := h.twoFactor.CompleteChallenge(token, c.PostForm("code"))
+	if err != nil {
+		if !errors.Is(err, services.ErrInvalidTwoFactorCode) {
+			h.restartAdminLogin(c, twoFactorErrorMessage(err))
+			return
+		}
+
+		data := gin.H{"Title": "两步验证", "Error": twoFactorErrorMessage(err)}
+		if challengeUser, err := h.twoFactor.ChallengeUser(token); err == nil {
+			setTwoFactorSetup(data, h.twoFactor.PendingSetup(challengeUser))
+		}
+		c.HTML(http.StatusUnauthorized, "login-2fa.html", data)
+		return
+	}
+
+	c.SetCookie(adminChallengeCookie, "", -1, "/admin/login", "", utils.IsSecureRequest(c), true)
+	h.startAdminSession(c, user, recoveryCodes)
+}
+
+// startAdminSession 创建会话并写入 Cookie，登录中刚启用两步验证时先展示恢复码
+func (h *AdminHandler) startAdminSession(c *gin.Context, user *models.User, recoveryCodes []string) {
+	// 创建会话并生成 JWT Token
+	tokens, err := h.sessionService.Create(user, sessionClient(c))
 	if err != nil {
-		c.HTML(http.StatusInternalServerError, "login.html", gin.H{
-			"Title": "管理员登录",
+		h.renderLogin(c, http.StatusInternalServerError, gin.H{
 			"Error": "登录失败，请重试",
 		})
 		return
 	}
 
 	// 设置 Cookie
-	c.SetCookie("admin_token", token, 3600*24, "/admin", "", false, true)
+	c.SetCookie("admin_token", tokens.AccessToken, 3600*24, "/admin", "", utils.IsSecureRequest(c), true)
+	if len(recoveryCodes) > 0 {
+		c.HTML(http.StatusOK, "login-2fa.html", gin.H{
+			"Title":         "两步验证已启用",
+			"RecoveryCodes": recoveryCodes,
+		})
+		return
+	}
 	c.Redirect(http.StatusFound, "/admin")
 }
 
-// Logout 退出登录
+// restartAdminLogin 清除登录挑战并返回登录页面
+func (h *AdminHandler) restartAdminLogin(c *gin.Context, message string) {
+	c.SetCookie(adminChallengeCookie, "", -1, "/admin/login", "", utils.IsSecureRequest(c), true)
+	h.renderLogin(c, http.StatusUnauthorized, gin.H{
+		"Error": message,
+	})
+}
+
+// Logout 退出登录，同时吊销当前会话
 func (h *AdminHandler) Logout(c *gin.Context) {
-	c.SetCookie("admin_token", "", -1, "/admin", "", false, true)
+	if sessionID, exists := middleware.GetSessionID(c); exists {
+		if err := h.sessionService.Revoke(sessionID); err != nil {
+			log.Printf("Failed to revoke admin session %s: %v", sessionID, err)
+		}
+	}
+	c.SetCookie("admin_token", "", -1, "/admin", "", utils.IsSecureRequest(c), true)
 	c.Redirect(http.StatusFound, "/admin/login")
 }
 
+// TwoFactor 当前账户的两步验证设置页面
+func (h *AdminHandler) TwoFactor(c *gin.Context) {
+	user, ok := h.currentAdminUser(c)
+	if !ok {
+		return
+	}
+	h.renderTwoFactor(c, http.StatusOK, user, gin.H{})
+}
+
+// TwoFactorSetup 生成新的 TOTP 密钥
+func (h *AdminHandler) TwoFactorSetup(c *gin.Context) {
+	user, ok := h.currentAdminUser(c)
+	if !ok {
+		return
+	}
+
+	setup, err := h.twoFactor.Setup(user)
+	if err != nil {
+		h.renderTwoFactor(c, http.StatusBadRequest, user, gin.H{"Error": twoFactorErrorMessage(err)})
+		return
+	}
+
+	data := gin.H{}
+	setTwoFactorSetup(data, setup)
+	h.renderTwoFactor(c, http.StatusOK, user, data)
+}
+
+// TwoFactorEnable 使用验证码确认密钥并启用两步验证
+func (h *AdminHandler) TwoFactorEnable(c *gin.Context) {
+	user, ok := h.currentAdminUser(c)
+	if !ok {
+		return
+	}
+
+	recoveryCodes, err := h.twoFactor.Enable(user, c.PostForm("code"))
+	if err != nil {
+		data := gin.H{"Error": twoFactorErrorMessage(err)}
+		setTwoFactorSetup(data, h.twoFactor.PendingSetup(user))
+		h.renderTwoFactor(c, http.StatusBadRequest, user, data)
+		return
+	}
+
+	h.renderTwoFactor(c, http.StatusOK, user, gin.H{
+		"Success":       "两步验证已启用",
+		"RecoveryCodes": recoveryCodes,
+	})
+}
+
+// TwoFactorDisable 关闭两步验证
+func (h *AdminHandler) TwoFactorDisable(c *gin.Context) {
+	user, ok := h.currentAdminUser(c)
+	if !ok {
+		return
+	}
+
+	if err := h.twoFactor.Disable(user, c.PostForm("password"), c.PostForm("code")); err != nil {
+		h.renderTwoFactor(c, http.StatusBadRequest, user, gin.H{"Error": twoFactorErrorMessage(err)})
+		return
+	}
+
+	user.TOTPEnabled = false
+	h.renderTwoFactor(c, http.StatusOK, user, gin.H{"Success": "两步验证已关闭"})
+}
+
+// TwoFactorRecoveryCodes 重新生成恢复码
+func (h *AdminHandler) TwoFactorRecoveryCodes(c *gin.Context) {
+	user, ok := h.currentAdminUser(c)
+	if !ok {
+		return
+	}
+
+	recoveryCodes, err := h.twoFactor.RegenerateRecoveryCodes(user, c.PostForm("code"))
+	if err != nil {
+		h.renderTwoFactor(c, http.StatusBadRequest, user, gin.H{"Error": twoFactorErrorMessage(err)})
+		return
+	}
+
+	h.renderTwoFactor(c, http.StatusOK, user, gin.H{
+		"Success":       "已生成新的恢复码，旧的恢复码已作废",
+		"RecoveryCodes": recoveryCodes,
+	})
+}
+
+// currentAdminUser 从数据库加载当前登录的用户
+func (h *AdminHandler) currentAdminUser(c *gin.Context) (*models.User, bool) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.Redirect(http.StatusFound, "/admin/login")
+		return nil, false
+	}
+
+	var user models.User
+	if err := database.DB.Where("id = ? AND is_active = ?", userID, true).First(&user).Error; err != nil {
+		c.Redirect(http.StatusFound, "/admin/login")
+		return nil, false
+	}
+	return &user, true
+}
+
+func (h *AdminHandler) renderTwoFactor(c *gin.Context, status int, user *models.User, data gin.H) {
+	twoFactorStatus, err := h.twoFactor.Status(user)
+	if err != nil {
+		log.Printf("Failed to get two-factor status for user %s: %v", user.ID, err)
+		twoFactorStatus = &services.TwoFactorStatus{Enabled: user.TOTPEnabled}
+	}
+
+	username, _ := c.Get("username")
+	data["Title"] = "两步验证"
+	data["Page"] = "two-factor"
+	data["Username"] = username
+	data["Status"] = twoFactorStatus
+	c.HTML(status, "layout.html", data)
+}
+
+// setTwoFactorSetup 将待确认的密钥写入模板数据，otpauth:// 链接需要标记为可信 URL
+func setTwoFactorSetup(data gin.H, setup *services.TwoFactorSetup) {
+	if setup == nil {
+		return
+	}
+	data["Setup"] = setup
+	data["SetupURI"] = template.URL(setup.URI)
+}
+
+// twoFactorErrorMessage 两步验证错误的页面提示
+func twoFactorErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, services.ErrInvalidTwoFactorCode):
+		return "验证码不正确或已使用"
+	case errors.Is(err, services.ErrInvalidChallenge):
+		return "验证已过期，请重新登录"
+	case errors.Is(err, services.ErrTooManyAttempts):
+		return "验证码错误次数过多，请稍后再试"
+	case errors.Is(err, services.ErrInvalidPassword):
+		return "密码错误"
+	case errors.Is(err, services.ErrTwoFactorMandatory):
+		return "系统要求管理员启用两步验证，不能关闭"
+	case errors.Is(err, services.ErrTwoFactorAlreadyEnabled):
+		return "两步验证已启用"
+	case errors.Is(err, services.ErrTwoFactorNotEnabled):
+		return "两步验证未启用"
+	case errors.Is(err, services.ErrTwoFactorNotSetUp):
+		return "请先生成密钥"
+	default:
+		log.Printf("Two-factor operation failed: %v", err)
+		return "操作失败，请重试"
+	}
+}
+
 // Dashboard 仪表板
 func (h *AdminHandler) Dashboard(c *gin.Context) {
 	// 获取统计数据
@@ -227,16 +496,13 @@ func (h *AdminHandler) DeleteContent(c *gin.Context) {
 		return
 	}
 
-	result := database.DB.Model(&models.Content{}).
-		Where("id = ?", id).
-		Update("is_active", false)
-
-	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": result.Error.Error()})
+	affected, err := h.storageService.SetContentsActive([]uuid.UUID{id}, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
 		return
 	}
 
-	if result.RowsAffected == 0 {
+	if affected == 0 {
 		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Content not found"})
 		return
 	}
@@ -253,16 +519,13 @@ func (h *AdminHandler) RestoreContent(c *gin.Context) {
 		return
 	}
 
-	result := database.DB.Model(&models.Content{}).
-		Where("id = ?", id).
-		Update("is_active", true)
-
-	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": result.Error.Error()})
+	affected, err := h.storageService.SetContentsActive([]uuid.UUID{id}, true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
 		return
 	}
 
-	if result.RowsAffected == 0 {
+	if affected == 0 {
 		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": "Content not found"})
 		return
 	}
@@ -298,18 +561,15 @@ func (h *AdminHandler) BatchDeleteContents(c *gin.Context) {
 	}
 
 	// 批量软删除
-	result := database.DB.Model(&models.Content{}).
-		Where("id IN ?", uuids).
-		Update("is_active", false)
-
-	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": result.Error.Error()})
+	affected, err := h.storageService.SetContentsActive(uuids, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"count":   result.RowsAffected,
+		"count":   affected,
 	})
 }
 
@@ -341,18 +601,15 @@ func (h *AdminHandler) BatchRestoreContents(c *gin.Context) {
 	}
 
 	// 批量恢复
-	result := database.DB.Model(&models.Content{}).
-		Where("id IN ?", uuids).
-		Update("is_active", true)
-
-	if result.Error != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": result.Error.Error()})
+	affected, err := h.storageService.SetContentsActive(uuids, true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"count":   result.RowsAffected,
+		"count":   affected,
 	})
 }
 
@@ -407,7 +664,7 @@ func (h *AdminHandler) CreateContent(c *gin.Context) {
 		IsActive:    true,
 	}
 
-	if err := database.DB.Create(&content).Error; err != nil {
+	if err := h.storageService.Create(&content); err != nil {
 		username, _ := c.Get("username")
 		c.HTML(http.StatusInternalServerError, "layout.html", gin.H{
 			"Title":       "新建内容",
@@ -445,6 +702,13 @@ func (h *AdminHandler) EditContent(c *gin.Context) {
 		})
 		return
 	}
+	if err := h.storageService.LoadBody(&content); err != nil {
+		c.HTML(http.StatusInternalServerError, "error.html", gin.H{
+			"Title":   "错误",
+			"Message": "读取内容失败: " + err.Error(),
+		})
+		return
+	}
 
 	username, _ := c.Get("username")
 
@@ -480,6 +744,13 @@ func (h *AdminHandler) UpdateContent(c *gin.Context) {
 		})
 		return
 	}
+	if err := h.storageService.LoadBody(&content); err != nil {
+		c.HTML(http.StatusInternalServerError, "error.html", gin.H{
+			"Title":   "错误",
+			"Message": "读取内容失败: " + err.Error(),
+		})
+		return
+	}
 
 	title := c.PostForm("title")
 	description := c.PostForm("description")
@@ -501,11 +772,14 @@ func (h *AdminHandler) UpdateContent(c *gin.Context) {
 		return
 	}
 
+	previous := content
 	content.Title = title
 	content.Description = description
 	content.Content = htmlContent
 
-	if err := database.DB.Save(&content).Error; err != nil {
+	// 保存内容并记录修订历史
+	adminID, _ := middleware.GetUserID(c)
+	if err := h.revisionService.SaveContent(&previous, &content, adminID, models.RevisionSourceAdmin); err != nil {
 		username, _ := c.Get("username")
 		c.HTML(http.StatusInternalServerError, "layout.html", gin.H{
 			"Title":       "编辑内容",
@@ -564,9 +838,10 @@ func (h *AdminHandler) Users(c *gin.Context) {
 	var total int64
 	query.Count(&total)
 
-	// 获取用户列表
+	// 获取用户列表（附带有效的 API 密钥用于显示前缀）
 	var users []models.User
-	query.Order("created_at DESC").
+	query.Preload("APIKeys", "revoked_at IS NULL").
+		Order("created_at DESC").
 		Offset(offset).
 		Limit(limit).
 		Find(&users)
@@ -621,6 +896,12 @@ func (h *AdminHandler) ToggleUserStatus(c *gin.Context) {
 		return
 	}
 
+	// 系统账户始终保持禁用
+	if user.IsSystem {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "System accounts cannot be enabled"})
+		return
+	}
+
 	// 切换状态
 	user.IsActive = !user.IsActive
 
@@ -629,6 +910,14 @@ func (h *AdminHandler) ToggleUserStatus(c *gin.Context) {
 		return
 	}
 
+	// 禁用用户时吊销其全部会话
+	if !user.IsActive {
+		if _, err := h.sessionService.RevokeAllForUser(user.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+			return
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{"success": true, "is_active": user.IsActive})
 }
 
@@ -673,11 +962,9 @@ func (h *AdminHandler) ResetUserAPIKey(c *gin.Context) {
 		return
 	}
 
-	// 生成新的API密钥
-	newAPIKey := uuid.New().String()[:32] // 只取前32个字符
-	user.APIKey = newAPIKey
-
-	if err := database.DB.Save(&user).Error; err != nil {
+	// 吊销全部密钥并生成新的密钥，明文只返回这一次
+	newAPIKey, err := h.apiKeyService.Reset(user.ID)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
 		return
 	}
@@ -755,7 +1042,6 @@ func (h *AdminHandler) CreateUser(c *gin.Context) {
 		Email:    email,
 		IsActive: true,
 		IsAdmin:  isAdmin,
-		APIKey:   uuid.New().String()[:32], // 生成API密钥
 	}
 
 	// 加密密码
@@ -807,6 +1093,9 @@ func (h *AdminHandler) GetUserDetails(c *gin.Context) {
 		return
 	}
 
+	// 获取用户的 API 密钥
+	apiKeys, _ := h.apiKeyService.List(id)
+
 	// 获取用户的内容统计
 	var contentCount int64
 	database.DB.Model(&models.Content{}).Where("user_id = ?", id).Count(&contentCount)
@@ -825,7 +1114,6 @@ func (h *AdminHandler) GetUserDetails(c *gin.Context) {
 			"id":         user.ID,
 			"username":   user.Username,
 			"email":      user.Email,
-			"api_key":    user.APIKey,
 			"is_active":  user.IsActive,
 			"is_admin":   user.IsAdmin,
 			"created_at": user.CreatedAt,
@@ -836,6 +1124,7 @@ func (h *AdminHandler) GetUserDetails(c *gin.Context) {
 			"active_contents": activeContentCount,
 		},
 		"recent_contents": recentContents,
+		"api_keys":        apiKeys,
 	})
 }
 
@@ -849,7 +1138,7 @@ func (h *AdminHandler) EditUser(c *gin.Context) {
 	}
 
 	var user models.User
-	if err := database.DB.Where("id = ?", id).First(&user).Error; err != nil {
+	if err := database.DB.Preload("APIKeys", "revoked_at IS NULL").Where("id = ?", id).First(&user).Error; err != nil {
 		c.Redirect(http.StatusFound, "/admin/users")
 		return
 	}
@@ -971,6 +1260,12 @@ func (h *AdminHandler) ResetUserPassword(c *gin.Context) {
 		return
 	}
 
+	// 吊销用旧密码登录的全部会话
+	if _, err := h.sessionService.RevokeAllForUser(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
 	// 在实际应用中，这里应该通过邮件发送新密码
 	// 现在直接返回新密码（仅用于演示）
 	c.JSON(http.StatusOK, gin.H{
@@ -1008,6 +1303,10 @@ func (h *AdminHandler) DeleteUser(c *gin.Context) {
 		}
 	}
 
+	// 记录需要删除的正文，事务提交后再删除
+	var contents []models.Content
+	database.DB.Select("id", "storage_key").Where("user_id = ?", id).Find(&contents)
+
 	// 开始事务
 	tx := database.DB.Begin()
 
@@ -1018,6 +1317,13 @@ func (h *AdminHandler) DeleteUser(c *gin.Context) {
 		return
 	}
 
+	// 删除用户的存储用量记录
+	if err := tx.Where("user_id = ?", id).Delete(&models.StorageUsage{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": "Failed to delete user storage usage"})
+		return
+	}
+
 	// 删除用户的所有分析数据
 	if err := tx.Where("user_id = ?", id).Delete(&models.ContentAnalytics{}).Error; err != nil {
 		tx.Rollback()
@@ -1034,6 +1340,7 @@ func (h *AdminHandler) DeleteUser(c *gin.Context) {
 
 	// 提交事务
 	tx.Commit()
+	h.storageService.DeleteBodies(contents)
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
@@ -1070,6 +1377,13 @@ func (h *AdminHandler) Analytics(c *gin.Context) {
 
 	// 获取来源统计
 	refererStats := h.getRefererStats(timeRange)
+	refererCategoryStats := h.getRefererCategoryStats(timeRange)
+	campaignStats := h.getCampaignStats(timeRange)
+
+	// 获取终端统计
+	deviceStats := h.getDeviceStats(timeRange)
+	browserStats := h.getBrowserStats(timeRange)
+	osStats := h.getOSStats(timeRange)
 
 	// 获取热门内容
 	popularContents := h.getPopularContents(timeRange)
@@ -1089,11 +1403,35 @@ func (h *AdminHandler) Analytics(c *gin.Context) {
 		"GeoStats":          geoStats,
 		"CountryStats":      countryStats,
 		"RefererStats":      refererStats,
+		"RefererCategories": refererCategoryStats,
+		"CampaignStats":     campaignStats,
+		"DeviceStats":       deviceStats,
+		"BrowserStats":      browserStats,
+		"OSStats":           osStats,
 		"PopularContents":   popularContents,
 		"UserActivityStats": userActivityStats,
 	})
 }
 
+// analyticsRangeDays 把统计页面的时间范围参数转换为天数
+func analyticsRangeDays(timeRange string) int {
+	switch timeRange {
+	case "1d":
+		return 1
+	case "30d":
+		return 30
+	case "90d":
+		return 90
+	default:
+		return 7
+	}
+}
+
+// analyticsStartDate 返回时间范围的起始日期
+func analyticsStartDate(timeRange string) string {
+	return time.Now().AddDate(0, 0, -analyticsRangeDays(timeRange)).Format("2006-01-02")
+}
+
 // getOverviewStats 获取总览统计
 func (h *AdminHandler) getOverviewStats() models.OverviewStats {
 	var stats models.OverviewStats
@@ -1104,63 +1442,51 @@ func (h *AdminHandler) getOverviewStats() models.OverviewStats {
 	// 活跃内容数
 	database.DB.Model(&models.Content{}).Where("is_active = ?", true).Count(&stats.ActiveContents)
 
-	// 总访问量
-	database.DB.Model(&models.ContentAnalytics{}).Count(&stats.TotalViews)
+	// 总访问量（原始记录会按保留天数删除，使用按天汇总的数据）
+	database.DB.Model(&models.AnalyticsDailyTotal{}).
+		Select("COALESCE(SUM(views), 0)").
+		Scan(&stats.TotalViews)
 
 	// 今日访问量
 	today := time.Now().Format("2006-01-02")
-	database.DB.Model(&models.ContentAnalytics{}).
-		Where("DATE(access_time) = ?", today).
-		Count(&stats.TodayViews)
-
-	// 独立访客数（基于IP地址）
-	database.DB.Model(&models.ContentAnalytics{}).
-		Distinct("ip_address").
-		Count(&stats.UniqueVisitors)
+	database.DB.Model(&models.AnalyticsDailyTotal{}).
+		Select("COALESCE(SUM(views), 0)").
+		Where("day = ?", today).
+		Scan(&stats.TodayViews)
+
+	// 独立访客数：合并每天的访客草图估算，不需要扫描原始记录
+	var sketches [][]byte
+	database.DB.Model(&models.AnalyticsDailyTotal{}).
+		Where("visitor_sketch IS NOT NULL").
+		Pluck("visitor_sketch", &sketches)
+	stats.UniqueVisitors = services.EstimateUniqueVisitors(sketches)
 
 	return stats
 }
 
 // getTrafficStats 获取流量趋势统计
 func (h *AdminHandler) getTrafficStats(timeRange string) []models.TrafficStats {
-	var stats []models.TrafficStats
-	var days int
+	days := analyticsRangeDays(timeRange)
+	firstDate := time.Now().AddDate(0, 0, -(days - 1)).Format("2006-01-02")
 
-	switch timeRange {
-	case "1d":
-		days = 1
-	case "7d":
-		days = 7
-	case "30d":
-		days = 30
-	case "90d":
-		days = 90
-	default:
-		days = 7
+	var totals []models.AnalyticsDailyTotal
+	database.DB.Where("day >= ?", firstDate).Find(&totals)
+
+	totalsByDate := make(map[string]models.AnalyticsDailyTotal, len(totals))
+	for _, total := range totals {
+		totalsByDate[total.Day.Format("2006-01-02")] = total
 	}
 
-	// 生成日期范围
+	// 生成日期范围，没有访问的日期补零
+	stats := make([]models.TrafficStats, 0, days)
 	for i := days - 1; i >= 0; i-- {
 		date := time.Now().AddDate(0, 0, -i).Format("2006-01-02")
-
-		var views int64
-		var uniqueIPs int64
-
-		// 获取当日访问量
-		database.DB.Model(&models.ContentAnalytics{}).
-			Where("DATE(access_time) = ?", date).
-			Count(&views)
-
-		// 获取当日独立IP数
-		database.DB.Model(&models.ContentAnalytics{}).
-			Where("DATE(access_time) = ?", date).
-			Distinct("ip_address").
-			Count(&uniqueIPs)
+		total := totalsByDate[date]
 
 		stats = append(stats, models.TrafficStats{
 			Date:      date,
-			Views:     views,
-			UniqueIPs: uniqueIPs,
+			Views:     total.Views,
+			UniqueIPs: total.UniqueIPs,
 		})
 	}
 
@@ -1170,26 +1496,10 @@ func (h *AdminHandler) getTrafficStats(timeRange string) []models.TrafficStats {
 // getGeoStats 获取地理位置统计
 func (h *AdminHandler) getGeoStats(timeRange string) []models.GeoStats {
 	var stats []models.GeoStats
-	var days int
-
-	switch timeRange {
-	case "1d":
-		days = 1
-	case "7d":
-		days = 7
-	case "30d":
-		days = 30
-	case "90d":
-		days = 90
-	default:
-		days = 7
-	}
 
-	startDate := time.Now().AddDate(0, 0, -days).Format("2006-01-02")
-
-	database.DB.Model(&models.ContentAnalytics{}).
-		Select("country, region, city, COUNT(*) as count").
-		Where("DATE(access_time) >= ? AND country != ''", startDate).
+	database.DB.Model(&models.AnalyticsDailyBreakdown{}).
+		Select("country, region, city, SUM(views) as count").
+		Where("day >= ? AND country != ''", analyticsStartDate(timeRange)).
 		Group("country, region, city").
 		Order("count DESC").
 		Limit(20).
@@ -1201,26 +1511,10 @@ func (h *AdminHandler) getGeoStats(timeRange string) []models.GeoStats {
 // getCountryStats 获取国家分布统计
 func (h *AdminHandler) getCountryStats(timeRange string) []models.CountryStats {
 	var stats []models.CountryStats
-	var days int
-
-	switch timeRange {
-	case "1d":
-		days = 1
-	case "7d":
-		days = 7
-	case "30d":
-		days = 30
-	case "90d":
-		days = 90
-	default:
-		days = 7
-	}
 
-	startDate := time.Now().AddDate(0, 0, -days).Format("2006-01-02")
-
-	database.DB.Model(&models.ContentAnalytics{}).
-		Select("country, COUNT(*) as count").
-		Where("DATE(access_time) >= ? AND country != ''", startDate).
+	database.DB.Model(&models.AnalyticsDailyBreakdown{}).
+		Select("country, SUM(views) as count").
+		Where("day >= ? AND country != ''", analyticsStartDate(timeRange)).
 		Group("country").
 		Order("count DESC").
 		Limit(10).
@@ -1229,30 +1523,87 @@ func (h *AdminHandler) getCountryStats(timeRange string) []models.CountryStats {
 	return stats
 }
 
-// getRefererStats 获取来源统计
+// getRefererStats 获取来源统计，按来源域名分组
 func (h *AdminHandler) getRefererStats(timeRange string) []models.RefererStats {
 	var stats []models.RefererStats
-	var days int
 
-	switch timeRange {
-	case "1d":
-		days = 1
-	case "7d":
-		days = 7
-	case "30d":
-		days = 30
-	case "90d":
-		days = 90
-	default:
-		days = 7
-	}
+	database.DB.Model(&models.AnalyticsDailyBreakdown{}).
+		Select("referer_host as referer, SUM(views) as count").
+		Where("day >= ? AND referer_host != ''", analyticsStartDate(timeRange)).
+		Group("referer_host").
+		Order("count DESC").
+		Limit(10).
+		Find(&stats)
 
-	startDate := time.Now().AddDate(0, 0, -days).Format("2006-01-02")
+	return stats
+}
 
-	database.DB.Model(&models.ContentAnalytics{}).
-		Select("referer, COUNT(*) as count").
-		Where("DATE(access_time) >= ? AND referer != ''", startDate).
-		Group("referer").
+// getRefererCategoryStats 获取来源分类统计
+func (h *AdminHandler) getRefererCategoryStats(timeRange string) []models.RefererCategoryStats {
+	var stats []models.RefererCategoryStats
+
+	database.DB.Model(&models.AnalyticsDailyBreakdown{}).
+		Select("referer_category, SUM(views) as count").
+		Where("day >= ?", analyticsStartDate(timeRange)).
+		Group("referer_category").
+		Order("count DESC").
+		Find(&stats)
+
+	return stats
+}
+
+// getCampaignStats 获取 UTM 推广活动统计
+func (h *AdminHandler) getCampaignStats(timeRange string) []models.CampaignStats {
+	var stats []models.CampaignStats
+
+	database.DB.Model(&models.AnalyticsDailyCampaign{}).
+		Select("utm_source, utm_medium, utm_campaign, SUM(views) as count").
+		Where("day >= ?", analyticsStartDate(timeRange)).
+		Group("utm_source, utm_medium, utm_campaign").
+		Order("count DESC").
+		Limit(10).
+		Find(&stats)
+
+	return stats
+}
+
+// getDeviceStats 获取设备类型统计
+func (h *AdminHandler) getDeviceStats(timeRange string) []models.DeviceStats {
+	var stats []models.DeviceStats
+
+	database.DB.Model(&models.AnalyticsDailyBreakdown{}).
+		Select("device_class, SUM(views) as count").
+		Where("day >= ?", analyticsStartDate(timeRange)).
+		Group("device_class").
+		Order("count DESC").
+		Find(&stats)
+
+	return stats
+}
+
+// getBrowserStats 获取浏览器统计
+func (h *AdminHandler) getBrowserStats(timeRange string) []models.BrowserStats {
+	var stats []models.BrowserStats
+
+	database.DB.Model(&models.AnalyticsDailyBreakdown{}).
+		Select("browser, SUM(views) as count").
+		Where("day >= ? AND browser != ''", analyticsStartDate(timeRange)).
+		Group("browser").
+		Order("count DESC").
+		Limit(10).
+		Find(&stats)
+
+	return stats
+}
+
+// getOSStats 获取操作系统统计
+func (h *AdminHandler) getOSStats(timeRange string) []models.OSStats {
+	var stats []models.OSStats
+
+	database.DB.Model(&models.AnalyticsDailyBreakdown{}).
+		Select("os, SUM(views) as count").
+		Where("day >= ? AND os != ''", analyticsStartDate(timeRange)).
+		Group("os").
 		Order("count DESC").
 		Limit(10).
 		Find(&stats)
@@ -1270,25 +1621,9 @@ func (h *AdminHandler) getPopularContents(timeRange string) []struct {
 		RecentViews int64 `json:"recent_views"`
 	}
 
-	var days int
-	switch timeRange {
-	case "1d":
-		days = 1
-	case "7d":
-		days = 7
-	case "30d":
-		days = 30
-	case "90d":
-		days = 90
-	default:
-		days = 7
-	}
-
-	startDate := time.Now().AddDate(0, 0, -days).Format("2006-01-02")
-
 	database.DB.Table("contents").
-		Select("contents.*, COUNT(content_analytics.id) as recent_views").
-		Joins("LEFT JOIN content_analytics ON contents.id = content_analytics.content_id AND DATE(content_analytics.access_time) >= ?", startDate).
+		Select("contents.*, COALESCE(SUM(analytics_daily.views), 0) as recent_views").
+		Joins("LEFT JOIN analytics_daily ON contents.id = analytics_daily.content_id AND analytics_daily.day >= ?", analyticsStartDate(timeRange)).
 		Where("contents.is_active = ?", true).
 		Group("contents.id").
 		Order("recent_views DESC").
@@ -1310,26 +1645,10 @@ func (h *AdminHandler) getUserActivityStats(timeRange string) []struct {
 		ViewCount    int64  `json:"view_count"`
 	}
 
-	var days int
-	switch timeRange {
-	case "1d":
-		days = 1
-	case "7d":
-		days = 7
-	case "30d":
-		days = 30
-	case "90d":
-		days = 90
-	default:
-		days = 7
-	}
-
-	startDate := time.Now().AddDate(0, 0, -days).Format("2006-01-02")
-
 	database.DB.Table("users").
-		Select("users.username, COUNT(DISTINCT contents.id) as content_count, COUNT(content_analytics.id) as view_count").
+		Select("users.username, COUNT(DISTINCT contents.id) as content_count, COALESCE(SUM(analytics_daily.views), 0) as view_count").
 		Joins("LEFT JOIN contents ON users.id = contents.user_id").
-		Joins("LEFT JOIN content_analytics ON contents.id = content_analytics.content_id AND DATE(content_analytics.access_time) >= ?", startDate).
+		Joins("LEFT JOIN analytics_daily ON contents.id = analytics_daily.content_id AND analytics_daily.day >= ?", analyticsStartDate(timeRange)).
 		Where("users.is_active = ?", true).
 		Group("users.id, users.username").
 		Order("view_count DESC").
@@ -1361,6 +1680,8 @@ func (h *AdminHandler) GeoIPMonitor(c *gin.Context) {
 			"errors":           0,
 			"last_error":       "",
 			"last_error_time":  "",
+			"reloads":          0,
+			"last_reload_time": "",
 		}
 		cacheStats = map[string]interface{}{
 			"cache_size":    0,
@@ -1370,11 +1691,12 @@ func (h *AdminHandler) GeoIPMonitor(c *gin.Context) {
 	}
 
 	c.HTML(http.StatusOK, "layout.html", gin.H{
-		"Title":        "GeoIP 服务监控",
-		"Page":         "geoip-monitor",
-		"Username":     username,
-		"ServiceStats": serviceStats,
-		"CacheStats":   cacheStats,
+		"Title":          "GeoIP 服务监控",
+		"Page":           "geoip-monitor",
+		"Username":       username,
+		"ServiceStats":   serviceStats,
+		"CacheStats":     cacheStats,
+		"AnalyticsStats": h.analytics.Stats(),
 	})
 }
 
@@ -1392,13 +1714,68 @@ func (h *AdminHandler) GetGeoIPStats(c *gin.Context) {
 	cacheStats := h.geoipService.GetCacheStats()
 
 	c.JSON(http.StatusOK, gin.H{
-		"success":       true,
-		"service_stats": serviceStats,
-		"cache_stats":   cacheStats,
-		"timestamp":     time.Now().Format("2006-01-02 15:04:05"),
+		"success":         true,
+		"service_stats":   serviceStats,
+		"cache_stats":     cacheStats,
+		"analytics_stats": h.analytics.Stats(),
+		"timestamp":       time.Now().Format("2006-01-02 15:04:05"),
 	})
 }
 
+// LiveViews 以 SSE 推送全站的实时访问，供仪表盘和 GeoIP 监控页面使用
+func (h *AdminHandler) LiveViews(c *gin.Context) {
+	check := func() error {
+		user, err := liveStreamUser(c, h.sessionService, h.apiKeyService)
+		if err != nil {
+			return err
+		}
+		if !user.IsAdmin {
+			return errAdminRequired
+		}
+		return nil
+	}
+	streamLiveViews(c, h.analytics.LiveViews(), nil, check)
+}
+
+// ExportAnalytics 导出全站或指定用户、内容的访问数据
+func (h *AdminHandler) ExportAnalytics(c *gin.Context) {
+	exportType, format, err := services.ParseExportOptions(c.Query("type"), c.Query("format"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	query, err := h.exportService.ResolveAdminQuery(services.AnalyticsRangeParams{
+		Range: c.Query("range"),
+		From:  c.Query("from"),
+		To:    c.Query("to"),
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	filter := services.AnalyticsExportFilter{Type: exportType, Format: format, Query: query, FullIP: true}
+	if userIDParam := c.Query("user_id"); userIDParam != "" {
+		userID, err := uuid.Parse(userIDParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid user ID"})
+			return
+		}
+		filter.UserID = &userID
+	}
+	if contentIDParam := c.Query("content_id"); contentIDParam != "" {
+		contentID, err := uuid.Parse(contentIDParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "Invalid content ID"})
+			return
+		}
+		filter.ContentID = &contentID
+	}
+
+	streamAnalyticsExport(c, h.exportService, filter)
+}
+
 // UserPlans 用户计划管理页面
 func (h *AdminHandler) UserPlans(c *gin.Context) {
 	var users []models.User
@@ -3,13 +3,18 @@ package api
 import (
 	"bytes"
 	"encoding/json"
+	"html/template"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"anywebsites/internal/database"
+	"anywebsites/internal/middleware"
 	"anywebsites/internal/models"
 	"anywebsites/internal/services"
+	"anywebsites/internal/utils"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -18,21 +23,41 @@ import (
 	"gorm.io/gorm"
 )
 
-func setupTestRouter() (*gin.Engine, *gorm.DB) {
+func setupTestRouter(t *testing.T) (*gin.Engine, *gorm.DB) {
 	// 设置测试模式
 	gin.SetMode(gin.TestMode)
 
-	// 创建内存数据库
+	// 使用内存数据库替换全局数据库连接
 	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
 	if err != nil {
-		panic("failed to connect database")
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}); err != nil {
+		t.Fatalf("迁移表结构失败: %v", err)
+	}
+	// 订阅和内容表的默认值使用了 PostgreSQL 函数，这里手动建表
+	for _, statement := range []string{
+		`CREATE TABLE user_subscriptions (id TEXT PRIMARY KEY, user_id TEXT NOT NULL, plan_type TEXT NOT NULL,
+			status TEXT NOT NULL, started_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP, expires_at DATETIME,
+			auto_renew BOOLEAN NOT NULL DEFAULT FALSE, payment_method TEXT, created_at DATETIME, updated_at DATETIME)`,
+		`CREATE TABLE contents (id TEXT PRIMARY KEY, user_id TEXT NOT NULL, title TEXT, description TEXT, content TEXT NOT NULL,
+			content_type TEXT DEFAULT 'text/html', visibility TEXT NOT NULL DEFAULT 'public', access_code_hash TEXT,
+			storage_key TEXT, content_hash TEXT, cache_max_age INTEGER, file_path TEXT, file_size INTEGER DEFAULT 0,
+			expires_at DATETIME, is_active BOOLEAN DEFAULT TRUE, deleted_at DATETIME, access_count INTEGER DEFAULT 0,
+			created_at DATETIME, updated_at DATETIME)`,
+	} {
+		if err := db.Exec(statement).Error; err != nil {
+			t.Fatalf("创建表失败: %v", err)
+		}
 	}
 
-	// 自动迁移表结构
-	db.AutoMigrate(&models.User{}, &models.UserSubscription{}, &models.PlanConfig{})
+	previous := database.DB
+	database.DB = db
+	t.Cleanup(func() { database.DB = previous })
 
-	// 创建路由
+	// 创建路由，页面只渲染标题，不依赖模板文件
 	router := gin.New()
+	router.SetHTMLTemplate(template.Must(template.New("layout.html").Parse(`{{.Title}}`)))
 
 	// 创建处理器
 	planService := services.NewPlanService()
@@ -52,7 +77,7 @@ func setupTestRouter() (*gin.Engine, *gorm.DB) {
 }
 
 func TestAdminHandler_UpgradeUserPlan(t *testing.T) {
-	router, db := setupTestRouter()
+	router, db := setupTestRouter(t)
 
 	// 创建测试用户
 	userID := uuid.New()
@@ -60,7 +85,6 @@ func TestAdminHandler_UpgradeUserPlan(t *testing.T) {
 		ID:       userID,
 		Username: "testuser",
 		Email:    "test@example.com",
-		APIKey:   "test-api-key",
 		IsActive: true,
 	}
 	db.Create(&user)
@@ -90,7 +114,7 @@ func TestAdminHandler_UpgradeUserPlan(t *testing.T) {
 }
 
 func TestAdminHandler_UpgradeUserPlan_InvalidUserID(t *testing.T) {
-	router, _ := setupTestRouter()
+	router, _ := setupTestRouter(t)
 
 	// 准备请求数据
 	requestData := map[string]interface{}{
@@ -116,7 +140,7 @@ func TestAdminHandler_UpgradeUserPlan_InvalidUserID(t *testing.T) {
 }
 
 func TestAdminHandler_UpgradeUserPlan_MissingPlanType(t *testing.T) {
-	router, _ := setupTestRouter()
+	router, _ := setupTestRouter(t)
 
 	userID := uuid.New()
 
@@ -144,7 +168,7 @@ func TestAdminHandler_UpgradeUserPlan_MissingPlanType(t *testing.T) {
 }
 
 func TestAdminHandler_DowngradeUserPlan(t *testing.T) {
-	router, db := setupTestRouter()
+	router, db := setupTestRouter(t)
 
 	// 创建测试用户
 	userID := uuid.New()
@@ -152,7 +176,6 @@ func TestAdminHandler_DowngradeUserPlan(t *testing.T) {
 		ID:       userID,
 		Username: "testuser",
 		Email:    "test@example.com",
-		APIKey:   "test-api-key",
 		IsActive: true,
 	}
 	db.Create(&user)
@@ -189,7 +212,7 @@ func TestAdminHandler_DowngradeUserPlan(t *testing.T) {
 }
 
 func TestAdminHandler_DowngradeUserPlan_EmptyUserID(t *testing.T) {
-	router, _ := setupTestRouter()
+	router, _ := setupTestRouter(t)
 
 	// 准备请求数据
 	requestData := map[string]interface{}{
@@ -205,12 +228,12 @@ func TestAdminHandler_DowngradeUserPlan_EmptyUserID(t *testing.T) {
 	w := httptest.NewRecorder()
 	router.ServeHTTP(w, req)
 
-	// 验证响应 - 应该是404因为路由不匹配
-	assert.Equal(t, http.StatusNotFound, w.Code)
+	// 验证响应 - 路由匹配到空的用户ID，由处理器拒绝
+	assert.Equal(t, http.StatusBadRequest, w.Code)
 }
 
 func TestAdminHandler_DowngradeUserPlan_InvalidJSON(t *testing.T) {
-	router, _ := setupTestRouter()
+	router, _ := setupTestRouter(t)
 
 	userID := uuid.New()
 
@@ -232,13 +255,13 @@ func TestAdminHandler_DowngradeUserPlan_InvalidJSON(t *testing.T) {
 }
 
 func TestAdminHandler_PlanStats(t *testing.T) {
-	router, db := setupTestRouter()
+	router, db := setupTestRouter(t)
 
 	// 创建测试用户和订阅
 	users := []models.User{
-		{ID: uuid.New(), Username: "user1", Email: "user1@example.com", APIKey: "key1", IsActive: true},
-		{ID: uuid.New(), Username: "user2", Email: "user2@example.com", APIKey: "key2", IsActive: true},
-		{ID: uuid.New(), Username: "user3", Email: "user3@example.com", APIKey: "key3", IsActive: true},
+		{ID: uuid.New(), Username: "user1", Email: "user1@example.com", IsActive: true},
+		{ID: uuid.New(), Username: "user2", Email: "user2@example.com", IsActive: true},
+		{ID: uuid.New(), Username: "user3", Email: "user3@example.com", IsActive: true},
 	}
 
 	for _, user := range users {
@@ -271,7 +294,7 @@ func TestAdminHandler_PlanStats(t *testing.T) {
 }
 
 func TestAdminHandler_UpgradeUserPlan_WithoutExpiresAt(t *testing.T) {
-	router, db := setupTestRouter()
+	router, db := setupTestRouter(t)
 
 	// 创建测试用户
 	userID := uuid.New()
@@ -279,7 +302,6 @@ func TestAdminHandler_UpgradeUserPlan_WithoutExpiresAt(t *testing.T) {
 		ID:       userID,
 		Username: "testuser",
 		Email:    "test@example.com",
-		APIKey:   "test-api-key",
 		IsActive: true,
 	}
 	db.Create(&user)
@@ -306,3 +328,35 @@ func TestAdminHandler_UpgradeUserPlan_WithoutExpiresAt(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "用户计划升级成功", response["message"])
 }
+
+func TestAdminHandler_LogoutCookieSecure(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	resolver, err := utils.NewClientIPResolver([]string{"10.0.0.0/8"}, utils.ProxyHeaderXForwarded)
+	assert.NoError(t, err)
+
+	router := gin.New()
+	router.Use(middleware.ClientIPMiddleware(resolver))
+	router.GET("/admin/logout", (&AdminHandler{}).Logout)
+
+	tests := []struct {
+		name   string
+		proto  string
+		secure bool
+	}{
+		{name: "经过 HTTPS 代理", proto: "https", secure: true},
+		{name: "HTTP 访问", proto: "http", secure: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/admin/logout", nil)
+			req.RemoteAddr = "10.0.0.2:4000"
+			req.Header.Set("X-Forwarded-Proto", tt.proto)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			cookie := w.Header().Get("Set-Cookie")
+			assert.Contains(t, cookie, "admin_token=")
+			assert.Equal(t, tt.secure, strings.Contains(cookie, "Secure"), cookie)
+		})
+	}
+}
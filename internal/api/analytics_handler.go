@@ -0,0 +1,246 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"anywebsites/internal/middleware"
+	"anywebsites/internal/models"
+	"anywebsites/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// liveCountsInterval 实时访问推送中每分钟访问量的刷新间隔，同时起到保持连接的作用
+// 每次刷新时复查认证和计划，会话被吊销或计划降级后结束推送
+const liveCountsInterval = 10 * time.Second
+
+// errAdminRequired 推送期间用户被取消管理员权限
+var errAdminRequired = errors.New("admin access required")
+
+type AnalyticsHandler struct {
+	analyticsService *services.OwnerAnalyticsService
+	exportService    *services.AnalyticsExportService
+	sessionService   *services.SessionService
+	apiKeyService    *services.APIKeyService
+	liveViews        *services.LiveViewHub
+}
+
+func NewAnalyticsHandler(settingsService *services.SettingsService, liveViews *services.LiveViewHub) *AnalyticsHandler {
+	return &AnalyticsHandler{
+		analyticsService: services.NewOwnerAnalyticsService(settingsService),
+		exportService:    services.NewAnalyticsExportService(),
+		sessionService:   services.NewSessionService(),
+		apiKeyService:    services.NewAPIKeyService(),
+		liveViews:        liveViews,
+	}
+}
+
+// Overview 获取当前用户所有内容的访问统计
+func (h *AnalyticsHandler) Overview(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	query, ok := h.resolveQuery(c, userID)
+	if !ok {
+		return
+	}
+
+	report, err := h.analyticsService.Overview(userID, query)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"analytics": report})
+}
+
+// Content 获取单个内容的访问统计
+func (h *AnalyticsHandler) Content(c *gin.Context) {
+	userID, contentID, ok := parseContentIDs(c)
+	if !ok {
+		return
+	}
+
+	query, ok := h.resolveQuery(c, userID)
+	if !ok {
+		return
+	}
+
+	report, err := h.analyticsService.ContentReport(userID, contentID, query)
+	if err != nil {
+		if errors.Is(err, services.ErrAnalyticsContentNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"analytics": report})
+}
+
+// Export 导出当前用户内容的访问数据，时间范围受计划可查询天数限制
+func (h *AnalyticsHandler) Export(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	exportType, format, err := services.ParseExportOptions(c.Query("type"), c.Query("format"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query, ok := h.resolveQuery(c, userID)
+	if !ok {
+		return
+	}
+
+	filter := services.AnalyticsExportFilter{Type: exportType, Format: format, Query: query, UserID: &userID}
+	if contentIDParam := c.Query("content_id"); contentIDParam != "" {
+		contentID, err := uuid.Parse(contentIDParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid content ID"})
+			return
+		}
+		filter.ContentID = &contentID
+	}
+
+	streamAnalyticsExport(c, h.exportService, filter)
+}
+
+// streamAnalyticsExport 校验内容后写出导出文件；开始写出后出错只能中断响应
+func streamAnalyticsExport(c *gin.Context, exportService *services.AnalyticsExportService, filter services.AnalyticsExportFilter) {
+	if err := exportService.CheckContent(filter); err != nil {
+		if errors.Is(err, services.ErrAnalyticsContentNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	contentType := "text/csv; charset=utf-8"
+	if filter.Format == models.AnalyticsExportNDJSON {
+		contentType = "application/x-ndjson"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, exportService.Filename(filter)))
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+
+	if err := exportService.Export(c.Writer, filter); err != nil {
+		log.Printf("Analytics export failed: %v", err)
+		c.Abort()
+	}
+}
+
+// Live 以 SSE 推送当前用户内容的实时访问，需要计划开启实时访问推送
+func (h *AnalyticsHandler) Live(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if err := h.analyticsService.CheckRealtime(userID); err != nil {
+		if errors.Is(err, services.ErrRealtimeAnalyticsNotAllowed) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	check := func() error {
+		if _, err := liveStreamUser(c, h.sessionService, h.apiKeyService); err != nil {
+			return err
+		}
+		return h.analyticsService.CheckRealtime(userID)
+	}
+	streamLiveViews(c, h.liveViews, &userID, check)
+}
+
+// liveStreamUser 按请求使用的认证方式重新检查会话或 API 密钥，返回用户的最新信息
+func liveStreamUser(c *gin.Context, sessionService *services.SessionService, apiKeyService *services.APIKeyService) (*models.User, error) {
+	userID, _ := middleware.GetUserID(c)
+	if sessionID, ok := middleware.GetSessionID(c); ok {
+		return sessionService.CheckActive(userID, sessionID)
+	}
+	if keyID, ok := c.Get("api_key_id"); ok {
+		return apiKeyService.CheckActive(keyID.(uuid.UUID))
+	}
+	return nil, services.ErrSessionRevoked
+}
+
+// streamLiveViews 推送 view 事件（每次访问）和 counts 事件（最近一小时每分钟的访问量）
+// 客户端断开、服务器关闭或 check 返回错误时结束，check 在每次推送 counts 前调用
+func streamLiveViews(c *gin.Context, hub *services.LiveViewHub, userID *uuid.UUID, check func() error) {
+	sub := hub.Subscribe(userID)
+	defer sub.Close()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // 禁止反向代理缓冲
+
+	counts := func() gin.H {
+		return gin.H{"minutes": hub.Counts(userID), "dropped": sub.Dropped()}
+	}
+
+	ticker := time.NewTicker(liveCountsInterval)
+	defer ticker.Stop()
+
+	c.SSEvent("counts", counts())
+	c.Writer.Flush()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-hub.Done():
+			return false
+		case event := <-sub.Events:
+			c.SSEvent("view", event)
+		case <-ticker.C:
+			if err := check(); err != nil {
+				c.SSEvent("error", gin.H{"error": err.Error()})
+				return false
+			}
+			c.SSEvent("counts", counts())
+		}
+		return true
+	})
+}
+
+// resolveQuery 解析 range、from、to 和 granularity 参数，超出计划限制时返回 403
+func (h *AnalyticsHandler) resolveQuery(c *gin.Context, userID uuid.UUID) (*services.AnalyticsQuery, bool) {
+	query, err := h.analyticsService.ResolveQuery(userID, services.AnalyticsRangeParams{
+		Range:       c.Query("range"),
+		From:        c.Query("from"),
+		To:          c.Query("to"),
+		Granularity: c.Query("granularity"),
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidAnalyticsRange), errors.Is(err, services.ErrHourlyRangeTooLong):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrAnalyticsRangeExceedsPlan), errors.Is(err, services.ErrAnalyticsGranularityNotAllowed):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		}
+		return nil, false
+	}
+	return query, true
+}
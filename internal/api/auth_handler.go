@@ -1,24 +1,30 @@
 package api
 
 import (
+	"errors"
 	"net/http"
 
+	"anywebsites/internal/auth"
 	"anywebsites/internal/database"
 	"anywebsites/internal/middleware"
+	"anywebsites/internal/models"
 	"anywebsites/internal/services"
+	"anywebsites/internal/utils"
 
 	"github.com/gin-gonic/gin"
 )
 
 // AuthHandler 认证处理器
 type AuthHandler struct {
-	userService *services.UserService
+	userService      *services.UserService
+	twoFactorService *services.TwoFactorService
 }
 
 // NewAuthHandler 创建认证处理器实例
-func NewAuthHandler() *AuthHandler {
+func NewAuthHandler(twoFactorService *services.TwoFactorService) *AuthHandler {
 	return &AuthHandler{
-		userService: services.NewUserService(database.DB),
+		userService:      services.NewUserService(database.DB),
+		twoFactorService: twoFactorService,
 	}
 }
 
@@ -43,6 +49,7 @@ func (h *AuthHandler) Register(c *gin.Context) {
 }
 
 // Login 用户登录
+// 需要两步验证时不签发 Token，返回 mfa_token，由客户端提交验证码到 /api/auth/login/2fa 完成登录
 func (h *AuthHandler) Login(c *gin.Context) {
 	var req services.LoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -50,15 +57,80 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	response, err := h.userService.Login(&req)
+	user, err := h.userService.Authenticate(&req)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
 
+	h.completeLogin(c, user)
+}
+
+// completeLogin 第一步验证（密码或单点登录）通过后签发 Token，需要两步验证时返回登录挑战
+func (h *AuthHandler) completeLogin(c *gin.Context, user *models.User) {
+	if h.twoFactorService.Required(user) {
+		challenge, err := h.twoFactorService.CreateChallenge(user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, challenge)
+		return
+	}
+
+	response, err := h.userService.StartSession(user, sessionClient(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// LoginTwoFactor 登录第二步：提交 TOTP 验证码或恢复码
+// 被强制启用两步验证的管理员首次登录时，验证码同时用于确认绑定，响应中包含恢复码
+func (h *AuthHandler) LoginTwoFactor(c *gin.Context) {
+	var req services.TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, recoveryCodes, err := h.twoFactorService.CompleteChallenge(req.MFAToken, req.Code)
+	if err != nil {
+		c.JSON(twoFactorErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := h.userService.StartSession(user, sessionClient(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	response.RecoveryCodes = recoveryCodes
+
 	c.JSON(http.StatusOK, response)
 }
 
+// LoginTwoFactorSetup 登录过程中获取绑定验证器的密钥，仅用于 mfa_enrollment_required 的挑战
+func (h *AuthHandler) LoginTwoFactorSetup(c *gin.Context) {
+	var req struct {
+		MFAToken string `json:"mfa_token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	setup, err := h.twoFactorService.ChallengeSetup(req.MFAToken)
+	if err != nil {
+		c.JSON(twoFactorErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, setup)
+}
+
 // RefreshToken 刷新访问令牌
 func (h *AuthHandler) RefreshToken(c *gin.Context) {
 	var req services.RefreshRequest
@@ -67,6 +139,7 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 		return
 	}
 
+	req.Client = sessionClient(c)
 	response, err := h.userService.RefreshToken(&req)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
@@ -76,6 +149,49 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
+// Logout 退出当前会话，当前会话的访问令牌和刷新令牌立即失效
+func (h *AuthHandler) Logout(c *gin.Context) {
+	sessionID, exists := middleware.GetSessionID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if err := h.userService.Logout(sessionID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+// LogoutAll 退出所有设备上的会话，包括当前会话
+func (h *AuthHandler) LogoutAll(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	revoked, err := h.userService.LogoutAll(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":          "Logged out from all sessions",
+		"revoked_sessions": revoked,
+	})
+}
+
+// JWKS 公开当前可用于校验 Token 的公钥，其他服务按 Token 头部的 kid 选择公钥
+// 遇到未知的 kid 时应重新获取，密钥轮换后新的 kid 会立即用于签发
+func (h *AuthHandler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, auth.PublicKeys())
+}
+
 // GetProfile 获取用户资料
 func (h *AuthHandler) GetProfile(c *gin.Context) {
 	userID, exists := middleware.GetUserID(c)
@@ -141,7 +257,8 @@ func (h *AuthHandler) ChangePassword(c *gin.Context) {
 		return
 	}
 
-	err := h.userService.ChangePassword(userID, req.OldPassword, req.NewPassword)
+	sessionID, _ := middleware.GetSessionID(c)
+	err := h.userService.ChangePassword(userID, sessionID, req.OldPassword, req.NewPassword)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -150,22 +267,150 @@ func (h *AuthHandler) ChangePassword(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Password changed successfully"})
 }
 
-// RegenerateAPIKey 重新生成 API 密钥
-func (h *AuthHandler) RegenerateAPIKey(c *gin.Context) {
-	userID, exists := middleware.GetUserID(c)
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+// TwoFactorStatus 获取当前用户的两步验证状态
+func (h *AuthHandler) TwoFactorStatus(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
 		return
 	}
 
-	apiKey, err := h.userService.RegenerateAPIKey(userID)
+	status, err := h.twoFactorService.Status(user)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	c.JSON(http.StatusOK, status)
+}
+
+// SetupTwoFactor 生成新的 TOTP 密钥，返回用于生成二维码的 otpauth:// URI
+func (h *AuthHandler) SetupTwoFactor(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	setup, err := h.twoFactorService.Setup(user)
+	if err != nil {
+		c.JSON(twoFactorErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, setup)
+}
+
+// EnableTwoFactor 使用验证码确认密钥并启用两步验证，恢复码只在响应中返回一次
+func (h *AuthHandler) EnableTwoFactor(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	recoveryCodes, err := h.twoFactorService.Enable(user, req.Code)
+	if err != nil {
+		c.JSON(twoFactorErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"message": "API key regenerated successfully",
-		"api_key": apiKey,
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": recoveryCodes,
 	})
 }
+
+// DisableTwoFactor 关闭两步验证，需要当前密码和验证码
+func (h *AuthHandler) DisableTwoFactor(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Password string `json:"password" binding:"required"`
+		Code     string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.twoFactorService.Disable(user, req.Password, req.Code); err != nil {
+		c.JSON(twoFactorErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码，旧的恢复码全部作废
+func (h *AuthHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	user, ok := h.currentUser(c)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	recoveryCodes, err := h.twoFactorService.RegenerateRecoveryCodes(user, req.Code)
+	if err != nil {
+		c.JSON(twoFactorErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": recoveryCodes})
+}
+
+// currentUser 从数据库加载当前登录的用户，失败时写入错误响应
+func (h *AuthHandler) currentUser(c *gin.Context) (*models.User, bool) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return nil, false
+	}
+
+	user, err := h.userService.GetUserByID(userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return user, true
+}
+
+// twoFactorErrorStatus 两步验证错误对应的 HTTP 状态码
+func twoFactorErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrInvalidTwoFactorCode), errors.Is(err, services.ErrInvalidChallenge):
+		return http.StatusUnauthorized
+	case errors.Is(err, services.ErrTooManyAttempts):
+		return http.StatusTooManyRequests
+	case errors.Is(err, services.ErrTwoFactorMandatory):
+		return http.StatusForbidden
+	case errors.Is(err, services.ErrTwoFactorAlreadyEnabled), errors.Is(err, services.ErrTwoFactorNotEnabled),
+		errors.Is(err, services.ErrTwoFactorNotSetUp):
+		return http.StatusConflict
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// sessionClient 记录创建会话的客户端信息
+func sessionClient(c *gin.Context) services.SessionClient {
+	return services.SessionClient{
+		UserAgent: c.Request.UserAgent(),
+		IPAddress: utils.GetRealClientIP(c),
+	}
+}
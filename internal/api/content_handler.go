@@ -1,60 +1,191 @@
 package api
 
 import (
+	"errors"
+	"mime"
 	"net/http"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
-	"anywebsites/internal/database"
+	"anywebsites/internal/config"
+	"anywebsites/internal/middleware"
 	"anywebsites/internal/models"
 	"anywebsites/internal/services"
+	"anywebsites/internal/utils"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
+// contentAccessCookie 记住已验证访问码的 Cookie 名称，路径限定在单个内容下
+const contentAccessCookie = "content_access"
+
 type ContentHandler struct {
-	contentService *services.ContentService
+	contentService   *services.ContentService
+	anonymousService *services.AnonymousUploadService
+
+	// csp 内容页的 Content-Security-Policy
+	csp string
+	// contentOrigin 单独的内容域名，为空时内容与平台同源
+	contentOrigin string
 }
 
-func NewContentHandler(geoipService *services.GeoIPService) *ContentHandler {
+func NewContentHandler(cfg *config.Config, analytics *services.AnalyticsPipeline, settingsService *services.SettingsService, accessTokenKey []byte) *ContentHandler {
 	return &ContentHandler{
-		contentService: services.NewContentService(geoipService),
+		contentService:   services.NewContentService(cfg, analytics, settingsService, accessTokenKey),
+		anonymousService: services.NewAnonymousUploadService(settingsService, services.NewHTMLSanitizer(cfg)),
+		csp:              cfg.ContentSecurity.CSP,
+		contentOrigin:    cfg.ContentSecurity.ContentOrigin,
 	}
 }
 
-// Upload 上传 HTML 内容
+// Upload 上传 HTML 内容，multipart 请求中的 zip/tar.gz 压缩包作为多文件站点包发布
+// 未认证的请求在开启匿名上传时按匿名内容处理
 func (h *ContentHandler) Upload(c *gin.Context) {
-	var req struct {
-		Title   string `json:"title"`
-		Content string `json:"content" binding:"required"`
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		h.uploadAnonymous(c)
+		return
 	}
 
+	if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		h.uploadBundle(c, userID)
+		return
+	}
+
+	var req services.UploadRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// 使用已注册的用户ID（临时解决方案）
-	defaultUserID := uuid.MustParse("0b64c9d9-c45b-45eb-8324-36a855e34d69")
+	content, err := h.contentService.Upload(userID, &req)
+	if err != nil {
+		c.JSON(contentErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":    "Content uploaded successfully",
+		"id":         content.ID,
+		"url":        h.viewURL(content.ID),
+		"expires_at": content.ExpiresAt,
+	})
+}
+
+// contentErrorStatus 内容写入失败时的响应状态码，超出存储空间返回 413
+func contentErrorStatus(err error) int {
+	if errors.Is(err, services.ErrStorageLimitExceeded) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// uploadAnonymous 处理未认证的上传，返回只显示一次的删除令牌
+func (h *ContentHandler) uploadAnonymous(c *gin.Context) {
+	if !h.anonymousService.Enabled() {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header or API key required"})
+		return
+	}
+
+	if strings.HasPrefix(c.ContentType(), "multipart/form-data") {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Bundle uploads require authentication"})
+		return
+	}
 
-	content := &models.Content{
-		UserID:      defaultUserID,
-		Title:       req.Title,
-		Content:     req.Content,
-		ContentType: "text/html",
-		IsActive:    true,
+	var req services.AnonymousUploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	if err := database.DB.Create(content).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create content"})
+	content, token, err := h.anonymousService.Upload(utils.GetRealClientIP(c), &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrAnonymousUploadDisabled):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header or API key required"})
+		case errors.Is(err, services.ErrAnonymousQuotaExceeded):
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrAnonymousContentTooLarge):
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create content"})
+		}
 		return
 	}
 
 	c.JSON(http.StatusCreated, gin.H{
-		"message": "Content uploaded successfully",
-		"id":      content.ID,
-		"url":     "/view/" + content.ID.String(),
+		"message":        "Content uploaded anonymously",
+		"id":             content.ID,
+		"url":            h.viewURL(content.ID),
+		"expires_at":     content.ExpiresAt,
+		"deletion_token": token,
+		"delete_url":     "/api/content/anonymous/" + content.ID.String(),
+	})
+}
+
+// DeleteAnonymous 凭上传时返回的删除令牌删除匿名内容
+func (h *ContentHandler) DeleteAnonymous(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return
+	}
+
+	token := c.GetHeader("X-Deletion-Token")
+	if token == "" {
+		token = c.Query("token")
+	}
+
+	if err := h.anonymousService.Delete(id, token); err != nil {
+		if errors.Is(err, services.ErrInvalidDeletionToken) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Invalid deletion token"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete content"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Content deleted successfully"})
+}
+
+// uploadBundle 处理多文件站点包上传
+func (h *ContentHandler) uploadBundle(c *gin.Context, userID uuid.UUID) {
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Bundle file is required"})
+		return
+	}
+
+	req := &services.BundleUploadRequest{
+		Title:       c.PostForm("title"),
+		Description: c.PostForm("description"),
+		Visibility:  models.ContentVisibility(c.PostForm("visibility")),
+		AccessCode:  c.PostForm("access_code"),
+		File:        file,
+	}
+	if expiresAt := c.PostForm("expires_at"); expiresAt != "" {
+		t, err := time.Parse(time.RFC3339, expiresAt)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid expires_at, expected RFC3339"})
+			return
+		}
+		req.ExpiresAt = &t
+	}
+
+	content, err := h.contentService.UploadBundle(userID, req)
+	if err != nil {
+		c.JSON(contentErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":   "Bundle uploaded successfully",
+		"id":        content.ID,
+		"url":       h.viewURL(content.ID) + "/",
+		"file_size": content.FileSize,
 	})
 }
 
@@ -121,36 +252,201 @@ func (h *ContentHandler) GetByID(c *gin.Context) {
 
 // View 查看 HTML 内容
 func (h *ContentHandler) View(c *gin.Context) {
+	content, req, ok := h.authorizeView(c)
+	if !ok {
+		return
+	}
+
+	// 站点包需要以 / 结尾访问，保证页面中的相对路径正确解析
+	if content.IsBundle() {
+		target := "/"
+		if !middleware.IsCustomDomain(c) {
+			target = "/view/" + content.ID.String() + "/"
+		}
+		c.Redirect(http.StatusMovedPermanently, target)
+		return
+	}
+
+	h.setSecurityHeaders(c)
+
+	// 旧内容在正文存入 blob 存储前没有计算哈希，读取正文时补全
+	if content.ContentHash == "" {
+		if !h.loadBody(c, content) {
+			return
+		}
+	}
+
+	c.Header("ETag", content.ETag())
+	c.Header("Last-Modified", content.UpdatedAt.UTC().Format(http.TimeFormat))
+	c.Header("Cache-Control", h.contentService.CacheControl(content))
+
+	// 重新验证同样计入访问统计
+	h.contentService.RecordView(content, req)
+
+	if notModified(c.Request, content.ETag(), content.UpdatedAt) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	if content.Content == "" {
+		if !h.loadBody(c, content) {
+			return
+		}
+	}
+
+	// 返回 HTML 内容
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.String(http.StatusOK, content.Content)
+}
+
+// loadBody 读取内容正文，失败时直接写入错误页
+func (h *ContentHandler) loadBody(c *gin.Context, content *models.Content) bool {
+	if err := h.contentService.LoadBody(content); err != nil {
+		c.HTML(http.StatusInternalServerError, "error.html", gin.H{
+			"Title":   "服务器错误",
+			"Message": "内容读取失败，请稍后重试",
+		})
+		return false
+	}
+	return true
+}
+
+// ViewAsset 查看站点包中的文件，根路径返回 index.html 并计入访问统计
+func (h *ContentHandler) ViewAsset(c *gin.Context) {
+	content, req, ok := h.authorizeView(c)
+	if !ok {
+		return
+	}
+
+	requestPath := c.Param("path")
+	if !content.IsBundle() {
+		if requestPath == "/" && !middleware.IsCustomDomain(c) {
+			c.Redirect(http.StatusMovedPermanently, "/view/"+content.ID.String())
+			return
+		}
+		c.HTML(http.StatusNotFound, "error.html", gin.H{
+			"Title":   "页面未找到",
+			"Message": "请求的页面不存在或已过期",
+		})
+		return
+	}
+
+	filePath, err := services.ResolveBundlePath(content.FilePath, requestPath)
+	if err != nil {
+		c.HTML(http.StatusNotFound, "error.html", gin.H{
+			"Title":   "页面未找到",
+			"Message": "请求的文件不存在",
+		})
+		return
+	}
+
+	if requestPath == "/" {
+		h.contentService.RecordView(content, req)
+	}
+
+	// 站点包文件由 c.File 处理 Last-Modified 和条件请求
+	h.setSecurityHeaders(c)
+	c.Header("Cache-Control", h.contentService.CacheControl(content))
+
+	if contentType := mime.TypeByExtension(filepath.Ext(filePath)); contentType != "" {
+		c.Header("Content-Type", contentType)
+	}
+	c.File(filePath)
+}
+
+// authorizeView 校验内容访问权限，未通过时直接写入响应（访问码输入页或错误页）
+func (h *ContentHandler) authorizeView(c *gin.Context) (*models.Content, *services.ViewRequest, bool) {
 	idStr := c.Param("id")
 	id, err := uuid.Parse(idStr)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
-		return
+		return nil, nil, false
 	}
 
-	// 获取访问码（如果有）
+	// 获取访问码（如果有），访问码输入页以表单方式提交
 	accessCode := c.Query("code")
+	if c.Request.Method == http.MethodPost {
+		accessCode = c.PostForm("code")
+	}
+	accessToken, _ := c.Cookie(contentAccessCookie)
+	viewerID, _ := middleware.GetUserID(c)
+
+	req := &services.ViewRequest{
+		ContentID:   id,
+		AccessCode:  accessCode,
+		AccessToken: accessToken,
+		ViewerID:    viewerID,
+		// 获取客户端IP地址（支持代理服务器传递的真实IP）
+		ClientIP: utils.GetRealClientIP(c),
+		// 获取用户代理和来源
+		UserAgent: c.GetHeader("User-Agent"),
+		Referer:   c.GetHeader("Referer"),
+		Host:      c.Request.Host,
+		// 推广活动参数
+		UTMSource:   c.Query("utm_source"),
+		UTMMedium:   c.Query("utm_medium"),
+		UTMCampaign: c.Query("utm_campaign"),
+	}
 
-	// 获取客户端IP地址（支持代理服务器传递的真实IP）
-	clientIP := getRealClientIP(c)
-
-	// 获取用户代理和来源
-	userAgent := c.GetHeader("User-Agent")
-	referer := c.GetHeader("Referer")
-
-	// 使用 ContentService 的 ViewContent 方法来记录访问统计
-	content, err := h.contentService.ViewContentWithAnalytics(id, accessCode, clientIP, userAgent, referer)
+	content, err := h.contentService.AuthorizeView(req)
 	if err != nil {
+		if errors.Is(err, services.ErrAccessCodeRequired) || errors.Is(err, services.ErrInvalidAccessCode) ||
+			errors.Is(err, services.ErrTooManyAccessCodeAttempts) {
+			data := gin.H{
+				"Title":      "需要访问码",
+				"FormAction": viewBasePath(c, id),
+			}
+			status := http.StatusUnauthorized
+			switch {
+			case errors.Is(err, services.ErrInvalidAccessCode):
+				data["Error"] = "访问码错误，请重试"
+			case errors.Is(err, services.ErrTooManyAccessCodeAttempts):
+				status = http.StatusTooManyRequests
+				data["Error"] = "尝试次数过多，请稍后再试"
+			}
+			c.HTML(status, "access-code.html", data)
+			return nil, nil, false
+		}
 		c.HTML(http.StatusNotFound, "error.html", gin.H{
 			"Title":   "页面未找到",
 			"Message": "请求的页面不存在或已过期",
 		})
-		return
+		return nil, nil, false
 	}
 
-	// 返回 HTML 内容
-	c.Header("Content-Type", "text/html; charset=utf-8")
-	c.String(http.StatusOK, content.Content)
+	// 访问码验证通过后写入 Cookie，后续访问无需重复输入
+	if accessCode != "" && content.Visibility == models.VisibilityAccessCode {
+		basePath := viewBasePath(c, id)
+		c.SetCookie(contentAccessCookie, h.contentService.IssueAccessToken(content), int(models.ContentAccessTokenTTL.Seconds()), basePath, "", utils.IsSecureRequest(c), true)
+		if c.Request.Method == http.MethodPost {
+			c.Redirect(http.StatusSeeOther, basePath)
+			return nil, nil, false
+		}
+	}
+
+	return content, req, true
+}
+
+// setSecurityHeaders 为用户内容设置安全响应头，CSP sandbox 使页面运行在独立的源中，无法读取平台的 Cookie 或调用 API
+func (h *ContentHandler) setSecurityHeaders(c *gin.Context) {
+	if h.csp != "" {
+		c.Header("Content-Security-Policy", h.csp)
+	}
+	c.Header("X-Frame-Options", "DENY")
+	c.Header("X-Content-Type-Options", "nosniff")
+}
+
+// viewURL 返回内容的访问地址，配置了内容域名时返回该域名下的完整地址
+func (h *ContentHandler) viewURL(id uuid.UUID) string {
+	return h.contentOrigin + "/view/" + id.String()
+}
+
+// viewBasePath 返回内容在当前 Host 上的访问路径，自定义域名下内容位于根路径
+func viewBasePath(c *gin.Context, id uuid.UUID) string {
+	if middleware.IsCustomDomain(c) {
+		return "/"
+	}
+	return "/view/" + id.String()
 }
 
 // Update 更新内容
@@ -176,7 +472,7 @@ func (h *ContentHandler) Update(c *gin.Context) {
 
 	content, err := h.contentService.Update(userID.(uuid.UUID), id, &req)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(contentErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -209,27 +505,3 @@ func (h *ContentHandler) Delete(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "Content deleted successfully"})
 }
-
-// getRealClientIP 获取真实的客户端IP地址，支持从代理服务器传递的真实IP
-func getRealClientIP(c *gin.Context) string {
-	// 1. 首先检查 X-Real-IP 头部（nginx proxy_set_header X-Real-IP $remote_addr;）
-	if realIP := c.GetHeader("X-Real-IP"); realIP != "" {
-		return realIP
-	}
-
-	// 2. 检查 X-Forwarded-For 头部（可能包含多个IP，第一个是真实客户端IP）
-	if forwardedFor := c.GetHeader("X-Forwarded-For"); forwardedFor != "" {
-		// X-Forwarded-For 格式: client, proxy1, proxy2
-		if firstIP := strings.Split(forwardedFor, ",")[0]; firstIP != "" {
-			return strings.TrimSpace(firstIP)
-		}
-	}
-
-	// 3. 检查 CF-Connecting-IP 头部（Cloudflare）
-	if cfIP := c.GetHeader("CF-Connecting-IP"); cfIP != "" {
-		return cfIP
-	}
-
-	// 4. 最后使用 Gin 的默认 ClientIP 方法
-	return c.ClientIP()
-}
@@ -0,0 +1,165 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"anywebsites/internal/middleware"
+	"anywebsites/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type DomainHandler struct {
+	domainService *services.DomainService
+}
+
+func NewDomainHandler(domainService *services.DomainService) *DomainHandler {
+	return &DomainHandler{
+		domainService: domainService,
+	}
+}
+
+// List 获取当前用户的自定义域名
+func (h *DomainHandler) List(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	domains, err := h.domainService.List(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get domains"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"domains": domains})
+}
+
+// Create 添加自定义域名，返回需要配置的 DNS TXT 记录
+func (h *DomainHandler) Create(c *gin.Context) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req services.CreateDomainRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	domain, err := h.domainService.Create(userID, &req)
+	if err != nil {
+		status := http.StatusBadRequest
+		switch {
+		case errors.Is(err, services.ErrDomainLimitExceeded):
+			status = http.StatusForbidden
+		case errors.Is(err, services.ErrDomainExists):
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"domain": domain,
+		"verification": gin.H{
+			"type":  "TXT",
+			"name":  domain.VerificationRecordName(),
+			"value": domain.VerificationRecordValue(),
+		},
+	})
+}
+
+// Verify 检查 DNS TXT 记录并完成域名验证
+func (h *DomainHandler) Verify(c *gin.Context) {
+	userID, domainID, ok := h.parseIDs(c)
+	if !ok {
+		return
+	}
+
+	domain, err := h.domainService.Verify(userID, domainID)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrDomainNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrDomainVerificationFailed):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrDomainExists):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrDomainClaimExpired):
+			c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify domain"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"domain": domain})
+}
+
+// Update 更新域名绑定的内容
+func (h *DomainHandler) Update(c *gin.Context) {
+	userID, domainID, ok := h.parseIDs(c)
+	if !ok {
+		return
+	}
+
+	var req services.UpdateDomainRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	domain, err := h.domainService.Update(userID, domainID, &req)
+	if err != nil {
+		if errors.Is(err, services.ErrDomainNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"domain": domain})
+}
+
+// Delete 删除自定义域名
+func (h *DomainHandler) Delete(c *gin.Context) {
+	userID, domainID, ok := h.parseIDs(c)
+	if !ok {
+		return
+	}
+
+	if err := h.domainService.Delete(userID, domainID); err != nil {
+		if errors.Is(err, services.ErrDomainNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete domain"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Domain deleted successfully"})
+}
+
+// parseIDs 获取当前用户 ID 和路径中的域名 ID
+func (h *DomainHandler) parseIDs(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	domainID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	return userID, domainID, true
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNotModified(t *testing.T) {
+	etag := `"abc123"`
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 500, time.UTC)
+
+	tests := []struct {
+		name    string
+		method  string
+		headers map[string]string
+		want    bool
+	}{
+		{"无条件请求", http.MethodGet, nil, false},
+		{"ETag 匹配", http.MethodGet, map[string]string{"If-None-Match": `"abc123"`}, true},
+		{"ETag 列表匹配", http.MethodGet, map[string]string{"If-None-Match": `"x", "abc123"`}, true},
+		{"弱 ETag 匹配", http.MethodGet, map[string]string{"If-None-Match": `W/"abc123"`}, true},
+		{"通配符", http.MethodGet, map[string]string{"If-None-Match": "*"}, true},
+		{"ETag 不匹配", http.MethodGet, map[string]string{"If-None-Match": `"other"`}, false},
+		{"未修改", http.MethodGet, map[string]string{"If-Modified-Since": modified.Format(http.TimeFormat)}, true},
+		{"之后未修改", http.MethodGet, map[string]string{"If-Modified-Since": modified.Add(time.Hour).Format(http.TimeFormat)}, true},
+		{"已修改", http.MethodGet, map[string]string{"If-Modified-Since": modified.Add(-time.Second).Format(http.TimeFormat)}, false},
+		{"无效日期", http.MethodGet, map[string]string{"If-Modified-Since": "yesterday"}, false},
+		{
+			"If-None-Match 优先于 If-Modified-Since", http.MethodGet,
+			map[string]string{"If-None-Match": `"other"`, "If-Modified-Since": modified.Format(http.TimeFormat)},
+			false,
+		},
+		{"POST 不使用缓存", http.MethodPost, map[string]string{"If-None-Match": `"abc123"`}, false},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/view/x", nil)
+		for key, value := range tt.headers {
+			req.Header.Set(key, value)
+		}
+		if got := notModified(req, etag, modified); got != tt.want {
+			t.Errorf("%s: notModified() = %v，期望 %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"anywebsites/internal/middleware"
+	"anywebsites/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+type RevisionHandler struct {
+	revisionService *services.RevisionService
+}
+
+func NewRevisionHandler() *RevisionHandler {
+	return &RevisionHandler{
+		revisionService: services.NewRevisionService(),
+	}
+}
+
+// List 获取内容的修订列表
+func (h *RevisionHandler) List(c *gin.Context) {
+	userID, contentID, ok := parseContentIDs(c)
+	if !ok {
+		return
+	}
+
+	revisions, err := h.revisionService.List(userID, contentID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"revisions": revisions})
+}
+
+// Get 获取指定修订的完整内容
+func (h *RevisionHandler) Get(c *gin.Context) {
+	userID, contentID, ok := parseContentIDs(c)
+	if !ok {
+		return
+	}
+	revision, err := strconv.Atoi(c.Param("revision"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid revision"})
+		return
+	}
+
+	rev, err := h.revisionService.Get(userID, contentID, revision)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"revision": rev})
+}
+
+// Diff 比较两个修订，参数 from 和 to 为修订号
+func (h *RevisionHandler) Diff(c *gin.Context) {
+	userID, contentID, ok := parseContentIDs(c)
+	if !ok {
+		return
+	}
+	from, err1 := strconv.Atoi(c.Query("from"))
+	to, err2 := strconv.Atoi(c.Query("to"))
+	if err1 != nil || err2 != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Query parameters from and to are required"})
+		return
+	}
+
+	diff, err := h.revisionService.Diff(userID, contentID, from, to)
+	if err != nil {
+		if errors.Is(err, services.ErrDiffTooLarge) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"diff": diff})
+}
+
+// Restore 将指定修订恢复为当前内容
+func (h *RevisionHandler) Restore(c *gin.Context) {
+	userID, contentID, ok := parseContentIDs(c)
+	if !ok {
+		return
+	}
+	revision, err := strconv.Atoi(c.Param("revision"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid revision"})
+		return
+	}
+
+	content, err := h.revisionService.Restore(userID, contentID, revision)
+	if err != nil {
+		if errors.Is(err, services.ErrStorageLimitExceeded) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Revision restored successfully",
+		"content": content,
+	})
+}
+
+// parseContentIDs 获取当前用户 ID 和路径中的内容 ID
+func parseContentIDs(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	userID, exists := middleware.GetUserID(c)
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	contentID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID"})
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	return userID, contentID, true
+}
@@ -5,18 +5,27 @@ import (
 	"anywebsites/internal/config"
 	"anywebsites/internal/middleware"
 	"anywebsites/internal/services"
+	"anywebsites/internal/utils"
 	"html/template"
+	"log"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-func SetupRoutes(cfg *config.Config, geoipService *services.GeoIPService) *gin.Engine {
-	// 初始化 JWT
-	auth.InitJWT(cfg)
-
+func SetupRoutes(cfg *config.Config, geoipService *services.GeoIPService, analytics *services.AnalyticsPipeline, apiUsage *services.APIUsageRecorder) *gin.Engine {
 	r := gin.Default()
 
+	// 客户端 IP：只有来自受信任代理的请求才读取转发头部，gin 自身的 ClientIP 只返回直接连接的地址
+	clientIPResolver, err := utils.NewClientIPResolver(cfg.Server.TrustedProxies, cfg.Server.TrustedProxyHeader)
+	if err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES or TRUSTED_PROXY_HEADER:", err)
+	}
+	if err := r.SetTrustedProxies(nil); err != nil {
+		log.Fatal("Failed to disable gin trusted proxies:", err)
+	}
+	r.Use(middleware.ClientIPMiddleware(clientIPResolver))
+
 	// 设置模板函数
 	r.SetFuncMap(template.FuncMap{
 		"add": func(a, b interface{}) int64 {
@@ -148,6 +157,7 @@ func SetupRoutes(cfg *config.Config, geoipService *services.GeoIPService) *gin.E
 	// 加载 HTML 模板
 	r.LoadHTMLFiles(
 		"web/templates/login.html",
+		"web/templates/login-2fa.html",
 		"web/templates/layout.html",
 		"web/templates/dashboard.html",
 		"web/templates/contents.html",
@@ -160,10 +170,24 @@ func SetupRoutes(cfg *config.Config, geoipService *services.GeoIPService) *gin.E
 		"web/templates/analytics.html",
 		"web/templates/geoip-monitor.html",
 		"web/templates/plan-stats.html",
+		"web/templates/two-factor.html",
 		"web/templates/error.html",
+		"web/templates/access-code.html",
 		"web/templates/admin/error.html",
 	)
 
+	// 自定义域名：绑定域名的请求改写到对应内容，需在注册路由之前启用
+	// 内容域名同样属于平台，不按自定义域名解析
+	primaryHosts := cfg.Domain.PrimaryHosts
+	if host := middleware.ContentOriginHost(cfg.ContentSecurity.ContentOrigin); host != "" {
+		primaryHosts = append(append([]string{}, primaryHosts...), host)
+	}
+	domainService := services.NewDomainService()
+	r.Use(middleware.CustomDomainMiddleware(r, domainService, primaryHosts))
+
+	// 内容域名：用户页面与管理后台和 API 分属不同的源
+	r.Use(middleware.ContentOriginMiddleware(cfg.ContentSecurity.ContentOrigin))
+
 	// 根路径重定向到登录页面
 	r.GET("/", func(c *gin.Context) {
 		c.Redirect(302, "/admin/login")
@@ -183,37 +207,130 @@ func SetupRoutes(cfg *config.Config, geoipService *services.GeoIPService) *gin.E
 		c.JSON(200, gin.H{"status": "ok"})
 	})
 
+	// 系统设置服务（匿名上传开关和配额、管理员两步验证也由系统设置控制）
+	settingsService := services.NewSettingsService()
+
+	// 两步验证服务，管理后台和 API 登录共用，输错次数按用户保存在数据库中
+	// TOTP 密钥和签名私钥使用同一个 JWT_KEY_ENCRYPTION_KEY 加密保存，内容访问令牌的签名密钥也由它派生
+	keyEncryptionKey, err := auth.ParseKeyEncryptionKey(cfg.JWT.KeyEncryptionKey)
+	if err != nil {
+		log.Fatal("Invalid JWT_KEY_ENCRYPTION_KEY:", err)
+	}
+	twoFactorService := services.NewTwoFactorService(settingsService, keyEncryptionKey)
+	if err := twoFactorService.EncryptLegacySecrets(); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+	oidcService := services.NewOIDCService(settingsService)
+
 	// 认证相关路由
-	authHandler := NewAuthHandler()
+	authHandler := NewAuthHandler(twoFactorService)
+	r.GET("/.well-known/jwks.json", authHandler.JWKS) // JWT 校验公钥
+
+	// 登录接口按客户端 IP 限流，密码和验证码两步分别计数，管理后台登录与 API 登录共用计数
+	loginRateLimitStore := services.NewMemoryRateLimitStore()
+	loginWindow := time.Duration(cfg.RateLimit.LoginWindow) * time.Second
+	loginRateLimit := middleware.IPRateLimitMiddleware(loginRateLimitStore, "login", cfg.RateLimit.LoginRequests, loginWindow)
+	loginTwoFactorRateLimit := middleware.IPRateLimitMiddleware(loginRateLimitStore, "login-2fa", cfg.RateLimit.LoginRequests, loginWindow)
+
 	authGroup := r.Group("/api/auth")
 	{
 		authGroup.POST("/register", authHandler.Register)
-		authGroup.POST("/login", authHandler.Login)
+		authGroup.POST("/login", loginRateLimit, authHandler.Login)
 		authGroup.POST("/refresh", authHandler.RefreshToken)
+		authGroup.POST("/login/2fa", loginTwoFactorRateLimit, authHandler.LoginTwoFactor) // 登录第二步
+		authGroup.POST("/login/2fa/setup", authHandler.LoginTwoFactorSetup)               // 强制启用时登录中绑定验证器
+	}
+
+	// 会话管理路由（仅支持 JWT 认证）
+	sessionGroup := r.Group("/api/auth")
+	sessionGroup.Use(middleware.AuthMiddleware())
+	{
+		sessionGroup.POST("/logout", authHandler.Logout)        // 退出当前会话
+		sessionGroup.POST("/logout-all", authHandler.LogoutAll) // 退出所有会话
+
+		// 两步验证管理
+		sessionGroup.GET("/2fa", authHandler.TwoFactorStatus)
+		sessionGroup.POST("/2fa/setup", authHandler.SetupTwoFactor)
+		sessionGroup.POST("/2fa/enable", authHandler.EnableTwoFactor)
+		sessionGroup.POST("/2fa/disable", authHandler.DisableTwoFactor)
+		sessionGroup.POST("/2fa/recovery-codes", authHandler.RegenerateRecoveryCodes)
 	}
 
+	// API 限流：按用户计划的每小时调用额度
+	rateLimitService := services.NewRateLimitService(cfg, services.NewMemoryRateLimitStore(), apiUsage)
+	rateLimit := middleware.RateLimitMiddleware(rateLimitService)
+
+	// API 认证：Bearer JWT 或 X-API-Key
+	apiKeyService := services.NewAPIKeyService()
+	apiAuth := middleware.APIAuthMiddleware(apiKeyService)
+
 	// 内容相关路由
-	contentHandler := NewContentHandler(geoipService)
+	contentHandler := NewContentHandler(cfg, analytics, settingsService, keyEncryptionKey.DeriveKey("content-access-token"))
 	planHandler := NewPlanHandler()
+	revisionHandler := NewRevisionHandler()
+	analyticsHandler := NewAnalyticsHandler(settingsService, analytics.LiveViews())
 
-	// 公开访问路由
-	r.GET("/view/:id", contentHandler.View)
+	// 公开访问路由（携带有效 Token 时可访问自己的私有内容）
+	r.GET("/view/:id", middleware.OptionalAuthMiddleware(), contentHandler.View)
+	r.POST("/view/:id", middleware.OptionalAuthMiddleware(), contentHandler.View)           // 提交访问码
+	r.GET("/view/:id/*path", middleware.OptionalAuthMiddleware(), contentHandler.ViewAsset) // 站点包文件
 
 	// 公开 API 路由
 	publicApiGroup := r.Group("/api/content")
 	{
-		// 公开上传（临时）
-		publicApiGroup.POST("/upload", contentHandler.Upload)
+		// 上传：已认证用户按计划限制上传，未认证时在开启匿名上传后按 IP 配额上传
+		publicApiGroup.POST("/upload", middleware.OptionalAPIAuthMiddleware(apiKeyService), rateLimit, contentHandler.Upload)
+		publicApiGroup.DELETE("/anonymous/:id", contentHandler.DeleteAnonymous) // 凭删除令牌删除匿名内容
 	}
 
 	// 需要认证的 API 路由
 	authApiGroup := r.Group("/api/content")
-	authApiGroup.Use(middleware.AuthMiddleware())
+	authApiGroup.Use(apiAuth, rateLimit)
 	{
 		authApiGroup.GET("", contentHandler.List)          // 获取内容列表
 		authApiGroup.GET("/:id", contentHandler.GetByID)   // 获取内容详情
 		authApiGroup.PUT("/:id", contentHandler.Update)    // 更新内容
 		authApiGroup.DELETE("/:id", contentHandler.Delete) // 删除内容
+
+		// 修订历史
+		authApiGroup.GET("/:id/revisions", revisionHandler.List)                       // 获取修订列表
+		authApiGroup.GET("/:id/revisions/diff", revisionHandler.Diff)                  // 比较两个修订
+		authApiGroup.GET("/:id/revisions/:revision", revisionHandler.Get)              // 获取修订详情
+		authApiGroup.POST("/:id/revisions/:revision/restore", revisionHandler.Restore) // 恢复修订
+
+		// 访问统计
+		authApiGroup.GET("/:id/analytics", analyticsHandler.Content) // 获取单个内容的访问统计
+	}
+
+	// 访问统计路由（只包含当前用户自己的内容）
+	analyticsGroup := r.Group("/api/analytics")
+	analyticsGroup.Use(apiAuth, rateLimit)
+	{
+		analyticsGroup.GET("/overview", analyticsHandler.Overview) // 获取所有内容的访问统计
+		analyticsGroup.GET("/export", analyticsHandler.Export)     // 导出访问数据（CSV 或 NDJSON）
+		analyticsGroup.GET("/live", analyticsHandler.Live)         // 实时访问推送（SSE）
+	}
+
+	// API 密钥管理路由（仅支持 JWT 认证）
+	apiKeyHandler := NewAPIKeyHandler(apiKeyService)
+	apiKeyGroup := r.Group("/api/keys")
+	apiKeyGroup.Use(middleware.AuthMiddleware(), rateLimit)
+	{
+		apiKeyGroup.GET("", apiKeyHandler.List)          // 获取密钥列表
+		apiKeyGroup.POST("", apiKeyHandler.Create)       // 创建密钥
+		apiKeyGroup.DELETE("/:id", apiKeyHandler.Revoke) // 吊销密钥
+	}
+
+	// 自定义域名路由
+	domainHandler := NewDomainHandler(domainService)
+	domainGroup := r.Group("/api/domains")
+	domainGroup.Use(apiAuth, rateLimit)
+	{
+		domainGroup.GET("", domainHandler.List)               // 获取域名列表
+		domainGroup.POST("", domainHandler.Create)            // 添加域名
+		domainGroup.POST("/:id/verify", domainHandler.Verify) // 验证域名
+		domainGroup.PUT("/:id", domainHandler.Update)         // 更新绑定的内容
+		domainGroup.DELETE("/:id", domainHandler.Delete)      // 删除域名
 	}
 
 	// 计划相关路由
@@ -224,7 +341,7 @@ func SetupRoutes(cfg *config.Config, geoipService *services.GeoIPService) *gin.E
 
 	// 需要认证的计划路由
 	authPlanGroup := r.Group("/api/plans")
-	authPlanGroup.Use(middleware.AuthMiddleware())
+	authPlanGroup.Use(apiAuth, rateLimit)
 	{
 		authPlanGroup.GET("/current", planHandler.GetUserPlan)    // 获取当前用户计划
 		authPlanGroup.GET("/usage", planHandler.GetUsageLimits)   // 获取使用限制
@@ -234,10 +351,7 @@ func SetupRoutes(cfg *config.Config, geoipService *services.GeoIPService) *gin.E
 	}
 
 	// 管理后台路由
-	adminHandler := NewAdminHandler(geoipService)
-
-	// 创建设置服务和处理器
-	settingsService := services.NewSettingsService()
+	adminHandler := NewAdminHandler(geoipService, analytics, apiKeyService, twoFactorService, oidcService)
 
 	// 创建配置重载服务
 	configReloadService := services.NewConfigReloadService(settingsService, cfg)
@@ -254,7 +368,14 @@ func SetupRoutes(cfg *config.Config, geoipService *services.GeoIPService) *gin.E
 
 	// 管理后台登录页面（无需认证）
 	r.GET("/admin/login", adminHandler.LoginPage)
-	r.POST("/admin/login", adminHandler.Login)
+	r.POST("/admin/login", loginRateLimit, adminHandler.Login)
+	r.GET("/admin/login/2fa", adminHandler.LoginTwoFactorPage)
+	r.POST("/admin/login/2fa", loginTwoFactorRateLimit, adminHandler.LoginTwoFactor)
+
+	// OpenID Connect 单点登录，管理后台和 API 共用同一个回调地址
+	ssoHandler := NewSSOHandler(oidcService, adminHandler, authHandler)
+	r.GET("/auth/oidc/login", ssoHandler.Login)
+	r.GET("/auth/oidc/callback", ssoHandler.Callback)
 
 	// 需要认证的管理后台路由
 	adminGroup := r.Group("/admin")
@@ -276,6 +397,11 @@ func SetupRoutes(cfg *config.Config, geoipService *services.GeoIPService) *gin.E
 		adminGroup.GET("/analytics", adminHandler.Analytics)
 		adminGroup.GET("/geoip-monitor", adminHandler.GeoIPMonitor)
 		adminGroup.GET("/settings", settingsHandler.SettingsPage)
+		adminGroup.GET("/two-factor", adminHandler.TwoFactor)
+		adminGroup.POST("/two-factor/setup", adminHandler.TwoFactorSetup)
+		adminGroup.POST("/two-factor/enable", adminHandler.TwoFactorEnable)
+		adminGroup.POST("/two-factor/disable", adminHandler.TwoFactorDisable)
+		adminGroup.POST("/two-factor/recovery-codes", adminHandler.TwoFactorRecoveryCodes)
 
 		// 用户计划管理路由
 		adminGroup.GET("/user-plans", adminHandler.UserPlans)
@@ -299,6 +425,8 @@ func SetupRoutes(cfg *config.Config, geoipService *services.GeoIPService) *gin.E
 			adminApiGroup.POST("/users/:id/reset-password", adminHandler.ResetUserPassword)
 			adminApiGroup.DELETE("/users/:id", adminHandler.DeleteUser)
 			adminApiGroup.GET("/geoip-stats", adminHandler.GetGeoIPStats)
+			adminApiGroup.GET("/analytics/export", adminHandler.ExportAnalytics)
+			adminApiGroup.GET("/analytics/live", adminHandler.LiveViews)
 
 			// 设置管理 API
 			adminApiGroup.GET("/settings", settingsHandler.GetAllSettings)
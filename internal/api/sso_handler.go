@@ -0,0 +1,132 @@
+package api
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"anywebsites/internal/services"
+	"anywebsites/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// oidcStateCookie 单点登录跳转期间保存 state 的 Cookie，回调时用于确认是同一个浏览器发起的登录
+const oidcStateCookie = "oidc_state"
+
+// oidcCookiePath state Cookie 只在单点登录路径下发送
+const oidcCookiePath = "/auth/oidc"
+
+// SSOHandler OpenID Connect 单点登录处理器，回调后按发起时的 target 进入管理后台或返回 API Token
+type SSOHandler struct {
+	oidc  *services.OIDCService
+	admin *AdminHandler
+	auth  *AuthHandler
+}
+
+// NewSSOHandler 创建单点登录处理器
+func NewSSOHandler(oidc *services.OIDCService, admin *AdminHandler, auth *AuthHandler) *SSOHandler {
+	return &SSOHandler{oidc: oidc, admin: admin, auth: auth}
+}
+
+// Login 跳转到身份提供方，target=api 时回调返回 JSON Token，默认进入管理后台
+func (h *SSOHandler) Login(c *gin.Context) {
+	target := services.OIDCTargetAdmin
+	if c.Query("target") == services.OIDCTargetAPI {
+		target = services.OIDCTargetAPI
+	}
+
+	login, err := h.oidc.Begin(c.Request.Context(), target)
+	if err != nil {
+		if !errors.Is(err, services.ErrSSODisabled) {
+			log.Printf("Failed to start SSO login: %v", err)
+		}
+		h.fail(c, target, err)
+		return
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, login.State, login.ExpiresIn, oidcCookiePath, "", utils.IsSecureRequest(c), true)
+	c.Redirect(http.StatusFound, login.URL)
+}
+
+// Callback 身份提供方回调：校验 state、换取并校验 ID Token，然后按第一步验证通过继续登录
+func (h *SSOHandler) Callback(c *gin.Context) {
+	state := c.Query("state")
+	cookie, _ := c.Cookie(oidcStateCookie)
+	c.SetCookie(oidcStateCookie, "", -1, oidcCookiePath, "", utils.IsSecureRequest(c), true)
+
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(cookie)) != 1 {
+		h.fail(c, "", services.ErrInvalidSSOState)
+		return
+	}
+	if errorCode := c.Query("error"); errorCode != "" {
+		// 用户在身份提供方取消授权等情况，同时作废 state
+		h.oidc.Discard(state)
+		h.fail(c, "", errors.New("identity provider returned error: "+errorCode))
+		return
+	}
+
+	user, target, err := h.oidc.Complete(c.Request.Context(), state, c.Query("code"))
+	if err != nil {
+		log.Printf("SSO login failed: %v", err)
+		h.fail(c, target, err)
+		return
+	}
+
+	if target == services.OIDCTargetAPI {
+		h.auth.completeLogin(c, user)
+		return
+	}
+	if !user.IsAdmin {
+		h.admin.renderLogin(c, http.StatusForbidden, gin.H{"Error": "您没有管理员权限"})
+		return
+	}
+	h.admin.completeLogin(c, user)
+}
+
+// fail 返回单点登录错误，不知道 target 时按 Accept 头部判断是否为浏览器
+func (h *SSOHandler) fail(c *gin.Context, target string, err error) {
+	if target == "" && strings.Contains(c.GetHeader("Accept"), "text/html") {
+		target = services.OIDCTargetAdmin
+	}
+	if target == services.OIDCTargetAdmin {
+		h.admin.renderLogin(c, ssoErrorStatus(err), gin.H{"Error": ssoErrorMessage(err)})
+		return
+	}
+	c.JSON(ssoErrorStatus(err), gin.H{"error": err.Error()})
+}
+
+// ssoErrorStatus 单点登录错误对应的 HTTP 状态码
+func ssoErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrSSODisabled):
+		return http.StatusNotFound
+	case errors.Is(err, services.ErrSSOEmailNotVerified),
+		errors.Is(err, services.ErrSSONoAccount),
+		errors.Is(err, services.ErrUserInactive):
+		return http.StatusForbidden
+	default:
+		return http.StatusUnauthorized
+	}
+}
+
+// ssoErrorMessage 单点登录错误在登录页面上显示的提示
+func ssoErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, services.ErrSSODisabled):
+		return "未启用单点登录"
+	case errors.Is(err, services.ErrInvalidSSOState):
+		return "单点登录已过期，请重新登录"
+	case errors.Is(err, services.ErrSSOEmailNotVerified):
+		return "身份提供方未验证该账户的邮箱，无法登录"
+	case errors.Is(err, services.ErrSSONoAccount):
+		return "该账户没有对应的用户，请联系管理员"
+	case errors.Is(err, services.ErrUserInactive):
+		return "用户已被禁用"
+	default:
+		return "单点登录失败，请重试"
+	}
+}
@@ -11,28 +11,37 @@ import (
 )
 
 // Claims JWT 声明结构
+// 刷新 Token 的 jti（RegisteredClaims.ID）即服务端会话记录的 ID，访问 Token 的 sid 指向签发它时的会话记录
 type Claims struct {
-	UserID   uuid.UUID `json:"user_id"`
-	Username string    `json:"username"`
-	IsAdmin  bool      `json:"is_admin"`
+	UserID    uuid.UUID `json:"user_id"`
+	Username  string    `json:"username"`
+	IsAdmin   bool      `json:"is_admin"`
+	SessionID uuid.UUID `json:"sid"`
 	jwt.RegisteredClaims
 }
 
-var jwtSecret []byte
+// Token 有效期
+const (
+	AccessTokenTTL  = 24 * time.Hour
+	RefreshTokenTTL = 7 * 24 * time.Hour
 
-// InitJWT 初始化 JWT 密钥
+	ChallengeTokenTTL = 5 * time.Minute // 密码验证通过后完成两步验证的时限
+)
+
+// InitJWT 使用配置中的共享密钥以 HS256 签名，非对称签名的密钥由 services.JWTKeyService 加载和轮换
 func InitJWT(cfg *config.Config) {
-	jwtSecret = []byte(cfg.JWT.Secret)
+	SetKeys(NewHMACKey([]byte(cfg.JWT.Secret)), nil)
 }
 
-// GenerateToken 生成 JWT Token
-func GenerateToken(userID uuid.UUID, username string, isAdmin bool) (string, error) {
+// GenerateToken 生成 JWT Token，sessionID 为所属的会话记录
+func GenerateToken(userID uuid.UUID, username string, isAdmin bool, sessionID uuid.UUID) (string, error) {
 	claims := Claims{
-		UserID:   userID,
-		Username: username,
-		IsAdmin:  isAdmin,
+		UserID:    userID,
+		Username:  username,
+		IsAdmin:   isAdmin,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)), // 24小时过期
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenTTL)), // 24小时过期
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
 			Issuer:    "anywebsites",
@@ -40,18 +49,19 @@ func GenerateToken(userID uuid.UUID, username string, isAdmin bool) (string, err
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	return signToken(claims)
 }
 
-// GenerateRefreshToken 生成刷新 Token
-func GenerateRefreshToken(userID uuid.UUID, username string, isAdmin bool) (string, error) {
+// GenerateRefreshToken 生成刷新 Token，tokenID 作为 jti，同时也是服务端会话记录的 ID
+func GenerateRefreshToken(userID uuid.UUID, username string, isAdmin bool, tokenID uuid.UUID) (string, error) {
 	claims := Claims{
-		UserID:   userID,
-		Username: username,
-		IsAdmin:  isAdmin,
+		UserID:    userID,
+		Username:  username,
+		IsAdmin:   isAdmin,
+		SessionID: tokenID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(7 * 24 * time.Hour)), // 7天过期
+			ID:        tokenID.String(),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(RefreshTokenTTL)), // 7天过期
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
 			Issuer:    "anywebsites-refresh",
@@ -59,24 +69,22 @@ func GenerateRefreshToken(userID uuid.UUID, username string, isAdmin bool) (stri
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	return signToken(claims)
 }
 
 // ValidateToken 验证 JWT Token
 func ValidateToken(tokenString string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("unexpected signing method")
-		}
-		return jwtSecret, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, verificationKey)
 
 	if err != nil {
 		return nil, err
 	}
 
 	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
+		// 刷新 Token 不能当作访问 Token 使用
+		if claims.Issuer != "anywebsites" {
+			return nil, errors.New("not an access token")
+		}
 		return claims, nil
 	}
 
@@ -85,12 +93,7 @@ func ValidateToken(tokenString string) (*Claims, error) {
 
 // ValidateRefreshToken 验证刷新 Token
 func ValidateRefreshToken(tokenString string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("unexpected signing method")
-		}
-		return jwtSecret, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, verificationKey)
 
 	if err != nil {
 		return nil, err
@@ -101,8 +104,48 @@ func ValidateRefreshToken(tokenString string) (*Claims, error) {
 		if claims.Issuer != "anywebsites-refresh" {
 			return nil, errors.New("not a refresh token")
 		}
+		if claims.ID == "" {
+			return nil, errors.New("refresh token without id")
+		}
 		return claims, nil
 	}
 
 	return nil, errors.New("invalid refresh token")
 }
+
+// GenerateChallengeToken 生成两步验证挑战 Token，密码验证通过后签发，只能用于完成登录的第二步
+func GenerateChallengeToken(userID uuid.UUID, challengeID uuid.UUID) (string, error) {
+	claims := Claims{
+		UserID: userID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        challengeID.String(),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ChallengeTokenTTL)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			NotBefore: jwt.NewNumericDate(time.Now()),
+			Issuer:    "anywebsites-2fa",
+			Subject:   userID.String(),
+		},
+	}
+
+	return signToken(claims)
+}
+
+// ValidateChallengeToken 验证两步验证挑战 Token
+func ValidateChallengeToken(tokenString string) (*Claims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, verificationKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
+		if claims.Issuer != "anywebsites-2fa" {
+			return nil, errors.New("not a challenge token")
+		}
+		if claims.ID == "" {
+			return nil, errors.New("challenge token without id")
+		}
+		return claims, nil
+	}
+
+	return nil, errors.New("invalid challenge token")
+}
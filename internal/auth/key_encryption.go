@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+// encryptedKeyPrefix 加密保存的私钥前缀，没有前缀的是加密前保存的 PEM
+const encryptedKeyPrefix = "enc:v1:"
+
+var (
+	// ErrInvalidKeyEncryptionKey JWT_KEY_ENCRYPTION_KEY 为空或不是 base64 编码的 32 字节
+	ErrInvalidKeyEncryptionKey = errors.New("JWT key encryption key must be 32 random bytes encoded in base64")
+	// ErrKeyDecryption 私钥密文被篡改、属于其他 kid 或使用了其他加密密钥
+	ErrKeyDecryption = errors.New("failed to decrypt JWT signing key")
+)
+
+// KeyEncryptionKey 加密数据库中签名私钥和 TOTP 密钥的密钥（KEK），使用 AES-256-GCM，
+// 记录的标识（kid 或用户）作为附加数据，密文不能挪到其他记录上使用
+type KeyEncryptionKey struct {
+	aead cipher.AEAD
+	raw  []byte
+}
+
+// ParseKeyEncryptionKey 解析 base64 编码的 32 字节密钥，可用 openssl rand -base64 32 生成
+func ParseKeyEncryptionKey(value string) (*KeyEncryptionKey, error) {
+	value = strings.TrimSpace(value)
+	raw, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		raw, err = base64.RawStdEncoding.DecodeString(value)
+	}
+	if err != nil || len(raw) != 32 {
+		return nil, ErrInvalidKeyEncryptionKey
+	}
+
+	block, err := aes.NewCipher(raw)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &KeyEncryptionKey{aead: aead, raw: raw}, nil
+}
+
+// DeriveKey 派生用于其他用途的密钥（HMAC-SHA256），不同 purpose 得到的密钥互不相关，也不能反推 KEK
+func (k *KeyEncryptionKey) DeriveKey(purpose string) []byte {
+	mac := hmac.New(sha256.New, k.raw)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// IsEncryptedKey 检查保存的私钥是否已加密
+func IsEncryptedKey(stored string) bool {
+	return strings.HasPrefix(stored, encryptedKeyPrefix)
+}
+
+// Encrypt 加密 PEM 私钥等秘密，keyID 为所属记录的标识，返回带前缀的 base64 密文（nonce + 密文）
+func (k *KeyEncryptionKey) Encrypt(keyID, privateKeyPEM string) (string, error) {
+	nonce := make([]byte, k.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := k.aead.Seal(nonce, nonce, []byte(privateKeyPEM), []byte(keyID))
+	return encryptedKeyPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt 解密 Encrypt 的结果，没有前缀时原样返回加密前保存的明文
+func (k *KeyEncryptionKey) Decrypt(keyID, stored string) (string, error) {
+	if !IsEncryptedKey(stored) {
+		return stored, nil
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, encryptedKeyPrefix))
+	if err != nil || len(sealed) < k.aead.NonceSize() {
+		return "", ErrKeyDecryption
+	}
+	nonce, ciphertext := sealed[:k.aead.NonceSize()], sealed[k.aead.NonceSize():]
+	plaintext, err := k.aead.Open(nil, nonce, ciphertext, []byte(keyID))
+	if err != nil {
+		return "", ErrKeyDecryption
+	}
+	return string(plaintext), nil
+}
@@ -0,0 +1,53 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestKeyEncryptionKey(t *testing.T) {
+	for _, value := range []string{"", "c2hvcnQ=", "not base64!"} {
+		if _, err := ParseKeyEncryptionKey(value); !errors.Is(err, ErrInvalidKeyEncryptionKey) {
+			t.Errorf("%q 应该被拒绝, 实际 %v", value, err)
+		}
+	}
+
+	kek, err := ParseKeyEncryptionKey("MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+	if err != nil {
+		t.Fatalf("解析密钥失败: %v", err)
+	}
+	key, err := GenerateSigningKey(AlgorithmEdDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey, err := key.MarshalPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := kek.Encrypt(key.ID, privateKey)
+	if err != nil {
+		t.Fatalf("加密失败: %v", err)
+	}
+	if !IsEncryptedKey(stored) || strings.Contains(stored, "PRIVATE KEY") {
+		t.Fatalf("保存的私钥应该是密文: %s", stored)
+	}
+	if decrypted, err := kek.Decrypt(key.ID, stored); err != nil || decrypted != privateKey {
+		t.Errorf("解密结果不一致: %v", err)
+	}
+
+	// 密文不能用于其他 kid，也不能用其他密钥解密
+	if _, err := kek.Decrypt("other-kid", stored); !errors.Is(err, ErrKeyDecryption) {
+		t.Errorf("其他 kid 应返回 ErrKeyDecryption, 实际 %v", err)
+	}
+	other, _ := ParseKeyEncryptionKey("ZmVkY2JhOTg3NjU0MzIxMGZlZGNiYTk4NzY1NDMyMTA=")
+	if _, err := other.Decrypt(key.ID, stored); !errors.Is(err, ErrKeyDecryption) {
+		t.Errorf("其他密钥应返回 ErrKeyDecryption, 实际 %v", err)
+	}
+
+	// 加密前保存的 PEM 原样返回
+	if decrypted, err := kek.Decrypt(key.ID, privateKey); err != nil || decrypted != privateKey {
+		t.Errorf("未加密的私钥应原样返回: %v", err)
+	}
+}
@@ -0,0 +1,344 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWT 签名算法
+const (
+	AlgorithmHS256 = "HS256" // 共享密钥，只能由持有密钥的服务校验
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA" // Ed25519
+)
+
+// rsaKeyBits RS256 密钥长度
+const rsaKeyBits = 2048
+
+var (
+	// ErrUnknownSigningKey Token 的 kid 不在当前可用的密钥中
+	ErrUnknownSigningKey = errors.New("unknown signing key")
+	// ErrInsecureSecret HS256 密钥为空、过短或仍是示例配置中的默认值
+	ErrInsecureSecret = errors.New("JWT secret is empty, shorter than 32 characters or a well-known default")
+)
+
+// defaultSecrets 示例配置和初始化脚本中出现过的默认密钥
+var defaultSecrets = map[string]bool{
+	"your-super-secret-jwt-key":                           true,
+	"your-super-secret-jwt-key-change-this-in-production": true,
+	"your-secret-key-here":                                true,
+	"change-me":                                           true,
+}
+
+// CheckSecret 检查 HS256 共享密钥是否可以使用
+func CheckSecret(secret string) error {
+	if len(secret) < 32 || defaultSecrets[secret] {
+		return ErrInsecureSecret
+	}
+	return nil
+}
+
+// IsAsymmetric 检查算法是否为非对称签名
+func IsAsymmetric(algorithm string) bool {
+	return algorithm == AlgorithmRS256 || algorithm == AlgorithmEdDSA
+}
+
+// SigningKey JWT 签名密钥，非对称密钥的 ID 为公钥的 RFC 7638 指纹，写入 Token 头部的 kid
+type SigningKey struct {
+	ID        string
+	Algorithm string
+
+	private crypto.PrivateKey // *rsa.PrivateKey、ed25519.PrivateKey 或 HS256 的 []byte
+	public  crypto.PublicKey  // 校验使用的密钥，HS256 与 private 相同
+}
+
+// NewHMACKey 使用共享密钥创建 HS256 签名密钥，Token 头部不带 kid
+func NewHMACKey(secret []byte) *SigningKey {
+	return &SigningKey{Algorithm: AlgorithmHS256, private: secret, public: secret}
+}
+
+// GenerateSigningKey 生成新的非对称签名密钥
+func GenerateSigningKey(algorithm string) (*SigningKey, error) {
+	var private crypto.PrivateKey
+	switch algorithm {
+	case AlgorithmRS256:
+		key, err := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+		if err != nil {
+			return nil, err
+		}
+		private = key
+	case AlgorithmEdDSA:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		private = key
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm: %s", algorithm)
+	}
+	return newSigningKey(algorithm, private)
+}
+
+// ParseSigningKey 解析 PKCS#8 PEM 格式的私钥
+func ParseSigningKey(algorithm, privateKeyPEM string) (*SigningKey, error) {
+	block, _ := pem.Decode([]byte(privateKeyPEM))
+	if block == nil {
+		return nil, errors.New("invalid PEM private key")
+	}
+	private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	return newSigningKey(algorithm, private)
+}
+
+func newSigningKey(algorithm string, private crypto.PrivateKey) (*SigningKey, error) {
+	key := &SigningKey{Algorithm: algorithm, private: private}
+	switch k := private.(type) {
+	case *rsa.PrivateKey:
+		if algorithm != AlgorithmRS256 {
+			return nil, fmt.Errorf("RSA key cannot be used with %s", algorithm)
+		}
+		key.public = &k.PublicKey
+	case ed25519.PrivateKey:
+		if algorithm != AlgorithmEdDSA {
+			return nil, fmt.Errorf("Ed25519 key cannot be used with %s", algorithm)
+		}
+		key.public = k.Public()
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", private)
+	}
+
+	thumbprint, err := key.PublicJWK().Thumbprint()
+	if err != nil {
+		return nil, err
+	}
+	key.ID = thumbprint
+	return key, nil
+}
+
+// MarshalPrivateKey 以 PKCS#8 PEM 格式导出私钥
+func (k *SigningKey) MarshalPrivateKey() (string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(k.private)
+	if err != nil {
+		return "", err
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
+
+// method 返回签名算法对应的 jwt 签名方法
+func (k *SigningKey) method() jwt.SigningMethod {
+	switch k.Algorithm {
+	case AlgorithmRS256:
+		return jwt.SigningMethodRS256
+	case AlgorithmEdDSA:
+		return jwt.SigningMethodEdDSA
+	default:
+		return jwt.SigningMethodHS256
+	}
+}
+
+// JWK RFC 7517 公钥，只包含 RSA、EC 和 Ed25519 需要的字段
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid,omitempty"`
+	Use       string `json:"use,omitempty"`
+	Algorithm string `json:"alg,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+	Y         string `json:"y,omitempty"` // 仅 EC
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+}
+
+// JWKSet /.well-known/jwks.json 的响应
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicJWK 返回非对称密钥的公钥 JWK，HS256 密钥不能公开
+func (k *SigningKey) PublicJWK() JWK {
+	jwk := JWK{KeyID: k.ID, Use: "sig", Algorithm: k.Algorithm}
+	switch public := k.public.(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(public)
+	}
+	return jwk
+}
+
+// Thumbprint 计算 RFC 7638 JWK 指纹：按字典序只取必需字段，SHA-256 后 base64url 编码
+func (j JWK) Thumbprint() (string, error) {
+	var members interface{}
+	switch j.KeyType {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{j.E, j.KeyType, j.N}
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{j.Curve, j.KeyType, j.X}
+	default:
+		return "", fmt.Errorf("unsupported key type: %s", j.KeyType)
+	}
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// PublicKey 解析 JWK 中的公钥，用于校验外部身份提供方签发的 Token
+func (j JWK) PublicKey() (crypto.PublicKey, error) {
+	switch j.KeyType {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(j.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA modulus: %w", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(j.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch j.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported EC curve: %s", j.Curve)
+		}
+		x, errX := base64.RawURLEncoding.DecodeString(j.X)
+		y, errY := base64.RawURLEncoding.DecodeString(j.Y)
+		if errX != nil || errY != nil {
+			return nil, errors.New("invalid EC coordinates")
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("EC point is not on curve")
+		}
+		return key, nil
+	case "OKP":
+		if j.Curve != "Ed25519" {
+			return nil, fmt.Errorf("unsupported OKP curve: %s", j.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 public key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type: %s", j.KeyType)
+	}
+}
+
+// keyRing 当前使用的签名密钥和可用于校验的全部密钥
+type keyRing struct {
+	mutex   sync.RWMutex
+	signing *SigningKey
+	verify  map[string]*SigningKey // 按 kid 索引，HS256 密钥的 kid 为空
+}
+
+var keys keyRing
+
+// SetKeys 替换签名密钥和校验密钥，signing 会自动加入校验密钥
+// 轮换后旧密钥应继续留在 verify 中，直到用它签发的 Token 全部过期
+func SetKeys(signing *SigningKey, verify []*SigningKey) {
+	ring := make(map[string]*SigningKey, len(verify)+1)
+	for _, key := range verify {
+		ring[key.ID] = key
+	}
+	ring[signing.ID] = signing
+
+	keys.mutex.Lock()
+	keys.signing = signing
+	keys.verify = ring
+	keys.mutex.Unlock()
+}
+
+// CurrentKeyID 返回当前签名密钥的 kid
+func CurrentKeyID() string {
+	keys.mutex.RLock()
+	defer keys.mutex.RUnlock()
+	if keys.signing == nil {
+		return ""
+	}
+	return keys.signing.ID
+}
+
+// PublicKeys 返回全部可用于校验的非对称公钥
+func PublicKeys() JWKSet {
+	keys.mutex.RLock()
+	defer keys.mutex.RUnlock()
+
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range keys.verify {
+		if IsAsymmetric(key.Algorithm) {
+			set.Keys = append(set.Keys, key.PublicJWK())
+		}
+	}
+	return set
+}
+
+// signToken 使用当前签名密钥签发 Token
+func signToken(claims jwt.Claims) (string, error) {
+	keys.mutex.RLock()
+	key := keys.signing
+	keys.mutex.RUnlock()
+	if key == nil {
+		return "", errors.New("JWT signing key not initialized")
+	}
+
+	token := jwt.NewWithClaims(key.method(), claims)
+	if key.ID != "" {
+		token.Header["kid"] = key.ID
+	}
+	return token.SignedString(key.private)
+}
+
+// verificationKey 根据 Token 头部的 kid 查找校验密钥，算法必须与密钥一致
+func verificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	keys.mutex.RLock()
+	key := keys.verify[kid]
+	keys.mutex.RUnlock()
+	if key == nil {
+		return nil, ErrUnknownSigningKey
+	}
+	if token.Method.Alg() != key.Algorithm {
+		return nil, errors.New("unexpected signing method")
+	}
+	return key.public, nil
+}
@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func TestJWKThumbprint(t *testing.T) {
+	// RFC 7638 第 3.1 节的示例
+	jwk := JWK{
+		KeyType: "RSA",
+		N:       "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+		E:       "AQAB",
+		KeyID:   "2011-04-29",
+		Use:     "sig",
+	}
+	thumbprint, err := jwk.Thumbprint()
+	if err != nil {
+		t.Fatalf("计算指纹失败: %v", err)
+	}
+	if thumbprint != "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs" {
+		t.Errorf("指纹不正确: %s", thumbprint)
+	}
+}
+
+func TestSigningKeyRoundTrip(t *testing.T) {
+	for _, algorithm := range []string{AlgorithmEdDSA, AlgorithmRS256} {
+		t.Run(algorithm, func(t *testing.T) {
+			key, err := GenerateSigningKey(algorithm)
+			if err != nil {
+				t.Fatalf("生成密钥失败: %v", err)
+			}
+			encoded, err := key.MarshalPrivateKey()
+			if err != nil {
+				t.Fatalf("导出私钥失败: %v", err)
+			}
+			parsed, err := ParseSigningKey(algorithm, encoded)
+			if err != nil {
+				t.Fatalf("解析私钥失败: %v", err)
+			}
+			if parsed.ID != key.ID {
+				t.Errorf("解析后的 kid 不一致: %s != %s", parsed.ID, key.ID)
+			}
+
+			other := AlgorithmRS256
+			if algorithm == AlgorithmRS256 {
+				other = AlgorithmEdDSA
+			}
+			if _, err := ParseSigningKey(other, encoded); err == nil {
+				t.Error("密钥类型与算法不一致时应该返回错误")
+			}
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	first, err := GenerateSigningKey(AlgorithmEdDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetKeys(first, nil)
+
+	userID := uuid.New()
+	oldToken, err := GenerateToken(userID, "alice", false, uuid.New())
+	if err != nil {
+		t.Fatalf("签发失败: %v", err)
+	}
+
+	// 轮换后旧密钥仍可校验，新 Token 使用新密钥
+	second, err := GenerateSigningKey(AlgorithmRS256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetKeys(second, []*SigningKey{first})
+	if CurrentKeyID() != second.ID {
+		t.Errorf("当前签名密钥应为 %s, 实际 %s", second.ID, CurrentKeyID())
+	}
+	if claims, err := ValidateToken(oldToken); err != nil || claims.UserID != userID {
+		t.Errorf("宽限期内旧 Token 应该有效: %v", err)
+	}
+	newToken, err := GenerateToken(userID, "alice", false, uuid.New())
+	if err != nil {
+		t.Fatalf("签发失败: %v", err)
+	}
+	parsed, _, err := jwt.NewParser().ParseUnverified(newToken, &Claims{})
+	if err != nil || parsed.Header["kid"] != second.ID || parsed.Method.Alg() != AlgorithmRS256 {
+		t.Errorf("新 Token 应使用新密钥签发, 头部 %v", parsed.Header)
+	}
+	if jwks := PublicKeys(); len(jwks.Keys) != 2 {
+		t.Errorf("JWKS 应包含 2 个公钥, 实际 %d", len(jwks.Keys))
+	}
+
+	// 宽限期结束后旧 Token 失效
+	SetKeys(second, nil)
+	if _, err := ValidateToken(oldToken); !errors.Is(err, ErrUnknownSigningKey) {
+		t.Errorf("旧密钥移除后应返回 ErrUnknownSigningKey, 实际 %v", err)
+	}
+}
+
+func TestRejectsAlgorithmConfusion(t *testing.T) {
+	key, err := GenerateSigningKey(AlgorithmRS256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetKeys(key, nil)
+
+	// 用公开的公钥作为 HS256 密钥伪造 Token
+	jwk := key.PublicJWK()
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+		UserID:           uuid.New(),
+		IsAdmin:          true,
+		RegisteredClaims: jwt.RegisteredClaims{Issuer: "anywebsites"},
+	})
+	forged.Header["kid"] = key.ID
+	signed, err := forged.SignedString([]byte(jwk.N))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateToken(signed); err == nil {
+		t.Error("算法与密钥不一致的 Token 应该被拒绝")
+	}
+}
+
+func TestCheckSecret(t *testing.T) {
+	for _, secret := range []string{"", "short", "your-super-secret-jwt-key", "your-super-secret-jwt-key-change-this-in-production"} {
+		if err := CheckSecret(secret); !errors.Is(err, ErrInsecureSecret) {
+			t.Errorf("%q 应该被拒绝", secret)
+		}
+	}
+	if err := CheckSecret("c2VjdXJlLXJhbmRvbS1zZWNyZXQtZm9yLXRlc3Rz"); err != nil {
+		t.Errorf("随机密钥应该可以使用: %v", err)
+	}
+}
@@ -0,0 +1,347 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// oidcMaxResponseSize 身份提供方响应的最大长度
+const oidcMaxResponseSize = 1 << 20
+
+// oidcClockSkew 校验 ID Token 时间时允许的时钟偏差
+const oidcClockSkew = time.Minute
+
+// oidcSigningMethods 接受的 ID Token 签名算法，不接受 none 和 HMAC
+var oidcSigningMethods = []string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+var (
+	ErrOIDCUnknownKey = errors.New("ID token signed with unknown key")
+	ErrOIDCNonce      = errors.New("ID token nonce mismatch")
+)
+
+// OIDCProvider 从 /.well-known/openid-configuration 读取的身份提供方元数据
+type OIDCProvider struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	TokenAuthMethods      []string `json:"token_endpoint_auth_methods_supported,omitempty"`
+}
+
+// OIDCClient 在身份提供方注册的客户端
+type OIDCClient struct {
+	ClientID     string
+	ClientSecret string // 公共客户端为空，只依靠 PKCE
+	RedirectURL  string
+	Scopes       []string
+}
+
+// OIDCTokenResponse 令牌端点的响应
+type OIDCTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	IDToken     string `json:"id_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// IDTokenClaims 校验通过的 ID Token 中登录需要的字段
+type IDTokenClaims struct {
+	Issuer            string
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+
+	raw jwt.MapClaims
+}
+
+// DiscoverOIDC 读取身份提供方元数据，文档中的 issuer 必须与配置的完全一致
+func DiscoverOIDC(ctx context.Context, client *http.Client, issuer string) (*OIDCProvider, error) {
+	endpoint := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+	var provider OIDCProvider
+	if err := getJSON(ctx, client, endpoint, &provider); err != nil {
+		return nil, fmt.Errorf("failed to discover OIDC provider: %w", err)
+	}
+	if provider.Issuer != issuer {
+		return nil, fmt.Errorf("OIDC issuer mismatch: expected %q, got %q", issuer, provider.Issuer)
+	}
+	if provider.AuthorizationEndpoint == "" || provider.TokenEndpoint == "" || provider.JWKSURI == "" {
+		return nil, errors.New("OIDC provider metadata is incomplete")
+	}
+	return &provider, nil
+}
+
+// FetchJWKS 读取身份提供方的签名公钥
+func FetchJWKS(ctx context.Context, client *http.Client, jwksURI string) (JWKSet, error) {
+	var set JWKSet
+	if err := getJSON(ctx, client, jwksURI, &set); err != nil {
+		return JWKSet{}, fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+	return set, nil
+}
+
+// GeneratePKCE 生成 RFC 7636 的 code_verifier 和 S256 code_challenge
+func GeneratePKCE() (verifier, challenge string, err error) {
+	verifier, err = randomURLToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	return verifier, pkceChallenge(verifier), nil
+}
+
+// pkceChallenge 计算 S256 code_challenge
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// RandomOIDCToken 生成 state 和 nonce 使用的随机值
+func RandomOIDCToken() (string, error) {
+	return randomURLToken(32)
+}
+
+// randomURLToken 生成 n 字节随机数的 base64url 编码
+func randomURLToken(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// AuthCodeURL 生成授权码流程的跳转地址
+func (p *OIDCProvider) AuthCodeURL(client OIDCClient, state, nonce, codeChallenge string) string {
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", client.ClientID)
+	query.Set("redirect_uri", client.RedirectURL)
+	query.Set("scope", strings.Join(client.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(p.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return p.AuthorizationEndpoint + separator + query.Encode()
+}
+
+// Exchange 用授权码和 code_verifier 换取令牌
+// 有客户端密钥时按身份提供方声明的方式认证，未声明时默认 client_secret_basic
+func (p *OIDCProvider) Exchange(ctx context.Context, httpClient *http.Client, client OIDCClient, code, verifier string) (*OIDCTokenResponse, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", client.RedirectURL)
+	form.Set("code_verifier", verifier)
+
+	basicAuth := client.ClientSecret != "" && p.supportsAuthMethod("client_secret_basic")
+	if !basicAuth {
+		form.Set("client_id", client.ClientID)
+		if client.ClientSecret != "" {
+			form.Set("client_secret", client.ClientSecret)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if basicAuth {
+		req.SetBasicAuth(url.QueryEscape(client.ClientID), url.QueryEscape(client.ClientSecret))
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, oidcMaxResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var oauthErr struct {
+			Error       string `json:"error"`
+			Description string `json:"error_description"`
+		}
+		if json.Unmarshal(body, &oauthErr) == nil && oauthErr.Error != "" {
+			return nil, fmt.Errorf("token request rejected: %s %s", oauthErr.Error, oauthErr.Description)
+		}
+		return nil, fmt.Errorf("token request failed with status %d", resp.StatusCode)
+	}
+
+	var tokens OIDCTokenResponse
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		return nil, fmt.Errorf("invalid token response: %w", err)
+	}
+	if tokens.IDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+	return &tokens, nil
+}
+
+// supportsAuthMethod 判断令牌端点是否支持指定的客户端认证方式，未声明时只支持 client_secret_basic
+func (p *OIDCProvider) supportsAuthMethod(method string) bool {
+	if len(p.TokenAuthMethods) == 0 {
+		return method == "client_secret_basic"
+	}
+	for _, supported := range p.TokenAuthMethods {
+		if supported == method {
+			return true
+		}
+	}
+	return false
+}
+
+// VerifyIDToken 校验 ID Token 的签名、issuer、audience、有效期和 nonce
+// 签名公钥按 kid 在 keys 中查找，找不到时返回 ErrOIDCUnknownKey，调用方可以刷新 JWKS 后重试
+func VerifyIDToken(raw string, keys JWKSet, issuer, clientID, nonce string) (*IDTokenClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		return oidcVerificationKey(token, keys)
+	},
+		jwt.WithValidMethods(oidcSigningMethods),
+		jwt.WithIssuer(issuer),
+		jwt.WithAudience(clientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(oidcClockSkew),
+	)
+	if err != nil {
+		if errors.Is(err, ErrOIDCUnknownKey) {
+			return nil, ErrOIDCUnknownKey
+		}
+		return nil, fmt.Errorf("invalid ID token: %w", err)
+	}
+
+	// 有多个 audience 时 azp 必须是本客户端
+	if audience, _ := claims.GetAudience(); len(audience) > 1 {
+		if azp, _ := claims["azp"].(string); azp != clientID {
+			return nil, errors.New("invalid ID token: authorized party mismatch")
+		}
+	}
+	if tokenNonce, _ := claims["nonce"].(string); nonce == "" || tokenNonce != nonce {
+		return nil, ErrOIDCNonce
+	}
+
+	result := &IDTokenClaims{Issuer: issuer, raw: claims}
+	result.Subject, _ = claims.GetSubject()
+	if result.Subject == "" {
+		return nil, errors.New("invalid ID token: missing subject")
+	}
+	result.Email, _ = claims["email"].(string)
+	result.Name, _ = claims["name"].(string)
+	result.PreferredUsername, _ = claims["preferred_username"].(string)
+	// 个别身份提供方把 email_verified 编码成字符串
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		result.EmailVerified = verified
+	case string:
+		result.EmailVerified = verified == "true"
+	}
+	return result, nil
+}
+
+// Groups 读取用户组 claim，支持字符串数组和单个字符串
+func (c *IDTokenClaims) Groups(claim string) []string {
+	switch value := c.raw[claim].(type) {
+	case string:
+		if value == "" {
+			return nil
+		}
+		return []string{value}
+	case []interface{}:
+		groups := make([]string, 0, len(value))
+		for _, item := range value {
+			if group, ok := item.(string); ok && group != "" {
+				groups = append(groups, group)
+			}
+		}
+		return groups
+	}
+	return nil
+}
+
+// oidcVerificationKey 按 kid 和算法在 JWKS 中查找公钥，没有 kid 时只允许 JWKS 中有唯一的密钥
+func oidcVerificationKey(token *jwt.Token, keys JWKSet) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	alg := token.Method.Alg()
+
+	var candidates []JWK
+	for _, key := range keys.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		if key.Algorithm != "" && key.Algorithm != alg {
+			continue
+		}
+		if kid == "" || key.KeyID == kid {
+			candidates = append(candidates, key)
+		}
+	}
+	if len(candidates) != 1 {
+		return nil, ErrOIDCUnknownKey
+	}
+
+	public, err := candidates[0].PublicKey()
+	if err != nil {
+		return nil, err
+	}
+	switch public.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") {
+			return nil, errors.New("key type does not match signing method")
+		}
+	case *ecdsa.PublicKey:
+		if !strings.HasPrefix(alg, "ES") {
+			return nil, errors.New("key type does not match signing method")
+		}
+	case ed25519.PublicKey:
+		if alg != "EdDSA" {
+			return nil, errors.New("key type does not match signing method")
+		}
+	}
+	return public, nil
+}
+
+// getJSON 读取 JSON 文档
+func getJSON(ctx context.Context, client *http.Client, endpoint string, target interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, endpoint)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, oidcMaxResponseSize)).Decode(target)
+}
@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestPKCEChallenge(t *testing.T) {
+	// RFC 7636 附录 B 的示例
+	if challenge := pkceChallenge("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"); challenge != "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM" {
+		t.Errorf("code_challenge 不正确: %s", challenge)
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	const issuer, clientID, nonce = "https://idp.example.com", "anywebsites", "n-0S6_WzA2Mj"
+
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := JWKSet{Keys: []JWK{{
+		KeyType: "EC",
+		KeyID:   "idp-key",
+		Use:     "sig",
+		Curve:   "P-256",
+		X:       base64.RawURLEncoding.EncodeToString(private.X.FillBytes(make([]byte, 32))),
+		Y:       base64.RawURLEncoding.EncodeToString(private.Y.FillBytes(make([]byte, 32))),
+	}}}
+
+	sign := func(claims jwt.MapClaims, kid string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(private)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	claims := func(override jwt.MapClaims) jwt.MapClaims {
+		now := time.Now()
+		base := jwt.MapClaims{
+			"iss":            issuer,
+			"aud":            clientID,
+			"sub":            "248289761001",
+			"iat":            now.Unix(),
+			"exp":            now.Add(time.Hour).Unix(),
+			"nonce":          nonce,
+			"email":          "alice@example.com",
+			"email_verified": "true",
+			"groups":         []string{"staff", "admins"},
+		}
+		for key, value := range override {
+			base[key] = value
+		}
+		return base
+	}
+
+	verified, err := VerifyIDToken(sign(claims(nil), "idp-key"), keys, issuer, clientID, nonce)
+	if err != nil {
+		t.Fatalf("合法的 ID Token 应该通过: %v", err)
+	}
+	if verified.Subject != "248289761001" || !verified.EmailVerified || len(verified.Groups("groups")) != 2 {
+		t.Errorf("解析的 claims 不正确: %+v %v", verified, verified.Groups("groups"))
+	}
+
+	if _, err := VerifyIDToken(sign(claims(nil), "rotated"), keys, issuer, clientID, nonce); !errors.Is(err, ErrOIDCUnknownKey) {
+		t.Errorf("未知 kid 应返回 ErrOIDCUnknownKey, 实际 %v", err)
+	}
+	if _, err := VerifyIDToken(sign(claims(nil), "idp-key"), keys, issuer, clientID, "other"); !errors.Is(err, ErrOIDCNonce) {
+		t.Errorf("nonce 不一致应返回 ErrOIDCNonce, 实际 %v", err)
+	}
+
+	invalid := map[string]jwt.MapClaims{
+		"其他客户端":         {"aud": "other-client"},
+		"其他 issuer":     {"iss": "https://evil.example.com"},
+		"已过期":           {"exp": time.Now().Add(-time.Hour).Unix()},
+		"缺少 sub":        {"sub": ""},
+		"多个 aud 缺少 azp": {"aud": []string{clientID, "other-client"}},
+	}
+	for name, override := range invalid {
+		if _, err := VerifyIDToken(sign(claims(override), "idp-key"), keys, issuer, clientID, nonce); err == nil {
+			t.Errorf("%s 的 ID Token 不应通过", name)
+		}
+	}
+
+	// 不接受 HMAC 签名，即使密钥恰好是公钥内容
+	hmacToken := jwt.NewWithClaims(jwt.SigningMethodHS256, claims(nil))
+	hmacToken.Header["kid"] = "idp-key"
+	signed, _ := hmacToken.SignedString([]byte(keys.Keys[0].X))
+	if _, err := VerifyIDToken(signed, keys, issuer, clientID, nonce); err == nil {
+		t.Error("HS256 签名的 ID Token 不应通过")
+	}
+}
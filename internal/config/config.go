@@ -4,20 +4,26 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
 
 // Config 应用配置结构
 type Config struct {
-	Database DatabaseConfig
-	Redis    RedisConfig
-	JWT      JWTConfig
-	Server   ServerConfig
-	Upload   UploadConfig
-	GeoIP    GeoIPConfig
-	Admin    AdminConfig
-	RateLimit RateLimitConfig
+	Database        DatabaseConfig
+	Redis           RedisConfig
+	JWT             JWTConfig
+	Server          ServerConfig
+	Upload          UploadConfig
+	GeoIP           GeoIPConfig
+	Admin           AdminConfig
+	RateLimit       RateLimitConfig
+	Domain          DomainConfig
+	Storage         StorageConfig
+	ContentSecurity ContentSecurityConfig
+	Analytics       AnalyticsConfig
 }
 
 // DatabaseConfig 数据库配置
@@ -39,13 +45,26 @@ type RedisConfig struct {
 
 // JWTConfig JWT 配置
 type JWTConfig struct {
+	// Algorithm 签名算法：EdDSA、RS256 或 HS256，非对称算法的密钥保存在数据库中并定期轮换
+	Algorithm string
+	// Secret HS256 共享密钥，只在 Algorithm 为 HS256 时使用
 	Secret string
+	// KeyRotationInterval 非对称签名密钥的轮换间隔
+	KeyRotationInterval time.Duration
+	// KeyGracePeriod 密钥轮换后继续用于校验的时间，不应短于刷新 Token 的有效期
+	KeyGracePeriod time.Duration
+	// KeyEncryptionKey 加密数据库中非对称签名私钥的密钥，base64 编码的 32 字节
+	KeyEncryptionKey string
 }
 
 // ServerConfig 服务器配置
 type ServerConfig struct {
 	Host string
 	Port string
+	// TrustedProxies 受信任的反向代理（CIDR、单个 IP 或 cloudflare），只有来自这些地址的请求才读取客户端 IP 转发头部
+	TrustedProxies []string
+	// TrustedProxyHeader 受信任代理转发客户端地址使用的头部：x-forwarded（X-Forwarded-For、X-Real-IP）或 forwarded（RFC 7239）
+	TrustedProxyHeader string
 }
 
 // UploadConfig 上传配置
@@ -57,7 +76,14 @@ type UploadConfig struct {
 
 // GeoIPConfig GeoIP 配置
 type GeoIPConfig struct {
+	// Provider 数据源类型：maxmind（MaxMind City 数据库）或 csv（离线 IP 段表）
+	Provider string
+	// DBPath 城市数据库或离线 IP 段表的路径
 	DBPath string
+	// ASNDBPath MaxMind ASN 数据库的路径，为空时不查询 ASN 和运营商
+	ASNDBPath string
+	// ReloadInterval 检查数据文件更新的间隔，文件变化后自动重新加载，0 表示不检查
+	ReloadInterval time.Duration
 }
 
 // AdminConfig 管理员配置
@@ -70,6 +96,70 @@ type AdminConfig struct {
 type RateLimitConfig struct {
 	Requests int
 	Window   int
+
+	// 登录接口按客户端 IP 限流，防止暴力猜测密码和两步验证码
+	LoginRequests int
+	LoginWindow   int
+
+	// 私有内容的访问码按客户端 IP 和内容限流，防止暴力猜测访问码
+	AccessCodeRequests int
+	AccessCodeWindow   int
+}
+
+// DomainConfig 域名配置
+type DomainConfig struct {
+	// PrimaryHosts 平台自身的域名，其余 Host 按自定义域名处理
+	PrimaryHosts []string
+}
+
+// StorageConfig 内容正文存储配置
+type StorageConfig struct {
+	// Backend 存储后端：local（UploadConfig.Path 下的本地目录）、s3 或 database（保存在 contents 表中）
+	Backend     string
+	S3Endpoint  string
+	S3Bucket    string
+	S3Region    string
+	S3AccessKey string
+	S3SecretKey string
+	// S3PathStyle 使用 endpoint/bucket/key 形式的地址，MinIO 等兼容服务通常需要开启
+	S3PathStyle bool
+}
+
+// ContentSecurityConfig 用户内容的安全配置
+type ContentSecurityConfig struct {
+	// SanitizeHTML 上传和更新内容时按计划的 HTML 策略清理正文
+	SanitizeHTML bool
+	// CSP 内容页的 Content-Security-Policy，默认以 sandbox 把页面隔离到独立的源
+	CSP string
+	// ContentOrigin 单独的内容域名（如 https://usercontent.example.com），设置后 /view 请求只在该域名上提供
+	ContentOrigin string
+}
+
+// defaultContentCSP 内容页默认的 CSP：页面可以运行脚本，但不能访问平台的 Cookie 和存储，也不能被嵌入其他页面
+const defaultContentCSP = "sandbox allow-scripts allow-forms allow-popups allow-popups-to-escape-sandbox allow-modals allow-downloads; " +
+	"base-uri 'none'; frame-ancestors 'none'"
+
+// 访问记录中 IP 地址的保存方式
+const (
+	IPStorageFull     = "full"     // 保存完整 IP
+	IPStorageTruncate = "truncate" // 只保存 IPv4 的 /24 或 IPv6 的 /48 网段
+	IPStorageNone     = "none"     // 不保存 IP，只保存按天加盐的访客标识
+)
+
+// AnalyticsConfig 访问统计写入管道配置
+type AnalyticsConfig struct {
+	// BufferSize 内存缓冲区能容纳的访问事件数，写满后新事件被丢弃
+	BufferSize int
+	// Workers 批量写入数据库的 worker 数量
+	Workers int
+	// BatchSize 单次插入的最大行数，缓冲区攒够一批时立即写入
+	BatchSize int
+	// FlushInterval 不足一批时的最长等待时间
+	FlushInterval time.Duration
+	// RollupInterval 把原始访问记录汇总到按天统计表的间隔
+	RollupInterval time.Duration
+	// IPStorage 访问记录中 IP 地址的保存方式，地理位置在处理前解析
+	IPStorage string
 }
 
 // Load 加载配置
@@ -94,11 +184,19 @@ func Load() *Config {
 			Password: getEnv("REDIS_PASSWORD", ""),
 		},
 		JWT: JWTConfig{
-			Secret: getEnv("JWT_SECRET", "your-super-secret-jwt-key"),
+			Algorithm:           getEnv("JWT_ALGORITHM", "EdDSA"),
+			Secret:              getEnv("JWT_SECRET", ""),
+			KeyRotationInterval: time.Duration(getEnvAsInt("JWT_KEY_ROTATION_DAYS", 30)) * 24 * time.Hour,
+			KeyGracePeriod:      time.Duration(getEnvAsInt("JWT_KEY_GRACE_DAYS", 7)) * 24 * time.Hour,
+			KeyEncryptionKey:    getEnv("JWT_KEY_ENCRYPTION_KEY", ""),
 		},
 		Server: ServerConfig{
 			Host: getEnv("SERVER_HOST", "0.0.0.0"),
 			Port: getEnv("SERVER_PORT", "8080"),
+			TrustedProxies: getEnvAsSlice("TRUSTED_PROXIES", []string{
+				"127.0.0.0/8", "::1/128", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7",
+			}),
+			TrustedProxyHeader: getEnv("TRUSTED_PROXY_HEADER", "x-forwarded"),
 		},
 		Upload: UploadConfig{
 			Path:            getEnv("UPLOAD_PATH", "./uploads"),
@@ -106,7 +204,10 @@ func Load() *Config {
 			CleanupInterval: getEnvAsInt("CLEANUP_INTERVAL", 3600),    // 1 hour
 		},
 		GeoIP: GeoIPConfig{
-			DBPath: getEnv("GEOIP_DB_PATH", "./data/GeoLite2-City.mmdb"),
+			Provider:       getEnv("GEOIP_PROVIDER", "maxmind"),
+			DBPath:         getEnv("GEOIP_DB_PATH", "./data/geoip/GeoLite2-City.mmdb"),
+			ASNDBPath:      getEnv("GEOIP_ASN_DB_PATH", ""),
+			ReloadInterval: time.Duration(getEnvAsInt("GEOIP_RELOAD_INTERVAL_SECONDS", 60)) * time.Second,
 		},
 		Admin: AdminConfig{
 			Username: getEnv("ADMIN_USERNAME", "admin"),
@@ -115,6 +216,37 @@ func Load() *Config {
 		RateLimit: RateLimitConfig{
 			Requests: getEnvAsInt("RATE_LIMIT_REQUESTS", 100),
 			Window:   getEnvAsInt("RATE_LIMIT_WINDOW", 3600),
+
+			LoginRequests: getEnvAsInt("LOGIN_RATE_LIMIT_REQUESTS", 20),
+			LoginWindow:   getEnvAsInt("LOGIN_RATE_LIMIT_WINDOW", 900),
+
+			AccessCodeRequests: getEnvAsInt("ACCESS_CODE_RATE_LIMIT_REQUESTS", 10),
+			AccessCodeWindow:   getEnvAsInt("ACCESS_CODE_RATE_LIMIT_WINDOW", 900),
+		},
+		Domain: DomainConfig{
+			PrimaryHosts: getEnvAsSlice("PRIMARY_HOSTS", []string{"localhost", "anywebsites.gslb.vip"}),
+		},
+		Storage: StorageConfig{
+			Backend:     getEnv("STORAGE_BACKEND", "local"),
+			S3Endpoint:  getEnv("S3_ENDPOINT", ""),
+			S3Bucket:    getEnv("S3_BUCKET", ""),
+			S3Region:    getEnv("S3_REGION", "us-east-1"),
+			S3AccessKey: getEnv("S3_ACCESS_KEY", ""),
+			S3SecretKey: getEnv("S3_SECRET_KEY", ""),
+			S3PathStyle: getEnvAsBool("S3_PATH_STYLE", true),
+		},
+		ContentSecurity: ContentSecurityConfig{
+			SanitizeHTML:  getEnvAsBool("HTML_SANITIZE", false),
+			CSP:           getEnv("CONTENT_CSP", defaultContentCSP),
+			ContentOrigin: strings.TrimSuffix(getEnv("CONTENT_ORIGIN", ""), "/"),
+		},
+		Analytics: AnalyticsConfig{
+			BufferSize:     getEnvAsInt("ANALYTICS_BUFFER_SIZE", 10000),
+			Workers:        getEnvAsInt("ANALYTICS_WORKERS", 2),
+			BatchSize:      getEnvAsInt("ANALYTICS_BATCH_SIZE", 500),
+			FlushInterval:  time.Duration(getEnvAsInt("ANALYTICS_FLUSH_INTERVAL_MS", 1000)) * time.Millisecond,
+			RollupInterval: time.Duration(getEnvAsInt("ANALYTICS_ROLLUP_INTERVAL_MINUTES", 5)) * time.Minute,
+			IPStorage:      getEnv("ANALYTICS_IP_STORAGE", IPStorageFull),
 		},
 	}
 }
@@ -146,3 +278,28 @@ func getEnvAsInt64(key string, defaultValue int64) int64 {
 	}
 	return defaultValue
 }
+
+// getEnvAsBool 获取环境变量并转换为布尔值
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
+
+// getEnvAsSlice 获取以逗号分隔的环境变量列表
+func getEnvAsSlice(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
@@ -8,7 +8,6 @@ import (
 	"anywebsites/internal/config"
 	"anywebsites/internal/models"
 
-	"github.com/google/uuid"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
@@ -170,6 +169,13 @@ func InitializeSystemSettings() error {
 			Icon:        "bi-gear",
 			SortOrder:   6,
 		},
+		{
+			Name:        "analytics",
+			DisplayName: "访问统计设置",
+			Description: "访问统计汇总和原始记录保留策略",
+			Icon:        "bi-graph-up",
+			SortOrder:   7,
+		},
 	}
 
 	// 创建分类（如果不存在）
@@ -224,18 +230,10 @@ func InitializeDefaultAdmins() error {
 					continue
 				}
 
-				// 生成API密钥
-				apiKey, err := generateAPIKey()
-				if err != nil {
-					log.Printf("Failed to generate API key for user %s: %v", admin.Username, err)
-					continue
-				}
-
 				newUser := models.User{
 					Username: admin.Username,
 					Email:    admin.Email,
 					Password: hashedPassword,
-					APIKey:   apiKey,
 					IsActive: true,
 					IsAdmin:  true,
 				}
@@ -277,9 +275,3 @@ func hashPassword(password string) (string, error) {
 	// 使用 auth 包中的 HashPassword 函数
 	return auth.HashPassword(password)
 }
-
-// generateAPIKey 生成API密钥
-func generateAPIKey() (string, error) {
-	// 生成UUID并取前32个字符作为API密钥
-	return uuid.New().String()[:32], nil
-}
@@ -3,13 +3,14 @@ package middleware
 import (
 	"net/http"
 
-	"anywebsites/internal/auth"
+	"anywebsites/internal/services"
 
 	"github.com/gin-gonic/gin"
 )
 
-// AdminAuthMiddleware 管理后台认证中间件
+// AdminAuthMiddleware 管理后台认证中间件，会话已吊销或用户已禁用时需要重新登录
 func AdminAuthMiddleware() gin.HandlerFunc {
+	sessionService := services.NewSessionService()
 	return func(c *gin.Context) {
 		// 从 Cookie 获取 Token
 		token, err := c.Cookie("admin_token")
@@ -19,19 +20,13 @@ func AdminAuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		// 验证 Token
-		claims, err := auth.ValidateToken(token)
-		if err != nil {
+		// 验证 Token 和会话，并将用户信息存储到上下文中
+		if err := authenticateToken(c, sessionService, token); err != nil {
 			c.SetCookie("admin_token", "", -1, "/admin", "", false, true)
 			c.Redirect(http.StatusFound, "/admin/login")
 			c.Abort()
 			return
 		}
-
-		// 将用户信息存储到上下文中
-		c.Set("user_id", claims.UserID)
-		c.Set("username", claims.Username)
-		c.Set("is_admin", claims.IsAdmin)
 		c.Next()
 	}
 }
@@ -1,19 +1,21 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 
 	"anywebsites/internal/auth"
-	"anywebsites/internal/database"
 	"anywebsites/internal/models"
+	"anywebsites/internal/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 )
 
-// AuthMiddleware JWT 认证中间件
+// AuthMiddleware JWT 认证中间件，Token 所属的会话已吊销或用户已禁用时拒绝请求
 func AuthMiddleware() gin.HandlerFunc {
+	sessionService := services.NewSessionService()
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -31,52 +33,155 @@ func AuthMiddleware() gin.HandlerFunc {
 		}
 
 		token := tokenParts[1]
-		claims, err := auth.ValidateToken(token)
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		if err := authenticateToken(c, sessionService, token); err != nil {
+			switch {
+			case errors.Is(err, services.ErrSessionRevoked):
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Session revoked or user inactive"})
+			case errors.Is(err, errInvalidToken):
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify session"})
+			}
 			c.Abort()
 			return
 		}
-
-		// 将用户信息存储到上下文中
-		c.Set("user_id", claims.UserID)
-		c.Set("username", claims.Username)
-		c.Set("is_admin", claims.IsAdmin)
 		c.Next()
 	}
 }
 
-// APIKeyMiddleware API Key 认证中间件
-func APIKeyMiddleware() gin.HandlerFunc {
+// OptionalAuthMiddleware 可选认证中间件，携带有效 Token 时写入用户信息，否则按匿名访问继续
+func OptionalAuthMiddleware() gin.HandlerFunc {
+	sessionService := services.NewSessionService()
 	return func(c *gin.Context) {
-		apiKey := c.GetHeader("X-API-Key")
-		if apiKey == "" {
-			// 尝试从查询参数获取
-			apiKey = c.Query("api_key")
+		tokenParts := strings.Split(c.GetHeader("Authorization"), " ")
+		if len(tokenParts) == 2 && tokenParts[0] == "Bearer" {
+			authenticateToken(c, sessionService, tokenParts[1])
 		}
+		c.Next()
+	}
+}
+
+// errInvalidToken Token 签名、格式或有效期校验失败
+var errInvalidToken = errors.New("invalid token")
 
+// authenticateToken 验证访问 Token 并检查所属会话，成功时将用户的最新信息存储到上下文中
+func authenticateToken(c *gin.Context, sessionService *services.SessionService, token string) error {
+	claims, err := auth.ValidateToken(token)
+	if err != nil {
+		return errInvalidToken
+	}
+
+	user, err := sessionService.Validate(claims)
+	if err != nil {
+		return err
+	}
+
+	c.Set("user_id", user.ID)
+	c.Set("username", user.Username)
+	c.Set("is_admin", user.IsAdmin)
+	c.Set("session_id", claims.SessionID)
+	return nil
+}
+
+// APIKeyMiddleware API Key 认证中间件，按请求方法校验密钥的权限范围
+func APIKeyMiddleware(apiKeyService *services.APIKeyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		apiKey := getAPIKey(c)
 		if apiKey == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "API key required"})
 			c.Abort()
 			return
 		}
 
-		// 验证 API Key
-		var user models.User
-		if err := database.DB.Where("api_key = ? AND is_active = ?", apiKey, true).First(&user).Error; err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+		if !authenticateAPIKey(c, apiKeyService, apiKey) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// APIAuthMiddleware API 认证中间件，接受 Bearer JWT 或 X-API-Key 任意一种方式
+func APIAuthMiddleware(apiKeyService *services.APIKeyService) gin.HandlerFunc {
+	jwtAuth := AuthMiddleware()
+	return func(c *gin.Context) {
+		// 优先使用 Authorization 头
+		if c.GetHeader("Authorization") != "" {
+			jwtAuth(c)
+			return
+		}
+
+		apiKey := getAPIKey(c)
+		if apiKey == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header or API key required"})
 			c.Abort()
 			return
 		}
 
-		// 将用户信息存储到上下文中
-		c.Set("user_id", user.ID)
-		c.Set("username", user.Username)
-		c.Set("is_admin", user.IsAdmin)
+		if !authenticateAPIKey(c, apiKeyService, apiKey) {
+			return
+		}
 		c.Next()
 	}
 }
 
+// OptionalAPIAuthMiddleware 可选 API 认证中间件，未携带任何凭据时按匿名访问继续，携带无效凭据时拒绝请求
+func OptionalAPIAuthMiddleware(apiKeyService *services.APIKeyService) gin.HandlerFunc {
+	apiAuth := APIAuthMiddleware(apiKeyService)
+	return func(c *gin.Context) {
+		if c.GetHeader("Authorization") == "" && getAPIKey(c) == "" {
+			c.Next()
+			return
+		}
+		apiAuth(c)
+	}
+}
+
+// getAPIKey 从请求头或查询参数获取 API Key
+func getAPIKey(c *gin.Context) string {
+	apiKey := c.GetHeader("X-API-Key")
+	if apiKey == "" {
+		// 尝试从查询参数获取
+		apiKey = c.Query("api_key")
+	}
+	return apiKey
+}
+
+// authenticateAPIKey 验证 API Key 和权限范围，失败时写入响应并中止请求
+func authenticateAPIKey(c *gin.Context, apiKeyService *services.APIKeyService, apiKey string) bool {
+	key, user, err := apiKeyService.Authenticate(apiKey)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+		c.Abort()
+		return false
+	}
+
+	scope := requiredScope(c.Request.Method)
+	if !key.HasScope(scope) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API key does not have the " + string(scope) + " scope"})
+		c.Abort()
+		return false
+	}
+
+	// 将用户信息存储到上下文中
+	c.Set("user_id", user.ID)
+	c.Set("username", user.Username)
+	c.Set("is_admin", user.IsAdmin)
+	c.Set("api_key_id", key.ID)
+	return true
+}
+
+// requiredScope 根据请求方法确定需要的权限范围
+func requiredScope(method string) models.APIKeyScope {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return models.ScopeRead
+	case http.MethodDelete:
+		return models.ScopeDelete
+	default:
+		return models.ScopeWrite
+	}
+}
+
 // AdminMiddleware 管理员权限中间件
 func AdminMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -99,6 +204,15 @@ func GetUserID(c *gin.Context) (uuid.UUID, bool) {
 	return userID.(uuid.UUID), true
 }
 
+// GetSessionID 从上下文获取当前会话 ID，使用 API Key 认证时不存在
+func GetSessionID(c *gin.Context) (uuid.UUID, bool) {
+	sessionID, exists := c.Get("session_id")
+	if !exists {
+		return uuid.Nil, false
+	}
+	return sessionID.(uuid.UUID), true
+}
+
 // GetUsername 从上下文获取用户名
 func GetUsername(c *gin.Context) (string, bool) {
 	username, exists := c.Get("username")
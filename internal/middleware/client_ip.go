@@ -0,0 +1,17 @@
+package middleware
+
+import (
+	"anywebsites/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ClientIPMiddleware 按受信任代理配置解析客户端 IP 和是否经过 HTTPS 并写入上下文，
+// 处理函数通过 utils.GetRealClientIP、utils.IsSecureRequest 读取
+func ClientIPMiddleware(resolver *utils.ClientIPResolver) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(utils.ClientIPKey, resolver.ClientIP(c.Request))
+		c.Set(utils.SecureRequestKey, resolver.IsSecure(c.Request))
+		c.Next()
+	}
+}
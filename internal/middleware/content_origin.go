@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ContentOriginHost 返回内容域名的主机名（不含端口），origin 为空或无效时返回空字符串
+func ContentOriginHost(origin string) string {
+	if origin == "" {
+		return ""
+	}
+	parsed, err := url.Parse(origin)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(parsed.Hostname())
+}
+
+// ContentOriginMiddleware 把用户内容和平台隔离到不同的源
+// 平台域名上的 /view 请求重定向到内容域名，内容域名上只提供 /view 和错误页使用的 /static；origin 为空时不做处理
+func ContentOriginMiddleware(origin string) gin.HandlerFunc {
+	contentHost := ContentOriginHost(origin)
+
+	return func(c *gin.Context) {
+		// 自定义域名本身就是独立的源
+		if contentHost == "" || IsCustomDomain(c) {
+			c.Next()
+			return
+		}
+
+		host := strings.ToLower(c.Request.Host)
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		isView := strings.HasPrefix(c.Request.URL.Path, "/view/")
+
+		if host == contentHost {
+			if !isView && !strings.HasPrefix(c.Request.URL.Path, "/static/") {
+				c.AbortWithStatus(http.StatusNotFound)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		if isView {
+			// 非 GET 请求使用 307 保留请求方法和表单内容
+			status := http.StatusFound
+			if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+				status = http.StatusTemporaryRedirect
+			}
+			c.Redirect(status, origin+c.Request.URL.RequestURI())
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
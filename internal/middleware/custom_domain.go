@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+
+	"anywebsites/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// customDomainKey 请求上下文中标记自定义域名请求的键
+type customDomainKey struct{}
+
+// DomainResolver 根据 Host 查找已验证的自定义域名
+type DomainResolver interface {
+	ResolveHost(host string) (*models.CustomDomain, error)
+}
+
+// CustomDomainMiddleware 自定义域名中间件，将绑定域名的请求改写到对应内容的 /view 路由
+// primaryHosts 为平台自身的域名，这些 Host 上的请求不做处理
+func CustomDomainMiddleware(engine *gin.Engine, resolver DomainResolver, primaryHosts []string) gin.HandlerFunc {
+	primary := make(map[string]bool, len(primaryHosts))
+	for _, host := range primaryHosts {
+		primary[strings.ToLower(strings.TrimSpace(host))] = true
+	}
+
+	return func(c *gin.Context) {
+		// 已改写过的请求直接放行
+		if IsCustomDomain(c) {
+			c.Next()
+			return
+		}
+
+		host := strings.ToLower(c.Request.Host)
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if host == "" || primary[host] || net.ParseIP(host) != nil {
+			c.Next()
+			return
+		}
+
+		customDomain, err := resolver.ResolveHost(host)
+		if err != nil || customDomain.Content == nil {
+			c.Next()
+			return
+		}
+
+		// 改写路径：根路径展示绑定的内容，其余路径作为站点包中的文件
+		base := "/view/" + customDomain.Content.ID.String()
+		requestPath := c.Request.URL.Path
+		switch {
+		case requestPath == "/" && customDomain.Content.IsBundle() && c.Request.Method != http.MethodPost:
+			requestPath = base + "/"
+		case requestPath == "/":
+			requestPath = base
+		default:
+			requestPath = base + requestPath
+		}
+
+		c.Request.URL.Path = requestPath
+		c.Request.URL.RawPath = ""
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), customDomainKey{}, true))
+		engine.HandleContext(c)
+		c.Abort()
+	}
+}
+
+// IsCustomDomain 判断当前请求是否来自自定义域名
+func IsCustomDomain(c *gin.Context) bool {
+	custom, _ := c.Request.Context().Value(customDomainKey{}).(bool)
+	return custom
+}
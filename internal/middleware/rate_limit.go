@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"anywebsites/internal/services"
+	"anywebsites/internal/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimitMiddleware 按用户计划限制每小时的 API 调用次数，需挂载在认证中间件之后
+func RateLimitMiddleware(limiter *services.RateLimitService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, exists := GetUserID(c)
+		if !exists {
+			c.Next()
+			return
+		}
+
+		result, err := limiter.Allow(userID)
+		if err != nil {
+			// 限流存储不可用时放行，避免影响正常请求
+			log.Printf("Rate limit check failed for %s: %v", userID, err)
+			c.Next()
+			return
+		}
+
+		if result != nil {
+			c.Header("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+			c.Header("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+
+			if !result.Allowed {
+				c.Header("Retry-After", strconv.Itoa(int(math.Ceil(result.RetryAfter.Seconds()))))
+				c.JSON(http.StatusTooManyRequests, gin.H{"error": "API rate limit exceeded"})
+				c.Abort()
+				return
+			}
+		}
+
+		limiter.RecordAPICall(userID)
+		c.Next()
+	}
+}
+
+// IPRateLimitMiddleware 按客户端 IP 限制未认证接口（如登录）的请求频率，scope 区分不同接口的计数
+func IPRateLimitMiddleware(store services.RateLimitStore, scope string, limit int, window time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		result, err := store.Allow(scope+":"+utils.GetRealClientIP(c), limit, window, time.Now())
+		if err != nil {
+			log.Printf("Rate limit check failed for %s: %v", scope, err)
+			c.Next()
+			return
+		}
+
+		if !result.Allowed {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(result.RetryAfter.Seconds()))))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests, please try again later"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
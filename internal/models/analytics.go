@@ -14,10 +14,23 @@ type ContentAnalytics struct {
 	UserID    uuid.UUID `json:"user_id" gorm:"type:uuid;not null;index"`
 
 	// 访问信息
-	IPAddress string `json:"ip_address" gorm:"size:45;index"` // 支持 IPv6
+	IPAddress string `json:"ip_address" gorm:"size:45;index"` // 支持 IPv6，按 ANALYTICS_IP_STORAGE 可能被截断或为空
+	VisitorID string `json:"visitor_id" gorm:"size:32"`       // IP 和 User-Agent 加当天盐值的哈希
 	UserAgent string `json:"user_agent" gorm:"size:500"`
 	Referer   string `json:"referer" gorm:"size:500"`
 
+	// 来源分类和访问链接中的 UTM 参数
+	RefererCategory string `json:"referer_category" gorm:"size:20"`
+	UTMSource       string `json:"utm_source" gorm:"column:utm_source;size:100"`
+	UTMMedium       string `json:"utm_medium" gorm:"column:utm_medium;size:100"`
+	UTMCampaign     string `json:"utm_campaign" gorm:"column:utm_campaign;size:100"`
+
+	// 由 User-Agent 解析的终端信息
+	Browser    string `json:"browser" gorm:"size:50"`
+	OS         string `json:"os" gorm:"column:os;size:50"`
+	DeviceType string `json:"device_type" gorm:"size:20"`
+	IsBot      bool   `json:"is_bot"`
+
 	// 地理位置信息
 	Country   string  `json:"country" gorm:"size:100"`
 	Region    string  `json:"region" gorm:"size:100"`
@@ -41,7 +54,94 @@ func (ca *ContentAnalytics) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
-// TrafficStats 流量统计结构
+// 设备类型，由 User-Agent 判断
+const (
+	DeviceClassDesktop = "desktop"
+	DeviceClassMobile  = "mobile"
+	DeviceClassTablet  = "tablet"
+	DeviceClassBot     = "bot"
+	DeviceClassUnknown = "unknown"
+)
+
+// 来源分类，由来源 URL 的域名判断
+const (
+	RefererCategoryDirect   = "direct"   // 没有来源，直接访问
+	RefererCategorySearch   = "search"   // 搜索引擎
+	RefererCategorySocial   = "social"   // 社交网络
+	RefererCategoryInternal = "internal" // 平台自身或内容绑定的域名
+	RefererCategoryReferral = "referral" // 其他网站
+)
+
+// AnalyticsDaily 每个内容每天的访问汇总
+type AnalyticsDaily struct {
+	ContentID uuid.UUID `json:"content_id" gorm:"type:uuid;primaryKey"`
+	Day       time.Time `json:"day" gorm:"type:date;primaryKey"`
+	UserID    uuid.UUID `json:"user_id" gorm:"type:uuid;not null;index"`
+	Views     int64     `json:"views"`
+	UniqueIPs int64     `json:"unique_ips" gorm:"column:unique_ips"` // 当天的独立访客数
+	// VisitorSketch 当天访客的 HyperLogLog 草图，用于估算跨天的独立访客数
+	VisitorSketch []byte    `json:"-"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (AnalyticsDaily) TableName() string {
+	return "analytics_daily"
+}
+
+// AnalyticsDailyBreakdown 每个内容每天按地区、来源域名、设备类型、浏览器和操作系统拆分的访问量
+type AnalyticsDailyBreakdown struct {
+	ContentID       uuid.UUID `json:"content_id" gorm:"type:uuid;primaryKey"`
+	Day             time.Time `json:"day" gorm:"type:date;primaryKey"`
+	UserID          uuid.UUID `json:"user_id" gorm:"type:uuid;not null"`
+	Country         string    `json:"country" gorm:"size:100;primaryKey"`
+	Region          string    `json:"region" gorm:"size:100;primaryKey"`
+	City            string    `json:"city" gorm:"size:100;primaryKey"`
+	RefererHost     string    `json:"referer_host" gorm:"size:255;primaryKey"`
+	RefererCategory string    `json:"referer_category" gorm:"size:20;primaryKey"` // 同一来源域名在不同访问中可能分别为站内和站外
+	DeviceClass     string    `json:"device_class" gorm:"size:20;primaryKey"`
+	Browser         string    `json:"browser" gorm:"size:50;primaryKey"`
+	OS              string    `json:"os" gorm:"column:os;size:50;primaryKey"`
+	Views           int64     `json:"views"`
+}
+
+// TableName 指定表名
+func (AnalyticsDailyBreakdown) TableName() string {
+	return "analytics_daily_breakdowns"
+}
+
+// AnalyticsDailyCampaign 每个内容每天按 UTM 参数拆分的访问量，只包含带有 UTM 参数的访问
+type AnalyticsDailyCampaign struct {
+	ContentID   uuid.UUID `json:"content_id" gorm:"type:uuid;primaryKey"`
+	Day         time.Time `json:"day" gorm:"type:date;primaryKey"`
+	UserID      uuid.UUID `json:"user_id" gorm:"type:uuid;not null"`
+	UTMSource   string    `json:"utm_source" gorm:"column:utm_source;size:100;primaryKey"`
+	UTMMedium   string    `json:"utm_medium" gorm:"column:utm_medium;size:100;primaryKey"`
+	UTMCampaign string    `json:"utm_campaign" gorm:"column:utm_campaign;size:100;primaryKey"`
+	Views       int64     `json:"views"`
+}
+
+// TableName 指定表名
+func (AnalyticsDailyCampaign) TableName() string {
+	return "analytics_daily_campaigns"
+}
+
+// AnalyticsDailyTotal 全站每天的访问汇总
+type AnalyticsDailyTotal struct {
+	Day       time.Time `json:"day" gorm:"type:date;primaryKey"`
+	Views     int64     `json:"views"`
+	UniqueIPs int64     `json:"unique_ips" gorm:"column:unique_ips"` // 当天的独立访客数
+	// VisitorSketch 当天访客的 HyperLogLog 草图，用于估算跨天的独立访客数
+	VisitorSketch []byte    `json:"-"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// TableName 指定表名
+func (AnalyticsDailyTotal) TableName() string {
+	return "analytics_daily_totals"
+}
+
+// TrafficStats 流量统计结构，UniqueIPs 为按访客标识去重的独立访客数
 type TrafficStats struct {
 	Date      string `json:"date"`
 	Views     int64  `json:"views"`
@@ -62,12 +162,70 @@ type CountryStats struct {
 	Count   int64  `json:"count"`
 }
 
-// RefererStats 来源统计结构
+// RefererStats 来源统计结构，Referer 为来源域名
 type RefererStats struct {
 	Referer string `json:"referer"`
 	Count   int64  `json:"count"`
 }
 
+// RefererCategoryStats 来源分类统计结构
+type RefererCategoryStats struct {
+	Category string `json:"category" gorm:"column:referer_category"`
+	Count    int64  `json:"count"`
+}
+
+// CampaignStats UTM 推广活动统计结构
+type CampaignStats struct {
+	Source   string `json:"utm_source" gorm:"column:utm_source"`
+	Medium   string `json:"utm_medium" gorm:"column:utm_medium"`
+	Campaign string `json:"utm_campaign" gorm:"column:utm_campaign"`
+	Count    int64  `json:"count"`
+}
+
+// DeviceStats 设备类型统计结构
+type DeviceStats struct {
+	DeviceClass string `json:"device_class"`
+	Count       int64  `json:"count"`
+}
+
+// BrowserStats 浏览器统计结构
+type BrowserStats struct {
+	Browser string `json:"browser"`
+	Count   int64  `json:"count"`
+}
+
+// OSStats 操作系统统计结构
+type OSStats struct {
+	OS    string `json:"os" gorm:"column:os"`
+	Count int64  `json:"count"`
+}
+
+// PageStats 页面访问排行
+type PageStats struct {
+	ContentID uuid.UUID `json:"content_id"`
+	Title     string    `json:"title"`
+	Views     int64     `json:"views"`
+}
+
+// OwnerAnalyticsReport 用户自己内容的访问统计，From 和 To 为包含在内的日期
+type OwnerAnalyticsReport struct {
+	From        string               `json:"from"`
+	To          string               `json:"to"`
+	Granularity AnalyticsGranularity `json:"granularity"`
+	TotalViews  int64                `json:"total_views"`
+	// UniqueVisitors 整个时间范围内的独立访客数，由每天的草图合并估算
+	UniqueVisitors    int64                  `json:"unique_visitors"`
+	Traffic           []TrafficStats         `json:"traffic"`
+	Countries         []CountryStats         `json:"countries"`
+	Referers          []RefererStats         `json:"referers"`
+	RefererCategories []RefererCategoryStats `json:"referer_categories"`
+	Campaigns         []CampaignStats        `json:"campaigns"`
+	Devices           []DeviceStats          `json:"devices"`
+	Browsers          []BrowserStats         `json:"browsers"`
+	OSes              []OSStats              `json:"operating_systems"`
+	TopPages          []PageStats            `json:"top_pages,omitempty"`
+}
+
 // OverviewStats 总览统计结构
 type OverviewStats struct {
 	TotalViews     int64 `json:"total_views"`
@@ -76,3 +234,60 @@ type OverviewStats struct {
 	TodayViews     int64 `json:"today_views"`
 	UniqueVisitors int64 `json:"unique_visitors"`
 }
+
+// AnalyticsExportType 访问数据导出的类型
+type AnalyticsExportType string
+
+const (
+	AnalyticsExportRaw   AnalyticsExportType = "raw"   // 原始访问记录
+	AnalyticsExportDaily AnalyticsExportType = "daily" // 按天汇总的访问量
+)
+
+// AnalyticsExportFormat 访问数据导出的文件格式
+type AnalyticsExportFormat string
+
+const (
+	AnalyticsExportCSV    AnalyticsExportFormat = "csv"
+	AnalyticsExportNDJSON AnalyticsExportFormat = "ndjson" // 每行一个 JSON 对象
+)
+
+// RawAnalyticsExportRow 原始访问记录的导出行
+type RawAnalyticsExportRow struct {
+	AccessTime      time.Time `json:"access_time"`
+	ContentID       uuid.UUID `json:"content_id"`
+	UserID          uuid.UUID `json:"user_id"`
+	IPAddress       string    `json:"ip_address"`
+	VisitorID       string    `json:"visitor_id"`
+	Country         string    `json:"country"`
+	Region          string    `json:"region"`
+	City            string    `json:"city"`
+	Latitude        float64   `json:"latitude"`
+	Longitude       float64   `json:"longitude"`
+	Referer         string    `json:"referer"`
+	RefererHost     string    `json:"referer_host"`
+	RefererCategory string    `json:"referer_category"`
+	UTMSource       string    `json:"utm_source" gorm:"column:utm_source"`
+	UTMMedium       string    `json:"utm_medium" gorm:"column:utm_medium"`
+	UTMCampaign     string    `json:"utm_campaign" gorm:"column:utm_campaign"`
+	Browser         string    `json:"browser"`
+	OS              string    `json:"os" gorm:"column:os"`
+	DeviceType      string    `json:"device_type"`
+	IsBot           bool      `json:"is_bot"`
+	UserAgent       string    `json:"user_agent"`
+}
+
+// DailyAnalyticsExportRow 按天汇总的导出行，每行是一个内容一天内某个地区、来源和终端组合的访问量
+type DailyAnalyticsExportRow struct {
+	Day             string    `json:"day"`
+	ContentID       uuid.UUID `json:"content_id"`
+	UserID          uuid.UUID `json:"user_id"`
+	Country         string    `json:"country"`
+	Region          string    `json:"region"`
+	City            string    `json:"city"`
+	RefererHost     string    `json:"referer_host"`
+	RefererCategory string    `json:"referer_category"`
+	DeviceClass     string    `json:"device_class"`
+	Browser         string    `json:"browser"`
+	OS              string    `json:"os" gorm:"column:os"`
+	Views           int64     `json:"views"`
+}
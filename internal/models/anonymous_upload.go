@@ -0,0 +1,42 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// AnonymousUsername 匿名上传内容归属的系统账户用户名，该账户处于禁用状态且无法登录
+const AnonymousUsername = "anonymous"
+
+// IsReservedUsername 检查用户名是否保留给系统账户，不区分大小写
+func IsReservedUsername(username string) bool {
+	return strings.EqualFold(strings.TrimSpace(username), AnonymousUsername)
+}
+
+// AnonymousUpload 匿名上传记录，用于按 IP 统计配额和凭删除令牌删除内容
+type AnonymousUpload struct {
+	ID                uuid.UUID `json:"id" gorm:"type:uuid;primaryKey"`
+	ContentID         uuid.UUID `json:"content_id" gorm:"type:uuid;not null;uniqueIndex"`
+	IPAddress         string    `json:"ip_address" gorm:"size:45;not null;index"`
+	DeletionTokenHash string    `json:"-" gorm:"size:64;not null"` // 删除令牌的 SHA-256 哈希
+	CreatedAt         time.Time `json:"created_at"`
+
+	// 关联关系
+	Content Content `json:"content,omitempty" gorm:"foreignKey:ContentID"`
+}
+
+// BeforeCreate 在创建记录前生成 UUID
+func (a *AnonymousUpload) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	return nil
+}
+
+// TableName 指定表名
+func (AnonymousUpload) TableName() string {
+	return "anonymous_uploads"
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// APIKeyScope API 密钥权限范围
+type APIKeyScope string
+
+const (
+	ScopeRead   APIKeyScope = "read"   // 读取（GET）
+	ScopeWrite  APIKeyScope = "write"  // 创建和修改（POST/PUT/PATCH）
+	ScopeDelete APIKeyScope = "delete" // 删除（DELETE）
+)
+
+// APIKeyPrefix API 密钥明文前缀，便于识别和密钥扫描
+const APIKeyPrefix = "aw_"
+
+// APIKey 用户 API 密钥，仅保存密钥的 SHA-256 哈希，明文只在创建时返回一次
+type APIKey struct {
+	ID         uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	UserID     uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
+	Name       string     `json:"name" gorm:"size:100;not null"`
+	Prefix     string     `json:"prefix" gorm:"size:16;not null"` // 密钥前几位，用于在列表中识别
+	KeyHash    string     `json:"-" gorm:"size:64;uniqueIndex;not null"`
+	Scopes     string     `json:"scopes" gorm:"size:50;not null"` // 逗号分隔，如 "read,write"
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// BeforeCreate 在创建 API 密钥前生成 UUID
+func (k *APIKey) BeforeCreate(tx *gorm.DB) error {
+	if k.ID == uuid.Nil {
+		k.ID = uuid.New()
+	}
+	return nil
+}
+
+// TableName 指定表名
+func (APIKey) TableName() string {
+	return "api_keys"
+}
+
+// IsRevoked 检查密钥是否已吊销
+func (k *APIKey) IsRevoked() bool {
+	return k.RevokedAt != nil
+}
+
+// HasScope 检查密钥是否拥有指定权限
+func (k *APIKey) HasScope(scope APIKeyScope) bool {
+	for _, s := range strings.Split(k.Scopes, ",") {
+		if APIKeyScope(strings.TrimSpace(s)) == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// IsValidAPIKeyScope 检查权限范围取值是否合法
+func IsValidAPIKeyScope(scope APIKeyScope) bool {
+	switch scope {
+	case ScopeRead, ScopeWrite, ScopeDelete:
+		return true
+	}
+	return false
+}
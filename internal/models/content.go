@@ -1,28 +1,50 @@
 package models
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
+// ContentVisibility 内容可见性枚举
+type ContentVisibility string
+
+const (
+	VisibilityPublic     ContentVisibility = "public"      // 公开访问
+	VisibilityAccessCode ContentVisibility = "access_code" // 需要访问码
+	VisibilityOwnerOnly  ContentVisibility = "owner_only"  // 仅所有者可见
+)
+
+// ContentTypeBundle 多文件站点包的内容类型
+const ContentTypeBundle = "application/x-site-bundle"
+
 // Content HTML 内容模型
 type Content struct {
-	ID          uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
-	UserID      uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
-	Title       string     `json:"title" gorm:"size:255"`
-	Description string     `json:"description" gorm:"size:500"`
-	Content     string     `json:"content" gorm:"type:text;not null;column:content"`
-	ContentType string     `json:"content_type" gorm:"size:50;default:'text/html'"`
-	FilePath    string     `json:"file_path" gorm:"size:500"`
-	FileSize    int64      `json:"file_size" gorm:"default:0"`
-	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
-	IsActive    bool       `json:"is_active" gorm:"default:true"`
-	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
-	AccessCount int        `json:"access_count" gorm:"default:0"`
-	CreatedAt   time.Time  `json:"created_at"`
-	UpdatedAt   time.Time  `json:"updated_at"`
+	ID             uuid.UUID         `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	UserID         uuid.UUID         `json:"user_id" gorm:"type:uuid;not null;index"`
+	Title          string            `json:"title" gorm:"size:255"`
+	Description    string            `json:"description" gorm:"size:500"`
+	Content        string            `json:"content" gorm:"type:text;not null;column:content"`
+	ContentType    string            `json:"content_type" gorm:"size:50;default:'text/html'"`
+	Visibility     ContentVisibility `json:"visibility" gorm:"type:varchar(20);not null;default:'public'"`
+	AccessCodeHash string            `json:"-" gorm:"size:255"`       // 访问码哈希，不在 JSON 中返回
+	StorageKey     string            `json:"-" gorm:"size:255"`       // 正文在 blob 存储中的键，为空时正文保存在 content 列
+	ContentHash    string            `json:"-" gorm:"size:64"`        // 正文 SHA-256，用作 ETag
+	CacheMaxAge    *int              `json:"cache_max_age,omitempty"` // 浏览器缓存秒数，为空时使用计划默认值
+	FilePath       string            `json:"file_path" gorm:"size:500"`
+	FileSize       int64             `json:"file_size" gorm:"default:0"`
+	ExpiresAt      *time.Time        `json:"expires_at,omitempty"`
+	IsActive       bool              `json:"is_active" gorm:"default:true"`
+	DeletedAt      *time.Time        `json:"deleted_at,omitempty"`
+	AccessCount    int               `json:"access_count" gorm:"default:0"`
+	CreatedAt      time.Time         `json:"created_at"`
+	UpdatedAt      time.Time         `json:"updated_at"`
 
 	// 关联关系
 	User      User               `json:"user,omitempty" gorm:"foreignKey:UserID"`
@@ -55,3 +77,76 @@ func (c *Content) CanAccess() bool {
 	}
 	return true
 }
+
+// ETag 返回内容的强校验 ETag，正文哈希未计算时返回空字符串
+func (c *Content) ETag() string {
+	if c.ContentHash == "" {
+		return ""
+	}
+	return `"` + c.ContentHash + `"`
+}
+
+// HashBody 计算正文的 SHA-256 十六进制摘要
+func HashBody(body string) string {
+	sum := sha256.Sum256([]byte(body))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsBundle 检查内容是否为多文件站点包（文件存放在 FilePath 目录下）
+func (c *Content) IsBundle() bool {
+	return c.FilePath != ""
+}
+
+// IsValidVisibility 检查可见性取值是否合法
+func IsValidVisibility(v ContentVisibility) bool {
+	switch v {
+	case VisibilityPublic, VisibilityAccessCode, VisibilityOwnerOnly:
+		return true
+	}
+	return false
+}
+
+// IsPrivate 检查内容是否为私有内容（需要访问码或仅所有者可见）
+func (c *Content) IsPrivate() bool {
+	return c.Visibility == VisibilityAccessCode || c.Visibility == VisibilityOwnerOnly
+}
+
+// ContentAccessTokenTTL 访问令牌的有效期，与记住访问码的 Cookie 有效期相同
+const ContentAccessTokenTTL = 24 * time.Hour
+
+// AccessToken 生成访问码验证通过后写入 Cookie 的令牌，格式为"签发时间.签名"
+// 签名是服务端密钥对内容 ID、访问码哈希和签发时间的 HMAC，访问码修改后旧令牌自动失效
+func (c *Content) AccessToken(key []byte, issuedAt time.Time) string {
+	if c.AccessCodeHash == "" {
+		return ""
+	}
+	timestamp := strconv.FormatInt(issuedAt.Unix(), 10)
+	return timestamp + "." + c.accessTokenSignature(key, timestamp)
+}
+
+// ValidAccessToken 校验访问令牌的签名，签发超过 ContentAccessTokenTTL 的令牌无效
+func (c *Content) ValidAccessToken(key []byte, token string, now time.Time) bool {
+	if c.AccessCodeHash == "" {
+		return false
+	}
+	timestamp, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return false
+	}
+	issued, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	// 允许少量时钟偏差，多个实例的时间不完全一致
+	issuedAt := time.Unix(issued, 0)
+	if now.Sub(issuedAt) > ContentAccessTokenTTL || issuedAt.After(now.Add(time.Minute)) {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(c.accessTokenSignature(key, timestamp)))
+}
+
+func (c *Content) accessTokenSignature(key []byte, timestamp string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(c.ID.String() + ":" + c.AccessCodeHash + ":" + timestamp))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// RevisionSource 修订来源
+type RevisionSource string
+
+const (
+	RevisionSourceOriginal RevisionSource = "original" // 首次修改前的原始内容
+	RevisionSourceAPI      RevisionSource = "api"      // 通过 API 更新
+	RevisionSourceAdmin    RevisionSource = "admin"    // 通过管理后台更新
+	RevisionSourceRestore  RevisionSource = "restore"  // 从历史修订恢复
+)
+
+// ContentRevision 内容修订历史，每次更新内容时写入一条，最新一条即当前内容
+type ContentRevision struct {
+	ID           uuid.UUID      `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	ContentID    uuid.UUID      `json:"content_id" gorm:"type:uuid;not null;uniqueIndex:idx_content_revisions_content_revision"`
+	Revision     int            `json:"revision" gorm:"not null;uniqueIndex:idx_content_revisions_content_revision"`
+	Title        string         `json:"title" gorm:"size:255"`
+	Description  string         `json:"description" gorm:"size:500"`
+	Content      string         `json:"content,omitempty" gorm:"type:text;not null"`
+	EditorID     *uuid.UUID     `json:"editor_id,omitempty" gorm:"type:uuid"`
+	Source       RevisionSource `json:"source" gorm:"type:varchar(20);not null"`
+	RestoredFrom *int           `json:"restored_from,omitempty"` // 恢复操作来源的修订号
+	CreatedAt    time.Time      `json:"created_at"`
+}
+
+// BeforeCreate 在创建修订前生成 UUID
+func (r *ContentRevision) BeforeCreate(tx *gorm.DB) error {
+	if r.ID == uuid.Nil {
+		r.ID = uuid.New()
+	}
+	return nil
+}
+
+// TableName 指定表名
+func (ContentRevision) TableName() string {
+	return "content_revisions"
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// CustomDomain 用户绑定的自定义域名
+// 同一域名只能有一条已验证记录（部分唯一索引），未验证的声明不占用域名，验证通过的用户接管该域名
+type CustomDomain struct {
+	ID                uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	UserID            uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
+	Domain            string     `json:"domain" gorm:"size:253;not null;index"`
+	ContentID         *uuid.UUID `json:"content_id,omitempty" gorm:"type:uuid"` // 域名根路径展示的内容
+	VerificationToken string     `json:"verification_token" gorm:"size:64;not null"`
+	IsVerified        bool       `json:"is_verified" gorm:"default:false"`
+	VerifiedAt        *time.Time `json:"verified_at,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+
+	// 关联关系
+	Content *Content `json:"content,omitempty" gorm:"foreignKey:ContentID"`
+}
+
+// BeforeCreate 在创建域名前生成 UUID
+func (d *CustomDomain) BeforeCreate(tx *gorm.DB) error {
+	if d.ID == uuid.Nil {
+		d.ID = uuid.New()
+	}
+	return nil
+}
+
+// TableName 指定表名
+func (CustomDomain) TableName() string {
+	return "custom_domains"
+}
+
+// VerificationRecordName 返回用于验证域名所有权的 TXT 记录名
+func (d *CustomDomain) VerificationRecordName() string {
+	return "_anywebsites-challenge." + d.Domain
+}
+
+// VerificationRecordValue 返回 TXT 记录需要包含的值
+func (d *CustomDomain) VerificationRecordValue() string {
+	return "anywebsites-verification=" + d.VerificationToken
+}
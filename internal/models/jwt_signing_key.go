@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// JWTSigningKey JWT 非对称签名密钥，ID 即 Token 头部的 kid
+// 最新的未退役密钥用于签发 Token；退役后的密钥在 ExpiresAt 之前仍用于校验并在 JWKS 中公开
+type JWTSigningKey struct {
+	ID         string     `json:"id" gorm:"primaryKey;size:64"`
+	Algorithm  string     `json:"algorithm" gorm:"size:10;not null"`
+	PrivateKey string     `json:"-" gorm:"type:text;not null"` // 使用 JWT_KEY_ENCRYPTION_KEY 加密的 PKCS#8 PEM
+	CreatedAt  time.Time  `json:"created_at"`
+	RetiredAt  *time.Time `json:"retired_at,omitempty"` // 停止签发的时间
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"` // 停止校验的时间
+}
+
+// TableName 指定表名
+func (JWTSigningKey) TableName() string {
+	return "jwt_signing_keys"
+}
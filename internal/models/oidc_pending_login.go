@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// OIDCPendingLogin 跳转到身份提供方期间保存的 PKCE 和 nonce，按 state 索引，回调时删除
+type OIDCPendingLogin struct {
+	State     string    `json:"-" gorm:"primaryKey;size:64"`
+	Issuer    string    `json:"issuer" gorm:"not null;size:255"`
+	Verifier  string    `json:"-" gorm:"not null;size:128"`
+	Nonce     string    `json:"-" gorm:"not null;size:64"`
+	Target    string    `json:"target" gorm:"not null;size:20"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"not null;index"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TableName 指定表名
+func (OIDCPendingLogin) TableName() string {
+	return "oidc_pending_logins"
+}
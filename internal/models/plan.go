@@ -29,21 +29,44 @@ const (
 	StatusSuspended SubscriptionStatus = "suspended"
 )
 
+// HTMLPolicy 上传 HTML 的清理策略
+type HTMLPolicy string
+
+const (
+	HTMLPolicyNone         HTMLPolicy = "none"          // 不清理
+	HTMLPolicyStripScripts HTMLPolicy = "strip_scripts" // 移除脚本、事件属性和 javascript: 链接
+	HTMLPolicyStrict       HTMLPolicy = "strict"        // 只保留白名单中的标签和属性
+)
+
+// AnalyticsGranularity 访问统计接口可用的最细时间粒度
+type AnalyticsGranularity string
+
+const (
+	AnalyticsGranularityDay  AnalyticsGranularity = "day"  // 按天
+	AnalyticsGranularityHour AnalyticsGranularity = "hour" // 按小时，数据来自保留期内的原始访问记录
+)
+
 // PlanConfig 计划配置模型
 type PlanConfig struct {
-	ID                   uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
-	Type                 PlanType  `gorm:"type:varchar(20);unique;not null" json:"type"`
-	Name                 string    `gorm:"type:varchar(100);not null" json:"name"`
-	Price                float64   `gorm:"type:decimal(10,2);not null;default:0" json:"price"`
-	Currency             string    `gorm:"type:varchar(3);not null;default:'USD'" json:"currency"`
-	ArticleRetentionDays int       `gorm:"not null" json:"article_retention_days"`
-	MonthlyUploadLimit   int       `gorm:"not null" json:"monthly_upload_limit"`
-	StorageLimitMB       int64     `gorm:"not null" json:"storage_limit_mb"`
-	APIRateLimitPerHour  int       `gorm:"not null" json:"api_rate_limit_per_hour"`
-	Features             string    `gorm:"type:text" json:"features"`
-	IsActive             bool      `gorm:"not null;default:true" json:"is_active"`
-	CreatedAt            time.Time `json:"created_at"`
-	UpdatedAt            time.Time `json:"updated_at"`
+	ID                    uuid.UUID            `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
+	Type                  PlanType             `gorm:"type:varchar(20);unique;not null" json:"type"`
+	Name                  string               `gorm:"type:varchar(100);not null" json:"name"`
+	Price                 float64              `gorm:"type:decimal(10,2);not null;default:0" json:"price"`
+	Currency              string               `gorm:"type:varchar(3);not null;default:'USD'" json:"currency"`
+	ArticleRetentionDays  int                  `gorm:"not null" json:"article_retention_days"`
+	MonthlyUploadLimit    int                  `gorm:"not null" json:"monthly_upload_limit"`
+	StorageLimitMB        int64                `gorm:"not null" json:"storage_limit_mb"`
+	APIRateLimitPerHour   int                  `gorm:"not null" json:"api_rate_limit_per_hour"`
+	RevisionRetention     int                  `gorm:"not null;default:10" json:"revision_retention"`                        // 每个内容保留的修订数量，-1 表示无限制
+	CacheMaxAge           int                  `gorm:"not null;default:300" json:"cache_max_age"`                            // 内容页默认的浏览器缓存秒数，0 表示每次重新验证
+	HTMLPolicy            HTMLPolicy           `gorm:"type:varchar(20);not null;default:'none'" json:"html_policy"`          // 开启 HTML 清理时使用的策略
+	AnalyticsLookbackDays int                  `gorm:"not null;default:7" json:"analytics_lookback_days"`                    // 访问统计接口可查询的天数，-1 表示无限制
+	AnalyticsGranularity  AnalyticsGranularity `gorm:"type:varchar(10);not null;default:'day'" json:"analytics_granularity"` // 访问统计接口可用的最细粒度
+	RealtimeAnalytics     bool                 `gorm:"not null;default:false" json:"realtime_analytics"`                     // 是否可以订阅自己内容的实时访问推送
+	Features              string               `gorm:"type:text" json:"features"`
+	IsActive              bool                 `gorm:"not null;default:true" json:"is_active"`
+	CreatedAt             time.Time            `json:"created_at"`
+	UpdatedAt             time.Time            `json:"updated_at"`
 }
 
 // UserSubscription 用户订阅模型
@@ -77,6 +100,13 @@ type UsageStatistics struct {
 	// 关联 - 移除以避免循环导入
 }
 
+// StorageUsage 用户当前占用的存储空间（按字节），随内容上传、更新和删除增减
+type StorageUsage struct {
+	UserID    uuid.UUID `gorm:"type:uuid;primaryKey" json:"user_id"`
+	UsedBytes int64     `gorm:"not null;default:0" json:"used_bytes"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
 // PlanUpgradeHistory 计划升级历史
 type PlanUpgradeHistory struct {
 	ID           uuid.UUID          `gorm:"type:uuid;primaryKey;default:gen_random_uuid()" json:"id"`
@@ -132,6 +162,7 @@ func GetDefaultPlanConfigs() []PlanConfig {
 			MonthlyUploadLimit:   50,
 			StorageLimitMB:       100,
 			APIRateLimitPerHour:  100,
+			RevisionRetention:    5,
 			Features:             `["50 articles per month","7 days retention","100MB storage","Public articles only","Basic statistics","Community support"]`,
 			IsActive:             true,
 		},
@@ -144,6 +175,7 @@ func GetDefaultPlanConfigs() []PlanConfig {
 			MonthlyUploadLimit:   600,
 			StorageLimitMB:       1024,
 			APIRateLimitPerHour:  1000,
+			RevisionRetention:    20,
 			Features:             `["600 articles per month","30 days retention","1GB storage","Private articles with access codes","Basic custom domain","Detailed analytics","Email support","Team collaboration"]`,
 			IsActive:             true,
 		},
@@ -156,6 +188,7 @@ func GetDefaultPlanConfigs() []PlanConfig {
 			MonthlyUploadLimit:   1500,
 			StorageLimitMB:       5120,
 			APIRateLimitPerHour:  5000,
+			RevisionRetention:    50,
 			Features:             `["1500 articles per month","90 days retention","5GB storage","Advanced custom domains","White-label solution","Advanced analytics and reports","Priority support","Advanced team management","Custom themes"]`,
 			IsActive:             true,
 		},
@@ -168,7 +201,9 @@ func GetDefaultPlanConfigs() []PlanConfig {
 			MonthlyUploadLimit:   4500,
 			StorageLimitMB:       20480,
 			APIRateLimitPerHour:  20000,
+			RevisionRetention:    200,
 			Features:             `["4500 articles per month","365 days retention","20GB storage","Unlimited custom domains","Complete white-label","Real-time monitoring","24/7 dedicated support","Enterprise security","API priority"]`,
+			RealtimeAnalytics:    true,
 			IsActive:             true,
 		},
 		{
@@ -180,7 +215,9 @@ func GetDefaultPlanConfigs() []PlanConfig {
 			MonthlyUploadLimit:   -1, // 无限制
 			StorageLimitMB:       -1, // 无限制
 			APIRateLimitPerHour:  -1, // 无限制
+			RevisionRetention:    -1, // 无限制
 			Features:             `["Unlimited articles","Unlimited retention","Unlimited storage","Custom solutions","Dedicated servers","SSO integration","Compliance support","Dedicated account manager","SLA guarantee"]`,
+			RealtimeAnalytics:    true,
 			IsActive:             true,
 		},
 	}
@@ -222,6 +259,10 @@ func (UsageStatistics) TableName() string {
 	return "usage_statistics"
 }
 
+func (StorageUsage) TableName() string {
+	return "storage_usages"
+}
+
 func (PlanUpgradeHistory) TableName() string {
 	return "plan_upgrade_histories"
 }
@@ -13,29 +13,29 @@ type User struct {
 	Username  string    `json:"username" gorm:"uniqueIndex;not null;size:50"`
 	Email     string    `json:"email" gorm:"uniqueIndex;not null;size:100"`
 	Password  string    `json:"-" gorm:"not null;size:255"` // 不在 JSON 中返回密码
-	APIKey    string    `json:"api_key" gorm:"uniqueIndex;not null;size:64"`
 	IsActive  bool      `json:"is_active" gorm:"default:true"`
 	IsAdmin   bool      `json:"is_admin" gorm:"default:false"`
+	IsSystem  bool      `json:"-" gorm:"column:is_system;default:false"` // 系统账户（如匿名上传的归属账户），始终禁用
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 
+	// 两步验证
+	TOTPSecret         string     `json:"-" gorm:"column:totp_secret;size:255"` // 加密保存，启用前为设置中的密钥
+	TOTPEnabled        bool       `json:"totp_enabled" gorm:"column:totp_enabled;default:false"`
+	TOTPLastStep       int64      `json:"-" gorm:"column:totp_last_step"`                 // 最近一次使用的时间步
+	TOTPFailedAttempts int        `json:"-" gorm:"column:totp_failed_attempts;default:0"` // 连续输错验证码的次数
+	TOTPLockedUntil    *time.Time `json:"-" gorm:"column:totp_locked_until"`              // 输错过多时锁定到该时间
+
 	// 关联关系
 	Contents     []Content         `json:"contents,omitempty" gorm:"foreignKey:UserID"`
 	Subscription *UserSubscription `json:"subscription,omitempty" gorm:"foreignKey:UserID"`
+	APIKeys      []APIKey          `json:"api_keys,omitempty" gorm:"foreignKey:UserID"`
 }
 
-// BeforeCreate 在创建用户前生成 UUID 和 API Key
+// BeforeCreate 在创建用户前生成 UUID
 func (u *User) BeforeCreate(tx *gorm.DB) error {
 	if u.ID == uuid.Nil {
 		u.ID = uuid.New()
 	}
-	if u.APIKey == "" {
-		u.APIKey = generateAPIKey()
-	}
 	return nil
 }
-
-// generateAPIKey 生成 API 密钥
-func generateAPIKey() string {
-	return uuid.New().String()[:32] // 只取前32个字符
-}
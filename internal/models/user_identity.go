@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// UserIdentity 外部身份提供方账户与本地用户的绑定，按 issuer + subject 唯一
+type UserIdentity struct {
+	ID          uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey"`
+	UserID      uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
+	Issuer      string     `json:"issuer" gorm:"not null;size:255;uniqueIndex:idx_user_identities_issuer_subject"`
+	Subject     string     `json:"subject" gorm:"not null;size:255;uniqueIndex:idx_user_identities_issuer_subject"`
+	Email       string     `json:"email" gorm:"size:100"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+}
+
+// TableName 指定表名
+func (UserIdentity) TableName() string {
+	return "user_identities"
+}
+
+// BeforeCreate 在创建绑定前生成 UUID
+func (i *UserIdentity) BeforeCreate(tx *gorm.DB) error {
+	if i.ID == uuid.Nil {
+		i.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UserSession 服务端会话记录，每个刷新 Token 对应一条记录，ID 即刷新 Token 的 jti
+// 同一次登录后轮换产生的记录属于同一个 FamilyID，已轮换的刷新 Token 再次使用时整个会话被吊销
+type UserSession struct {
+	ID         uuid.UUID  `json:"id" gorm:"type:uuid;primaryKey"`
+	FamilyID   uuid.UUID  `json:"family_id" gorm:"type:uuid;not null;index"`
+	UserID     uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
+	UserAgent  string     `json:"user_agent" gorm:"size:255"`
+	IPAddress  string     `json:"ip_address" gorm:"size:45"`
+	ExpiresAt  time.Time  `json:"expires_at" gorm:"not null"`
+	ReplacedBy *uuid.UUID `json:"replaced_by,omitempty" gorm:"type:uuid"` // 轮换后的新记录
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// TableName 指定表名
+func (UserSession) TableName() string {
+	return "user_sessions"
+}
+
+// IsRevoked 检查会话是否已吊销
+func (s *UserSession) IsRevoked() bool {
+	return s.RevokedAt != nil
+}
+
+// IsRotated 检查刷新 Token 是否已被轮换
+func (s *UserSession) IsRotated() bool {
+	return s.ReplacedBy != nil
+}
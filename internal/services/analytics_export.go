@@ -0,0 +1,288 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"anywebsites/internal/config"
+	"anywebsites/internal/database"
+	"anywebsites/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// exportFlushRows 每写出多少行刷新一次 CSV 缓冲区
+const exportFlushRows = 1000
+
+var (
+	// ErrInvalidExportType 导出类型无效
+	ErrInvalidExportType = errors.New("invalid export type, use raw or daily")
+	// ErrInvalidExportFormat 导出格式无效
+	ErrInvalidExportFormat = errors.New("invalid export format, use csv or ndjson")
+)
+
+var rawExportColumns = []string{
+	"access_time", "content_id", "user_id", "ip_address", "visitor_id",
+	"country", "region", "city", "latitude", "longitude",
+	"referer", "referer_host", "referer_category", "utm_source", "utm_medium", "utm_campaign",
+	"browser", "os", "device_type", "is_bot", "user_agent",
+}
+
+var dailyExportColumns = []string{
+	"day", "content_id", "user_id", "country", "region", "city",
+	"referer_host", "referer_category", "device_class", "browser", "os", "views",
+}
+
+// AnalyticsExportFilter 导出的数据范围，UserID 为空时导出全站数据（仅管理员）
+type AnalyticsExportFilter struct {
+	Type      models.AnalyticsExportType
+	Format    models.AnalyticsExportFormat
+	Query     *AnalyticsQuery
+	UserID    *uuid.UUID
+	ContentID *uuid.UUID
+	// FullIP 导出完整的访客 IP，只有管理员导出设置，内容所有者导出的 IP 截断为网段
+	FullIP bool
+}
+
+// AnalyticsExportService 以 CSV 或 NDJSON 流式导出访问数据，逐行读取数据库并写出，不在内存中保留结果集
+type AnalyticsExportService struct{}
+
+// NewAnalyticsExportService 创建访问数据导出服务
+func NewAnalyticsExportService() *AnalyticsExportService {
+	return &AnalyticsExportService{}
+}
+
+// ParseExportOptions 解析导出类型和格式，默认导出按天汇总的 CSV
+func ParseExportOptions(exportType, format string) (models.AnalyticsExportType, models.AnalyticsExportFormat, error) {
+	t := models.AnalyticsExportType(exportType)
+	switch t {
+	case "":
+		t = models.AnalyticsExportDaily
+	case models.AnalyticsExportRaw, models.AnalyticsExportDaily:
+	default:
+		return "", "", ErrInvalidExportType
+	}
+
+	f := models.AnalyticsExportFormat(format)
+	switch f {
+	case "":
+		f = models.AnalyticsExportCSV
+	case models.AnalyticsExportCSV, models.AnalyticsExportNDJSON:
+	default:
+		return "", "", ErrInvalidExportFormat
+	}
+	return t, f, nil
+}
+
+// ResolveAdminQuery 解析管理员导出的时间范围，不受计划可查询天数的限制
+func (s *AnalyticsExportService) ResolveAdminQuery(params AnalyticsRangeParams) (*AnalyticsQuery, error) {
+	params.Granularity = ""
+	return resolveAnalyticsQuery(params, &models.PlanConfig{AnalyticsLookbackDays: -1}, time.Now())
+}
+
+// CheckContent 检查要导出的内容存在，指定用户时内容必须属于该用户
+func (s *AnalyticsExportService) CheckContent(filter AnalyticsExportFilter) error {
+	if filter.ContentID == nil {
+		return nil
+	}
+
+	db := database.DB.Model(&models.Content{}).Where("id = ?", *filter.ContentID)
+	if filter.UserID != nil {
+		db = db.Where("user_id = ?", *filter.UserID)
+	}
+	var count int64
+	if err := db.Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrAnalyticsContentNotFound
+	}
+	return nil
+}
+
+// Filename 导出文件名，包含类型和日期范围
+func (s *AnalyticsExportService) Filename(filter AnalyticsExportFilter) string {
+	return fmt.Sprintf("analytics-%s-%s-%s.%s", filter.Type, filter.Query.fromDate(), filter.Query.toDate(), filter.Format)
+}
+
+// Export 把访问数据写入 w，调用前应先通过 CheckContent 校验内容
+func (s *AnalyticsExportService) Export(w io.Writer, filter AnalyticsExportFilter) error {
+	out := newAnalyticsExportWriter(w, filter.Format)
+	if filter.Type == models.AnalyticsExportRaw {
+		return s.exportRaw(out, filter)
+	}
+	return s.exportDaily(out, filter)
+}
+
+// exportRaw 导出原始访问记录，包括爬虫访问，referer_host 与汇总表使用相同的规则提取
+func (s *AnalyticsExportService) exportRaw(out *analyticsExportWriter, filter AnalyticsExportFilter) error {
+	db := database.DB.Table("content_analytics ca").
+		Select(`ca.access_time, ca.content_id, ca.user_id, ca.ip_address, ca.visitor_id,
+			ca.country, ca.region, ca.city, ca.latitude, ca.longitude,
+			ca.referer, COALESCE(lower(substring(ca.referer FROM ?)), '') as referer_host,
+			COALESCE(NULLIF(ca.referer_category, ''), 'direct') as referer_category, ca.utm_source, ca.utm_medium, ca.utm_campaign,
+			ca.browser, ca.os, ca.device_type, ca.is_bot, ca.user_agent`, refererHostPattern).
+		Where("ca.access_time >= ?::date AND ca.access_time < ?::date + 1", filter.Query.fromDate(), filter.Query.toDate())
+	if filter.UserID != nil {
+		db = db.Where("ca.user_id = ?", *filter.UserID)
+	}
+	if filter.ContentID != nil {
+		db = db.Where("ca.content_id = ?", *filter.ContentID)
+	}
+
+	if err := out.header(rawExportColumns); err != nil {
+		return err
+	}
+	return streamExportRows(db.Order("ca.access_time"), out, func(tx *gorm.DB, rows *sql.Rows) error {
+		var row models.RawAnalyticsExportRow
+		if err := tx.ScanRows(rows, &row); err != nil {
+			return err
+		}
+		if !filter.FullIP {
+			row.IPAddress = anonymizeIP(row.IPAddress, config.IPStorageTruncate)
+		}
+		return out.row(&row, []string{
+			row.AccessTime.Format(time.RFC3339),
+			row.ContentID.String(),
+			row.UserID.String(),
+			row.IPAddress,
+			row.VisitorID,
+			row.Country,
+			row.Region,
+			row.City,
+			strconv.FormatFloat(row.Latitude, 'f', -1, 64),
+			strconv.FormatFloat(row.Longitude, 'f', -1, 64),
+			row.Referer,
+			row.RefererHost,
+			row.RefererCategory,
+			row.UTMSource,
+			row.UTMMedium,
+			row.UTMCampaign,
+			row.Browser,
+			row.OS,
+			row.DeviceType,
+			strconv.FormatBool(row.IsBot),
+			row.UserAgent,
+		})
+	})
+}
+
+// exportDaily 导出按天汇总的访问量，与统计接口一样按设置排除爬虫
+func (s *AnalyticsExportService) exportDaily(out *analyticsExportWriter, filter AnalyticsExportFilter) error {
+	db := database.DB.Model(&models.AnalyticsDailyBreakdown{}).
+		Select("to_char(day, 'YYYY-MM-DD') as day, content_id, user_id, country, region, city, referer_host, referer_category, device_class, browser, os, views").
+		Where("day BETWEEN ? AND ?", filter.Query.fromDate(), filter.Query.toDate())
+	if filter.UserID != nil {
+		db = db.Where("user_id = ?", *filter.UserID)
+	}
+	if filter.ContentID != nil {
+		db = db.Where("content_id = ?", *filter.ContentID)
+	}
+
+	if err := out.header(dailyExportColumns); err != nil {
+		return err
+	}
+	return streamExportRows(db.Order("day, content_id"), out, func(tx *gorm.DB, rows *sql.Rows) error {
+		var row models.DailyAnalyticsExportRow
+		if err := tx.ScanRows(rows, &row); err != nil {
+			return err
+		}
+		return out.row(&row, []string{
+			row.Day,
+			row.ContentID.String(),
+			row.UserID.String(),
+			row.Country,
+			row.Region,
+			row.City,
+			row.RefererHost,
+			row.RefererCategory,
+			row.DeviceClass,
+			row.Browser,
+			row.OS,
+			strconv.FormatInt(row.Views, 10),
+		})
+	})
+}
+
+// streamExportRows 逐行读取查询结果并写出
+func streamExportRows(db *gorm.DB, out *analyticsExportWriter, write func(tx *gorm.DB, rows *sql.Rows) error) error {
+	rows, err := db.Rows()
+	if err != nil {
+		return fmt.Errorf("failed to query analytics export: %w", err)
+	}
+	defer rows.Close()
+
+	for count := 1; rows.Next(); count++ {
+		if err := write(db, rows); err != nil {
+			return fmt.Errorf("failed to write analytics export: %w", err)
+		}
+		if count%exportFlushRows == 0 {
+			if err := out.flush(); err != nil {
+				return fmt.Errorf("failed to write analytics export: %w", err)
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read analytics export: %w", err)
+	}
+	return out.flush()
+}
+
+// analyticsExportWriter 按格式写出导出行：CSV 写表头和字符串列，NDJSON 每行编码一个对象
+type analyticsExportWriter struct {
+	csv  *csv.Writer
+	json *json.Encoder
+}
+
+func newAnalyticsExportWriter(w io.Writer, format models.AnalyticsExportFormat) *analyticsExportWriter {
+	if format == models.AnalyticsExportNDJSON {
+		return &analyticsExportWriter{json: json.NewEncoder(w)}
+	}
+	return &analyticsExportWriter{csv: csv.NewWriter(w)}
+}
+
+func (e *analyticsExportWriter) header(columns []string) error {
+	if e.csv == nil {
+		return nil
+	}
+	return e.csv.Write(columns)
+}
+
+// row 写出一行，value 用于 NDJSON，record 用于 CSV
+func (e *analyticsExportWriter) row(value interface{}, record []string) error {
+	if e.csv == nil {
+		return e.json.Encode(value)
+	}
+	for i, cell := range record {
+		record[i] = csvSafeCell(cell)
+	}
+	return e.csv.Write(record)
+}
+
+// csvSafeCell 来源、UTM 参数和 User-Agent 由访客控制，以公式字符开头的单元格前加单引号，
+// 防止在电子表格或 BI 工具中打开时被当作公式执行，数字（如负的经纬度）保持不变
+func csvSafeCell(cell string) string {
+	if cell == "" || !strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+		return cell
+	}
+	if _, err := strconv.ParseFloat(cell, 64); err == nil {
+		return cell
+	}
+	return "'" + cell
+}
+
+func (e *analyticsExportWriter) flush() error {
+	if e.csv == nil {
+		return nil
+	}
+	e.csv.Flush()
+	return e.csv.Error()
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"bytes"
+	"testing"
+
+	"anywebsites/internal/models"
+)
+
+func TestParseExportOptions(t *testing.T) {
+	exportType, format, err := ParseExportOptions("", "")
+	if err != nil || exportType != models.AnalyticsExportDaily || format != models.AnalyticsExportCSV {
+		t.Errorf("默认期望 daily/csv, 实际 %s/%s (%v)", exportType, format, err)
+	}
+
+	exportType, format, err = ParseExportOptions("raw", "ndjson")
+	if err != nil || exportType != models.AnalyticsExportRaw || format != models.AnalyticsExportNDJSON {
+		t.Errorf("期望 raw/ndjson, 实际 %s/%s (%v)", exportType, format, err)
+	}
+
+	if _, _, err := ParseExportOptions("hourly", "csv"); err != ErrInvalidExportType {
+		t.Errorf("期望 ErrInvalidExportType, 实际 %v", err)
+	}
+	if _, _, err := ParseExportOptions("raw", "xlsx"); err != ErrInvalidExportFormat {
+		t.Errorf("期望 ErrInvalidExportFormat, 实际 %v", err)
+	}
+}
+
+func TestAnalyticsExportWriter(t *testing.T) {
+	row := models.DailyAnalyticsExportRow{Day: "2024-05-06", Country: "China", RefererHost: "example.com", Views: 3}
+	record := []string{row.Day, row.Country, `say "hi", bye`}
+
+	var buf bytes.Buffer
+	out := newAnalyticsExportWriter(&buf, models.AnalyticsExportCSV)
+	if err := out.header([]string{"day", "country", "note"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.row(&row, record); err != nil {
+		t.Fatal(err)
+	}
+	if err := out.flush(); err != nil {
+		t.Fatal(err)
+	}
+	want := "day,country,note\n2024-05-06,China,\"say \"\"hi\"\", bye\"\n"
+	if buf.String() != want {
+		t.Errorf("CSV 期望 %q, 实际 %q", want, buf.String())
+	}
+
+	buf.Reset()
+	out = newAnalyticsExportWriter(&buf, models.AnalyticsExportNDJSON)
+	if err := out.header([]string{"day"}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := out.row(&row, record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("NDJSON 期望 2 行, 实际 %d 行: %s", len(lines), buf.String())
+	}
+	if !bytes.Contains(lines[0], []byte(`"referer_host":"example.com"`)) || !bytes.Contains(lines[0], []byte(`"views":3`)) {
+		t.Errorf("NDJSON 行内容不正确: %s", lines[0])
+	}
+}
+
+func TestCSVSafeCell(t *testing.T) {
+	tests := []struct {
+		cell string
+		want string
+	}{
+		{"", ""},
+		{"China", "China"},
+		{"=HYPERLINK(\"http://evil.example\")", "'=HYPERLINK(\"http://evil.example\")"},
+		{"+cmd|' /C calc'!A0", "'+cmd|' /C calc'!A0"},
+		{"-2+3", "'-2+3"},
+		{"@SUM(A1:A2)", "'@SUM(A1:A2)"},
+		{"\t=1", "'\t=1"},
+		{"-33.8688", "-33.8688"},
+	}
+
+	for _, tt := range tests {
+		if got := csvSafeCell(tt.cell); got != tt.want {
+			t.Errorf("csvSafeCell(%q) = %q，期望 %q", tt.cell, got, tt.want)
+		}
+	}
+}
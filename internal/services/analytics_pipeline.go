@@ -0,0 +1,341 @@
+package services
+
+import (
+	"log"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"anywebsites/internal/config"
+	"anywebsites/internal/database"
+	"anywebsites/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// AnalyticsEvent 一次页面访问，由请求处理流程写入缓冲区，后台 worker 补全地理位置后批量入库
+type AnalyticsEvent struct {
+	ContentID uuid.UUID
+	UserID    uuid.UUID
+	ClientIP  string
+	UserAgent string
+	Referer   string
+	Host      string // 请求的 Host，来源为同一域名时视为站内访问
+	// UTM 参数，来自内容访问地址的查询字符串
+	UTMSource   string
+	UTMMedium   string
+	UTMCampaign string
+	AccessTime  time.Time
+}
+
+// analyticsRing 固定容量的环形缓冲区，写满后丢弃新事件
+type analyticsRing struct {
+	mutex  sync.Mutex
+	events []AnalyticsEvent
+	head   int
+	size   int
+}
+
+func newAnalyticsRing(capacity int) *analyticsRing {
+	return &analyticsRing{events: make([]AnalyticsEvent, capacity)}
+}
+
+// push 写入事件，缓冲区已满时返回 false；同时返回写入后的长度
+func (r *analyticsRing) push(event AnalyticsEvent) (bool, int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.size == len(r.events) {
+		return false, r.size
+	}
+	r.events[(r.head+r.size)%len(r.events)] = event
+	r.size++
+	return true, r.size
+}
+
+// pop 取出最多 max 个事件追加到 dst
+func (r *analyticsRing) pop(dst []AnalyticsEvent, max int) []AnalyticsEvent {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for i := 0; i < max && r.size > 0; i++ {
+		dst = append(dst, r.events[r.head])
+		r.events[r.head] = AnalyticsEvent{}
+		r.head = (r.head + 1) % len(r.events)
+		r.size--
+	}
+	return dst
+}
+
+func (r *analyticsRing) len() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.size
+}
+
+// AnalyticsPipeline 有界的访问统计写入管道：环形缓冲区 + 固定数量的 worker，按批量大小或时间间隔批量插入
+type AnalyticsPipeline struct {
+	geoipService  *GeoIPService
+	visitorSalts  *VisitorSalts
+	ipStorage     string
+	internalHosts []string
+	writer        func(records []models.ContentAnalytics) error
+	liveViews     *LiveViewHub
+	ring          *analyticsRing
+	workers       int
+	batchSize     int
+	flushInterval time.Duration
+
+	notify    chan struct{}
+	done      chan struct{}
+	wg        sync.WaitGroup
+	startOnce sync.Once
+	closeOnce sync.Once
+	closed    int32
+
+	enqueued int64
+	dropped  int64
+	written  int64
+	failed   int64
+	batches  int64
+}
+
+// NewAnalyticsPipeline 创建访问统计写入管道，需调用 Start 启动 worker
+func NewAnalyticsPipeline(cfg *config.Config, geoipService *GeoIPService) *AnalyticsPipeline {
+	p := newAnalyticsPipeline(cfg.Analytics, geoipService, writeAnalyticsBatch)
+	p.visitorSalts = newVisitorSalts(loadVisitorSalt)
+	// 容量与长度一致，buildRecord 中追加请求 Host 时总是复制，多个 worker 之间不会互相覆盖
+	p.internalHosts = slices.Clip(cfg.Domain.PrimaryHosts)
+	return p
+}
+
+func newAnalyticsPipeline(cfg config.AnalyticsConfig, geoipService *GeoIPService, writer func([]models.ContentAnalytics) error) *AnalyticsPipeline {
+	if cfg.BufferSize <= 0 {
+		cfg.BufferSize = 10000
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 500
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = time.Second
+	}
+
+	return &AnalyticsPipeline{
+		geoipService:  geoipService,
+		visitorSalts:  newVisitorSalts(memoryVisitorSalt),
+		ipStorage:     cfg.IPStorage,
+		writer:        writer,
+		liveViews:     NewLiveViewHub(),
+		ring:          newAnalyticsRing(cfg.BufferSize),
+		workers:       cfg.Workers,
+		batchSize:     cfg.BatchSize,
+		flushInterval: cfg.FlushInterval,
+		notify:        make(chan struct{}, cfg.Workers),
+		done:          make(chan struct{}),
+	}
+}
+
+// Start 启动 worker
+func (p *AnalyticsPipeline) Start() {
+	p.startOnce.Do(func() {
+		for i := 0; i < p.workers; i++ {
+			p.wg.Add(1)
+			go p.worker()
+		}
+	})
+}
+
+// Record 把访问事件放入缓冲区，不会阻塞请求；缓冲区已满或管道已关闭时丢弃并计数
+func (p *AnalyticsPipeline) Record(event AnalyticsEvent) {
+	if atomic.LoadInt32(&p.closed) == 1 {
+		atomic.AddInt64(&p.dropped, 1)
+		return
+	}
+	if event.AccessTime.IsZero() {
+		event.AccessTime = time.Now()
+	}
+
+	ok, size := p.ring.push(event)
+	if !ok {
+		atomic.AddInt64(&p.dropped, 1)
+		return
+	}
+	atomic.AddInt64(&p.enqueued, 1)
+
+	// 攒够一批时唤醒 worker 立即写入
+	if size >= p.batchSize {
+		select {
+		case p.notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Close 停止接收新事件并写完缓冲区中的剩余事件，超时后返回 false
+func (p *AnalyticsPipeline) Close(timeout time.Duration) bool {
+	p.closeOnce.Do(func() {
+		atomic.StoreInt32(&p.closed, 1)
+		close(p.done)
+	})
+
+	finished := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return true
+	case <-time.After(timeout):
+		log.Printf("Analytics pipeline did not drain within %s, %d events lost", timeout, p.ring.len())
+		return false
+	}
+}
+
+// LiveViews 实时访问发布订阅中心，每个访问在补全地理位置后发布
+func (p *AnalyticsPipeline) LiveViews() *LiveViewHub {
+	return p.liveViews
+}
+
+// Stats 返回队列深度和写入计数，用于管理后台监控页面
+func (p *AnalyticsPipeline) Stats() map[string]interface{} {
+	return map[string]interface{}{
+		"queue_depth":    p.ring.len(),
+		"queue_capacity": len(p.ring.events),
+		"workers":        p.workers,
+		"batch_size":     p.batchSize,
+		"enqueued":       atomic.LoadInt64(&p.enqueued),
+		"dropped":        atomic.LoadInt64(&p.dropped),
+		"written":        atomic.LoadInt64(&p.written),
+		"failed":         atomic.LoadInt64(&p.failed),
+		"batches":        atomic.LoadInt64(&p.batches),
+	}
+}
+
+// worker 缓冲区攒够一批或到达刷新间隔时写入，关闭时写完剩余事件后退出
+func (p *AnalyticsPipeline) worker() {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(p.flushInterval)
+	defer ticker.Stop()
+
+	batch := make([]AnalyticsEvent, 0, p.batchSize)
+	for {
+		select {
+		case <-p.notify:
+			for p.ring.len() >= p.batchSize {
+				batch = p.flushNext(batch)
+			}
+		case <-ticker.C:
+			for p.ring.len() > 0 {
+				batch = p.flushNext(batch)
+			}
+		case <-p.done:
+			for p.ring.len() > 0 {
+				batch = p.flushNext(batch)
+			}
+			return
+		}
+	}
+}
+
+// flushNext 取出一批事件写入数据库，返回清空后的切片以便复用
+func (p *AnalyticsPipeline) flushNext(batch []AnalyticsEvent) []AnalyticsEvent {
+	batch = p.ring.pop(batch[:0], p.batchSize)
+	if len(batch) == 0 {
+		return batch
+	}
+
+	records := make([]models.ContentAnalytics, len(batch))
+	for i, event := range batch {
+		records[i] = p.buildRecord(event)
+		p.liveViews.Publish(LiveViewEvent{
+			ContentID:   records[i].ContentID,
+			UserID:      records[i].UserID,
+			Country:     records[i].Country,
+			RefererHost: refererHost(event.Referer),
+			DeviceType:  records[i].DeviceType,
+			IsBot:       records[i].IsBot,
+			AccessTime:  records[i].AccessTime,
+		})
+	}
+
+	atomic.AddInt64(&p.batches, 1)
+	if err := p.writer(records); err != nil {
+		// 记录统计失败不应该影响内容访问
+		log.Printf("Failed to write %d analytics records: %v", len(records), err)
+		atomic.AddInt64(&p.failed, int64(len(records)))
+	} else {
+		atomic.AddInt64(&p.written, int64(len(records)))
+	}
+	return batch[:0]
+}
+
+// buildRecord 解析 User-Agent、计算访客标识并补全地理位置信息，地理位置解析完成后才按配置处理 IP
+func (p *AnalyticsPipeline) buildRecord(event AnalyticsEvent) models.ContentAnalytics {
+	client := ParseUserAgent(event.UserAgent)
+	referer := ClassifyReferer(event.Referer, append(p.internalHosts, event.Host)...)
+	record := models.ContentAnalytics{
+		ID:         uuid.New(),
+		ContentID:  event.ContentID,
+		UserID:     event.UserID,
+		IPAddress:  anonymizeIP(event.ClientIP, p.ipStorage),
+		VisitorID:  p.visitorSalts.VisitorID(event.ClientIP, event.UserAgent, event.AccessTime),
+		UserAgent:  truncateString(event.UserAgent, 500),
+		Referer:    truncateString(event.Referer, 500),
+		Browser:    client.Browser,
+		OS:         client.OS,
+		DeviceType: client.DeviceType,
+		IsBot:      client.IsBot,
+		AccessTime: event.AccessTime,
+
+		RefererCategory: referer.Category,
+		UTMSource:       truncateString(event.UTMSource, 100),
+		UTMMedium:       truncateString(event.UTMMedium, 100),
+		UTMCampaign:     truncateString(event.UTMCampaign, 100),
+	}
+
+	if p.geoipService != nil {
+		if locationInfo, err := p.geoipService.GetLocationInfo(event.ClientIP); err == nil {
+			record.Country = locationInfo.Country
+			record.Region = locationInfo.Region
+			record.City = locationInfo.City
+			record.Latitude = locationInfo.Latitude
+			record.Longitude = locationInfo.Longitude
+			return record
+		}
+	} else if event.ClientIP == "127.0.0.1" || event.ClientIP == "::1" {
+		// GeoIP 服务不可用，使用简单的本地检测
+		record.Country = "Local"
+		record.Region = "Local"
+		record.City = "Local"
+		return record
+	}
+
+	record.Country = "Unknown"
+	record.Region = "Unknown"
+	record.City = "Unknown"
+	return record
+}
+
+// writeAnalyticsBatch 使用单条多行 INSERT 写入一批访问记录
+func writeAnalyticsBatch(records []models.ContentAnalytics) error {
+	return database.DB.CreateInBatches(records, len(records)).Error
+}
+
+// truncateString 按字节截断字符串，保证不超过列长度
+func truncateString(value string, max int) string {
+	if len(value) <= max {
+		return value
+	}
+	// 避免截断在多字节字符中间
+	for max > 0 && value[max]&0xC0 == 0x80 {
+		max--
+	}
+	return value[:max]
+}
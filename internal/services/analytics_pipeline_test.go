@@ -0,0 +1,162 @@
+package services
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"anywebsites/internal/config"
+	"anywebsites/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// recordingWriter 在内存中记录每次批量写入
+type recordingWriter struct {
+	mutex   sync.Mutex
+	batches [][]models.ContentAnalytics
+}
+
+func (w *recordingWriter) write(records []models.ContentAnalytics) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.batches = append(w.batches, append([]models.ContentAnalytics(nil), records...))
+	return nil
+}
+
+func (w *recordingWriter) total() int {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	count := 0
+	for _, batch := range w.batches {
+		count += len(batch)
+	}
+	return count
+}
+
+// waitFor 等待条件成立，超时返回 false
+func waitFor(condition func() bool) bool {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if condition() {
+			return true
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return false
+}
+
+func TestAnalyticsRing(t *testing.T) {
+	ring := newAnalyticsRing(3)
+	for i := 0; i < 3; i++ {
+		if ok, _ := ring.push(AnalyticsEvent{ClientIP: string(rune('a' + i))}); !ok {
+			t.Fatalf("缓冲区未满时写入不应失败")
+		}
+	}
+	if ok, size := ring.push(AnalyticsEvent{ClientIP: "d"}); ok || size != 3 {
+		t.Errorf("缓冲区已满时应拒绝写入")
+	}
+
+	events := ring.pop(nil, 2)
+	if len(events) != 2 || events[0].ClientIP != "a" || events[1].ClientIP != "b" {
+		t.Fatalf("应按写入顺序取出，实际 %+v", events)
+	}
+
+	// 写入位置回绕到数组开头
+	ring.push(AnalyticsEvent{ClientIP: "e"})
+	ring.push(AnalyticsEvent{ClientIP: "f"})
+	events = ring.pop(nil, 10)
+	if len(events) != 3 || events[0].ClientIP != "c" || events[2].ClientIP != "f" {
+		t.Errorf("回绕后的取出顺序错误: %+v", events)
+	}
+	if ring.len() != 0 {
+		t.Errorf("取出全部事件后长度应为 0")
+	}
+}
+
+func TestAnalyticsPipeline_FlushBySize(t *testing.T) {
+	writer := &recordingWriter{}
+	pipeline := newAnalyticsPipeline(config.AnalyticsConfig{
+		BufferSize: 100, Workers: 2, BatchSize: 3, FlushInterval: time.Hour,
+	}, nil, writer.write)
+	pipeline.Start()
+	defer pipeline.Close(time.Second)
+
+	for i := 0; i < 3; i++ {
+		pipeline.Record(AnalyticsEvent{ContentID: uuid.New(), ClientIP: "203.0.113.1"})
+	}
+	if !waitFor(func() bool { return writer.total() == 3 }) {
+		t.Fatalf("攒够一批后应立即写入，实际写入 %d 条", writer.total())
+	}
+	if len(writer.batches) != 1 {
+		t.Errorf("3 条事件应在一次批量插入中写入，实际 %d 次", len(writer.batches))
+	}
+	if writer.batches[0][0].Country != "Unknown" {
+		t.Errorf("没有 GeoIP 服务时国家应为 Unknown")
+	}
+}
+
+func TestAnalyticsPipeline_FlushByInterval(t *testing.T) {
+	writer := &recordingWriter{}
+	pipeline := newAnalyticsPipeline(config.AnalyticsConfig{
+		BufferSize: 100, Workers: 1, BatchSize: 100, FlushInterval: 10 * time.Millisecond,
+	}, nil, writer.write)
+	pipeline.Start()
+	defer pipeline.Close(time.Second)
+
+	pipeline.Record(AnalyticsEvent{ContentID: uuid.New(), ClientIP: "127.0.0.1"})
+	if !waitFor(func() bool { return writer.total() == 1 }) {
+		t.Fatalf("不足一批时应在刷新间隔后写入")
+	}
+	if writer.batches[0][0].Country != "Local" {
+		t.Errorf("本地地址的国家应为 Local")
+	}
+}
+
+func TestAnalyticsPipeline_DropWhenFull(t *testing.T) {
+	writer := &recordingWriter{}
+	pipeline := newAnalyticsPipeline(config.AnalyticsConfig{
+		BufferSize: 2, Workers: 1, BatchSize: 10, FlushInterval: time.Hour,
+	}, nil, writer.write)
+
+	for i := 0; i < 5; i++ {
+		pipeline.Record(AnalyticsEvent{ContentID: uuid.New()})
+	}
+	stats := pipeline.Stats()
+	if stats["queue_depth"] != 2 || stats["dropped"] != int64(3) || stats["enqueued"] != int64(2) {
+		t.Errorf("缓冲区写满后应丢弃新事件，实际 %+v", stats)
+	}
+}
+
+func TestAnalyticsPipeline_CloseDrains(t *testing.T) {
+	writer := &recordingWriter{}
+	pipeline := newAnalyticsPipeline(config.AnalyticsConfig{
+		BufferSize: 100, Workers: 2, BatchSize: 4, FlushInterval: time.Hour,
+	}, nil, writer.write)
+	pipeline.Start()
+
+	for i := 0; i < 10; i++ {
+		pipeline.Record(AnalyticsEvent{ContentID: uuid.New()})
+	}
+	if !pipeline.Close(2 * time.Second) {
+		t.Fatalf("关闭时应在超时前写完缓冲区")
+	}
+	if writer.total() != 10 {
+		t.Errorf("关闭后应写入全部 10 条事件，实际 %d", writer.total())
+	}
+
+	pipeline.Record(AnalyticsEvent{ContentID: uuid.New()})
+	if pipeline.Stats()["dropped"] != int64(1) {
+		t.Errorf("关闭后的事件应计入丢弃数")
+	}
+}
+
+func TestTruncateString(t *testing.T) {
+	if got := truncateString("abc", 5); got != "abc" {
+		t.Errorf("未超长时不应截断，实际 %q", got)
+	}
+	// "你" 占 3 个字节，截断到 4 字节时不能留下半个字符
+	if got := truncateString("你好", 4); got != "你" {
+		t.Errorf("截断结果 = %q，期望 你", got)
+	}
+}
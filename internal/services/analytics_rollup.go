@@ -0,0 +1,326 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"anywebsites/internal/config"
+	"anywebsites/internal/database"
+	"anywebsites/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// rollupGracePeriod 一天结束后等待缓冲区中的访问记录写入的时间，之后的重算才认为该天已完整汇总
+const rollupGracePeriod = 10 * time.Minute
+
+// rawPruneBatchSize 删除原始访问记录时每条语句删除的最大行数，避免长时间锁表
+const rawPruneBatchSize = 10000
+
+// refererHostPattern 提取来源 URL 主机名的正则，作为参数传入以免其中的 ? 被当作占位符
+const refererHostPattern = `^[A-Za-z][A-Za-z0-9+.-]*://(?:[^@/#?]*@)?([^:/#?]+)`
+
+// visitorKeySQL 独立访客的去重依据，早于访客标识的记录使用 IP
+const visitorKeySQL = `COALESCE(NULLIF(ca.visitor_id, ''), ca.ip_address)`
+
+// AnalyticsRollupService 定期把原始访问记录汇总到按天统计的表中
+type AnalyticsRollupService struct {
+	interval        time.Duration
+	stopChan        chan bool
+	settingsService *SettingsService
+}
+
+// NewAnalyticsRollupService 创建访问统计汇总服务
+func NewAnalyticsRollupService(cfg *config.Config, settingsService *SettingsService) *AnalyticsRollupService {
+	interval := cfg.Analytics.RollupInterval
+	if interval <= 0 {
+		interval = 5 * time.Minute
+	}
+	return &AnalyticsRollupService{
+		interval:        interval,
+		stopChan:        make(chan bool),
+		settingsService: settingsService,
+	}
+}
+
+// Start 启动汇总服务，首次运行时会补齐所有历史数据
+func (s *AnalyticsRollupService) Start() {
+	log.Println("📊 Starting analytics rollup service...")
+
+	s.runRollup()
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.runRollup()
+		case <-s.stopChan:
+			log.Println("🛑 Analytics rollup service stopped")
+			return
+		}
+	}
+}
+
+// Stop 停止汇总服务
+func (s *AnalyticsRollupService) Stop() {
+	close(s.stopChan)
+}
+
+func (s *AnalyticsRollupService) runRollup() {
+	if err := s.RollupPending(); err != nil {
+		log.Printf("❌ Error rolling up analytics: %v", err)
+	}
+}
+
+// RollupPending 重算最后一个完整汇总日之后直到今天的每一天
+func (s *AnalyticsRollupService) RollupPending() error {
+	today := truncateDay(time.Now())
+
+	from, err := firstPendingRollupDay(today)
+	if err != nil {
+		return err
+	}
+
+	for _, day := range rollupDays(from, today) {
+		if err := s.RollupDay(day); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RollupDay 用原始访问记录重算某一天的汇总数据，开启 analytics.exclude_bots 时不统计爬虫访问
+func (s *AnalyticsRollupService) RollupDay(day time.Time) error {
+	date := day.Format("2006-01-02")
+	excludeBots := s.settingsService.GetBoolValue("analytics", "exclude_bots", true)
+
+	tx := database.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// 多个实例同时汇总时串行执行，避免重复插入
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext('analytics_rollup'))").Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to acquire rollup lock: %w", err)
+	}
+
+	if err := tx.Where("day = ?", date).Delete(&models.AnalyticsDaily{}).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to clear daily rollup for %s: %w", date, err)
+	}
+	if err := tx.Where("day = ?", date).Delete(&models.AnalyticsDailyBreakdown{}).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to clear daily breakdown for %s: %w", date, err)
+	}
+	if err := tx.Where("day = ?", date).Delete(&models.AnalyticsDailyCampaign{}).Error; err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to clear daily campaigns for %s: %w", date, err)
+	}
+
+	err := tx.Exec(`INSERT INTO analytics_daily (content_id, day, user_id, views, unique_ips, updated_at)
+		SELECT ca.content_id, ?::date, c.user_id, COUNT(*), COUNT(DISTINCT `+visitorKeySQL+`), NOW()
+		FROM content_analytics ca JOIN contents c ON c.id = ca.content_id
+		WHERE ca.access_time >= ?::date AND ca.access_time < ?::date + 1 AND NOT (ca.is_bot AND ?)
+		GROUP BY ca.content_id, c.user_id`, date, date, date, excludeBots).Error
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to roll up daily views for %s: %w", date, err)
+	}
+
+	err = tx.Exec(`INSERT INTO analytics_daily_breakdowns (content_id, day, user_id, country, region, city, referer_host, referer_category, device_class, browser, os, views)
+		SELECT ca.content_id, ?::date, c.user_id,
+			left(COALESCE(ca.country, ''), 100), left(COALESCE(ca.region, ''), 100), left(COALESCE(ca.city, ''), 100),
+			left(COALESCE(lower(substring(ca.referer FROM ?)), ''), 255),
+			COALESCE(NULLIF(ca.referer_category, ''), 'direct'),
+			COALESCE(NULLIF(ca.device_type, ''), 'unknown'), ca.browser, ca.os,
+			COUNT(*)
+		FROM content_analytics ca JOIN contents c ON c.id = ca.content_id
+		WHERE ca.access_time >= ?::date AND ca.access_time < ?::date + 1 AND NOT (ca.is_bot AND ?)
+		GROUP BY 1, 3, 4, 5, 6, 7, 8, 9, 10, 11`, date, refererHostPattern, date, date, excludeBots).Error
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to roll up daily breakdown for %s: %w", date, err)
+	}
+
+	// 只统计带有 UTM 参数的访问
+	err = tx.Exec(`INSERT INTO analytics_daily_campaigns (content_id, day, user_id, utm_source, utm_medium, utm_campaign, views)
+		SELECT ca.content_id, ?::date, c.user_id, ca.utm_source, ca.utm_medium, ca.utm_campaign, COUNT(*)
+		FROM content_analytics ca JOIN contents c ON c.id = ca.content_id
+		WHERE ca.access_time >= ?::date AND ca.access_time < ?::date + 1 AND NOT (ca.is_bot AND ?)
+			AND (ca.utm_source <> '' OR ca.utm_medium <> '' OR ca.utm_campaign <> '')
+		GROUP BY 1, 3, 4, 5, 6`, date, date, date, excludeBots).Error
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to roll up daily campaigns for %s: %w", date, err)
+	}
+
+	err = tx.Exec(`INSERT INTO analytics_daily_totals (day, views, unique_ips, updated_at)
+		SELECT ?::date, COUNT(*), COUNT(DISTINCT `+visitorKeySQL+`), NOW()
+		FROM content_analytics ca
+		WHERE ca.access_time >= ?::date AND ca.access_time < ?::date + 1 AND NOT (ca.is_bot AND ?)
+		ON CONFLICT (day) DO UPDATE SET views = EXCLUDED.views, unique_ips = EXCLUDED.unique_ips, updated_at = EXCLUDED.updated_at`,
+		date, date, date, excludeBots).Error
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to roll up daily totals for %s: %w", date, err)
+	}
+
+	if err := rollupVisitorSketches(tx, date, excludeBots); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return fmt.Errorf("failed to commit rollup for %s: %w", date, err)
+	}
+	return nil
+}
+
+// rollupVisitorSketches 为当天每个内容和全站生成访客草图
+func rollupVisitorSketches(tx *gorm.DB, date string, excludeBots bool) error {
+	rows, err := tx.Raw(`SELECT DISTINCT ca.content_id, `+visitorKeySQL+`
+		FROM content_analytics ca
+		WHERE ca.access_time >= ?::date AND ca.access_time < ?::date + 1 AND NOT (ca.is_bot AND ?)`,
+		date, date, excludeBots).Rows()
+	if err != nil {
+		return fmt.Errorf("failed to read visitors for %s: %w", date, err)
+	}
+
+	sketches := make(map[uuid.UUID]*HyperLogLog)
+	total := NewHyperLogLog()
+	for rows.Next() {
+		var contentID uuid.UUID
+		var visitor string
+		if err := rows.Scan(&contentID, &visitor); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan visitor for %s: %w", date, err)
+		}
+		sketch, ok := sketches[contentID]
+		if !ok {
+			sketch = NewHyperLogLog()
+			sketches[contentID] = sketch
+		}
+		sketch.Add(visitor)
+		total.Add(visitor)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read visitors for %s: %w", date, err)
+	}
+
+	for contentID, sketch := range sketches {
+		err := tx.Model(&models.AnalyticsDaily{}).
+			Where("content_id = ? AND day = ?", contentID, date).
+			UpdateColumn("visitor_sketch", sketch.Bytes()).Error
+		if err != nil {
+			return fmt.Errorf("failed to save visitor sketch for %s: %w", date, err)
+		}
+	}
+	err = tx.Model(&models.AnalyticsDailyTotal{}).
+		Where("day = ?", date).
+		UpdateColumn("visitor_sketch", total.Bytes()).Error
+	if err != nil {
+		return fmt.Errorf("failed to save total visitor sketch for %s: %w", date, err)
+	}
+	return nil
+}
+
+// lastCompleteRollupDay 返回最后一个完整汇总的日期：该天结束并过了宽限期之后还重算过
+func lastCompleteRollupDay() (time.Time, bool, error) {
+	var last sql.NullTime
+	err := database.DB.Raw(`SELECT MAX(day) FROM analytics_daily_totals
+		WHERE updated_at >= (day + 1)::timestamp + make_interval(mins => ?)`, int(rollupGracePeriod/time.Minute)).
+		Row().Scan(&last)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("failed to find last complete rollup day: %w", err)
+	}
+	if !last.Valid {
+		return time.Time{}, false, nil
+	}
+	return truncateDay(last.Time), true, nil
+}
+
+// firstPendingRollupDay 返回需要重算的第一天；还没有完整汇总过时从最早的原始访问记录开始
+func firstPendingRollupDay(today time.Time) (time.Time, error) {
+	last, ok, err := lastCompleteRollupDay()
+	if err != nil {
+		return today, err
+	}
+	if ok {
+		return last.AddDate(0, 0, 1), nil
+	}
+
+	var first sql.NullTime
+	if err := database.DB.Raw("SELECT MIN(access_time) FROM content_analytics").Row().Scan(&first); err != nil {
+		return today, fmt.Errorf("failed to find first analytics record: %w", err)
+	}
+	if !first.Valid {
+		return today, nil
+	}
+	return truncateDay(first.Time), nil
+}
+
+// pruneRawAnalytics 删除超过保留天数且已完整汇总的原始访问记录，retentionDays 为 0 时永久保留
+func pruneRawAnalytics(retentionDays int) (int64, error) {
+	if retentionDays <= 0 {
+		return 0, nil
+	}
+
+	last, ok, err := lastCompleteRollupDay()
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, nil
+	}
+	cutoff := rawPruneCutoff(time.Now(), retentionDays, last).Format("2006-01-02")
+
+	var total int64
+	for {
+		result := database.DB.Exec(`DELETE FROM content_analytics WHERE id IN (
+			SELECT id FROM content_analytics WHERE access_time < ?::date LIMIT ?)`, cutoff, rawPruneBatchSize)
+		if result.Error != nil {
+			return total, fmt.Errorf("failed to prune raw analytics: %w", result.Error)
+		}
+		total += result.RowsAffected
+		if result.RowsAffected < rawPruneBatchSize {
+			return total, nil
+		}
+	}
+}
+
+// rawPruneCutoff 计算原始访问记录的删除界限（不含当天），不会超过最后一个完整汇总日
+func rawPruneCutoff(now time.Time, retentionDays int, lastComplete time.Time) time.Time {
+	cutoff := truncateDay(now).AddDate(0, 0, -retentionDays)
+	if limit := truncateDay(lastComplete).AddDate(0, 0, 1); cutoff.After(limit) {
+		return limit
+	}
+	return cutoff
+}
+
+// rollupDays 返回 from 到 to（含）之间的每一天，from 晚于 to 时只返回 to
+func rollupDays(from, to time.Time) []time.Time {
+	from, to = truncateDay(from), truncateDay(to)
+	if from.After(to) {
+		return []time.Time{to}
+	}
+
+	var days []time.Time
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		days = append(days, day)
+	}
+	return days
+}
+
+// truncateDay 返回本地时区中当天的零点；数据库中的 DATE 以 UTC 零点读出，只取年月日
+func truncateDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRollupDays(t *testing.T) {
+	from := time.Date(2024, 2, 27, 15, 30, 0, 0, time.Local)
+	to := time.Date(2024, 3, 1, 8, 0, 0, 0, time.Local)
+
+	days := rollupDays(from, to)
+	want := []string{"2024-02-27", "2024-02-28", "2024-02-29", "2024-03-01"}
+	if len(days) != len(want) {
+		t.Fatalf("期望 %d 天, 实际 %d 天", len(want), len(days))
+	}
+	for i, day := range days {
+		if got := day.Format("2006-01-02"); got != want[i] {
+			t.Errorf("第 %d 天期望 %s, 实际 %s", i, want[i], got)
+		}
+		if day.Hour() != 0 || day.Minute() != 0 {
+			t.Errorf("日期 %v 应该是当天零点", day)
+		}
+	}
+
+	// from 晚于 to 时只重算 to 这一天
+	days = rollupDays(to.AddDate(0, 0, 2), to)
+	if len(days) != 1 || days[0].Format("2006-01-02") != "2024-03-01" {
+		t.Errorf("from 晚于 to 时期望只返回 2024-03-01, 实际 %v", days)
+	}
+}
+
+func TestTruncateDayFromUTCDate(t *testing.T) {
+	// 数据库中的 DATE 以 UTC 零点读出，转换后年月日不变
+	day := truncateDay(time.Date(2024, 5, 6, 0, 0, 0, 0, time.UTC))
+	if got := day.Format("2006-01-02"); got != "2024-05-06" {
+		t.Errorf("期望 2024-05-06, 实际 %s", got)
+	}
+	if day.Location() != time.Local {
+		t.Errorf("期望本地时区, 实际 %v", day.Location())
+	}
+}
+
+func TestRawPruneCutoff(t *testing.T) {
+	now := time.Date(2024, 6, 30, 12, 0, 0, 0, time.Local)
+
+	tests := []struct {
+		name          string
+		retentionDays int
+		lastComplete  time.Time
+		want          string
+	}{
+		{"汇总已是最新时按保留天数删除", 90, time.Date(2024, 6, 29, 0, 0, 0, 0, time.Local), "2024-04-01"},
+		{"汇总落后时只删除已汇总的日期", 90, time.Date(2024, 3, 15, 0, 0, 0, 0, time.Local), "2024-03-16"},
+		{"最后汇总日恰好在界限前一天", 1, time.Date(2024, 6, 28, 0, 0, 0, 0, time.Local), "2024-06-29"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := rawPruneCutoff(now, tt.retentionDays, tt.lastComplete).Format("2006-01-02")
+			if got != tt.want {
+				t.Errorf("期望 %s, 实际 %s", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"anywebsites/internal/database"
+	"anywebsites/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrAnonymousUploadDisabled 未开启匿名上传
+	ErrAnonymousUploadDisabled = errors.New("anonymous uploads are disabled")
+	// ErrAnonymousQuotaExceeded 当前 IP 的匿名上传次数已用完
+	ErrAnonymousQuotaExceeded = errors.New("anonymous upload quota exceeded")
+	// ErrAnonymousContentTooLarge 匿名上传内容超过大小限制
+	ErrAnonymousContentTooLarge = errors.New("anonymous content too large")
+	// ErrInvalidDeletionToken 删除令牌无效或内容不存在
+	ErrInvalidDeletionToken = errors.New("invalid deletion token")
+	// ErrAnonymousOwnerConflict 用户名 anonymous 被非系统账户占用或系统账户被启用
+	ErrAnonymousOwnerConflict = errors.New("user \"anonymous\" is not the disabled anonymous system account")
+)
+
+// anonymousQuotaWindow 匿名上传配额的统计窗口
+const anonymousQuotaWindow = 24 * time.Hour
+
+// AnonymousUploadService 匿名上传服务，开关和配额由系统设置的 upload 分类控制
+type AnonymousUploadService struct {
+	settingsService *SettingsService
+	sanitizer       *HTMLSanitizer
+
+	ownerID    uuid.UUID
+	ownerMutex sync.Mutex
+}
+
+// NewAnonymousUploadService 创建匿名上传服务实例
+func NewAnonymousUploadService(settingsService *SettingsService, sanitizer *HTMLSanitizer) *AnonymousUploadService {
+	return &AnonymousUploadService{
+		settingsService: settingsService,
+		sanitizer:       sanitizer,
+	}
+}
+
+// AnonymousUploadRequest 匿名上传请求，匿名内容始终公开且不能自定义过期时间
+type AnonymousUploadRequest struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Content     string `json:"content" binding:"required"`
+}
+
+// Enabled 检查是否允许匿名上传
+func (s *AnonymousUploadService) Enabled() bool {
+	return s.settingsService.GetBoolValue("upload", "anonymous_enabled", false)
+}
+
+// Upload 以匿名系统账户发布内容，返回内容和只显示一次的删除令牌
+func (s *AnonymousUploadService) Upload(clientIP string, req *AnonymousUploadRequest) (*models.Content, string, error) {
+	if !s.Enabled() {
+		return nil, "", ErrAnonymousUploadDisabled
+	}
+
+	maxSize := s.settingsService.GetIntValue("upload", "anonymous_max_size", 512*1024)
+	if maxSize > 0 && len(req.Content) > maxSize {
+		return nil, "", fmt.Errorf("%w (max %d bytes)", ErrAnonymousContentTooLarge, maxSize)
+	}
+
+	ownerID, err := s.owner()
+	if err != nil {
+		return nil, "", err
+	}
+
+	token, err := generateDeletionToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	expiryHours := s.settingsService.GetIntValue("upload", "anonymous_expiry_hours", 24)
+	if expiryHours <= 0 {
+		expiryHours = 24
+	}
+	expiresAt := time.Now().Add(time.Duration(expiryHours) * time.Hour)
+
+	// 匿名内容使用匿名系统账户所属计划的 HTML 策略
+	body, err := s.sanitizer.Sanitize(ownerID, req.Content)
+	if err != nil {
+		return nil, "", err
+	}
+
+	content := &models.Content{
+		UserID:      ownerID,
+		Title:       req.Title,
+		Description: req.Description,
+		Content:     body,
+		ContentType: "text/html",
+		Visibility:  models.VisibilityPublic,
+		FileSize:    int64(len(body)),
+		ExpiresAt:   &expiresAt,
+		IsActive:    true,
+	}
+
+	// 开始事务
+	tx := database.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// 锁定系统账户使匿名上传串行执行，并发请求不能同时通过配额检查
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").
+		Where("id = ?", ownerID).First(&models.User{}).Error; err != nil {
+		tx.Rollback()
+		return nil, "", fmt.Errorf("failed to lock anonymous user: %w", err)
+	}
+
+	quota := s.settingsService.GetIntValue("upload", "anonymous_daily_quota", 5)
+	var count int64
+	if err := tx.Model(&models.AnonymousUpload{}).
+		Where("ip_address = ? AND created_at > ?", clientIP, time.Now().Add(-anonymousQuotaWindow)).
+		Count(&count).Error; err != nil {
+		tx.Rollback()
+		return nil, "", fmt.Errorf("failed to count anonymous uploads: %w", err)
+	}
+	if count >= int64(quota) {
+		tx.Rollback()
+		return nil, "", ErrAnonymousQuotaExceeded
+	}
+
+	if err := saveContentRow(tx, content, true); err != nil {
+		tx.Rollback()
+		return nil, "", fmt.Errorf("failed to create content: %w", err)
+	}
+
+	upload := &models.AnonymousUpload{
+		ContentID:         content.ID,
+		IPAddress:         clientIP,
+		DeletionTokenHash: hashAPIKey(token),
+	}
+	if err := tx.Create(upload).Error; err != nil {
+		tx.Rollback()
+		return nil, "", fmt.Errorf("failed to record anonymous upload: %w", err)
+	}
+
+	if err := updateUsageStatistics(tx, ownerID, 1, content.FileSize, 0); err != nil {
+		tx.Rollback()
+		return nil, "", fmt.Errorf("failed to update usage statistics: %w", err)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, "", fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return content, token, nil
+}
+
+// Delete 凭删除令牌删除匿名内容
+func (s *AnonymousUploadService) Delete(contentID uuid.UUID, token string) error {
+	if token == "" {
+		return ErrInvalidDeletionToken
+	}
+
+	var upload models.AnonymousUpload
+	if err := database.DB.Where("content_id = ?", contentID).First(&upload).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidDeletionToken
+		}
+		return err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashAPIKey(token)), []byte(upload.DeletionTokenHash)) != 1 {
+		return ErrInvalidDeletionToken
+	}
+
+	affected, err := setContentsActive(false, "id = ?", contentID)
+	if err != nil {
+		return fmt.Errorf("failed to delete content: %w", err)
+	}
+	if affected == 0 {
+		return ErrInvalidDeletionToken
+	}
+
+	return nil
+}
+
+// owner 获取匿名内容归属的系统账户，账户不存在时创建一个禁用的系统账户；
+// 同名用户不是禁用的系统账户时拒绝上传，避免匿名内容归到普通用户名下
+func (s *AnonymousUploadService) owner() (uuid.UUID, error) {
+	s.ownerMutex.Lock()
+	defer s.ownerMutex.Unlock()
+
+	if s.ownerID != uuid.Nil {
+		return s.ownerID, nil
+	}
+
+	var user models.User
+	err := database.DB.Where("username = ?", models.AnonymousUsername).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		// 密码不是合法的 bcrypt 哈希，该账户无法登录；使用 map 写入，is_active 的零值不会被列默认值覆盖
+		now := time.Now()
+		user = models.User{
+			ID:        uuid.New(),
+			Username:  models.AnonymousUsername,
+			Email:     models.AnonymousUsername + "@anywebsites.local",
+			Password:  "!",
+			IsActive:  false,
+			IsSystem:  true,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		if err := database.DB.Model(&models.User{}).Create(map[string]interface{}{
+			"id": user.ID, "username": user.Username, "email": user.Email, "password": user.Password,
+			"is_active": user.IsActive, "is_system": user.IsSystem, "created_at": now, "updated_at": now,
+		}).Error; err != nil {
+			return uuid.Nil, fmt.Errorf("failed to create anonymous user: %w", err)
+		}
+	} else if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to get anonymous user: %w", err)
+	}
+
+	if !user.IsSystem || user.IsActive {
+		log.Printf("Anonymous uploads refused: user %s (%s) is not the disabled anonymous system account", user.ID, user.Username)
+		return uuid.Nil, ErrAnonymousOwnerConflict
+	}
+
+	s.ownerID = user.ID
+	return s.ownerID, nil
+}
+
+// generateDeletionToken 生成匿名内容的删除令牌
+func generateDeletionToken() (string, error) {
+	bytes := make([]byte, 24)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("failed to generate deletion token: %w", err)
+	}
+	return hex.EncodeToString(bytes), nil
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"anywebsites/internal/models"
+)
+
+func TestGenerateDeletionToken(t *testing.T) {
+	first, err := generateDeletionToken()
+	if err != nil {
+		t.Fatalf("生成删除令牌失败: %v", err)
+	}
+	second, err := generateDeletionToken()
+	if err != nil {
+		t.Fatalf("生成删除令牌失败: %v", err)
+	}
+
+	if len(first) != 48 {
+		t.Errorf("删除令牌长度 = %d，期望 48", len(first))
+	}
+	if first == second {
+		t.Error("两次生成的删除令牌不应相同")
+	}
+	if hashAPIKey(first) == hashAPIKey(second) {
+		t.Error("不同令牌的哈希不应相同")
+	}
+}
+
+func TestValidateAnonymousUploadSettings(t *testing.T) {
+	s := &SettingsService{}
+	tests := []struct {
+		key     string
+		value   interface{}
+		wantErr bool
+	}{
+		{"anonymous_enabled", true, false},
+		{"anonymous_enabled", "yes", true},
+		{"anonymous_daily_quota", 10, false},
+		{"anonymous_daily_quota", -1, true},
+		{"anonymous_max_size", 0, false},
+		{"anonymous_expiry_hours", 24, false},
+		{"anonymous_expiry_hours", 0, true},
+		{"anonymous_expiry_hours", 24*7 + 1, true},
+	}
+
+	for _, tt := range tests {
+		err := s.validateUploadSetting(tt.key, tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("validateUploadSetting(%q, %v) error = %v，期望出错 %v", tt.key, tt.value, err, tt.wantErr)
+		}
+	}
+}
+
+func TestAnonymousUploadOwner(t *testing.T) {
+	db := useTestDB(t, &models.User{})
+
+	// 首次上传时创建禁用的系统账户
+	service := &AnonymousUploadService{}
+	ownerID, err := service.owner()
+	if err != nil {
+		t.Fatalf("创建系统账户失败: %v", err)
+	}
+	var owner models.User
+	if err := db.First(&owner, "id = ?", ownerID).Error; err != nil {
+		t.Fatalf("读取系统账户失败: %v", err)
+	}
+	if !owner.IsSystem || owner.IsActive {
+		t.Errorf("系统账户应为禁用的系统账户: is_system=%v is_active=%v", owner.IsSystem, owner.IsActive)
+	}
+
+	// 同名的普通用户不能作为匿名内容的归属账户
+	db.Exec("DELETE FROM users")
+	db.Create(&models.User{Username: models.AnonymousUsername, Email: "someone@example.com", Password: "hash", IsActive: true})
+	if _, err := (&AnonymousUploadService{}).owner(); !errors.Is(err, ErrAnonymousOwnerConflict) {
+		t.Errorf("普通用户占用用户名时应返回 ErrAnonymousOwnerConflict, 实际 %v", err)
+	}
+}
@@ -0,0 +1,208 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"anywebsites/internal/database"
+	"anywebsites/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidAPIKey API 密钥无效、已吊销或所属用户已禁用
+	ErrInvalidAPIKey = errors.New("invalid API key")
+	// ErrAPIKeyNotFound API 密钥不存在
+	ErrAPIKeyNotFound = errors.New("API key not found")
+)
+
+// maxAPIKeysPerUser 每个用户可同时持有的有效密钥数量
+const maxAPIKeysPerUser = 20
+
+// apiKeyTouchInterval 最后使用时间的最小更新间隔，避免每次请求都写数据库
+const apiKeyTouchInterval = time.Minute
+
+// AllAPIKeyScopes 全部权限范围
+var AllAPIKeyScopes = []models.APIKeyScope{models.ScopeRead, models.ScopeWrite, models.ScopeDelete}
+
+// APIKeyService API 密钥服务
+type APIKeyService struct{}
+
+// NewAPIKeyService 创建 API 密钥服务实例
+func NewAPIKeyService() *APIKeyService {
+	return &APIKeyService{}
+}
+
+// CreateAPIKeyRequest 创建 API 密钥请求
+type CreateAPIKeyRequest struct {
+	Name   string               `json:"name" binding:"required,max=100"`
+	Scopes []models.APIKeyScope `json:"scopes"`
+}
+
+// Create 为用户创建新的 API 密钥，返回密钥记录和只显示一次的明文
+func (s *APIKeyService) Create(userID uuid.UUID, req *CreateAPIKeyRequest) (*models.APIKey, string, error) {
+	scopes := req.Scopes
+	if len(scopes) == 0 {
+		scopes = []models.APIKeyScope{models.ScopeRead}
+	}
+	scopeNames := make([]string, 0, len(scopes))
+	seen := make(map[models.APIKeyScope]bool)
+	for _, scope := range scopes {
+		if !models.IsValidAPIKeyScope(scope) {
+			return nil, "", fmt.Errorf("invalid scope: %s", scope)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopeNames = append(scopeNames, string(scope))
+		}
+	}
+
+	var count int64
+	if err := database.DB.Model(&models.APIKey{}).Where("user_id = ? AND revoked_at IS NULL", userID).Count(&count).Error; err != nil {
+		return nil, "", fmt.Errorf("failed to count API keys: %w", err)
+	}
+	if count >= maxAPIKeysPerUser {
+		return nil, "", fmt.Errorf("too many active API keys (max %d)", maxAPIKeysPerUser)
+	}
+
+	return s.create(database.DB, userID, req.Name, strings.Join(scopeNames, ","))
+}
+
+// create 生成密钥并写入数据库
+func (s *APIKeyService) create(db *gorm.DB, userID uuid.UUID, name, scopes string) (*models.APIKey, string, error) {
+	bytes := make([]byte, 24)
+	if _, err := rand.Read(bytes); err != nil {
+		return nil, "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	plaintext := models.APIKeyPrefix + hex.EncodeToString(bytes)
+
+	key := &models.APIKey{
+		UserID:  userID,
+		Name:    name,
+		Prefix:  plaintext[:len(models.APIKeyPrefix)+6],
+		KeyHash: hashAPIKey(plaintext),
+		Scopes:  scopes,
+	}
+	if err := db.Create(key).Error; err != nil {
+		return nil, "", fmt.Errorf("failed to create API key: %w", err)
+	}
+
+	return key, plaintext, nil
+}
+
+// List 获取用户的 API 密钥（含已吊销），按创建时间倒序
+func (s *APIKeyService) List(userID uuid.UUID) ([]models.APIKey, error) {
+	var keys []models.APIKey
+	if err := database.DB.Where("user_id = ?", userID).Order("created_at DESC").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// Revoke 吊销用户的 API 密钥
+func (s *APIKeyService) Revoke(userID, keyID uuid.UUID) error {
+	result := database.DB.Model(&models.APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", keyID, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("failed to revoke API key: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+// Reset 吊销用户的全部密钥并生成一个拥有全部权限的新密钥（管理后台使用）
+func (s *APIKeyService) Reset(userID uuid.UUID) (string, error) {
+	tx := database.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := tx.Model(&models.APIKey{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error; err != nil {
+		tx.Rollback()
+		return "", fmt.Errorf("failed to revoke API keys: %w", err)
+	}
+
+	scopes := make([]string, len(AllAPIKeyScopes))
+	for i, scope := range AllAPIKeyScopes {
+		scopes[i] = string(scope)
+	}
+	_, plaintext, err := s.create(tx, userID, "default", strings.Join(scopes, ","))
+	if err != nil {
+		tx.Rollback()
+		return "", err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return "", fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return plaintext, nil
+}
+
+// Authenticate 校验 API 密钥明文，返回密钥记录和所属用户
+func (s *APIKeyService) Authenticate(plaintext string) (*models.APIKey, *models.User, error) {
+	if plaintext == "" {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	var key models.APIKey
+	if err := database.DB.Where("key_hash = ? AND revoked_at IS NULL", hashAPIKey(plaintext)).First(&key).Error; err != nil {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	var user models.User
+	if err := database.DB.Where("id = ? AND is_active = ?", key.UserID, true).First(&user).Error; err != nil {
+		return nil, nil, ErrInvalidAPIKey
+	}
+
+	s.touch(&key)
+	return &key, &user, nil
+}
+
+// CheckActive 检查密钥未被撤销且所属用户仍然有效，用于长连接在推送期间定期复查
+func (s *APIKeyService) CheckActive(keyID uuid.UUID) (*models.User, error) {
+	var key models.APIKey
+	if err := database.DB.Where("id = ? AND revoked_at IS NULL", keyID).First(&key).Error; err != nil {
+		return nil, ErrInvalidAPIKey
+	}
+
+	var user models.User
+	if err := database.DB.Where("id = ? AND is_active = ?", key.UserID, true).First(&user).Error; err != nil {
+		return nil, ErrInvalidAPIKey
+	}
+	return &user, nil
+}
+
+// touch 异步更新密钥的最后使用时间
+func (s *APIKeyService) touch(key *models.APIKey) {
+	now := time.Now()
+	if key.LastUsedAt != nil && now.Sub(*key.LastUsedAt) < apiKeyTouchInterval {
+		return
+	}
+	go func(id uuid.UUID) {
+		if err := database.DB.Model(&models.APIKey{}).Where("id = ?", id).Update("last_used_at", now).Error; err != nil {
+			log.Printf("Failed to update API key last used time: %v", err)
+		}
+	}(key.ID)
+}
+
+// hashAPIKey 计算 API 密钥的 SHA-256 哈希
+func hashAPIKey(plaintext string) string {
+	sum := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(sum[:])
+}
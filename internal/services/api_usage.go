@@ -0,0 +1,139 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"anywebsites/internal/database"
+	"anywebsites/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// apiUsageFlushInterval API 调用次数写入数据库的间隔
+const apiUsageFlushInterval = 10 * time.Second
+
+// APIUsageRecorder 在内存中按用户累加 API 调用次数，定期用一条批量 UPSERT 写入当月的使用统计
+type APIUsageRecorder struct {
+	writer   func(counts map[uuid.UUID]int) error
+	interval time.Duration
+
+	mutex  sync.Mutex
+	counts map[uuid.UUID]int
+
+	done      chan struct{}
+	finished  chan struct{}
+	startOnce sync.Once
+	closeOnce sync.Once
+}
+
+// NewAPIUsageRecorder 创建 API 调用计数器，需调用 Start 启动定时写入
+func NewAPIUsageRecorder() *APIUsageRecorder {
+	return newAPIUsageRecorder(apiUsageFlushInterval, writeAPIUsageBatch)
+}
+
+func newAPIUsageRecorder(interval time.Duration, writer func(map[uuid.UUID]int) error) *APIUsageRecorder {
+	return &APIUsageRecorder{
+		writer:   writer,
+		interval: interval,
+		counts:   make(map[uuid.UUID]int),
+		done:     make(chan struct{}),
+		finished: make(chan struct{}),
+	}
+}
+
+// Start 启动定时写入
+func (r *APIUsageRecorder) Start() {
+	r.startOnce.Do(func() {
+		go r.run()
+	})
+}
+
+// Record 累加一次 API 调用，只修改内存中的计数
+func (r *APIUsageRecorder) Record(userID uuid.UUID) {
+	r.mutex.Lock()
+	r.counts[userID]++
+	r.mutex.Unlock()
+}
+
+// Close 停止定时写入并写入剩余的计数，超时后返回 false
+func (r *APIUsageRecorder) Close(timeout time.Duration) bool {
+	r.closeOnce.Do(func() {
+		close(r.done)
+	})
+	// 未启动时直接写入
+	r.startOnce.Do(func() {
+		r.flush()
+		close(r.finished)
+	})
+
+	select {
+	case <-r.finished:
+		return true
+	case <-time.After(timeout):
+		log.Printf("API usage recorder did not flush within %s", timeout)
+		return false
+	}
+}
+
+func (r *APIUsageRecorder) run() {
+	defer close(r.finished)
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			r.flush()
+		case <-r.done:
+			r.flush()
+			return
+		}
+	}
+}
+
+// flush 取出当前的计数并写入，写入失败时只记录日志，不影响 API 请求
+func (r *APIUsageRecorder) flush() {
+	r.mutex.Lock()
+	counts := r.counts
+	if len(counts) == 0 {
+		r.mutex.Unlock()
+		return
+	}
+	r.counts = make(map[uuid.UUID]int, len(counts))
+	r.mutex.Unlock()
+
+	if err := r.writer(counts); err != nil {
+		log.Printf("Failed to record API calls for %d users: %v", len(counts), err)
+	}
+}
+
+// writeAPIUsageBatch 用一条 UPSERT 累加多个用户当月的 API 调用次数
+// 新建的当月记录与 updateUsageStatistics 一样同步存储用量快照
+func writeAPIUsageBatch(counts map[uuid.UUID]int) error {
+	values := make([]string, 0, len(counts))
+	args := make([]interface{}, 0, len(counts)*2+3)
+	args = append(args, models.GetCurrentMonthYear(), bytesPerMB-1, bytesPerMB)
+	for userID, calls := range counts {
+		values = append(values, "(?::uuid, ?::int)")
+		args = append(args, userID, calls)
+	}
+
+	err := database.DB.Exec(`
+		INSERT INTO usage_statistics (user_id, month_year, articles_uploaded, storage_used_mb, api_calls_made, created_at, updated_at)
+		SELECT v.user_id, ?, 0, COALESCE((SELECT (su.used_bytes + ?) / ? FROM storage_usages su WHERE su.user_id = v.user_id), 0), v.calls, NOW(), NOW()
+		FROM (VALUES `+strings.Join(values, ", ")+`) AS v(user_id, calls)
+		ON CONFLICT (user_id, month_year)
+		DO UPDATE SET
+			api_calls_made = usage_statistics.api_calls_made + EXCLUDED.api_calls_made,
+			updated_at = NOW()
+	`, args...).Error
+	if err != nil {
+		return fmt.Errorf("failed to upsert API usage: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// usageWriter 记录每次批量写入的计数
+type usageWriter struct {
+	mutex   sync.Mutex
+	batches []map[uuid.UUID]int
+}
+
+func (w *usageWriter) write(counts map[uuid.UUID]int) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.batches = append(w.batches, counts)
+	return nil
+}
+
+func (w *usageWriter) total(userID uuid.UUID) int {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	total := 0
+	for _, batch := range w.batches {
+		total += batch[userID]
+	}
+	return total
+}
+
+func TestAPIUsageRecorder_FlushByInterval(t *testing.T) {
+	writer := &usageWriter{}
+	recorder := newAPIUsageRecorder(10*time.Millisecond, writer.write)
+	recorder.Start()
+	defer recorder.Close(time.Second)
+
+	alice, bob := uuid.New(), uuid.New()
+	for i := 0; i < 3; i++ {
+		recorder.Record(alice)
+	}
+	recorder.Record(bob)
+
+	if !waitFor(func() bool { return writer.total(alice) == 3 && writer.total(bob) == 1 }) {
+		t.Fatalf("应在刷新间隔后写入累加的计数")
+	}
+	writer.mutex.Lock()
+	defer writer.mutex.Unlock()
+	if len(writer.batches[0]) != 2 {
+		t.Errorf("同一间隔内的调用应合并为一次写入，实际 %v", writer.batches)
+	}
+}
+
+func TestAPIUsageRecorder_CloseFlushes(t *testing.T) {
+	writer := &usageWriter{}
+	recorder := newAPIUsageRecorder(time.Hour, writer.write)
+	recorder.Start()
+
+	userID := uuid.New()
+	for i := 0; i < 5; i++ {
+		recorder.Record(userID)
+	}
+	if !recorder.Close(time.Second) {
+		t.Fatalf("关闭时应在超时前写入剩余计数")
+	}
+	if writer.total(userID) != 5 {
+		t.Errorf("关闭后应写入全部 5 次调用，实际 %d", writer.total(userID))
+	}
+}
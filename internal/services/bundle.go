@@ -0,0 +1,237 @@
+package services
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// BundleIndexFile 站点包的入口文件
+const BundleIndexFile = "index.html"
+
+// maxBundleFiles 单个站点包允许的最大文件数
+const maxBundleFiles = 1000
+
+var (
+	// ErrUnsupportedBundle 不支持的压缩包格式
+	ErrUnsupportedBundle = errors.New("unsupported bundle format, expected .zip, .tar.gz or .tgz")
+	// ErrBundleTooLarge 解压后的站点包超过大小限制
+	ErrBundleTooLarge = errors.New("bundle exceeds the extracted size limit")
+	// ErrBundleMissingIndex 站点包缺少 index.html
+	ErrBundleMissingIndex = errors.New("bundle must contain an index.html at its root")
+)
+
+// bundleExtractor 站点包解压器，负责路径校验和大小限制
+type bundleExtractor struct {
+	destDir  string
+	maxSize  int64
+	written  int64
+	numFiles int
+}
+
+// isBundleFilename 根据文件名判断是否为支持的站点包格式
+func isBundleFilename(filename string) bool {
+	name := strings.ToLower(filename)
+	return strings.HasSuffix(name, ".zip") || strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tgz")
+}
+
+// extractBundle 将 zip 或 tar.gz 压缩包解压到 destDir，返回解压后的总字节数
+// 如果压缩包内所有文件都位于同一个顶层目录下，会自动去掉该目录层级
+func extractBundle(filename string, r io.ReaderAt, size int64, destDir string, maxSize int64) (int64, error) {
+	e := &bundleExtractor{destDir: destDir, maxSize: maxSize}
+
+	name := strings.ToLower(filename)
+	var err error
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		err = e.extractZip(r, size)
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		err = e.extractTarGz(io.NewSectionReader(r, 0, size))
+	default:
+		err = ErrUnsupportedBundle
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if err := flattenBundleRoot(destDir); err != nil {
+		return 0, fmt.Errorf("failed to normalize bundle root: %w", err)
+	}
+
+	if info, err := os.Stat(filepath.Join(destDir, BundleIndexFile)); err != nil || info.IsDir() {
+		return 0, ErrBundleMissingIndex
+	}
+
+	return e.written, nil
+}
+
+// extractZip 解压 zip 压缩包
+func (e *bundleExtractor) extractZip(r io.ReaderAt, size int64) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return fmt.Errorf("invalid zip archive: %w", err)
+	}
+
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		// 跳过符号链接等非普通文件
+		if !f.Mode().IsRegular() {
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", f.Name, err)
+		}
+		err = e.writeFile(f.Name, rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// extractTarGz 解压 tar.gz 压缩包
+func (e *bundleExtractor) extractTarGz(r io.Reader) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("invalid gzip archive: %w", err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid tar archive: %w", err)
+		}
+		// 只解压普通文件，目录会在写入文件时自动创建
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := e.writeFile(header.Name, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// writeFile 将单个文件写入解压目录，拒绝越出目标目录的路径
+func (e *bundleExtractor) writeFile(name string, r io.Reader) error {
+	target, err := e.safePath(name)
+	if err != nil {
+		return err
+	}
+
+	e.numFiles++
+	if e.numFiles > maxBundleFiles {
+		return fmt.Errorf("bundle contains more than %d files", maxBundleFiles)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", name, err)
+	}
+	defer out.Close()
+
+	// 多读一个字节用于判断是否超过限制
+	remaining := e.maxSize - e.written
+	n, err := io.Copy(out, io.LimitReader(r, remaining+1))
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	e.written += n
+	if e.written > e.maxSize {
+		return ErrBundleTooLarge
+	}
+
+	return nil
+}
+
+// safePath 将压缩包内的文件名转换为目标目录下的路径
+func (e *bundleExtractor) safePath(name string) (string, error) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if strings.HasPrefix(name, "/") || strings.Contains(name, "../") || strings.HasSuffix(name, "/..") || name == ".." {
+		return "", fmt.Errorf("illegal file path in bundle: %s", name)
+	}
+
+	cleaned := path.Clean(name)
+	if cleaned == "." || cleaned == "" {
+		return "", fmt.Errorf("illegal file path in bundle: %s", name)
+	}
+
+	return filepath.Join(e.destDir, filepath.FromSlash(cleaned)), nil
+}
+
+// flattenBundleRoot 当解压目录下只有一个顶层目录且没有 index.html 时，将该目录的内容上移一层
+func flattenBundleRoot(destDir string) error {
+	if _, err := os.Stat(filepath.Join(destDir, BundleIndexFile)); err == nil {
+		return nil
+	}
+
+	entries, err := os.ReadDir(destDir)
+	if err != nil {
+		return err
+	}
+	if len(entries) != 1 || !entries[0].IsDir() {
+		return nil
+	}
+
+	// 先改名，避免顶层目录与其中的同名条目冲突
+	innerDir := filepath.Join(destDir, ".bundle-root")
+	if err := os.Rename(filepath.Join(destDir, entries[0].Name()), innerDir); err != nil {
+		return err
+	}
+	innerEntries, err := os.ReadDir(innerDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range innerEntries {
+		if err := os.Rename(filepath.Join(innerDir, entry.Name()), filepath.Join(destDir, entry.Name())); err != nil {
+			return err
+		}
+	}
+
+	return os.Remove(innerDir)
+}
+
+// ResolveBundlePath 将请求路径解析为站点包目录下的文件路径
+// 目录请求返回该目录下的 index.html，不存在且没有扩展名的路径回退到根 index.html
+func ResolveBundlePath(bundleDir, requestPath string) (string, error) {
+	cleaned := path.Clean("/" + requestPath)
+	target := filepath.Join(bundleDir, filepath.FromSlash(cleaned))
+
+	info, err := os.Stat(target)
+	if err == nil {
+		if info.IsDir() {
+			target = filepath.Join(target, BundleIndexFile)
+			if _, err := os.Stat(target); err != nil {
+				return "", os.ErrNotExist
+			}
+		}
+		return target, nil
+	}
+
+	if os.IsNotExist(err) && path.Ext(cleaned) == "" {
+		return filepath.Join(bundleDir, BundleIndexFile), nil
+	}
+
+	return "", os.ErrNotExist
+}
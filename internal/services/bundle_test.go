@@ -0,0 +1,169 @@
+package services
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// buildZip 构造测试用的 zip 压缩包
+func buildZip(t *testing.T, files map[string]string) *bytes.Reader {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, body := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("创建 zip 条目失败: %v", err)
+		}
+		w.Write([]byte(body))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("关闭 zip 失败: %v", err)
+	}
+	return bytes.NewReader(buf.Bytes())
+}
+
+// buildTarGz 构造测试用的 tar.gz 压缩包
+func buildTarGz(t *testing.T, files map[string]string) *bytes.Reader {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, body := range files {
+		header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(body)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatalf("写入 tar 头失败: %v", err)
+		}
+		tw.Write([]byte(body))
+	}
+	tw.Close()
+	gz.Close()
+	return bytes.NewReader(buf.Bytes())
+}
+
+func TestExtractBundle(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		build    func(*testing.T, map[string]string) *bytes.Reader
+		files    map[string]string
+		wantErr  bool
+		wantFile string
+	}{
+		{
+			name:     "zip站点包",
+			filename: "site.zip",
+			build:    buildZip,
+			files:    map[string]string{"index.html": "<h1>hi</h1>", "css/app.css": "body{}"},
+			wantFile: "css/app.css",
+		},
+		{
+			name:     "tar.gz站点包",
+			filename: "site.tar.gz",
+			build:    buildTarGz,
+			files:    map[string]string{"index.html": "<h1>hi</h1>", "js/app.js": "1"},
+			wantFile: "js/app.js",
+		},
+		{
+			name:     "去掉单个顶层目录",
+			filename: "report.zip",
+			build:    buildZip,
+			files:    map[string]string{"report/index.html": "<h1>hi</h1>", "report/img/a.png": "png"},
+			wantFile: "img/a.png",
+		},
+		{
+			name:     "缺少index.html",
+			filename: "site.zip",
+			build:    buildZip,
+			files:    map[string]string{"about.html": "about"},
+			wantErr:  true,
+		},
+		{
+			name:     "拒绝路径穿越",
+			filename: "evil.zip",
+			build:    buildZip,
+			files:    map[string]string{"index.html": "ok", "../escape.txt": "bad"},
+			wantErr:  true,
+		},
+		{
+			name:     "不支持的格式",
+			filename: "site.rar",
+			build:    buildZip,
+			files:    map[string]string{"index.html": "ok"},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			destDir := t.TempDir()
+			r := tt.build(t, tt.files)
+
+			size, err := extractBundle(tt.filename, r, r.Size(), destDir, 1<<20)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("期望错误，但没有返回错误")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("不期望错误，但返回了错误: %v", err)
+			}
+			if size <= 0 {
+				t.Errorf("解压大小应该大于0，实际为 %d", size)
+			}
+			if _, err := os.Stat(filepath.Join(destDir, filepath.FromSlash(tt.wantFile))); err != nil {
+				t.Errorf("期望文件 %s 存在: %v", tt.wantFile, err)
+			}
+		})
+	}
+}
+
+func TestExtractBundle_SizeLimit(t *testing.T) {
+	r := buildZip(t, map[string]string{"index.html": string(make([]byte, 2048))})
+
+	if _, err := extractBundle("site.zip", r, r.Size(), t.TempDir(), 1024); err != ErrBundleTooLarge {
+		t.Errorf("期望 ErrBundleTooLarge，实际为 %v", err)
+	}
+}
+
+func TestResolveBundlePath(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "docs"), 0755)
+	os.WriteFile(filepath.Join(root, "index.html"), []byte("root"), 0644)
+	os.WriteFile(filepath.Join(root, "docs", "index.html"), []byte("docs"), 0644)
+	os.WriteFile(filepath.Join(root, "app.js"), []byte("js"), 0644)
+
+	tests := []struct {
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{"/", "index.html", false},
+		{"/app.js", "app.js", false},
+		{"/docs/", "docs/index.html", false},
+		{"/some/route", "index.html", false}, // 无扩展名的路径回退到根 index.html
+		{"/missing.css", "", true},
+		{"/../../app.js", "app.js", false}, // 路径被限定在站点包目录内
+	}
+
+	for _, tt := range tests {
+		got, err := ResolveBundlePath(root, tt.path)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: 期望错误，实际返回 %s", tt.path, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: 不期望错误: %v", tt.path, err)
+			continue
+		}
+		if want := filepath.Join(root, filepath.FromSlash(tt.want)); got != want {
+			t.Errorf("%s: 期望 %s，实际 %s", tt.path, want, got)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package services
 import (
 	"fmt"
 	"log"
+	"os"
 	"time"
 
 	"anywebsites/internal/database"
@@ -10,12 +11,16 @@ import (
 )
 
 type CleanupService struct {
-	stopChan chan bool
+	stopChan        chan bool
+	storageService  *StorageService
+	settingsService *SettingsService
 }
 
-func NewCleanupService() *CleanupService {
+func NewCleanupService(settingsService *SettingsService) *CleanupService {
 	return &CleanupService{
-		stopChan: make(chan bool),
+		stopChan:        make(chan bool),
+		storageService:  NewStorageService(),
+		settingsService: settingsService,
 	}
 }
 
@@ -70,6 +75,26 @@ func (s *CleanupService) runCleanup() {
 		log.Printf("❌ Error cleaning up old usage statistics: %v", err)
 	}
 
+	// 5. 根据 contents 表核对存储用量
+	if err := s.reconcileStorageUsage(); err != nil {
+		log.Printf("❌ Error reconciling storage usage: %v", err)
+	}
+
+	// 6. 删除超过保留天数且已汇总的原始访问记录
+	if err := s.pruneRawAnalytics(); err != nil {
+		log.Printf("❌ Error pruning raw analytics: %v", err)
+	}
+
+	// 7. 删除已过期的登录会话
+	if err := s.pruneExpiredSessions(); err != nil {
+		log.Printf("❌ Error pruning expired sessions: %v", err)
+	}
+
+	// 8. 删除超过有效期仍未验证的自定义域名
+	if err := s.pruneUnverifiedDomains(); err != nil {
+		log.Printf("❌ Error pruning unverified domains: %v", err)
+	}
+
 	log.Println("✅ Cleanup tasks completed")
 }
 
@@ -89,22 +114,16 @@ func (s *CleanupService) softDeleteExpiredContent() error {
 		return nil
 	}
 
-	// 批量软删除
-	result := database.DB.Model(&models.Content{}).
-		Where("expires_at IS NOT NULL AND expires_at < ? AND is_active = ?", now, true).
-		Updates(map[string]interface{}{
-			"is_active":  false,
-			"deleted_at": now,
-		})
-
-	if result.Error != nil {
-		return fmt.Errorf("failed to soft delete expired content: %w", result.Error)
+	// 批量软删除，同时扣减所有者的存储用量
+	affected, err := setContentsActive(false, "expires_at IS NOT NULL AND expires_at < ?", now)
+	if err != nil {
+		return fmt.Errorf("failed to soft delete expired content: %w", err)
 	}
 
-	log.Printf("🗑️ Soft deleted %d expired articles", result.RowsAffected)
+	log.Printf("🗑️ Soft deleted %d expired articles", affected)
 
 	// 记录清理统计
-	s.logCleanupStats("soft_delete", int(result.RowsAffected))
+	s.logCleanupStats("soft_delete", int(affected))
 
 	return nil
 }
@@ -146,7 +165,7 @@ func (s *CleanupService) hardDeleteOldContent() error {
 		return fmt.Errorf("failed to delete content analytics: %w", err)
 	}
 
-	// 硬删除内容
+	// 硬删除内容（软删除时已扣减存储用量，这里只删除仍处于删除状态的内容）
 	result := tx.Unscoped().Where("is_active = ? AND deleted_at IS NOT NULL AND deleted_at < ?", false, thirtyDaysAgo).Delete(&models.Content{})
 	if result.Error != nil {
 		tx.Rollback()
@@ -158,6 +177,16 @@ func (s *CleanupService) hardDeleteOldContent() error {
 		return fmt.Errorf("failed to commit hard delete transaction: %w", err)
 	}
 
+	// 删除 blob 存储中的正文和站点包文件
+	deleteBodies(oldContents)
+	for _, content := range oldContents {
+		if content.IsBundle() {
+			if err := os.RemoveAll(content.FilePath); err != nil {
+				log.Printf("❌ Failed to remove bundle files for %s: %v", content.ID, err)
+			}
+		}
+	}
+
 	log.Printf("🗑️ Hard deleted %d old articles and their analytics", result.RowsAffected)
 
 	// 记录清理统计
@@ -166,6 +195,68 @@ func (s *CleanupService) hardDeleteOldContent() error {
 	return nil
 }
 
+// reconcileStorageUsage 重新计算存储用量，修正增减计数产生的偏差
+func (s *CleanupService) reconcileStorageUsage() error {
+	fixed, err := s.storageService.Reconcile()
+	if err != nil {
+		return err
+	}
+
+	if fixed > 0 {
+		log.Printf("💾 Reconciled storage usage for %d users", fixed)
+	}
+	s.logCleanupStats("storage_reconcile", int(fixed))
+
+	return nil
+}
+
+// pruneRawAnalytics 按系统设置的保留天数删除原始访问记录，按天汇总的数据不受影响
+func (s *CleanupService) pruneRawAnalytics() error {
+	retentionDays := s.settingsService.GetIntValue("analytics", "raw_retention_days", 90)
+
+	pruned, err := pruneRawAnalytics(retentionDays)
+	if err != nil {
+		return err
+	}
+
+	if pruned > 0 {
+		log.Printf("📊 Pruned %d raw analytics records older than %d days", pruned, retentionDays)
+	}
+	s.logCleanupStats("analytics_prune", int(pruned))
+
+	return nil
+}
+
+// pruneExpiredSessions 删除已过期的登录会话记录
+func (s *CleanupService) pruneExpiredSessions() error {
+	pruned, err := pruneExpiredSessions()
+	if err != nil {
+		return err
+	}
+
+	if pruned > 0 {
+		log.Printf("🔑 Pruned %d expired sessions", pruned)
+	}
+	s.logCleanupStats("session_prune", int(pruned))
+
+	return nil
+}
+
+// pruneUnverifiedDomains 删除超过有效期仍未验证的自定义域名，释放被占用的域名
+func (s *CleanupService) pruneUnverifiedDomains() error {
+	pruned, err := pruneUnverifiedDomains()
+	if err != nil {
+		return err
+	}
+
+	if pruned > 0 {
+		log.Printf("🌐 Pruned %d unverified domains", pruned)
+	}
+	s.logCleanupStats("domain_prune", int(pruned))
+
+	return nil
+}
+
 // cleanupExpiredSubscriptions 清理过期订阅
 func (s *CleanupService) cleanupExpiredSubscriptions() error {
 	now := time.Now()
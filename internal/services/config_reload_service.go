@@ -337,10 +337,9 @@ func NewSecurityReloadHandler() *SecurityReloadHandler {
 // OnConfigReload 处理安全配置重载
 func (h *SecurityReloadHandler) OnConfigReload(oldConfig, newConfig *config.Config) error {
 	// 检查JWT配置是否有变化
+	// 运行时不替换共享密钥，否则已签发的 token 全部失效；非对称签名密钥由 JWTKeyService 按计划轮换
 	if oldConfig.JWT.Secret != newConfig.JWT.Secret {
-		log.Printf("JWT secret changed")
-		// JWT密钥变化会影响现有token的验证
-		log.Printf("WARNING: JWT secret changed, existing tokens may become invalid")
+		log.Printf("JWT secret setting changed, ignored: signing keys come from JWT_ALGORITHM and JWT_SECRET")
 	}
 
 	// 检查限流配置是否有变化
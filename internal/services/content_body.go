@@ -0,0 +1,94 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"anywebsites/internal/models"
+	"anywebsites/internal/storage"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrBodyStoreUnavailable 正文保存在 blob 存储中，但当前未配置存储后端
+var ErrBodyStoreUnavailable = errors.New("content body is in blob storage but no storage backend is configured")
+
+// ContentBodyKey 内容正文在 blob 存储中的键
+func ContentBodyKey(contentID uuid.UUID) string {
+	return "contents/" + contentID.String() + ".html"
+}
+
+// saveContentRow 写入内容记录，配置了 blob 存储时正文写入存储，数据库中只保留存储键
+// create 为 true 时插入新记录，否则保存已有记录；返回后 content.Content 仍为完整正文
+func saveContentRow(db *gorm.DB, content *models.Content, create bool) error {
+	if !content.IsBundle() {
+		content.ContentHash = models.HashBody(content.Content)
+	}
+
+	if storage.Store == nil || content.IsBundle() {
+		if create {
+			return db.Create(content).Error
+		}
+		return db.Save(content).Error
+	}
+
+	if content.ID == uuid.Nil {
+		content.ID = uuid.New()
+	}
+	if content.StorageKey == "" {
+		content.StorageKey = ContentBodyKey(content.ID)
+	}
+
+	body := content.Content
+	content.Content = ""
+	var err error
+	if create {
+		err = db.Create(content).Error
+	} else {
+		err = db.Save(content).Error
+	}
+	content.Content = body
+	if err != nil {
+		return err
+	}
+
+	// 在事务提交前写入正文，写入失败时由调用方回滚
+	if err := storage.Store.Put(content.StorageKey, []byte(body)); err != nil {
+		return fmt.Errorf("failed to store content body: %w", err)
+	}
+	return nil
+}
+
+// loadBody 从 blob 存储读取正文，正文保存在数据库中时不做任何操作
+func loadBody(content *models.Content) error {
+	if content.StorageKey == "" {
+		return nil
+	}
+	if storage.Store == nil {
+		return ErrBodyStoreUnavailable
+	}
+
+	data, err := storage.Store.Get(content.StorageKey)
+	if err != nil {
+		return fmt.Errorf("failed to load content body: %w", err)
+	}
+	content.Content = string(data)
+	return nil
+}
+
+// deleteBodies 删除已硬删除内容的正文，失败时只记录日志
+func deleteBodies(contents []models.Content) {
+	if storage.Store == nil {
+		return
+	}
+	for _, content := range contents {
+		if content.StorageKey == "" {
+			continue
+		}
+		if err := storage.Store.Delete(content.StorageKey); err != nil {
+			log.Printf("Failed to delete content body %s: %v", content.StorageKey, err)
+		}
+	}
+}
@@ -3,8 +3,13 @@ package services
 import (
 	"errors"
 	"fmt"
+	"mime/multipart"
+	"os"
+	"path/filepath"
 	"time"
 
+	"anywebsites/internal/auth"
+	"anywebsites/internal/config"
 	"anywebsites/internal/database"
 	"anywebsites/internal/models"
 
@@ -12,31 +17,110 @@ import (
 	"gorm.io/gorm"
 )
 
+var (
+	// ErrAccessCodeRequired 访问私有内容需要访问码
+	ErrAccessCodeRequired = errors.New("access code required")
+	// ErrInvalidAccessCode 访问码错误
+	ErrInvalidAccessCode = errors.New("invalid access code")
+	// ErrTooManyAccessCodeAttempts 同一客户端 IP 对同一内容尝试访问码的次数过多
+	ErrTooManyAccessCodeAttempts = errors.New("too many access code attempts, please try again later")
+	// ErrPrivateContentNotAllowed 当前计划不支持私有内容
+	ErrPrivateContentNotAllowed = errors.New("private content is not available on the community plan")
+	// ErrStorageLimitExceeded 超出计划存储空间限制
+	ErrStorageLimitExceeded = errors.New("storage limit exceeded")
+)
+
+// bundleExpansionFactor 站点包解压后允许的大小相对上传大小限制的倍数
+const bundleExpansionFactor = 10
+
+// minAccessCodeLength 访问码最小长度
+const minAccessCodeLength = 4
+
 type ContentService struct {
-	geoipService *GeoIPService
-	planService  *PlanService
+	analytics       *AnalyticsPipeline
+	settingsService *SettingsService
+	planService     *PlanService
+	revisionService *RevisionService
+	cachePolicy     *CachePolicy
+	sanitizer       *HTMLSanitizer
+	uploadCfg       config.UploadConfig
+
+	// 访问码按客户端 IP 和内容限流
+	accessCodeLimiter RateLimitStore
+	accessCodeLimit   int
+	accessCodeWindow  time.Duration
+	accessTokenKey    []byte // 签名记住访问码的令牌
 }
 
-func NewContentService(geoipService *GeoIPService) *ContentService {
+// NewContentService 创建内容服务实例，accessTokenKey 用于签名访问码验证通过后的令牌，所有实例需要相同
+func NewContentService(cfg *config.Config, analytics *AnalyticsPipeline, settingsService *SettingsService, accessTokenKey []byte) *ContentService {
+	planService := NewPlanService()
 	return &ContentService{
-		geoipService: geoipService,
-		planService:  NewPlanService(),
+		analytics:       analytics,
+		settingsService: settingsService,
+		planService:     planService,
+		revisionService: NewRevisionService(),
+		cachePolicy:     NewCachePolicy(planService),
+		sanitizer:       NewHTMLSanitizer(cfg),
+		uploadCfg:       cfg.Upload,
+
+		accessCodeLimiter: NewMemoryRateLimitStore(),
+		accessCodeLimit:   cfg.RateLimit.AccessCodeRequests,
+		accessCodeWindow:  time.Duration(cfg.RateLimit.AccessCodeWindow) * time.Second,
+		accessTokenKey:    accessTokenKey,
 	}
 }
 
+// IssueAccessToken 为通过访问码验证的访问者签发访问令牌
+func (s *ContentService) IssueAccessToken(content *models.Content) string {
+	return content.AccessToken(s.accessTokenKey, time.Now())
+}
+
 type UploadRequest struct {
-	Title       string     `json:"title"`
-	Description string     `json:"description"`
-	Content     string     `json:"content" binding:"required"`
-	ExpiresAt   *time.Time `json:"expires_at"`
+	Title       string                   `json:"title"`
+	Description string                   `json:"description"`
+	Content     string                   `json:"content" binding:"required"`
+	ExpiresAt   *time.Time               `json:"expires_at"`
+	Visibility  models.ContentVisibility `json:"visibility"`
+	AccessCode  string                   `json:"access_code"`
+	CacheMaxAge *int                     `json:"cache_max_age"` // 浏览器缓存秒数，不传时使用计划默认值
 }
 
 // UpdateRequest 更新内容请求
 type UpdateRequest struct {
-	Title       string     `json:"title"`
-	Description string     `json:"description"`
-	Content     string     `json:"content"`
-	ExpiresAt   *time.Time `json:"expires_at"`
+	Title       string                   `json:"title"`
+	Description string                   `json:"description"`
+	Content     string                   `json:"content"`
+	ExpiresAt   *time.Time               `json:"expires_at"`
+	Visibility  models.ContentVisibility `json:"visibility"`
+	AccessCode  string                   `json:"access_code"`
+	CacheMaxAge *int                     `json:"cache_max_age"` // 浏览器缓存秒数，负数表示恢复为计划默认值
+}
+
+// BundleUploadRequest 站点包上传请求
+type BundleUploadRequest struct {
+	Title       string
+	Description string
+	ExpiresAt   *time.Time
+	Visibility  models.ContentVisibility
+	AccessCode  string
+	File        *multipart.FileHeader // zip 或 tar.gz 压缩包
+}
+
+// ViewRequest 查看内容请求
+type ViewRequest struct {
+	ContentID   uuid.UUID
+	AccessCode  string    // 访问者提交的访问码
+	AccessToken string    // 之前验证通过后写入 Cookie 的访问令牌
+	ViewerID    uuid.UUID // 已登录访问者的用户ID，匿名访问为 uuid.Nil
+	ClientIP    string
+	UserAgent   string
+	Referer     string
+	Host        string
+	// 访问地址中的 UTM 参数，用于按推广活动统计访问量
+	UTMSource   string
+	UTMMedium   string
+	UTMCampaign string
 }
 
 func (s *ContentService) Upload(userID uuid.UUID, req *UploadRequest) (*models.Content, error) {
@@ -64,15 +148,35 @@ func (s *ContentService) Upload(userID uuid.UUID, req *UploadRequest) (*models.C
 		expiresAt = calculatedExpiration
 	}
 
+	// 按计划策略清理 HTML（未开启时原样保存）
+	body, err := s.sanitizer.Sanitize(userID, req.Content)
+	if err != nil {
+		return nil, err
+	}
+
 	content := &models.Content{
 		UserID:      userID,
 		Title:       req.Title,
 		Description: req.Description,
-		Content:     req.Content,
+		Content:     body,
 		ContentType: "text/html",
 		ExpiresAt:   expiresAt,
 		IsActive:    true,
 	}
+	content.FileSize = contentSize(content)
+	if err := applyCacheMaxAge(content, req.CacheMaxAge); err != nil {
+		return nil, err
+	}
+
+	// 检查存储空间
+	if err := limitStatus.checkStorage(content.FileSize); err != nil {
+		return nil, err
+	}
+
+	// 设置可见性和访问码
+	if err := s.applyVisibility(userID, content, req.Visibility, req.AccessCode); err != nil {
+		return nil, err
+	}
 
 	// 开始事务
 	tx := database.DB.Begin()
@@ -83,13 +187,13 @@ func (s *ContentService) Upload(userID uuid.UUID, req *UploadRequest) (*models.C
 	}()
 
 	// 创建内容
-	if err := tx.Create(content).Error; err != nil {
+	if err := saveContentRow(tx, content, true); err != nil {
 		tx.Rollback()
 		return nil, fmt.Errorf("failed to create content: %w", err)
 	}
 
 	// 更新使用统计
-	if err := s.updateUsageStatistics(tx, userID, 1, 0, 0); err != nil {
+	if err := updateUsageStatistics(tx, userID, 1, content.FileSize, 0); err != nil {
 		tx.Rollback()
 		return nil, fmt.Errorf("failed to update usage statistics: %w", err)
 	}
@@ -102,21 +206,136 @@ func (s *ContentService) Upload(userID uuid.UUID, req *UploadRequest) (*models.C
 	return content, nil
 }
 
-// updateUsageStatistics 更新用户使用统计
-func (s *ContentService) updateUsageStatistics(tx *gorm.DB, userID uuid.UUID, articlesUploaded int, storageUsedMB int64, apiCallsMade int) error {
+// UploadBundle 上传多文件站点包，解压到上传目录并作为一个内容发布
+func (s *ContentService) UploadBundle(userID uuid.UUID, req *BundleUploadRequest) (*models.Content, error) {
+	if req.File == nil {
+		return nil, errors.New("bundle file is required")
+	}
+	if !isBundleFilename(req.File.Filename) {
+		return nil, ErrUnsupportedBundle
+	}
+	if s.uploadCfg.MaxFileSize > 0 && req.File.Size > s.uploadCfg.MaxFileSize {
+		return nil, fmt.Errorf("bundle exceeds the maximum upload size of %d bytes", s.uploadCfg.MaxFileSize)
+	}
+
+	// 检查用户使用限制
+	limitStatus, err := s.planService.CheckUsageLimits(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check usage limits: %w", err)
+	}
+	if !limitStatus.CanUploadArticle {
+		return nil, fmt.Errorf("monthly upload limit exceeded (%d/%d)", limitStatus.ArticlesUploaded, limitStatus.MonthlyUploadLimit)
+	}
+
+	expiresAt := req.ExpiresAt
+	if expiresAt == nil {
+		expiresAt, err = s.planService.CalculateArticleExpiration(userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to calculate expiration: %w", err)
+		}
+	}
+
+	content := &models.Content{
+		ID:          uuid.New(),
+		UserID:      userID,
+		Title:       req.Title,
+		Description: req.Description,
+		ContentType: models.ContentTypeBundle,
+		ExpiresAt:   expiresAt,
+		IsActive:    true,
+	}
+	if err := s.applyVisibility(userID, content, req.Visibility, req.AccessCode); err != nil {
+		return nil, err
+	}
+
+	// 解压到以内容ID命名的目录
+	bundleDir := filepath.Join(s.uploadCfg.Path, "bundles", content.ID.String())
+	if err := os.MkdirAll(bundleDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create bundle directory: %w", err)
+	}
+
+	file, err := req.File.Open()
+	if err != nil {
+		os.RemoveAll(bundleDir)
+		return nil, fmt.Errorf("failed to open bundle: %w", err)
+	}
+	defer file.Close()
+
+	maxExtracted := s.uploadCfg.MaxFileSize * bundleExpansionFactor
+	if maxExtracted <= 0 {
+		maxExtracted = 100 << 20
+	}
+	size, err := extractBundle(req.File.Filename, file, req.File.Size, bundleDir, maxExtracted)
+	if err != nil {
+		os.RemoveAll(bundleDir)
+		return nil, err
+	}
+
+	// 检查存储空间
+	if err := limitStatus.checkStorage(size); err != nil {
+		os.RemoveAll(bundleDir)
+		return nil, err
+	}
+
+	content.FilePath = bundleDir
+	content.FileSize = size
+
+	tx := database.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := tx.Create(content).Error; err != nil {
+		tx.Rollback()
+		os.RemoveAll(bundleDir)
+		return nil, fmt.Errorf("failed to create content: %w", err)
+	}
+
+	if err := updateUsageStatistics(tx, userID, 1, size, 0); err != nil {
+		tx.Rollback()
+		os.RemoveAll(bundleDir)
+		return nil, fmt.Errorf("failed to update usage statistics: %w", err)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		os.RemoveAll(bundleDir)
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return content, nil
+}
+
+// updateUsageStatistics 更新用户使用统计，storageDeltaBytes 为存储用量的变化（字节，可为负）
+// 当月统计中的 storage_used_mb 每次更新时都会同步为当前存储用量的快照
+func updateUsageStatistics(tx *gorm.DB, userID uuid.UUID, articlesUploaded int, storageDeltaBytes int64, apiCallsMade int) error {
+	if storageDeltaBytes != 0 {
+		if err := tx.Exec(`
+			INSERT INTO storage_usages (user_id, used_bytes, updated_at)
+			VALUES (?, GREATEST(?::bigint, 0), NOW())
+			ON CONFLICT (user_id)
+			DO UPDATE SET
+				used_bytes = GREATEST(storage_usages.used_bytes + ?::bigint, 0),
+				updated_at = NOW()
+		`, userID, storageDeltaBytes, storageDeltaBytes).Error; err != nil {
+			return err
+		}
+	}
+
 	currentMonth := models.GetCurrentMonthYear()
 
 	// PostgreSQL UPSERT
 	err := tx.Exec(`
 		INSERT INTO usage_statistics (user_id, month_year, articles_uploaded, storage_used_mb, api_calls_made, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, NOW(), NOW())
+		VALUES (?, ?, ?, COALESCE((SELECT (used_bytes + ?) / ? FROM storage_usages WHERE user_id = ?), 0), ?, NOW(), NOW())
 		ON CONFLICT (user_id, month_year)
 		DO UPDATE SET
 			articles_uploaded = usage_statistics.articles_uploaded + EXCLUDED.articles_uploaded,
-			storage_used_mb = usage_statistics.storage_used_mb + EXCLUDED.storage_used_mb,
+			storage_used_mb = EXCLUDED.storage_used_mb,
 			api_calls_made = usage_statistics.api_calls_made + EXCLUDED.api_calls_made,
 			updated_at = NOW()
-	`, userID, currentMonth, articlesUploaded, storageUsedMB, apiCallsMade).Error
+	`, userID, currentMonth, articlesUploaded, bytesPerMB-1, bytesPerMB, userID, apiCallsMade).Error
 
 	return err
 }
@@ -129,6 +348,9 @@ func (s *ContentService) GetByID(contentID uuid.UUID) (*models.Content, error) {
 		}
 		return nil, err
 	}
+	if err := loadBody(&content); err != nil {
+		return nil, err
+	}
 	return &content, nil
 }
 
@@ -141,9 +363,13 @@ func (s *ContentService) GetByUserID(userID, contentID uuid.UUID) (*models.Conte
 		}
 		return nil, err
 	}
+	if err := loadBody(&content); err != nil {
+		return nil, err
+	}
 	return &content, nil
 }
 
+// List 分页获取用户的内容列表，只返回元数据，不读取正文（content 为空），正文通过 GetByUserID 获取
 func (s *ContentService) List(userID uuid.UUID, page, limit int) ([]models.Content, int64, error) {
 	var contents []models.Content
 	var total int64
@@ -154,7 +380,8 @@ func (s *ContentService) List(userID uuid.UUID, page, limit int) ([]models.Conte
 		return nil, 0, err
 	}
 
-	if err := database.DB.Where("user_id = ? AND is_active = ?", userID, true).
+	if err := database.DB.Omit("content").
+		Where("user_id = ? AND is_active = ?", userID, true).
 		Order("created_at DESC").
 		Offset(offset).
 		Limit(limit).
@@ -170,6 +397,10 @@ func (s *ContentService) Update(userID, contentID uuid.UUID, req *UpdateRequest)
 	if err := database.DB.Where("id = ? AND user_id = ? AND is_active = ?", contentID, userID, true).First(&content).Error; err != nil {
 		return nil, errors.New("content not found")
 	}
+	if err := loadBody(&content); err != nil {
+		return nil, err
+	}
+	previous := content
 
 	// 更新字段
 	if req.Title != "" {
@@ -179,29 +410,94 @@ func (s *ContentService) Update(userID, contentID uuid.UUID, req *UpdateRequest)
 		content.Description = req.Description
 	}
 	if req.Content != "" {
-		content.Content = req.Content
+		body, err := s.sanitizer.Sanitize(userID, req.Content)
+		if err != nil {
+			return nil, err
+		}
+		content.Content = body
 	}
 	if req.ExpiresAt != nil {
 		content.ExpiresAt = req.ExpiresAt
 	}
+	if err := applyCacheMaxAge(&content, req.CacheMaxAge); err != nil {
+		return nil, err
+	}
+	if req.Visibility != "" || req.AccessCode != "" {
+		if err := s.applyVisibility(userID, &content, req.Visibility, req.AccessCode); err != nil {
+			return nil, err
+		}
+	}
 
-	if err := database.DB.Save(&content).Error; err != nil {
-		return nil, fmt.Errorf("failed to update content: %w", err)
+	// 保存内容并记录修订历史
+	if err := s.revisionService.SaveContent(&previous, &content, userID, models.RevisionSourceAPI); err != nil {
+		return nil, err
 	}
 
 	return &content, nil
 }
 
-func (s *ContentService) Delete(userID, contentID uuid.UUID) error {
-	result := database.DB.Model(&models.Content{}).
-		Where("id = ? AND user_id = ?", contentID, userID).
-		Update("is_active", false)
+// applyVisibility 校验并设置内容的可见性，访问码以 bcrypt 哈希形式保存
+// visibility 为空时保持内容当前的可见性
+func (s *ContentService) applyVisibility(userID uuid.UUID, content *models.Content, visibility models.ContentVisibility, accessCode string) error {
+	if visibility == "" {
+		visibility = content.Visibility
+	}
+	if visibility == "" {
+		visibility = models.VisibilityPublic
+	}
+	if !models.IsValidVisibility(visibility) {
+		return fmt.Errorf("invalid visibility: %s", visibility)
+	}
 
-	if result.Error != nil {
-		return result.Error
+	if visibility == models.VisibilityPublic {
+		content.Visibility = models.VisibilityPublic
+		content.AccessCodeHash = ""
+		return nil
 	}
 
-	if result.RowsAffected == 0 {
+	// 私有内容需要付费计划
+	allowed, err := s.planService.CanCreatePrivateContent(userID)
+	if err != nil {
+		return fmt.Errorf("failed to check plan: %w", err)
+	}
+	if !allowed {
+		return ErrPrivateContentNotAllowed
+	}
+
+	if visibility == models.VisibilityOwnerOnly {
+		content.Visibility = models.VisibilityOwnerOnly
+		content.AccessCodeHash = ""
+		return nil
+	}
+
+	// 访问码模式：未提供新访问码时沿用已有的访问码
+	if accessCode == "" {
+		if content.AccessCodeHash == "" {
+			return errors.New("access code is required for access_code visibility")
+		}
+		content.Visibility = models.VisibilityAccessCode
+		return nil
+	}
+	if len(accessCode) < minAccessCodeLength {
+		return fmt.Errorf("access code must be at least %d characters", minAccessCodeLength)
+	}
+
+	hashedCode, err := auth.HashPassword(accessCode)
+	if err != nil {
+		return fmt.Errorf("failed to hash access code: %w", err)
+	}
+	content.Visibility = models.VisibilityAccessCode
+	content.AccessCodeHash = hashedCode
+	return nil
+}
+
+func (s *ContentService) Delete(userID, contentID uuid.UUID) error {
+	affected, err := setContentsActive(false, "id = ? AND user_id = ?", contentID, userID)
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
 		return errors.New("content not found")
 	}
 
@@ -218,83 +514,132 @@ func (s *ContentService) ViewContent(contentID uuid.UUID, accessCode string, cli
 		return nil, errors.New("access denied")
 	}
 
-	// 增加访问计数
-	database.DB.Model(content).UpdateColumn("access_count", gorm.Expr("access_count + ?", 1))
-
-	// 记录访问统计
-	analytics := &models.ContentAnalytics{
-		ContentID:  contentID,
-		UserID:     content.UserID,
-		IPAddress:  clientIP,
-		AccessTime: time.Now(),
+	if err := s.checkVisibility(content, &ViewRequest{ContentID: contentID, AccessCode: accessCode}); err != nil {
+		return nil, err
 	}
-	database.DB.Create(analytics)
+
+	s.RecordView(content, &ViewRequest{ContentID: contentID, ClientIP: clientIP})
 
 	return content, nil
 }
 
 // ViewContentWithAnalytics 查看内容并记录详细的访问统计
-func (s *ContentService) ViewContentWithAnalytics(contentID uuid.UUID, accessCode string, clientIP string, userAgent string, referer string) (*models.Content, error) {
-	content, err := s.GetByID(contentID)
+func (s *ContentService) ViewContentWithAnalytics(req *ViewRequest) (*models.Content, error) {
+	content, err := s.AuthorizeView(req)
 	if err != nil {
 		return nil, err
 	}
+	if err := s.LoadBody(content); err != nil {
+		return nil, err
+	}
+
+	s.RecordView(content, req)
+
+	return content, nil
+}
+
+// AuthorizeView 获取内容并校验访问权限，不记录访问统计
+// 返回的内容不包含正文，条件请求命中缓存时无需读取正文；需要正文时调用 LoadBody
+func (s *ContentService) AuthorizeView(req *ViewRequest) (*models.Content, error) {
+	var content models.Content
+	if err := database.DB.Omit("content").Where("id = ? AND is_active = ?", req.ContentID, true).First(&content).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("content not found")
+		}
+		return nil, err
+	}
 
 	if !content.CanAccess() {
 		return nil, errors.New("access denied")
 	}
 
-	// 增加访问计数
-	database.DB.Model(content).UpdateColumn("access_count", gorm.Expr("access_count + ?", 1))
+	// 校验私有内容的访问权限，未通过的访问不计入统计
+	if err := s.checkVisibility(&content, req); err != nil {
+		return nil, err
+	}
 
-	// 异步记录详细的访问统计
-	go s.recordAnalyticsAsync(contentID, content.UserID, clientIP, userAgent, referer)
+	return &content, nil
+}
 
-	return content, nil
+// LoadBody 读取 AuthorizeView 未加载的正文，旧内容缺少正文哈希时顺带补全
+func (s *ContentService) LoadBody(content *models.Content) error {
+	if content.IsBundle() {
+		return nil
+	}
+
+	if content.StorageKey == "" {
+		var row models.Content
+		if err := database.DB.Select("content").Where("id = ?", content.ID).Take(&row).Error; err != nil {
+			return fmt.Errorf("failed to load content body: %w", err)
+		}
+		content.Content = row.Content
+	} else if err := loadBody(content); err != nil {
+		return err
+	}
+
+	if content.ContentHash == "" {
+		content.ContentHash = models.HashBody(content.Content)
+		database.DB.Model(content).UpdateColumn("content_hash", content.ContentHash)
+	}
+	return nil
 }
 
-// recordAnalyticsAsync 异步记录访问统计信息
-func (s *ContentService) recordAnalyticsAsync(contentID, userID uuid.UUID, clientIP, userAgent, referer string) {
-	// 记录详细的访问统计
-	analytics := &models.ContentAnalytics{
-		ContentID:  contentID,
-		UserID:     userID,
-		IPAddress:  clientIP,
-		UserAgent:  userAgent,
-		Referer:    referer,
-		AccessTime: time.Now(),
-	}
-
-	// 使用 GeoIP 服务获取地理位置信息
-	if s.geoipService != nil {
-		if locationInfo, err := s.geoipService.GetLocationInfo(clientIP); err == nil {
-			analytics.Country = locationInfo.Country
-			analytics.Region = locationInfo.Country // 暂时使用国家作为地区
-			analytics.City = locationInfo.City
-			analytics.Latitude = locationInfo.Latitude
-			analytics.Longitude = locationInfo.Longitude
-		} else {
-			// GeoIP 查询失败，使用默认值
-			fmt.Printf("GeoIP lookup failed for %s: %v\n", clientIP, err)
-			analytics.Country = "Unknown"
-			analytics.Region = "Unknown"
-			analytics.City = "Unknown"
+// CacheControl 返回内容页的 Cache-Control 响应头
+func (s *ContentService) CacheControl(content *models.Content) string {
+	return s.cachePolicy.CacheControl(content)
+}
+
+// RecordView 增加访问计数并异步记录详细的访问统计
+func (s *ContentService) RecordView(content *models.Content, req *ViewRequest) {
+	// 增加访问计数，开启 analytics.exclude_bots 时爬虫访问不计数
+	if !IsBotUserAgent(req.UserAgent) || !s.settingsService.GetBoolValue("analytics", "exclude_bots", true) {
+		database.DB.Model(content).UpdateColumn("access_count", gorm.Expr("access_count + ?", 1))
+	}
+
+	// 详细的访问统计由写入管道批量入库
+	s.analytics.Record(AnalyticsEvent{
+		ContentID: content.ID,
+		UserID:    content.UserID,
+		ClientIP:  req.ClientIP,
+		UserAgent: req.UserAgent,
+		Referer:   req.Referer,
+		Host:      req.Host,
+
+		UTMSource:   req.UTMSource,
+		UTMMedium:   req.UTMMedium,
+		UTMCampaign: req.UTMCampaign,
+	})
+}
+
+// checkVisibility 根据内容可见性校验访问者权限，所有者始终可以访问自己的内容
+func (s *ContentService) checkVisibility(content *models.Content, req *ViewRequest) error {
+	if req.ViewerID != uuid.Nil && req.ViewerID == content.UserID {
+		return nil
+	}
+
+	switch content.Visibility {
+	case models.VisibilityOwnerOnly:
+		return errors.New("access denied")
+	case models.VisibilityAccessCode:
+		// 优先使用 Cookie 中记住的访问令牌
+		if req.AccessToken != "" && content.ValidAccessToken(s.accessTokenKey, req.AccessToken, time.Now()) {
+			return nil
 		}
-	} else {
-		// GeoIP 服务不可用，使用简单的本地检测
-		if clientIP == "127.0.0.1" || clientIP == "::1" {
-			analytics.Country = "Local"
-			analytics.Region = "Local"
-			analytics.City = "Local"
-		} else {
-			analytics.Country = "Unknown"
-			analytics.Region = "Unknown"
-			analytics.City = "Unknown"
+		if req.AccessCode == "" {
+			return ErrAccessCodeRequired
+		}
+		// 每次尝试都计数，超出限制时不再校验访问码
+		result, err := s.accessCodeLimiter.Allow("access-code:"+content.ID.String()+":"+req.ClientIP, s.accessCodeLimit, s.accessCodeWindow, time.Now())
+		if err != nil {
+			return err
+		}
+		if !result.Allowed {
+			return ErrTooManyAccessCodeAttempts
+		}
+		if !auth.CheckPassword(req.AccessCode, content.AccessCodeHash) {
+			return ErrInvalidAccessCode
 		}
 	}
 
-	if err := database.DB.Create(analytics).Error; err != nil {
-		// 记录统计失败不应该影响内容访问
-		fmt.Printf("Failed to record analytics: %v\n", err)
-	}
+	return nil
 }
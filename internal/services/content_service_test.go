@@ -0,0 +1,86 @@
+package services
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"anywebsites/internal/auth"
+	"anywebsites/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestCheckVisibilityAccessCodeLimit(t *testing.T) {
+	hash, err := auth.HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newContent := func() *models.Content {
+		return &models.Content{ID: uuid.New(), UserID: uuid.New(), Visibility: models.VisibilityAccessCode, AccessCodeHash: hash}
+	}
+	service := &ContentService{accessCodeLimiter: NewMemoryRateLimitStore(), accessCodeLimit: 3, accessCodeWindow: time.Minute, accessTokenKey: []byte("test-key")}
+	content := newContent()
+
+	for i := 0; i < 3; i++ {
+		if err := service.checkVisibility(content, &ViewRequest{AccessCode: "wrong", ClientIP: "198.51.100.7"}); !errors.Is(err, ErrInvalidAccessCode) {
+			t.Fatalf("第 %d 次输错应返回 ErrInvalidAccessCode, 实际 %v", i+1, err)
+		}
+	}
+	// 超出限制后即使访问码正确也不再校验
+	if err := service.checkVisibility(content, &ViewRequest{AccessCode: "secret", ClientIP: "198.51.100.7"}); !errors.Is(err, ErrTooManyAccessCodeAttempts) {
+		t.Errorf("超出限制应返回 ErrTooManyAccessCodeAttempts, 实际 %v", err)
+	}
+
+	// 其他客户端 IP 和其他内容分别计数
+	if err := service.checkVisibility(content, &ViewRequest{AccessCode: "secret", ClientIP: "198.51.100.8"}); err != nil {
+		t.Errorf("其他客户端 IP 不应受影响: %v", err)
+	}
+	if err := service.checkVisibility(newContent(), &ViewRequest{AccessCode: "secret", ClientIP: "198.51.100.7"}); err != nil {
+		t.Errorf("其他内容不应受影响: %v", err)
+	}
+
+	// 已记住访问令牌的访问和没有提交访问码的请求不计数
+	if err := service.checkVisibility(content, &ViewRequest{AccessToken: service.IssueAccessToken(content), ClientIP: "198.51.100.7"}); err != nil {
+		t.Errorf("有效的访问令牌不应受限流影响: %v", err)
+	}
+	if err := service.checkVisibility(content, &ViewRequest{ClientIP: "198.51.100.7"}); !errors.Is(err, ErrAccessCodeRequired) {
+		t.Errorf("没有访问码应返回 ErrAccessCodeRequired, 实际 %v", err)
+	}
+}
+
+func TestContentAccessToken(t *testing.T) {
+	key := []byte("test-key")
+	content := &models.Content{ID: uuid.New(), AccessCodeHash: "hash"}
+	now := time.Now()
+
+	token := content.AccessToken(key, now)
+	if !content.ValidAccessToken(key, token, now) {
+		t.Fatal("刚签发的令牌应该有效")
+	}
+
+	tests := []struct {
+		name  string
+		key   []byte
+		token string
+		now   time.Time
+	}{
+		{"其他密钥签名", []byte("other-key"), token, now},
+		{"超过有效期", key, token, now.Add(models.ContentAccessTokenTTL + time.Second)},
+		{"签发时间被篡改", key, strconv.FormatInt(now.Add(time.Hour).Unix(), 10) + token[strings.Index(token, "."):], now.Add(2 * time.Hour)},
+		{"缺少签发时间", key, token[strings.Index(token, ".")+1:], now},
+	}
+	for _, tt := range tests {
+		if content.ValidAccessToken(tt.key, tt.token, tt.now) {
+			t.Errorf("%s 的令牌应该无效", tt.name)
+		}
+	}
+
+	// 访问码修改后旧令牌失效
+	content.AccessCodeHash = "new-hash"
+	if content.ValidAccessToken(key, token, now) {
+		t.Error("修改访问码后旧令牌应该无效")
+	}
+}
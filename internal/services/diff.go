@@ -0,0 +1,111 @@
+package services
+
+import (
+	"errors"
+	"strings"
+)
+
+// maxDiffCells 行级 LCS 计算允许的最大矩阵规模，避免超大内容占用过多内存
+const maxDiffCells = 4000000
+
+// ErrDiffTooLarge 两个版本差异过大，无法计算逐行差异
+var ErrDiffTooLarge = errors.New("revisions are too large to diff")
+
+// DiffOp 差异操作类型
+type DiffOp string
+
+const (
+	DiffEqual  DiffOp = "equal"
+	DiffInsert DiffOp = "insert"
+	DiffDelete DiffOp = "delete"
+)
+
+// DiffLine 差异中的一行
+type DiffLine struct {
+	Op   DiffOp `json:"op"`
+	Text string `json:"text"`
+}
+
+// diffLines 计算两段文本的逐行差异，先去掉公共前后缀再对中间部分做 LCS
+func diffLines(a, b string) ([]DiffLine, error) {
+	aLines := splitLines(a)
+	bLines := splitLines(b)
+
+	// 公共前缀
+	prefix := 0
+	for prefix < len(aLines) && prefix < len(bLines) && aLines[prefix] == bLines[prefix] {
+		prefix++
+	}
+	// 公共后缀
+	suffix := 0
+	for suffix < len(aLines)-prefix && suffix < len(bLines)-prefix &&
+		aLines[len(aLines)-1-suffix] == bLines[len(bLines)-1-suffix] {
+		suffix++
+	}
+
+	aMid := aLines[prefix : len(aLines)-suffix]
+	bMid := bLines[prefix : len(bLines)-suffix]
+	if (len(aMid)+1)*(len(bMid)+1) > maxDiffCells {
+		return nil, ErrDiffTooLarge
+	}
+
+	result := make([]DiffLine, 0, len(aLines)+len(bLines))
+	for _, line := range aLines[:prefix] {
+		result = append(result, DiffLine{Op: DiffEqual, Text: line})
+	}
+
+	// lcs[i][j] 为 aMid[i:] 与 bMid[j:] 的最长公共子序列长度
+	n, m := len(aMid), len(bMid)
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if aMid[i] == bMid[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case aMid[i] == bMid[j]:
+			result = append(result, DiffLine{Op: DiffEqual, Text: aMid[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			result = append(result, DiffLine{Op: DiffDelete, Text: aMid[i]})
+			i++
+		default:
+			result = append(result, DiffLine{Op: DiffInsert, Text: bMid[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		result = append(result, DiffLine{Op: DiffDelete, Text: aMid[i]})
+	}
+	for ; j < m; j++ {
+		result = append(result, DiffLine{Op: DiffInsert, Text: bMid[j]})
+	}
+
+	for _, line := range aLines[len(aLines)-suffix:] {
+		result = append(result, DiffLine{Op: DiffEqual, Text: line})
+	}
+
+	return result, nil
+}
+
+// splitLines 按行拆分文本，空文本返回空切片
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
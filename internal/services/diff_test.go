@@ -0,0 +1,59 @@
+package services
+
+import (
+	"strings"
+	"testing"
+)
+
+// renderDiff 将差异渲染为 " a"/"-b"/"+c" 形式便于比较
+func renderDiff(lines []DiffLine) string {
+	var parts []string
+	for _, line := range lines {
+		prefix := " "
+		switch line.Op {
+		case DiffInsert:
+			prefix = "+"
+		case DiffDelete:
+			prefix = "-"
+		}
+		parts = append(parts, prefix+line.Text)
+	}
+	return strings.Join(parts, "|")
+}
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a    string
+		b    string
+		want string
+	}{
+		{"相同内容", "a\nb", "a\nb", " a| b"},
+		{"修改中间行", "a\nb\nc", "a\nx\nc", " a|-b|+x| c"},
+		{"追加行", "a\nb", "a\nb\nc\n", " a| b|+c"},
+		{"删除行", "a\nb\nc", "a\nc", " a|-b| c"},
+		{"从空内容开始", "", "a", "+a"},
+		{"CRLF 换行", "a\r\nb", "a\nb", " a| b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines, err := diffLines(tt.a, tt.b)
+			if err != nil {
+				t.Fatalf("不期望错误: %v", err)
+			}
+			if got := renderDiff(lines); got != tt.want {
+				t.Errorf("期望 %q，实际 %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestDiffLines_TooLarge(t *testing.T) {
+	a := strings.Repeat("a\n", 3000)
+	b := strings.Repeat("b\n", 3000)
+
+	if _, err := diffLines(a, b); err != ErrDiffTooLarge {
+		t.Errorf("期望 ErrDiffTooLarge，实际为 %v", err)
+	}
+}
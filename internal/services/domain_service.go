@@ -0,0 +1,359 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"anywebsites/internal/database"
+	"anywebsites/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrDomainNotFound 域名不存在或未验证
+	ErrDomainNotFound = errors.New("domain not found")
+	// ErrDomainLimitExceeded 超出计划的自定义域名数量限制
+	ErrDomainLimitExceeded = errors.New("custom domain limit exceeded for current plan")
+	// ErrDomainVerificationFailed DNS TXT 验证失败
+	ErrDomainVerificationFailed = errors.New("domain verification failed: TXT record not found")
+	// ErrDomainExists 域名已被其他用户验证，或当前用户已添加过该域名
+	ErrDomainExists = errors.New("domain already exists")
+	// ErrDomainClaimExpired 添加后超过有效期仍未验证
+	ErrDomainClaimExpired = errors.New("domain claim expired, please add the domain again")
+)
+
+// unverifiedDomainTTL 未验证域名的有效期，过期后由清理任务删除，其他用户可以重新添加
+const unverifiedDomainTTL = 7 * 24 * time.Hour
+
+// domainPattern 域名格式校验
+var domainPattern = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,63}$`)
+
+// domainCacheEntry 域名解析缓存条目，只缓存已绑定内容的域名
+type domainCacheEntry struct {
+	domain    *models.CustomDomain
+	timestamp time.Time
+}
+
+// DomainService 自定义域名服务
+type DomainService struct {
+	planService *PlanService
+	// lookupTXT DNS TXT 查询函数，便于测试替换
+	lookupTXT func(name string) ([]string, error)
+
+	cache       map[string]*domainCacheEntry
+	mutex       sync.RWMutex
+	cacheExpiry time.Duration
+}
+
+// NewDomainService 创建自定义域名服务实例
+func NewDomainService() *DomainService {
+	return &DomainService{
+		planService: NewPlanService(),
+		lookupTXT:   net.LookupTXT,
+		cache:       make(map[string]*domainCacheEntry),
+		cacheExpiry: time.Minute,
+	}
+}
+
+// CreateDomainRequest 添加域名请求
+type CreateDomainRequest struct {
+	Domain    string     `json:"domain" binding:"required"`
+	ContentID *uuid.UUID `json:"content_id"`
+}
+
+// UpdateDomainRequest 更新域名请求
+type UpdateDomainRequest struct {
+	ContentID *uuid.UUID `json:"content_id"`
+}
+
+// NormalizeDomain 规范化域名：小写、去掉端口和末尾的点
+func NormalizeDomain(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(host, ".")
+}
+
+// customDomainLimit 获取计划允许的自定义域名数量，-1 表示无限制
+func customDomainLimit(planType models.PlanType) int {
+	switch planType {
+	case models.PlanDeveloper:
+		return 1
+	case models.PlanPro:
+		return 5
+	case models.PlanMax, models.PlanEnterprise:
+		return -1
+	default:
+		return 0
+	}
+}
+
+// Create 添加自定义域名，添加后需要通过 DNS TXT 记录验证所有权
+// 只有已验证的域名才会阻止其他用户添加，未验证的声明不会占用域名
+func (s *DomainService) Create(userID uuid.UUID, req *CreateDomainRequest) (*models.CustomDomain, error) {
+	domain := NormalizeDomain(req.Domain)
+	if !domainPattern.MatchString(domain) {
+		return nil, fmt.Errorf("invalid domain: %s", req.Domain)
+	}
+
+	// 检查计划限制
+	subscription, err := s.planService.GetUserPlan(userID)
+	if err != nil {
+		return nil, err
+	}
+	limit := customDomainLimit(subscription.PlanType)
+	if limit == 0 {
+		return nil, ErrDomainLimitExceeded
+	}
+	if limit > 0 {
+		var count int64
+		if err := database.DB.Model(&models.CustomDomain{}).Where("user_id = ?", userID).Count(&count).Error; err != nil {
+			return nil, fmt.Errorf("failed to count domains: %w", err)
+		}
+		if count >= int64(limit) {
+			return nil, ErrDomainLimitExceeded
+		}
+	}
+
+	// 检查域名是否已被验证，或当前用户已经添加过
+	var existing int64
+	if err := database.DB.Model(&models.CustomDomain{}).
+		Where("domain = ? AND (is_verified = ? OR user_id = ?)", domain, true, userID).
+		Count(&existing).Error; err != nil {
+		return nil, fmt.Errorf("failed to check domain: %w", err)
+	}
+	if existing > 0 {
+		return nil, ErrDomainExists
+	}
+
+	if req.ContentID != nil {
+		if err := s.checkContentOwner(userID, *req.ContentID); err != nil {
+			return nil, err
+		}
+	}
+
+	token, err := generateVerificationToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate verification token: %w", err)
+	}
+
+	customDomain := &models.CustomDomain{
+		UserID:            userID,
+		Domain:            domain,
+		ContentID:         req.ContentID,
+		VerificationToken: token,
+	}
+
+	if err := database.DB.Create(customDomain).Error; err != nil {
+		return nil, fmt.Errorf("failed to create domain: %w", err)
+	}
+
+	return customDomain, nil
+}
+
+// List 获取用户的所有自定义域名
+func (s *DomainService) List(userID uuid.UUID) ([]models.CustomDomain, error) {
+	var domains []models.CustomDomain
+	if err := database.DB.Where("user_id = ?", userID).Order("created_at DESC").Find(&domains).Error; err != nil {
+		return nil, err
+	}
+	return domains, nil
+}
+
+// Get 获取用户的指定域名
+func (s *DomainService) Get(userID, domainID uuid.UUID) (*models.CustomDomain, error) {
+	var customDomain models.CustomDomain
+	if err := database.DB.Where("id = ? AND user_id = ?", domainID, userID).First(&customDomain).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrDomainNotFound
+		}
+		return nil, err
+	}
+	return &customDomain, nil
+}
+
+// Verify 通过 DNS TXT 记录验证域名所有权
+// 验证通过后其他用户对同一域名的未验证声明一并删除
+func (s *DomainService) Verify(userID, domainID uuid.UUID) (*models.CustomDomain, error) {
+	customDomain, err := s.Get(userID, domainID)
+	if err != nil {
+		return nil, err
+	}
+	if customDomain.IsVerified {
+		return customDomain, nil
+	}
+	if time.Since(customDomain.CreatedAt) > unverifiedDomainTTL {
+		return nil, ErrDomainClaimExpired
+	}
+
+	records, err := s.lookupTXT(customDomain.VerificationRecordName())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDomainVerificationFailed, err)
+	}
+
+	expected := customDomain.VerificationRecordValue()
+	verified := false
+	for _, record := range records {
+		if strings.TrimSpace(record) == expected {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return nil, ErrDomainVerificationFailed
+	}
+
+	now := time.Now()
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// 已验证的域名由部分唯一索引保证只有一条，这里先检查以返回明确的错误
+		var verified int64
+		if err := tx.Model(&models.CustomDomain{}).
+			Where("domain = ? AND is_verified = ? AND id <> ?", customDomain.Domain, true, customDomain.ID).
+			Count(&verified).Error; err != nil {
+			return err
+		}
+		if verified > 0 {
+			return ErrDomainExists
+		}
+
+		if err := tx.Model(customDomain).Updates(map[string]interface{}{
+			"is_verified": true,
+			"verified_at": now,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("domain = ? AND is_verified = ? AND id <> ?", customDomain.Domain, false, customDomain.ID).
+			Delete(&models.CustomDomain{}).Error
+	})
+	if err != nil {
+		if errors.Is(err, ErrDomainExists) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to update domain: %w", err)
+	}
+	customDomain.IsVerified = true
+	customDomain.VerifiedAt = &now
+
+	s.invalidateCache(customDomain.Domain)
+	return customDomain, nil
+}
+
+// Update 更新域名根路径展示的内容
+func (s *DomainService) Update(userID, domainID uuid.UUID, req *UpdateDomainRequest) (*models.CustomDomain, error) {
+	customDomain, err := s.Get(userID, domainID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.ContentID != nil {
+		if err := s.checkContentOwner(userID, *req.ContentID); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := database.DB.Model(customDomain).Update("content_id", req.ContentID).Error; err != nil {
+		return nil, fmt.Errorf("failed to update domain: %w", err)
+	}
+	customDomain.ContentID = req.ContentID
+
+	s.invalidateCache(customDomain.Domain)
+	return customDomain, nil
+}
+
+// Delete 删除自定义域名
+func (s *DomainService) Delete(userID, domainID uuid.UUID) error {
+	customDomain, err := s.Get(userID, domainID)
+	if err != nil {
+		return err
+	}
+
+	if err := database.DB.Delete(customDomain).Error; err != nil {
+		return fmt.Errorf("failed to delete domain: %w", err)
+	}
+
+	s.invalidateCache(customDomain.Domain)
+	return nil
+}
+
+// ResolveHost 根据请求的 Host 查找已验证并绑定了内容的域名
+func (s *DomainService) ResolveHost(host string) (*models.CustomDomain, error) {
+	domain := NormalizeDomain(host)
+
+	s.mutex.RLock()
+	entry, exists := s.cache[domain]
+	s.mutex.RUnlock()
+	if exists && time.Since(entry.timestamp) < s.cacheExpiry {
+		return entry.domain, nil
+	}
+
+	var customDomain models.CustomDomain
+	err := database.DB.Preload("Content").
+		Where("domain = ? AND is_verified = ? AND content_id IS NOT NULL", domain, true).
+		First(&customDomain).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrDomainNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if customDomain.Content == nil {
+		return nil, ErrDomainNotFound
+	}
+
+	// 只缓存已绑定的域名，缓存大小受已验证域名数量限制；任意 Host 的未命中不缓存，避免缓存被无限撑大
+	s.mutex.Lock()
+	s.cache[domain] = &domainCacheEntry{domain: &customDomain, timestamp: time.Now()}
+	s.mutex.Unlock()
+
+	return &customDomain, nil
+}
+
+// invalidateCache 清除域名缓存
+func (s *DomainService) invalidateCache(domain string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.cache, domain)
+}
+
+// checkContentOwner 检查内容是否属于该用户
+func (s *DomainService) checkContentOwner(userID, contentID uuid.UUID) error {
+	var count int64
+	if err := database.DB.Model(&models.Content{}).
+		Where("id = ? AND user_id = ? AND is_active = ?", contentID, userID, true).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return errors.New("content not found")
+	}
+	return nil
+}
+
+// pruneUnverifiedDomains 删除超过有效期仍未验证的域名
+func pruneUnverifiedDomains() (int64, error) {
+	result := database.DB.Where("is_verified = ? AND created_at < ?", false, time.Now().Add(-unverifiedDomainTTL)).
+		Delete(&models.CustomDomain{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to prune unverified domains: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// generateVerificationToken 生成域名验证令牌
+func generateVerificationToken() (string, error) {
+	bytes := make([]byte, 16)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
@@ -0,0 +1,158 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"anywebsites/internal/database"
+	"anywebsites/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// setupDomainTestDB 创建自定义域名和订阅表，返回两个 Pro 计划的用户
+func setupDomainTestDB(t *testing.T) (uuid.UUID, uuid.UUID) {
+	db := useTestDB(t)
+	// 表的默认值使用了 PostgreSQL 函数，这里手动建表
+	for _, statement := range []string{
+		`CREATE TABLE custom_domains (id TEXT PRIMARY KEY, user_id TEXT NOT NULL, domain TEXT NOT NULL, content_id TEXT,
+			verification_token TEXT NOT NULL, is_verified BOOLEAN NOT NULL DEFAULT FALSE, verified_at DATETIME,
+			created_at DATETIME, updated_at DATETIME)`,
+		`CREATE UNIQUE INDEX idx_custom_domains_domain_verified ON custom_domains(domain) WHERE is_verified`,
+		userSubscriptionsTable,
+	} {
+		if err := db.Exec(statement).Error; err != nil {
+			t.Fatalf("创建表失败: %v", err)
+		}
+	}
+
+	users := []uuid.UUID{uuid.New(), uuid.New()}
+	for _, userID := range users {
+		subscription := &models.UserSubscription{ID: uuid.New(), UserID: userID, PlanType: models.PlanPro, Status: models.StatusActive, StartedAt: time.Now()}
+		if err := db.Create(subscription).Error; err != nil {
+			t.Fatalf("创建订阅失败: %v", err)
+		}
+	}
+	return users[0], users[1]
+}
+
+func TestNormalizeDomain(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"Blog.Example.com", "blog.example.com"},
+		{"blog.example.com:8443", "blog.example.com"},
+		{"blog.example.com.", "blog.example.com"},
+		{"  blog.example.com  ", "blog.example.com"},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeDomain(tt.input); got != tt.want {
+			t.Errorf("NormalizeDomain(%q) = %q，期望 %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestDomainPattern(t *testing.T) {
+	valid := []string{"example.com", "blog.example.com", "my-site.example.co.uk"}
+	invalid := []string{"localhost", "-bad.example.com", "example", "exa mple.com", "127.0.0.1"}
+
+	for _, domain := range valid {
+		if !domainPattern.MatchString(domain) {
+			t.Errorf("%s 应该是合法域名", domain)
+		}
+	}
+	for _, domain := range invalid {
+		if domainPattern.MatchString(domain) {
+			t.Errorf("%s 不应该是合法域名", domain)
+		}
+	}
+}
+
+func TestCustomDomainLimit(t *testing.T) {
+	tests := []struct {
+		planType models.PlanType
+		want     int
+	}{
+		{models.PlanCommunity, 0},
+		{models.PlanDeveloper, 1},
+		{models.PlanPro, 5},
+		{models.PlanMax, -1},
+		{models.PlanEnterprise, -1},
+	}
+
+	for _, tt := range tests {
+		if got := customDomainLimit(tt.planType); got != tt.want {
+			t.Errorf("%s 计划的域名限制为 %d，期望 %d", tt.planType, got, tt.want)
+		}
+	}
+}
+
+func TestDomainClaimTakeover(t *testing.T) {
+	squatter, owner := setupDomainTestDB(t)
+	service := NewDomainService()
+	records := map[string][]string{}
+	service.lookupTXT = func(name string) ([]string, error) { return records[name], nil }
+
+	claim, err := service.Create(squatter, &CreateDomainRequest{Domain: "example.com"})
+	if err != nil {
+		t.Fatalf("添加域名失败: %v", err)
+	}
+	if _, err := service.Create(squatter, &CreateDomainRequest{Domain: "example.com"}); !errors.Is(err, ErrDomainExists) {
+		t.Errorf("同一用户重复添加应返回 ErrDomainExists, 实际 %v", err)
+	}
+
+	// 未验证的声明不阻止真正的所有者添加和验证
+	domain, err := service.Create(owner, &CreateDomainRequest{Domain: "example.com"})
+	if err != nil {
+		t.Fatalf("未验证的声明不应占用域名: %v", err)
+	}
+	records[domain.VerificationRecordName()] = []string{domain.VerificationRecordValue()}
+	if _, err := service.Verify(owner, domain.ID); err != nil {
+		t.Fatalf("验证失败: %v", err)
+	}
+
+	if _, err := service.Get(squatter, claim.ID); !errors.Is(err, ErrDomainNotFound) {
+		t.Errorf("验证通过后其他用户的声明应删除, 实际 %v", err)
+	}
+	if _, err := service.Create(squatter, &CreateDomainRequest{Domain: "example.com"}); !errors.Is(err, ErrDomainExists) {
+		t.Errorf("已验证的域名不能再添加, 实际 %v", err)
+	}
+}
+
+func TestUnverifiedDomainExpiry(t *testing.T) {
+	userID, _ := setupDomainTestDB(t)
+	service := NewDomainService()
+	service.lookupTXT = func(name string) ([]string, error) { return nil, nil }
+
+	domain, err := service.Create(userID, &CreateDomainRequest{Domain: "blog.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.DB.Model(domain).Update("created_at", time.Now().Add(-unverifiedDomainTTL-time.Hour)).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := service.Verify(userID, domain.ID); !errors.Is(err, ErrDomainClaimExpired) {
+		t.Errorf("过期的声明应返回 ErrDomainClaimExpired, 实际 %v", err)
+	}
+	if pruned, err := pruneUnverifiedDomains(); err != nil || pruned != 1 {
+		t.Errorf("应删除 1 条过期声明, 实际 %d %v", pruned, err)
+	}
+}
+
+func TestResolveHostDoesNotCacheMisses(t *testing.T) {
+	setupDomainTestDB(t)
+	service := NewDomainService()
+
+	for _, host := range []string{"unknown-1.example.com", "unknown-2.example.com:8080"} {
+		if _, err := service.ResolveHost(host); !errors.Is(err, ErrDomainNotFound) {
+			t.Errorf("%s 应返回 ErrDomainNotFound, 实际 %v", host, err)
+		}
+	}
+	if len(service.cache) != 0 {
+		t.Errorf("未命中的域名不应缓存, 实际缓存了 %d 条", len(service.cache))
+	}
+}
@@ -1,12 +1,13 @@
 package services
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"sync"
 	"time"
 
-	"github.com/oschwald/geoip2-golang"
+	"anywebsites/internal/config"
 )
 
 // CacheEntry 缓存条目
@@ -28,9 +29,9 @@ type BatchResponse struct {
 }
 
 type GeoIPService struct {
-	db    *geoip2.Reader
-	cache map[string]*CacheEntry
-	mutex sync.RWMutex
+	provider LocationProvider
+	cache    map[string]*CacheEntry
+	mutex    sync.RWMutex
 	// 缓存过期时间，默认1小时
 	cacheExpiry time.Duration
 	// 批量处理相关
@@ -52,23 +53,91 @@ type ServiceStats struct {
 	Errors          int64
 	LastError       string
 	LastErrorTime   time.Time
+	Reloads         int64
+	LastReloadTime  time.Time
 }
 
 type LocationInfo struct {
 	Country   string  `json:"country"`
+	Region    string  `json:"region"` // 省、州等一级行政区
 	City      string  `json:"city"`
 	Latitude  float64 `json:"latitude"`
 	Longitude float64 `json:"longitude"`
+	ASN       uint    `json:"asn,omitempty"`
+	ISP       string  `json:"isp,omitempty"`
 }
 
+// merge 用 other 补充为空的字段
+func (l *LocationInfo) merge(other *LocationInfo) {
+	if l.Country == "" {
+		l.Country = other.Country
+	}
+	if l.Region == "" {
+		l.Region = other.Region
+	}
+	if l.City == "" {
+		l.City = other.City
+	}
+	if l.Latitude == 0 && l.Longitude == 0 {
+		l.Latitude = other.Latitude
+		l.Longitude = other.Longitude
+	}
+	if l.ASN == 0 {
+		l.ASN = other.ASN
+	}
+	if l.ISP == "" {
+		l.ISP = other.ISP
+	}
+}
+
+// NewGeoIPService 使用 MaxMind City 数据库创建服务，不检查数据库文件更新
 func NewGeoIPService(dbPath string) (*GeoIPService, error) {
-	db, err := geoip2.Open(dbPath)
+	return NewGeoIPServiceFromConfig(config.GeoIPConfig{Provider: GeoIPProviderMaxMind, DBPath: dbPath})
+}
+
+// NewGeoIPServiceFromConfig 按配置打开数据源，ReloadInterval 大于 0 时数据文件更新后自动重新加载并清空缓存
+func NewGeoIPServiceFromConfig(cfg config.GeoIPConfig) (*GeoIPService, error) {
+	service := newGeoIPService()
+
+	var open func(string) (LocationProvider, error)
+	switch cfg.Provider {
+	case "", GeoIPProviderMaxMind:
+		open = OpenMaxMindCity
+	case GeoIPProviderCSV:
+		open = OpenCSVRanges
+	default:
+		return nil, fmt.Errorf("unknown GeoIP provider: %s", cfg.Provider)
+	}
+
+	location, err := newReloadingProvider(cfg.DBPath, open, cfg.ReloadInterval, service.onReload)
 	if err != nil {
 		return nil, err
 	}
+	service.provider = location
+
+	if cfg.ASNDBPath != "" {
+		asn, err := newReloadingProvider(cfg.ASNDBPath, OpenMaxMindASN, cfg.ReloadInterval, service.onReload)
+		if err != nil {
+			location.Close()
+			return nil, fmt.Errorf("failed to open ASN database: %w", err)
+		}
+		service.provider = multiProvider{location, asn}
+	}
+
+	service.start()
+	return service, nil
+}
+
+// NewGeoIPServiceWithProvider 使用指定的数据源创建服务
+func NewGeoIPServiceWithProvider(provider LocationProvider) *GeoIPService {
+	service := newGeoIPService()
+	service.provider = provider
+	service.start()
+	return service
+}
 
-	service := &GeoIPService{
-		db:           db,
+func newGeoIPService() *GeoIPService {
+	return &GeoIPService{
 		cache:        make(map[string]*CacheEntry),
 		cacheExpiry:  time.Hour,                      // 默认缓存1小时
 		batchChannel: make(chan *BatchRequest, 1000), // 批量处理通道
@@ -76,18 +145,21 @@ func NewGeoIPService(dbPath string) (*GeoIPService, error) {
 		batchTimeout: 50 * time.Millisecond,          // 批量超时时间
 		stats:        &ServiceStats{},                // 初始化统计信息
 	}
+}
 
+func (g *GeoIPService) start() {
 	// 启动定期清理过期缓存的 goroutine
-	go service.startCacheCleanup()
+	go g.startCacheCleanup()
 
 	// 启动批量处理 goroutine
-	go service.startBatchProcessor()
-
-	return service, nil
+	go g.startBatchProcessor()
 }
 
 func (g *GeoIPService) Close() error {
-	return g.db.Close()
+	if g.provider == nil {
+		return nil
+	}
+	return g.provider.Close()
 }
 
 func (g *GeoIPService) GetLocationInfo(ipStr string) (*LocationInfo, error) {
@@ -95,6 +167,7 @@ func (g *GeoIPService) GetLocationInfo(ipStr string) (*LocationInfo, error) {
 	if g.isLocalIP(ipStr) {
 		return &LocationInfo{
 			Country:   "Local",
+			Region:    "Local",
 			City:      "Local",
 			Latitude:  0,
 			Longitude: 0,
@@ -148,42 +221,23 @@ func (g *GeoIPService) processLocationInfo(ipStr string) (*LocationInfo, error)
 		return nil, fmt.Errorf("invalid IP address: %s", ipStr)
 	}
 
-	record, err := g.db.City(ip)
-	if err != nil {
-		return nil, err
+	if g.provider == nil {
+		return nil, errors.New("no GeoIP data source configured")
 	}
 
-	country := "Unknown"
-	if len(record.Country.Names) > 0 {
-		if name, ok := record.Country.Names["en"]; ok {
-			country = name
-		} else {
-			// 取第一个可用的名称
-			for _, name := range record.Country.Names {
-				country = name
-				break
-			}
-		}
+	locationInfo, err := g.provider.Lookup(ip)
+	if errors.Is(err, ErrLocationNotFound) {
+		locationInfo, err = &LocationInfo{}, nil
 	}
-
-	city := "Unknown"
-	if len(record.City.Names) > 0 {
-		if name, ok := record.City.Names["en"]; ok {
-			city = name
-		} else {
-			// 取第一个可用的名称
-			for _, name := range record.City.Names {
-				city = name
-				break
-			}
-		}
+	if err != nil {
+		return nil, err
 	}
 
-	locationInfo := &LocationInfo{
-		Country:   country,
-		City:      city,
-		Latitude:  float64(record.Location.Latitude),
-		Longitude: float64(record.Location.Longitude),
+	// 数据源中没有的地区记为 Unknown
+	for _, field := range []*string{&locationInfo.Country, &locationInfo.Region, &locationInfo.City} {
+		if *field == "" {
+			*field = "Unknown"
+		}
 	}
 
 	// 将结果存入缓存
@@ -266,6 +320,18 @@ func (g *GeoIPService) setCache(ip string, locationInfo *LocationInfo) {
 	}
 }
 
+// onReload 数据文件重新加载后清空缓存，避免继续返回旧数据的查询结果
+func (g *GeoIPService) onReload() {
+	g.mutex.Lock()
+	g.cache = make(map[string]*CacheEntry)
+	g.mutex.Unlock()
+
+	g.stats.mutex.Lock()
+	defer g.stats.mutex.Unlock()
+	g.stats.Reloads++
+	g.stats.LastReloadTime = time.Now()
+}
+
 // ClearExpiredCache 清理过期的缓存条目
 func (g *GeoIPService) ClearExpiredCache() {
 	g.mutex.Lock()
@@ -399,6 +465,10 @@ func (g *GeoIPService) GetServiceStats() map[string]interface{} {
 	if g.stats.TotalRequests > 0 {
 		cacheHitRate = float64(g.stats.CacheHits) / float64(g.stats.TotalRequests) * 100
 	}
+	lastReloadTime := ""
+	if !g.stats.LastReloadTime.IsZero() {
+		lastReloadTime = g.stats.LastReloadTime.Format("2006-01-02 15:04:05")
+	}
 
 	return map[string]interface{}{
 		"total_requests":   g.stats.TotalRequests,
@@ -410,5 +480,7 @@ func (g *GeoIPService) GetServiceStats() map[string]interface{} {
 		"errors":           g.stats.Errors,
 		"last_error":       g.stats.LastError,
 		"last_error_time":  g.stats.LastErrorTime.Format("2006-01-02 15:04:05"),
+		"reloads":          g.stats.Reloads,
+		"last_reload_time": lastReloadTime,
 	}
 }
@@ -0,0 +1,380 @@
+package services
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+// GeoIP 数据源类型
+const (
+	GeoIPProviderMaxMind = "maxmind"
+	GeoIPProviderCSV     = "csv"
+)
+
+// ErrLocationNotFound 数据源中没有该 IP 的记录
+var ErrLocationNotFound = errors.New("location not found")
+
+// LocationProvider 地理位置数据源，Lookup 只填充数据源能提供的字段，其余字段留空
+type LocationProvider interface {
+	Lookup(ip net.IP) (*LocationInfo, error)
+	Close() error
+}
+
+// maxMindCityProvider MaxMind GeoIP2/GeoLite2 City 数据库
+type maxMindCityProvider struct {
+	db *geoip2.Reader
+}
+
+// OpenMaxMindCity 打开 MaxMind City 数据库
+func OpenMaxMindCity(path string) (LocationProvider, error) {
+	db, err := geoip2.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &maxMindCityProvider{db: db}, nil
+}
+
+func (p *maxMindCityProvider) Lookup(ip net.IP) (*LocationInfo, error) {
+	record, err := p.db.City(ip)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &LocationInfo{
+		Country:   localizedName(record.Country.Names),
+		City:      localizedName(record.City.Names),
+		Latitude:  record.Location.Latitude,
+		Longitude: record.Location.Longitude,
+	}
+	// 省、州等一级行政区
+	if len(record.Subdivisions) > 0 {
+		info.Region = localizedName(record.Subdivisions[0].Names)
+	}
+	return info, nil
+}
+
+func (p *maxMindCityProvider) Close() error {
+	return p.db.Close()
+}
+
+// maxMindASNProvider MaxMind GeoLite2 ASN 数据库，只提供 ASN 和运营商
+type maxMindASNProvider struct {
+	db *geoip2.Reader
+}
+
+// OpenMaxMindASN 打开 MaxMind ASN 数据库
+func OpenMaxMindASN(path string) (LocationProvider, error) {
+	db, err := geoip2.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &maxMindASNProvider{db: db}, nil
+}
+
+func (p *maxMindASNProvider) Lookup(ip net.IP) (*LocationInfo, error) {
+	record, err := p.db.ASN(ip)
+	if err != nil {
+		return nil, err
+	}
+	return &LocationInfo{
+		ASN: record.AutonomousSystemNumber,
+		ISP: record.AutonomousSystemOrganization,
+	}, nil
+}
+
+func (p *maxMindASNProvider) Close() error {
+	return p.db.Close()
+}
+
+// localizedName 优先使用英文名称，没有时取任意一个可用的名称
+func localizedName(names map[string]string) string {
+	if name, ok := names["en"]; ok {
+		return name
+	}
+	for _, name := range names {
+		return name
+	}
+	return ""
+}
+
+// ipRange 离线 IP 段表中的一段，地址统一为 16 字节形式以便 IPv4 和 IPv6 一起比较
+type ipRange struct {
+	start net.IP
+	end   net.IP
+	info  LocationInfo
+}
+
+// csvRangeProvider 离线 IP 段表，不依赖 MaxMind 数据库
+type csvRangeProvider struct {
+	ranges []ipRange
+}
+
+// OpenCSVRanges 读取离线 IP 段表文件
+func OpenCSVRanges(path string) (LocationProvider, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return parseCSVRanges(file)
+}
+
+// parseCSVRanges 解析 IP 段表，每行为 start_ip,end_ip,country,region,city,latitude,longitude,asn,isp，
+// country 之后的列可以省略；# 开头的行和首行表头会被忽略，IP 段之间不应重叠
+func parseCSVRanges(r io.Reader) (*csvRangeProvider, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	provider := &csvRangeProvider{}
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if line == 1 && len(record) > 0 && net.ParseIP(record[0]) == nil {
+			continue
+		}
+		if len(record) < 3 {
+			return nil, fmt.Errorf("line %d: expected at least start_ip, end_ip and country", line)
+		}
+
+		start, end := net.ParseIP(record[0]).To16(), net.ParseIP(record[1]).To16()
+		if start == nil || end == nil || bytes.Compare(start, end) > 0 {
+			return nil, fmt.Errorf("line %d: invalid IP range %s - %s", line, record[0], record[1])
+		}
+
+		entry := ipRange{start: start, end: end}
+		entry.info.Country = record[2]
+		if len(record) > 3 {
+			entry.info.Region = record[3]
+		}
+		if len(record) > 4 {
+			entry.info.City = record[4]
+		}
+		if len(record) > 5 {
+			if entry.info.Latitude, err = parseOptionalFloat(record[5]); err != nil {
+				return nil, fmt.Errorf("line %d: invalid latitude: %w", line, err)
+			}
+		}
+		if len(record) > 6 {
+			if entry.info.Longitude, err = parseOptionalFloat(record[6]); err != nil {
+				return nil, fmt.Errorf("line %d: invalid longitude: %w", line, err)
+			}
+		}
+		if len(record) > 7 && record[7] != "" {
+			asn, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(record[7]), "AS"), 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid ASN: %w", line, err)
+			}
+			entry.info.ASN = uint(asn)
+		}
+		if len(record) > 8 {
+			entry.info.ISP = record[8]
+		}
+		provider.ranges = append(provider.ranges, entry)
+	}
+
+	sort.Slice(provider.ranges, func(i, j int) bool {
+		return bytes.Compare(provider.ranges[i].start, provider.ranges[j].start) < 0
+	})
+	return provider, nil
+}
+
+func parseOptionalFloat(value string) (float64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.ParseFloat(value, 64)
+}
+
+func (p *csvRangeProvider) Lookup(ip net.IP) (*LocationInfo, error) {
+	ip = ip.To16()
+	if ip == nil {
+		return nil, ErrLocationNotFound
+	}
+
+	// 找到起始地址不大于 ip 的最后一段
+	i := sort.Search(len(p.ranges), func(i int) bool {
+		return bytes.Compare(p.ranges[i].start, ip) > 0
+	}) - 1
+	if i < 0 || bytes.Compare(ip, p.ranges[i].end) > 0 {
+		return nil, ErrLocationNotFound
+	}
+	info := p.ranges[i].info
+	return &info, nil
+}
+
+func (p *csvRangeProvider) Close() error {
+	return nil
+}
+
+// multiProvider 依次查询多个数据源，后面的数据源只补充前面没有提供的字段，例如 City 库加 ASN 库
+type multiProvider []LocationProvider
+
+func (m multiProvider) Lookup(ip net.IP) (*LocationInfo, error) {
+	var result *LocationInfo
+	var lastErr error
+	for _, provider := range m {
+		info, err := provider.Lookup(ip)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if result == nil {
+			result = info
+			continue
+		}
+		result.merge(info)
+	}
+	if result == nil {
+		return nil, lastErr
+	}
+	return result, nil
+}
+
+func (m multiProvider) Close() error {
+	var errs []error
+	for _, provider := range m {
+		errs = append(errs, provider.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// reloadingProvider 定期检查数据文件的修改时间和大小，文件更新后打开新的数据源并替换，再关闭旧的数据源
+// 更新数据文件时应先写入临时文件再重命名，避免读到写了一半的文件
+type reloadingProvider struct {
+	path     string
+	open     func(path string) (LocationProvider, error)
+	onReload func()
+
+	mutex   sync.RWMutex
+	current LocationProvider
+	modTime time.Time
+	size    int64
+	closed  bool
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// newReloadingProvider 打开数据文件，interval 大于 0 时启动后台检查
+func newReloadingProvider(path string, open func(string) (LocationProvider, error), interval time.Duration, onReload func()) (*reloadingProvider, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	current, err := open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &reloadingProvider{
+		path:     path,
+		open:     open,
+		onReload: onReload,
+		current:  current,
+		modTime:  info.ModTime(),
+		size:     info.Size(),
+		done:     make(chan struct{}),
+	}
+	if interval > 0 {
+		go p.watch(interval)
+	}
+	return p, nil
+}
+
+func (p *reloadingProvider) Lookup(ip net.IP) (*LocationInfo, error) {
+	// 持有读锁期间旧的数据源不会被关闭
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.current.Lookup(ip)
+}
+
+// reload 文件有变化时重新打开，新文件无法打开时继续使用旧的数据源，下次检查时重试
+func (p *reloadingProvider) reload() (bool, error) {
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return false, err
+	}
+
+	p.mutex.RLock()
+	changed := !info.ModTime().Equal(p.modTime) || info.Size() != p.size
+	p.mutex.RUnlock()
+	if !changed {
+		return false, nil
+	}
+
+	next, err := p.open(p.path)
+	if err != nil {
+		return false, err
+	}
+
+	p.mutex.Lock()
+	if p.closed {
+		p.mutex.Unlock()
+		return false, next.Close()
+	}
+	previous := p.current
+	p.current = next
+	p.modTime = info.ModTime()
+	p.size = info.Size()
+	p.mutex.Unlock()
+
+	// 取得写锁后已没有使用旧数据源的查询
+	if err := previous.Close(); err != nil {
+		log.Printf("Failed to close previous GeoIP database %s: %v", p.path, err)
+	}
+	if p.onReload != nil {
+		p.onReload()
+	}
+	return true, nil
+}
+
+func (p *reloadingProvider) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			reloaded, err := p.reload()
+			if err != nil {
+				log.Printf("Failed to reload GeoIP database %s: %v", p.path, err)
+			} else if reloaded {
+				log.Printf("GeoIP database reloaded: %s", p.path)
+			}
+		case <-p.done:
+			return
+		}
+	}
+}
+
+func (p *reloadingProvider) Close() error {
+	p.closeOnce.Do(func() { close(p.done) })
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+	return p.current.Close()
+}
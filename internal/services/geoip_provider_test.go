@@ -0,0 +1,181 @@
+package services
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testRangeTable = `start_ip,end_ip,country,region,city,latitude,longitude,asn,isp
+# 注释行
+1.0.0.0,1.0.0.255,Australia,Queensland,Brisbane,-27.47,153.02,AS13335,Cloudflare
+8.8.8.0,8.8.8.255,United States,California,Mountain View,37.4,-122.08,15169,Google LLC
+2001:db8::,2001:db8::ffff,Testland
+`
+
+func TestCSVRangeProviderLookup(t *testing.T) {
+	provider, err := parseCSVRanges(strings.NewReader(testRangeTable))
+	if err != nil {
+		t.Fatalf("解析 IP 段表失败: %v", err)
+	}
+
+	info, err := provider.Lookup(net.ParseIP("8.8.8.8"))
+	if err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	if info.Country != "United States" || info.Region != "California" || info.City != "Mountain View" ||
+		info.ASN != 15169 || info.ISP != "Google LLC" || info.Latitude != 37.4 {
+		t.Errorf("查询结果不正确: %+v", info)
+	}
+
+	if info, err := provider.Lookup(net.ParseIP("1.0.0.1")); err != nil || info.ASN != 13335 {
+		t.Errorf("AS 前缀的 ASN 应该被解析, 实际 %+v, %v", info, err)
+	}
+	if info, err := provider.Lookup(net.ParseIP("2001:db8::1")); err != nil || info.Country != "Testland" || info.City != "" {
+		t.Errorf("IPv6 段查询结果不正确: %+v, %v", info, err)
+	}
+
+	for _, ip := range []string{"8.8.9.1", "0.255.255.255", "2001:db9::1"} {
+		if _, err := provider.Lookup(net.ParseIP(ip)); err != ErrLocationNotFound {
+			t.Errorf("%s 期望 ErrLocationNotFound, 实际 %v", ip, err)
+		}
+	}
+}
+
+func TestCSVRangeProviderInvalidRange(t *testing.T) {
+	if _, err := parseCSVRanges(strings.NewReader("8.8.8.255,8.8.8.0,Nowhere\n")); err == nil {
+		t.Error("起始地址大于结束地址时应该返回错误")
+	}
+}
+
+// fakeProvider 返回固定结果的数据源
+type fakeProvider struct {
+	info   *LocationInfo
+	err    error
+	closed bool
+}
+
+func (f *fakeProvider) Lookup(ip net.IP) (*LocationInfo, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	info := *f.info
+	return &info, nil
+}
+
+func (f *fakeProvider) Close() error {
+	f.closed = true
+	return nil
+}
+
+func TestMultiProviderMerge(t *testing.T) {
+	city := &fakeProvider{info: &LocationInfo{Country: "Japan", City: "Tokyo"}}
+	asn := &fakeProvider{info: &LocationInfo{Country: "Ignored", ASN: 2516, ISP: "KDDI"}}
+
+	info, err := multiProvider{city, asn}.Lookup(net.ParseIP("203.0.113.1"))
+	if err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	if info.Country != "Japan" || info.City != "Tokyo" || info.ASN != 2516 || info.ISP != "KDDI" {
+		t.Errorf("合并结果不正确: %+v", info)
+	}
+
+	// 前面的数据源失败时使用后面的结果
+	failing := &fakeProvider{err: ErrLocationNotFound}
+	if info, err := (multiProvider{failing, asn}).Lookup(net.ParseIP("203.0.113.1")); err != nil || info.ASN != 2516 {
+		t.Errorf("期望使用 ASN 数据源的结果, 实际 %+v, %v", info, err)
+	}
+	if _, err := (multiProvider{failing}).Lookup(net.ParseIP("203.0.113.1")); err != ErrLocationNotFound {
+		t.Errorf("所有数据源都失败时应该返回错误, 实际 %v", err)
+	}
+}
+
+func TestReloadingProviderSwapsOnChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ranges.csv")
+	if err := os.WriteFile(path, []byte("8.8.8.0,8.8.8.255,Old\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	reloads := 0
+	provider, err := newReloadingProvider(path, OpenCSVRanges, 0, func() { reloads++ })
+	if err != nil {
+		t.Fatalf("打开数据文件失败: %v", err)
+	}
+	defer provider.Close()
+
+	if reloaded, err := provider.reload(); reloaded || err != nil {
+		t.Errorf("文件未变化时不应该重新加载, 实际 %v, %v", reloaded, err)
+	}
+
+	// 先写临时文件再重命名，与下载脚本的更新方式一致
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte("8.8.8.0,8.8.8.255,New\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(tmp, time.Now(), time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatal(err)
+	}
+
+	if reloaded, err := provider.reload(); !reloaded || err != nil {
+		t.Fatalf("文件变化后应该重新加载, 实际 %v, %v", reloaded, err)
+	}
+	if reloads != 1 {
+		t.Errorf("期望重新加载回调 1 次, 实际 %d", reloads)
+	}
+	if info, err := provider.Lookup(net.ParseIP("8.8.8.8")); err != nil || info.Country != "New" {
+		t.Errorf("期望查询到新数据, 实际 %+v, %v", info, err)
+	}
+
+	// 新文件无法解析时继续使用旧数据
+	if err := os.WriteFile(path, []byte("not,an,ip-range\n8.8.8.8\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, time.Now(), time.Now().Add(2*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := provider.reload(); err == nil {
+		t.Error("无法解析的数据文件应该返回错误")
+	}
+	if info, err := provider.Lookup(net.ParseIP("8.8.8.8")); err != nil || info.Country != "New" {
+		t.Errorf("重新加载失败后应该继续使用旧数据, 实际 %+v, %v", info, err)
+	}
+}
+
+func TestGeoIPServiceWithProvider(t *testing.T) {
+	provider := &fakeProvider{info: &LocationInfo{Country: "Germany", Region: "Berlin", City: "Berlin", ASN: 3320, ISP: "Deutsche Telekom AG"}}
+	service := NewGeoIPServiceWithProvider(provider)
+
+	info, err := service.GetLocationInfo("203.0.113.10")
+	if err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	if info.Region != "Berlin" || info.ASN != 3320 || info.ISP != "Deutsche Telekom AG" {
+		t.Errorf("查询结果不正确: %+v", info)
+	}
+
+	// 数据源中没有记录时地区记为 Unknown
+	provider.err = ErrLocationNotFound
+	info, err = service.GetLocationInfo("203.0.113.11")
+	if err != nil {
+		t.Fatalf("没有记录时不应该返回错误: %v", err)
+	}
+	if info.Country != "Unknown" || info.Region != "Unknown" || info.City != "Unknown" {
+		t.Errorf("期望 Unknown, 实际 %+v", info)
+	}
+
+	// 重新加载后清空缓存
+	service.onReload()
+	if cached := service.getFromCache("203.0.113.10"); cached != nil {
+		t.Error("重新加载后缓存应该被清空")
+	}
+
+	if err := service.Close(); err != nil || !provider.closed {
+		t.Errorf("Close 应该关闭数据源, 实际 %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"anywebsites/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// maxCacheMaxAge 单个内容允许设置的最长缓存时间（一年）
+const maxCacheMaxAge = 365 * 24 * 3600
+
+// defaultCacheMaxAge 计划配置查询失败时使用的缓存时间
+const defaultCacheMaxAge = 60
+
+// ErrInvalidCacheMaxAge 缓存时间超出允许范围
+var ErrInvalidCacheMaxAge = fmt.Errorf("cache_max_age must be between 0 and %d seconds", maxCacheMaxAge)
+
+// cachedMaxAge 缓存的用户计划默认缓存时间
+type cachedMaxAge struct {
+	maxAge    int
+	expiresAt time.Time
+}
+
+// CachePolicy 根据内容设置和所有者计划生成 Cache-Control 响应头
+type CachePolicy struct {
+	planService *PlanService
+
+	maxAges  map[uuid.UUID]*cachedMaxAge
+	mutex    sync.RWMutex
+	cacheTTL time.Duration
+}
+
+// NewCachePolicy 创建缓存策略
+func NewCachePolicy(planService *PlanService) *CachePolicy {
+	return &CachePolicy{
+		planService: planService,
+		maxAges:     make(map[uuid.UUID]*cachedMaxAge),
+		cacheTTL:    5 * time.Minute,
+	}
+}
+
+// CacheControl 返回内容页的 Cache-Control 值，内容自身的设置优先于计划默认值
+func (p *CachePolicy) CacheControl(content *models.Content) string {
+	maxAge := 0
+	if content.CacheMaxAge != nil {
+		maxAge = *content.CacheMaxAge
+	} else {
+		maxAge = p.planMaxAge(content.UserID)
+	}
+	return cacheControlValue(content.Visibility, maxAge)
+}
+
+// planMaxAge 获取所有者计划的默认缓存时间，结果缓存一段时间以减少数据库查询
+func (p *CachePolicy) planMaxAge(userID uuid.UUID) int {
+	p.mutex.RLock()
+	cached, exists := p.maxAges[userID]
+	p.mutex.RUnlock()
+	if exists && time.Now().Before(cached.expiresAt) {
+		return cached.maxAge
+	}
+
+	maxAge := defaultCacheMaxAge
+	if subscription, err := p.planService.GetUserPlan(userID); err == nil {
+		if planConfig, err := p.planService.GetPlanConfig(subscription.PlanType); err == nil {
+			maxAge = planConfig.CacheMaxAge
+		}
+	}
+
+	p.mutex.Lock()
+	p.maxAges[userID] = &cachedMaxAge{maxAge: maxAge, expiresAt: time.Now().Add(p.cacheTTL)}
+	p.mutex.Unlock()
+
+	return maxAge
+}
+
+// cacheControlValue 公开内容允许共享缓存，私有内容只允许浏览器缓存；maxAge 为 0 时每次重新验证
+func cacheControlValue(visibility models.ContentVisibility, maxAge int) string {
+	scope := "public"
+	if visibility == models.VisibilityAccessCode || visibility == models.VisibilityOwnerOnly {
+		scope = "private"
+	}
+	if maxAge <= 0 {
+		return scope + ", no-cache"
+	}
+	return fmt.Sprintf("%s, max-age=%d", scope, maxAge)
+}
+
+// applyCacheMaxAge 校验并设置内容的缓存时间，value 为负数时清除设置，恢复为计划默认值
+func applyCacheMaxAge(content *models.Content, value *int) error {
+	if value == nil {
+		return nil
+	}
+	if *value < 0 {
+		content.CacheMaxAge = nil
+		return nil
+	}
+	if *value > maxCacheMaxAge {
+		return ErrInvalidCacheMaxAge
+	}
+	maxAge := *value
+	content.CacheMaxAge = &maxAge
+	return nil
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"anywebsites/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestCacheControlValue(t *testing.T) {
+	tests := []struct {
+		visibility models.ContentVisibility
+		maxAge     int
+		want       string
+	}{
+		{models.VisibilityPublic, 300, "public, max-age=300"},
+		{models.VisibilityPublic, 0, "public, no-cache"},
+		{"", 60, "public, max-age=60"},
+		{models.VisibilityAccessCode, 300, "private, max-age=300"},
+		{models.VisibilityOwnerOnly, 0, "private, no-cache"},
+	}
+
+	for _, tt := range tests {
+		if got := cacheControlValue(tt.visibility, tt.maxAge); got != tt.want {
+			t.Errorf("cacheControlValue(%q, %d) = %q，期望 %q", tt.visibility, tt.maxAge, got, tt.want)
+		}
+	}
+}
+
+func TestCachePolicy_ContentOverride(t *testing.T) {
+	userID := uuid.New()
+	policy := NewCachePolicy(NewPlanService())
+	// 预置计划缓存，避免查询数据库
+	policy.maxAges[userID] = &cachedMaxAge{maxAge: 600, expiresAt: time.Now().Add(time.Minute)}
+
+	content := &models.Content{UserID: userID, Visibility: models.VisibilityPublic}
+	if got := policy.CacheControl(content); got != "public, max-age=600" {
+		t.Errorf("未设置内容缓存时间时应使用计划默认值，实际 %q", got)
+	}
+
+	zero := 0
+	content.CacheMaxAge = &zero
+	if got := policy.CacheControl(content); got != "public, no-cache" {
+		t.Errorf("内容缓存时间为 0 时应每次重新验证，实际 %q", got)
+	}
+}
+
+func TestApplyCacheMaxAge(t *testing.T) {
+	content := &models.Content{}
+
+	if err := applyCacheMaxAge(content, nil); err != nil || content.CacheMaxAge != nil {
+		t.Errorf("不传缓存时间时不应修改内容")
+	}
+
+	value := 120
+	if err := applyCacheMaxAge(content, &value); err != nil {
+		t.Fatalf("合法的缓存时间不应出错: %v", err)
+	}
+	if content.CacheMaxAge == nil || *content.CacheMaxAge != 120 {
+		t.Errorf("缓存时间应设置为 120")
+	}
+	value = 999
+	if *content.CacheMaxAge != 120 {
+		t.Errorf("内容不应引用请求中的指针")
+	}
+
+	tooLong := maxCacheMaxAge + 1
+	if err := applyCacheMaxAge(content, &tooLong); !errors.Is(err, ErrInvalidCacheMaxAge) {
+		t.Errorf("超出上限时应返回 ErrInvalidCacheMaxAge，实际 %v", err)
+	}
+
+	reset := -1
+	if err := applyCacheMaxAge(content, &reset); err != nil || content.CacheMaxAge != nil {
+		t.Errorf("负数应清除内容的缓存时间设置")
+	}
+}
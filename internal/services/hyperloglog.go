@@ -0,0 +1,108 @@
+package services
+
+import (
+	"errors"
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+// hllPrecision 寄存器数量为 2^hllPrecision，标准误差约为 1.04/sqrt(2^hllPrecision) ≈ 3.3%
+const hllPrecision = 10
+
+const hllRegisters = 1 << hllPrecision
+
+// ErrInvalidSketch 草图数据长度不正确
+var ErrInvalidSketch = errors.New("invalid visitor sketch")
+
+// HyperLogLog 基数估算草图，用于跨天合并独立访客数而不保存访客标识
+// 序列化后为 hllRegisters 个字节，每个字节是一个寄存器
+type HyperLogLog struct {
+	registers []uint8
+}
+
+// NewHyperLogLog 创建空草图
+func NewHyperLogLog() *HyperLogLog {
+	return &HyperLogLog{registers: make([]uint8, hllRegisters)}
+}
+
+// ParseHyperLogLog 从 Bytes 的输出恢复草图
+func ParseHyperLogLog(data []byte) (*HyperLogLog, error) {
+	if len(data) != hllRegisters {
+		return nil, ErrInvalidSketch
+	}
+	return &HyperLogLog{registers: append([]uint8(nil), data...)}, nil
+}
+
+// Add 加入一个值
+func (h *HyperLogLog) Add(value string) {
+	hasher := fnv.New64a()
+	hasher.Write([]byte(value))
+	x := mix64(hasher.Sum64())
+
+	index := x >> (64 - hllPrecision)
+	// 剩余位中第一个 1 的位置；加一个哨兵位保证全零时不越界
+	rank := uint8(bits.LeadingZeros64(x<<hllPrecision|1<<(hllPrecision-1))) + 1
+	if rank > h.registers[index] {
+		h.registers[index] = rank
+	}
+}
+
+// Merge 合并另一个草图，结果等于两个集合并集的草图
+func (h *HyperLogLog) Merge(other *HyperLogLog) {
+	for i, rank := range other.registers {
+		if rank > h.registers[i] {
+			h.registers[i] = rank
+		}
+	}
+}
+
+// Count 估算不同值的数量
+func (h *HyperLogLog) Count() uint64 {
+	m := float64(hllRegisters)
+	sum := 0.0
+	zeros := 0
+	for _, rank := range h.registers {
+		sum += 1 / float64(uint64(1)<<rank)
+		if rank == 0 {
+			zeros++
+		}
+	}
+
+	alpha := 0.7213 / (1 + 1.079/m)
+	estimate := alpha * m * m / sum
+
+	// 基数较小时使用线性计数
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(estimate + 0.5)
+}
+
+// Bytes 序列化草图
+func (h *HyperLogLog) Bytes() []byte {
+	return append([]byte(nil), h.registers...)
+}
+
+// EstimateUniqueVisitors 合并多天的访客草图并估算独立访客数，无效的草图被忽略
+func EstimateUniqueVisitors(sketches [][]byte) int64 {
+	merged := NewHyperLogLog()
+	for _, data := range sketches {
+		sketch, err := ParseHyperLogLog(data)
+		if err != nil {
+			continue
+		}
+		merged.Merge(sketch)
+	}
+	return int64(merged.Count())
+}
+
+// mix64 打散 FNV 哈希的低熵输入（splitmix64 的最后一步）
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
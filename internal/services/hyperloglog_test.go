@@ -0,0 +1,63 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestHyperLogLogCount(t *testing.T) {
+	for _, n := range []int{0, 1, 100, 5000, 100000} {
+		h := NewHyperLogLog()
+		for i := 0; i < n; i++ {
+			h.Add(fmt.Sprintf("visitor-%d", i))
+			// 重复加入不影响估算
+			h.Add(fmt.Sprintf("visitor-%d", i))
+		}
+
+		got := float64(h.Count())
+		if n == 0 {
+			if got != 0 {
+				t.Errorf("空草图期望 0, 实际 %v", got)
+			}
+			continue
+		}
+		if diff := math.Abs(got-float64(n)) / float64(n); diff > 0.1 {
+			t.Errorf("%d 个访客估算为 %v, 误差 %.1f%% 超过 10%%", n, got, diff*100)
+		}
+	}
+}
+
+func TestHyperLogLogMerge(t *testing.T) {
+	day1 := NewHyperLogLog()
+	day2 := NewHyperLogLog()
+	for i := 0; i < 3000; i++ {
+		day1.Add(fmt.Sprintf("visitor-%d", i))
+	}
+	// 第二天有 1000 个访客与第一天重复
+	for i := 2000; i < 5000; i++ {
+		day2.Add(fmt.Sprintf("visitor-%d", i))
+	}
+
+	got := EstimateUniqueVisitors([][]byte{day1.Bytes(), day2.Bytes(), []byte("invalid")})
+	if diff := math.Abs(float64(got)-5000) / 5000; diff > 0.1 {
+		t.Errorf("合并后期望约 5000, 实际 %d", got)
+	}
+}
+
+func TestParseHyperLogLog(t *testing.T) {
+	h := NewHyperLogLog()
+	h.Add("visitor")
+
+	parsed, err := ParseHyperLogLog(h.Bytes())
+	if err != nil {
+		t.Fatalf("解析草图失败: %v", err)
+	}
+	if parsed.Count() != h.Count() {
+		t.Errorf("解析后估算值不一致: %d != %d", parsed.Count(), h.Count())
+	}
+
+	if _, err := ParseHyperLogLog(make([]byte, hllRegisters-1)); err != ErrInvalidSketch {
+		t.Errorf("长度错误时期望 ErrInvalidSketch, 实际 %v", err)
+	}
+}
@@ -0,0 +1,223 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"anywebsites/internal/auth"
+	"anywebsites/internal/config"
+	"anywebsites/internal/database"
+	"anywebsites/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// jwtKeyCheckInterval 检查是否需要轮换并重新加载密钥的间隔，多个实例通过数据库共用同一组密钥
+const jwtKeyCheckInterval = time.Minute
+
+// JWTKeyService JWT 签名密钥服务，负责非对称密钥的生成、定期轮换和加载
+// 轮换后旧密钥停止签发，但在宽限期内继续用于校验，已签发的 Token 不受影响
+type JWTKeyService struct {
+	algorithm        string
+	secret           string
+	rotationInterval time.Duration
+	gracePeriod      time.Duration
+	kek              *auth.KeyEncryptionKey // 加密数据库中的私钥
+
+	stopChan chan struct{}
+	stopOnce sync.Once
+}
+
+// NewJWTKeyService 创建 JWT 签名密钥服务，HS256 的密钥不安全、非对称签名缺少私钥加密密钥
+// 或算法不受支持时返回错误
+func NewJWTKeyService(cfg config.JWTConfig) (*JWTKeyService, error) {
+	var kek *auth.KeyEncryptionKey
+	switch cfg.Algorithm {
+	case auth.AlgorithmHS256:
+		if err := auth.CheckSecret(cfg.Secret); err != nil {
+			return nil, err
+		}
+	case auth.AlgorithmRS256, auth.AlgorithmEdDSA:
+		if cfg.KeyRotationInterval <= 0 {
+			return nil, errors.New("JWT key rotation interval must be positive")
+		}
+		var err error
+		if kek, err = auth.ParseKeyEncryptionKey(cfg.KeyEncryptionKey); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported JWT algorithm: %s", cfg.Algorithm)
+	}
+
+	// 宽限期短于刷新 Token 的有效期时，轮换前签发的刷新 Token 会提前失效
+	gracePeriod := cfg.KeyGracePeriod
+	if gracePeriod < auth.RefreshTokenTTL {
+		log.Printf("Warning: JWT key grace period %v is shorter than the refresh token lifetime, using %v", gracePeriod, auth.RefreshTokenTTL)
+		gracePeriod = auth.RefreshTokenTTL
+	}
+
+	return &JWTKeyService{
+		algorithm:        cfg.Algorithm,
+		secret:           cfg.Secret,
+		rotationInterval: cfg.KeyRotationInterval,
+		gracePeriod:      gracePeriod,
+		kek:              kek,
+		stopChan:         make(chan struct{}),
+	}, nil
+}
+
+// Start 加载签名密钥，数据库中没有可用密钥时生成新密钥，并在后台定期检查轮换
+func (s *JWTKeyService) Start() error {
+	if s.algorithm == auth.AlgorithmHS256 {
+		auth.SetKeys(auth.NewHMACKey([]byte(s.secret)), nil)
+		return nil
+	}
+
+	if err := s.refresh(); err != nil {
+		return err
+	}
+	go s.watch()
+	return nil
+}
+
+// Stop 停止后台检查
+func (s *JWTKeyService) Stop() {
+	s.stopOnce.Do(func() { close(s.stopChan) })
+}
+
+func (s *JWTKeyService) watch() {
+	ticker := time.NewTicker(jwtKeyCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.refresh(); err != nil {
+				log.Printf("Failed to refresh JWT signing keys: %v", err)
+			}
+		case <-s.stopChan:
+			return
+		}
+	}
+}
+
+// refresh 当前密钥到期或算法变化时轮换，删除已过宽限期的密钥，再重新加载
+func (s *JWTKeyService) refresh() error {
+	var current models.JWTSigningKey
+	err := database.DB.Where("retired_at IS NULL").Order("created_at DESC").First(&current).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		if err := s.Rotate(); err != nil {
+			return err
+		}
+	case err != nil:
+		return fmt.Errorf("failed to find JWT signing key: %w", err)
+	case current.Algorithm != s.algorithm || time.Since(current.CreatedAt) >= s.rotationInterval:
+		if err := s.Rotate(); err != nil {
+			return err
+		}
+	}
+
+	if err := database.DB.Where("expires_at IS NOT NULL AND expires_at < ?", time.Now()).
+		Delete(&models.JWTSigningKey{}).Error; err != nil {
+		return fmt.Errorf("failed to delete expired JWT signing keys: %w", err)
+	}
+
+	return s.load()
+}
+
+// Rotate 生成新的签名密钥，其余密钥退役并在宽限期内继续用于校验
+func (s *JWTKeyService) Rotate() error {
+	key, err := auth.GenerateSigningKey(s.algorithm)
+	if err != nil {
+		return fmt.Errorf("failed to generate JWT signing key: %w", err)
+	}
+	privateKey, err := key.MarshalPrivateKey()
+	if err != nil {
+		return fmt.Errorf("failed to encode JWT signing key: %w", err)
+	}
+	encrypted, err := s.kek.Encrypt(key.ID, privateKey)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt JWT signing key: %w", err)
+	}
+
+	// 其他实例最多在一个检查间隔之后才切换到新密钥，期间仍用旧密钥签发
+	now := time.Now()
+	expiresAt := now.Add(s.gracePeriod + jwtKeyCheckInterval)
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.JWTSigningKey{}).
+			Where("retired_at IS NULL").
+			Updates(map[string]interface{}{"retired_at": now, "expires_at": expiresAt}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.JWTSigningKey{
+			ID:         key.ID,
+			Algorithm:  key.Algorithm,
+			PrivateKey: encrypted,
+			CreatedAt:  now,
+		}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to rotate JWT signing key: %w", err)
+	}
+
+	log.Printf("JWT signing key rotated, new kid %s (%s)", key.ID, key.Algorithm)
+	return nil
+}
+
+// load 从数据库加载未过期的密钥，最新的未退役密钥用于签发
+func (s *JWTKeyService) load() error {
+	var records []models.JWTSigningKey
+	if err := database.DB.Where("expires_at IS NULL OR expires_at > ?", time.Now()).
+		Order("created_at DESC").Find(&records).Error; err != nil {
+		return fmt.Errorf("failed to load JWT signing keys: %w", err)
+	}
+
+	var signing *auth.SigningKey
+	var verify []*auth.SigningKey
+	for _, record := range records {
+		privateKey, err := s.kek.Decrypt(record.ID, record.PrivateKey)
+		if err != nil {
+			log.Printf("Skipping JWT signing key %s: %v", record.ID, err)
+			continue
+		}
+		key, err := auth.ParseSigningKey(record.Algorithm, privateKey)
+		if err != nil {
+			log.Printf("Skipping invalid JWT signing key %s: %v", record.ID, err)
+			continue
+		}
+		if !auth.IsEncryptedKey(record.PrivateKey) {
+			s.encryptLegacyKey(record, privateKey)
+		}
+		if signing == nil && record.RetiredAt == nil {
+			signing = key
+			continue
+		}
+		verify = append(verify, key)
+	}
+	if signing == nil {
+		return errors.New("no active JWT signing key")
+	}
+
+	auth.SetKeys(signing, verify)
+	return nil
+}
+
+// encryptLegacyKey 加密启用私钥加密之前保存的明文私钥，失败时只记录日志，下次加载时重试
+// 只更新仍为明文的记录，多个实例同时加密时不会互相覆盖
+func (s *JWTKeyService) encryptLegacyKey(record models.JWTSigningKey, privateKey string) {
+	encrypted, err := s.kek.Encrypt(record.ID, privateKey)
+	if err == nil {
+		err = database.DB.Model(&models.JWTSigningKey{}).
+			Where("id = ? AND private_key = ?", record.ID, record.PrivateKey).
+			Update("private_key", encrypted).Error
+	}
+	if err != nil {
+		log.Printf("Failed to encrypt JWT signing key %s: %v", record.ID, err)
+		return
+	}
+	log.Printf("Encrypted JWT signing key %s", record.ID)
+}
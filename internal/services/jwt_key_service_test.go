@@ -0,0 +1,186 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"anywebsites/internal/auth"
+	"anywebsites/internal/config"
+	"anywebsites/internal/database"
+	"anywebsites/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// setupJWTKeyTestDB 创建签名密钥表
+func setupJWTKeyTestDB(t *testing.T) {
+	useTestDB(t, &models.JWTSigningKey{})
+}
+
+// testKeyEncryptionKey 测试用的私钥加密密钥
+const testKeyEncryptionKey = "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="
+
+func TestNewJWTKeyServiceValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.JWTConfig
+		err  bool
+	}{
+		{"默认共享密钥", config.JWTConfig{Algorithm: auth.AlgorithmHS256, Secret: "your-super-secret-jwt-key"}, true},
+		{"空共享密钥", config.JWTConfig{Algorithm: auth.AlgorithmHS256}, true},
+		{"足够长的共享密钥", config.JWTConfig{Algorithm: auth.AlgorithmHS256, Secret: "0123456789abcdef0123456789abcdef"}, false},
+		{"非对称签名不需要共享密钥", config.JWTConfig{Algorithm: auth.AlgorithmEdDSA, KeyRotationInterval: time.Hour, KeyEncryptionKey: testKeyEncryptionKey}, false},
+		{"缺少私钥加密密钥", config.JWTConfig{Algorithm: auth.AlgorithmEdDSA, KeyRotationInterval: time.Hour}, true},
+		{"私钥加密密钥长度不正确", config.JWTConfig{Algorithm: auth.AlgorithmRS256, KeyRotationInterval: time.Hour, KeyEncryptionKey: "c2hvcnQ="}, true},
+		{"不支持的算法", config.JWTConfig{Algorithm: "none"}, true},
+		{"轮换间隔为 0", config.JWTConfig{Algorithm: auth.AlgorithmRS256, KeyEncryptionKey: testKeyEncryptionKey}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewJWTKeyService(tt.cfg); (err != nil) != tt.err {
+				t.Errorf("期望出错 %v, 实际 %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestJWTKeyServiceRotation(t *testing.T) {
+	setupJWTKeyTestDB(t)
+
+	service, err := NewJWTKeyService(config.JWTConfig{
+		Algorithm:           auth.AlgorithmEdDSA,
+		KeyRotationInterval: 30 * 24 * time.Hour,
+		KeyGracePeriod:      time.Hour, // 短于刷新 Token 有效期，应被调整
+		KeyEncryptionKey:    testKeyEncryptionKey,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if service.gracePeriod != auth.RefreshTokenTTL {
+		t.Errorf("宽限期应调整为刷新 Token 有效期, 实际 %v", service.gracePeriod)
+	}
+
+	// 没有密钥时生成新密钥
+	if err := service.refresh(); err != nil {
+		t.Fatalf("加载密钥失败: %v", err)
+	}
+	firstKID := auth.CurrentKeyID()
+	if firstKID == "" {
+		t.Fatal("应该生成签名密钥")
+	}
+	token, err := auth.GenerateToken(uuid.New(), "alice", false, uuid.New())
+	if err != nil {
+		t.Fatalf("签发失败: %v", err)
+	}
+
+	// 未到轮换时间不生成新密钥
+	if err := service.refresh(); err != nil || auth.CurrentKeyID() != firstKID {
+		t.Errorf("未到轮换时间不应更换密钥, 实际 %s, %v", auth.CurrentKeyID(), err)
+	}
+
+	// 当前密钥到期后轮换，旧密钥在宽限期内仍可校验
+	database.DB.Model(&models.JWTSigningKey{}).Where("id = ?", firstKID).
+		Update("created_at", time.Now().Add(-31*24*time.Hour))
+	if err := service.refresh(); err != nil {
+		t.Fatalf("轮换失败: %v", err)
+	}
+	if auth.CurrentKeyID() == firstKID {
+		t.Fatal("到期后应该轮换密钥")
+	}
+	if _, err := auth.ValidateToken(token); err != nil {
+		t.Errorf("宽限期内旧 Token 应该有效: %v", err)
+	}
+	if jwks := auth.PublicKeys(); len(jwks.Keys) != 2 {
+		t.Errorf("JWKS 应包含新旧 2 个公钥, 实际 %d", len(jwks.Keys))
+	}
+
+	// 宽限期结束后删除旧密钥
+	database.DB.Model(&models.JWTSigningKey{}).Where("id = ?", firstKID).
+		Update("expires_at", time.Now().Add(-time.Minute))
+	if err := service.refresh(); err != nil {
+		t.Fatalf("重新加载失败: %v", err)
+	}
+	var count int64
+	database.DB.Model(&models.JWTSigningKey{}).Count(&count)
+	if count != 1 {
+		t.Errorf("过期密钥应该被删除, 剩余 %d", count)
+	}
+	if _, err := auth.ValidateToken(token); !errors.Is(err, auth.ErrUnknownSigningKey) {
+		t.Errorf("宽限期结束后旧 Token 应失效, 实际 %v", err)
+	}
+
+	// 切换算法时立即轮换
+	service.algorithm = auth.AlgorithmRS256
+	if err := service.refresh(); err != nil {
+		t.Fatalf("切换算法失败: %v", err)
+	}
+	var current models.JWTSigningKey
+	database.DB.Where("retired_at IS NULL").First(&current)
+	if current.Algorithm != auth.AlgorithmRS256 || current.ID != auth.CurrentKeyID() {
+		t.Errorf("切换算法后应使用 RS256 密钥签发, 实际 %s", current.Algorithm)
+	}
+}
+
+func TestJWTKeyServiceEncryptsPrivateKeys(t *testing.T) {
+	setupJWTKeyTestDB(t)
+
+	service, err := NewJWTKeyService(config.JWTConfig{
+		Algorithm:           auth.AlgorithmEdDSA,
+		KeyRotationInterval: 30 * 24 * time.Hour,
+		KeyEncryptionKey:    testKeyEncryptionKey,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 启用加密之前保存的明文私钥在加载时加密，仍可继续签发
+	legacy, err := auth.GenerateSigningKey(auth.AlgorithmEdDSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacyPEM, err := legacy.MarshalPrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	database.DB.Create(&models.JWTSigningKey{ID: legacy.ID, Algorithm: legacy.Algorithm, PrivateKey: legacyPEM, CreatedAt: time.Now()})
+
+	if err := service.refresh(); err != nil {
+		t.Fatalf("加载密钥失败: %v", err)
+	}
+	if auth.CurrentKeyID() != legacy.ID {
+		t.Errorf("应继续使用已有的密钥签发, 实际 %s", auth.CurrentKeyID())
+	}
+	var stored models.JWTSigningKey
+	database.DB.First(&stored, "id = ?", legacy.ID)
+	if !auth.IsEncryptedKey(stored.PrivateKey) || strings.Contains(stored.PrivateKey, "PRIVATE KEY") {
+		t.Errorf("明文私钥应在加载时加密: %s", stored.PrivateKey)
+	}
+
+	// 轮换生成的私钥加密保存
+	if err := service.Rotate(); err != nil {
+		t.Fatalf("轮换失败: %v", err)
+	}
+	if err := service.load(); err != nil {
+		t.Fatalf("重新加载失败: %v", err)
+	}
+	database.DB.First(&stored, "id = ?", auth.CurrentKeyID())
+	if !auth.IsEncryptedKey(stored.PrivateKey) {
+		t.Errorf("新私钥应加密保存: %s", stored.PrivateKey)
+	}
+
+	// 使用其他加密密钥时无法加载
+	other, err := NewJWTKeyService(config.JWTConfig{
+		Algorithm:           auth.AlgorithmEdDSA,
+		KeyRotationInterval: 30 * 24 * time.Hour,
+		KeyEncryptionKey:    "ZmVkY2JhOTg3NjU0MzIxMGZlZGNiYTk4NzY1NDMyMTA=",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := other.load(); err == nil {
+		t.Error("加密密钥不一致时不应加载签名密钥")
+	}
+}
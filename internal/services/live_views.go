@@ -0,0 +1,218 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// liveViewMinutes 滚动统计保留的分钟数
+	liveViewMinutes = 60
+	// liveViewBuffer 每个订阅者的事件缓冲，消费不及时时丢弃新事件而不阻塞发布者
+	liveViewBuffer = 64
+)
+
+// LiveViewEvent 推送给实时监控页面的一次访问，地理位置由写入管道解析
+type LiveViewEvent struct {
+	ContentID   uuid.UUID `json:"content_id"`
+	UserID      uuid.UUID `json:"-"`
+	Country     string    `json:"country"`
+	RefererHost string    `json:"referer_host"`
+	DeviceType  string    `json:"device_type"`
+	IsBot       bool      `json:"is_bot"`
+	AccessTime  time.Time `json:"access_time"`
+}
+
+// LiveViewMinute 一分钟内的访问量
+type LiveViewMinute struct {
+	Minute string `json:"minute"` // 2006-01-02T15:04
+	Views  int64  `json:"views"`
+}
+
+// LiveViewSubscription 一个实时访问订阅，UserID 为空时接收全站事件
+type LiveViewSubscription struct {
+	Events  <-chan LiveViewEvent
+	events  chan LiveViewEvent
+	userID  *uuid.UUID
+	hub     *LiveViewHub
+	dropped int64
+}
+
+// Dropped 因消费不及时被丢弃的事件数
+func (s *LiveViewSubscription) Dropped() int64 {
+	s.hub.mutex.RLock()
+	defer s.hub.mutex.RUnlock()
+	return s.dropped
+}
+
+// Close 取消订阅
+func (s *LiveViewSubscription) Close() {
+	s.hub.unsubscribe(s)
+}
+
+// liveViewCounter 最近 liveViewMinutes 分钟每分钟的访问量，按分钟序号循环使用槽位
+type liveViewCounter struct {
+	minutes [liveViewMinutes]int64
+	counts  [liveViewMinutes]int64
+}
+
+// add 计入一次访问，槽位已被更晚的分钟占用时说明访问早于统计窗口，忽略
+func (c *liveViewCounter) add(minute int64) {
+	slot := minute % liveViewMinutes
+	if c.minutes[slot] > minute {
+		return
+	}
+	if c.minutes[slot] != minute {
+		c.minutes[slot] = minute
+		c.counts[slot] = 0
+	}
+	c.counts[slot]++
+}
+
+// series 返回截至 now 的每分钟访问量，按时间从早到晚排列
+func (c *liveViewCounter) series(now int64) []LiveViewMinute {
+	series := make([]LiveViewMinute, 0, liveViewMinutes)
+	for minute := now - liveViewMinutes + 1; minute <= now; minute++ {
+		slot := minute % liveViewMinutes
+		var views int64
+		if c.minutes[slot] == minute {
+			views = c.counts[slot]
+		}
+		series = append(series, LiveViewMinute{
+			Minute: time.Unix(minute*60, 0).Format("2006-01-02T15:04"),
+			Views:  views,
+		})
+	}
+	return series
+}
+
+// latest 最近一次有访问的分钟序号
+func (c *liveViewCounter) latest() int64 {
+	var latest int64
+	for i, minute := range c.minutes {
+		if c.counts[i] > 0 && minute > latest {
+			latest = minute
+		}
+	}
+	return latest
+}
+
+// LiveViewHub 进程内的实时访问发布订阅中心，同时维护全站和每个用户的滚动每分钟访问量
+// 多实例部署时每个实例只能看到自己处理的访问
+type LiveViewHub struct {
+	mutex       sync.RWMutex
+	subscribers map[*LiveViewSubscription]struct{}
+	total       liveViewCounter
+	owners      map[uuid.UUID]*liveViewCounter
+	now         func() time.Time
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewLiveViewHub 创建实时访问发布订阅中心
+func NewLiveViewHub() *LiveViewHub {
+	return &LiveViewHub{
+		subscribers: make(map[*LiveViewSubscription]struct{}),
+		owners:      make(map[uuid.UUID]*liveViewCounter),
+		now:         time.Now,
+		done:        make(chan struct{}),
+	}
+}
+
+// Close 关闭订阅中心，服务器关闭时调用，所有推送连接随 Done 结束
+func (h *LiveViewHub) Close() {
+	h.closeOnce.Do(func() {
+		close(h.done)
+	})
+}
+
+// Done 订阅中心关闭时关闭的通道
+func (h *LiveViewHub) Done() <-chan struct{} {
+	return h.done
+}
+
+// Publish 发布一次访问，不会阻塞
+func (h *LiveViewHub) Publish(event LiveViewEvent) {
+	if event.AccessTime.IsZero() {
+		event.AccessTime = h.now()
+	}
+	minute := event.AccessTime.Unix() / 60
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	// 爬虫访问照常推送，但与访问次数一样不计入每分钟访问量
+	if !event.IsBot {
+		h.total.add(minute)
+		owner, ok := h.owners[event.UserID]
+		if !ok {
+			h.pruneOwners(minute)
+			owner = &liveViewCounter{}
+			h.owners[event.UserID] = owner
+		}
+		owner.add(minute)
+	}
+
+	for sub := range h.subscribers {
+		if sub.userID != nil && *sub.userID != event.UserID {
+			continue
+		}
+		select {
+		case sub.events <- event:
+		default:
+			sub.dropped++
+		}
+	}
+}
+
+// Subscribe 订阅实时访问，userID 为空时订阅全站；用完必须调用 Close
+func (h *LiveViewHub) Subscribe(userID *uuid.UUID) *LiveViewSubscription {
+	events := make(chan LiveViewEvent, liveViewBuffer)
+	sub := &LiveViewSubscription{Events: events, events: events, userID: userID, hub: h}
+
+	h.mutex.Lock()
+	h.subscribers[sub] = struct{}{}
+	h.mutex.Unlock()
+	return sub
+}
+
+// Counts 最近一小时每分钟的访问量，userID 为空时返回全站数据
+func (h *LiveViewHub) Counts(userID *uuid.UUID) []LiveViewMinute {
+	now := h.now().Unix() / 60
+
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	if userID == nil {
+		return h.total.series(now)
+	}
+	if owner, ok := h.owners[*userID]; ok {
+		return owner.series(now)
+	}
+	return (&liveViewCounter{}).series(now)
+}
+
+// Subscribers 当前订阅数
+func (h *LiveViewHub) Subscribers() int {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+	return len(h.subscribers)
+}
+
+func (h *LiveViewHub) unsubscribe(sub *LiveViewSubscription) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	delete(h.subscribers, sub)
+}
+
+// pruneOwners 删除一小时内没有访问的用户计数器，调用方需持有写锁
+func (h *LiveViewHub) pruneOwners(minute int64) {
+	for userID, counter := range h.owners {
+		if counter.latest() <= minute-liveViewMinutes {
+			delete(h.owners, userID)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestLiveViewHubScopedSubscriptions(t *testing.T) {
+	hub := NewLiveViewHub()
+	owner := uuid.New()
+	other := uuid.New()
+
+	all := hub.Subscribe(nil)
+	defer all.Close()
+	mine := hub.Subscribe(&owner)
+	defer mine.Close()
+
+	hub.Publish(LiveViewEvent{ContentID: uuid.New(), UserID: owner, Country: "China"})
+	hub.Publish(LiveViewEvent{ContentID: uuid.New(), UserID: other, Country: "Japan"})
+
+	if len(all.Events) != 2 {
+		t.Errorf("全站订阅期望收到 2 个事件, 实际 %d", len(all.Events))
+	}
+	if len(mine.Events) != 1 {
+		t.Fatalf("用户订阅期望收到 1 个事件, 实际 %d", len(mine.Events))
+	}
+	if event := <-mine.Events; event.Country != "China" {
+		t.Errorf("用户订阅收到了其他用户的事件: %+v", event)
+	}
+
+	mine.Close()
+	if hub.Subscribers() != 1 {
+		t.Errorf("取消订阅后期望 1 个订阅, 实际 %d", hub.Subscribers())
+	}
+}
+
+func TestLiveViewHubDropsWhenSubscriberIsSlow(t *testing.T) {
+	hub := NewLiveViewHub()
+	sub := hub.Subscribe(nil)
+	defer sub.Close()
+
+	for i := 0; i < liveViewBuffer+5; i++ {
+		hub.Publish(LiveViewEvent{UserID: uuid.New()})
+	}
+	if len(sub.Events) != liveViewBuffer {
+		t.Errorf("期望缓冲 %d 个事件, 实际 %d", liveViewBuffer, len(sub.Events))
+	}
+	if sub.Dropped() != 5 {
+		t.Errorf("期望丢弃 5 个事件, 实际 %d", sub.Dropped())
+	}
+}
+
+func TestLiveViewHubCounts(t *testing.T) {
+	now := time.Date(2024, 5, 6, 12, 30, 20, 0, time.Local)
+	hub := NewLiveViewHub()
+	hub.now = func() time.Time { return now }
+	owner := uuid.New()
+
+	hub.Publish(LiveViewEvent{UserID: owner, AccessTime: now})
+	hub.Publish(LiveViewEvent{UserID: owner, AccessTime: now.Add(-10 * time.Second)})
+	hub.Publish(LiveViewEvent{UserID: owner, AccessTime: now.Add(-5 * time.Minute)})
+	hub.Publish(LiveViewEvent{UserID: owner, AccessTime: now, IsBot: true})
+	hub.Publish(LiveViewEvent{UserID: uuid.New(), AccessTime: now})
+	// 超过一小时的访问不在统计窗口内
+	hub.Publish(LiveViewEvent{UserID: owner, AccessTime: now.Add(-2 * time.Hour)})
+
+	counts := hub.Counts(&owner)
+	if len(counts) != liveViewMinutes {
+		t.Fatalf("期望 %d 个分钟桶, 实际 %d", liveViewMinutes, len(counts))
+	}
+	last := counts[len(counts)-1]
+	if last.Minute != "2024-05-06T12:30" || last.Views != 2 {
+		t.Errorf("最后一分钟期望 12:30 有 2 次访问, 实际 %+v", last)
+	}
+	if got := counts[len(counts)-6]; got.Views != 1 {
+		t.Errorf("5 分钟前期望 1 次访问, 实际 %+v", got)
+	}
+
+	var total int64
+	for _, minute := range hub.Counts(nil) {
+		total += minute.Views
+	}
+	if total != 4 {
+		t.Errorf("全站最近一小时期望 4 次访问（不含爬虫）, 实际 %d", total)
+	}
+}
+
+func TestLiveViewHubClose(t *testing.T) {
+	hub := NewLiveViewHub()
+	select {
+	case <-hub.Done():
+		t.Fatal("关闭前 Done 不应结束")
+	default:
+	}
+
+	hub.Close()
+	hub.Close() // 重复关闭不应 panic
+	select {
+	case <-hub.Done():
+	default:
+		t.Error("关闭后 Done 应结束")
+	}
+}
@@ -0,0 +1,505 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"anywebsites/internal/auth"
+	"anywebsites/internal/database"
+	"anywebsites/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// 单点登录参数
+const (
+	oidcLoginTTL    = 10 * time.Minute // 跳转到身份提供方后完成登录的时限
+	oidcProviderTTL = time.Hour        // 元数据和 JWKS 的缓存时间，遇到未知 kid 时提前刷新
+	oidcHTTPTimeout = 10 * time.Second
+	oidcPlanReason  = "sso_groups" // 由用户组映射修改计划时记录的原因
+)
+
+// 单点登录完成后进入的位置
+const (
+	OIDCTargetAdmin = "admin" // 管理后台
+	OIDCTargetAPI   = "api"   // 返回 API Token
+)
+
+var (
+	// ErrSSODisabled 未启用单点登录或配置不完整
+	ErrSSODisabled = errors.New("single sign-on is not enabled")
+	// ErrInvalidSSOState 登录状态不存在、已使用或已过期
+	ErrInvalidSSOState = errors.New("invalid or expired single sign-on state")
+	// ErrSSOEmailNotVerified 身份提供方未验证邮箱，不能用来绑定或创建本地用户
+	ErrSSOEmailNotVerified = errors.New("email address is not verified by the identity provider")
+	// ErrSSONoAccount 没有对应的本地用户且未开启自动创建
+	ErrSSONoAccount = errors.New("no local account is linked to this identity")
+)
+
+// planRanks 计划从低到高的顺序，用户属于多个映射的用户组时取最高的计划
+var planRanks = map[models.PlanType]int{
+	models.PlanCommunity:  0,
+	models.PlanDeveloper:  1,
+	models.PlanPro:        2,
+	models.PlanMax:        3,
+	models.PlanEnterprise: 4,
+}
+
+// usernameInvalidChars 自动创建用户时从用户名中去掉的字符
+var usernameInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// OIDCConfig 从 sso 分类读取的单点登录配置
+type OIDCConfig struct {
+	Issuer        string
+	Client        auth.OIDCClient
+	GroupsClaim   string
+	AdminGroups   []string                   // 为空时不修改管理员状态
+	PlanGroups    map[string]models.PlanType // 为空时不修改计划
+	AutoProvision bool
+}
+
+// OIDCLogin 开始单点登录时返回的跳转地址和用于绑定浏览器的 state
+type OIDCLogin struct {
+	URL       string
+	State     string
+	ExpiresIn int
+}
+
+// OIDCService OpenID Connect 单点登录：授权码 + PKCE、即时创建用户和用户组映射
+type OIDCService struct {
+	settingsService *SettingsService
+	httpClient      *http.Client
+
+	mutex          sync.Mutex
+	provider       *auth.OIDCProvider
+	keys           auth.JWKSet
+	providerExpiry time.Time
+}
+
+// NewOIDCService 创建单点登录服务，settingsService 为空时不启用
+func NewOIDCService(settingsService *SettingsService) *OIDCService {
+	return &OIDCService{
+		settingsService: settingsService,
+		httpClient:      &http.Client{Timeout: oidcHTTPTimeout},
+	}
+}
+
+// Enabled 检查是否启用了单点登录
+func (s *OIDCService) Enabled() bool {
+	_, err := s.config()
+	return err == nil
+}
+
+// config 读取单点登录配置，未启用或缺少必填项时返回 ErrSSODisabled
+func (s *OIDCService) config() (*OIDCConfig, error) {
+	if s.settingsService == nil || !s.settingsService.GetBoolValue("sso", "oidc_enabled", false) {
+		return nil, ErrSSODisabled
+	}
+
+	cfg := &OIDCConfig{
+		Issuer: s.settingsService.GetStringValue("sso", "oidc_issuer", ""),
+		Client: auth.OIDCClient{
+			ClientID:     s.settingsService.GetStringValue("sso", "oidc_client_id", ""),
+			ClientSecret: s.settingsService.GetStringValue("sso", "oidc_client_secret", ""),
+			RedirectURL:  s.settingsService.GetStringValue("sso", "oidc_redirect_url", ""),
+			Scopes:       strings.Fields(s.settingsService.GetStringValue("sso", "oidc_scopes", "openid profile email groups")),
+		},
+		GroupsClaim:   s.settingsService.GetStringValue("sso", "oidc_groups_claim", "groups"),
+		AdminGroups:   splitGroups(s.settingsService.GetStringValue("sso", "oidc_admin_groups", "")),
+		AutoProvision: s.settingsService.GetBoolValue("sso", "oidc_auto_provision", true),
+	}
+	if cfg.Issuer == "" || cfg.Client.ClientID == "" || cfg.Client.RedirectURL == "" {
+		return nil, ErrSSODisabled
+	}
+	if !containsString(cfg.Client.Scopes, "openid") {
+		cfg.Client.Scopes = append([]string{"openid"}, cfg.Client.Scopes...)
+	}
+
+	var planGroups map[string]models.PlanType
+	if err := s.settingsService.GetJSONValue("sso", "oidc_plan_groups", &planGroups); err == nil {
+		cfg.PlanGroups = planGroups
+	}
+	return cfg, nil
+}
+
+// Begin 开始单点登录，返回身份提供方的授权地址，target 为 OIDCTargetAdmin 或 OIDCTargetAPI
+func (s *OIDCService) Begin(ctx context.Context, target string) (*OIDCLogin, error) {
+	cfg, err := s.config()
+	if err != nil {
+		return nil, err
+	}
+	provider, _, err := s.providerFor(ctx, cfg.Issuer, false)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := auth.RandomOIDCToken()
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := auth.RandomOIDCToken()
+	if err != nil {
+		return nil, err
+	}
+	verifier, challenge, err := auth.GeneratePKCE()
+	if err != nil {
+		return nil, err
+	}
+
+	// PKCE 和 nonce 保存在数据库中，回调可能由其他实例处理
+	now := time.Now()
+	if err := database.DB.Where("expires_at < ?", now).Delete(&models.OIDCPendingLogin{}).Error; err != nil {
+		log.Printf("Warning: failed to prune expired SSO logins: %v", err)
+	}
+	if err := database.DB.Create(&models.OIDCPendingLogin{
+		State:     state,
+		Issuer:    cfg.Issuer,
+		Verifier:  verifier,
+		Nonce:     nonce,
+		Target:    target,
+		ExpiresAt: now.Add(oidcLoginTTL),
+	}).Error; err != nil {
+		return nil, fmt.Errorf("failed to save SSO login: %w", err)
+	}
+
+	return &OIDCLogin{
+		URL:       provider.AuthCodeURL(cfg.Client, state, nonce, challenge),
+		State:     state,
+		ExpiresIn: int(oidcLoginTTL.Seconds()),
+	}, nil
+}
+
+// Complete 用回调中的授权码完成登录，返回本地用户和 Begin 时指定的 target
+// 调用方负责确认 state 与发起登录的浏览器一致
+func (s *OIDCService) Complete(ctx context.Context, state, code string) (*models.User, string, error) {
+	login, err := s.consume(state)
+	if err != nil {
+		return nil, "", err
+	}
+
+	cfg, err := s.config()
+	if err != nil {
+		return nil, login.Target, err
+	}
+	if cfg.Issuer != login.Issuer {
+		return nil, login.Target, ErrInvalidSSOState
+	}
+	provider, keys, err := s.providerFor(ctx, cfg.Issuer, false)
+	if err != nil {
+		return nil, login.Target, err
+	}
+
+	tokens, err := provider.Exchange(ctx, s.httpClient, cfg.Client, code, login.Verifier)
+	if err != nil {
+		return nil, login.Target, err
+	}
+	claims, err := auth.VerifyIDToken(tokens.IDToken, keys, cfg.Issuer, cfg.Client.ClientID, login.Nonce)
+	if errors.Is(err, auth.ErrOIDCUnknownKey) {
+		// 身份提供方可能已轮换签名密钥
+		if _, keys, err = s.providerFor(ctx, cfg.Issuer, true); err != nil {
+			return nil, login.Target, err
+		}
+		claims, err = auth.VerifyIDToken(tokens.IDToken, keys, cfg.Issuer, cfg.Client.ClientID, login.Nonce)
+	}
+	if err != nil {
+		return nil, login.Target, err
+	}
+
+	user, err := s.resolveUser(cfg, claims)
+	if err != nil {
+		return nil, login.Target, err
+	}
+	if err := s.syncGroups(cfg, user, claims.Groups(cfg.GroupsClaim)); err != nil {
+		return nil, login.Target, err
+	}
+	return user, login.Target, nil
+}
+
+// Discard 作废未完成的登录，用于身份提供方返回错误的回调
+func (s *OIDCService) Discard(state string) {
+	if err := database.DB.Where("state = ?", state).Delete(&models.OIDCPendingLogin{}).Error; err != nil {
+		log.Printf("Warning: failed to discard SSO login: %v", err)
+	}
+}
+
+// consume 取出并删除未完成的登录，只有删除成功的请求可以继续，同一个 state 并发回调时只有一个生效
+func (s *OIDCService) consume(state string) (*models.OIDCPendingLogin, error) {
+	var login models.OIDCPendingLogin
+	if err := database.DB.Where("state = ?", state).First(&login).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidSSOState
+		}
+		return nil, fmt.Errorf("failed to get SSO login: %w", err)
+	}
+
+	result := database.DB.Where("state = ?", state).Delete(&models.OIDCPendingLogin{})
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to consume SSO login: %w", result.Error)
+	}
+	if result.RowsAffected == 0 || time.Now().After(login.ExpiresAt) {
+		return nil, ErrInvalidSSOState
+	}
+	return &login, nil
+}
+
+// providerFor 返回缓存的身份提供方元数据和 JWKS，issuer 变化、缓存过期或 refresh 时重新读取
+func (s *OIDCService) providerFor(ctx context.Context, issuer string, refresh bool) (*auth.OIDCProvider, auth.JWKSet, error) {
+	s.mutex.Lock()
+	if !refresh && s.provider != nil && s.provider.Issuer == issuer && time.Now().Before(s.providerExpiry) {
+		provider, keys := s.provider, s.keys
+		s.mutex.Unlock()
+		return provider, keys, nil
+	}
+	s.mutex.Unlock()
+
+	provider, err := auth.DiscoverOIDC(ctx, s.httpClient, issuer)
+	if err != nil {
+		return nil, auth.JWKSet{}, err
+	}
+	keys, err := auth.FetchJWKS(ctx, s.httpClient, provider.JWKSURI)
+	if err != nil {
+		return nil, auth.JWKSet{}, err
+	}
+
+	s.mutex.Lock()
+	s.provider, s.keys, s.providerExpiry = provider, keys, time.Now().Add(oidcProviderTTL)
+	s.mutex.Unlock()
+	return provider, keys, nil
+}
+
+// resolveUser 按顺序查找本地用户：已绑定的外部身份、邮箱已验证的同邮箱用户、自动创建
+// 邮箱未验证时既不绑定也不创建，避免在身份提供方注册同名邮箱接管本地账户
+func (s *OIDCService) resolveUser(cfg *OIDCConfig, claims *auth.IDTokenClaims) (*models.User, error) {
+	now := time.Now()
+
+	var identity models.UserIdentity
+	err := database.DB.Where("issuer = ? AND subject = ?", claims.Issuer, claims.Subject).First(&identity).Error
+	if err == nil {
+		var user models.User
+		if err := database.DB.First(&user, "id = ?", identity.UserID).Error; err != nil {
+			return nil, fmt.Errorf("failed to get linked user: %w", err)
+		}
+		if !user.IsActive {
+			return nil, ErrUserInactive
+		}
+		if err := database.DB.Model(&identity).Updates(map[string]interface{}{
+			"email":         claims.Email,
+			"last_login_at": now,
+		}).Error; err != nil {
+			return nil, fmt.Errorf("failed to update identity: %w", err)
+		}
+		return &user, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to get identity: %w", err)
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return nil, ErrSSOEmailNotVerified
+	}
+
+	var user models.User
+	err = database.DB.Where("LOWER(email) = LOWER(?)", claims.Email).First(&user).Error
+	switch {
+	case err == nil:
+		if !user.IsActive {
+			return nil, ErrUserInactive
+		}
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		if !cfg.AutoProvision {
+			return nil, ErrSSONoAccount
+		}
+		username, err := s.availableUsername(claims)
+		if err != nil {
+			return nil, err
+		}
+		// 密码不是合法的 bcrypt 哈希，自动创建的用户只能通过单点登录
+		user = models.User{Username: username, Email: claims.Email, Password: "!", IsActive: true}
+	default:
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if user.ID == uuid.Nil {
+			if err := tx.Create(&user).Error; err != nil {
+				return fmt.Errorf("failed to create user: %w", err)
+			}
+		}
+		identity = models.UserIdentity{
+			UserID:      user.ID,
+			Issuer:      claims.Issuer,
+			Subject:     claims.Subject,
+			Email:       claims.Email,
+			LastLoginAt: &now,
+		}
+		if err := tx.Create(&identity).Error; err != nil {
+			return fmt.Errorf("failed to link identity: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// availableUsername 根据 preferred_username 或邮箱前缀生成未被占用的用户名
+func (s *OIDCService) availableUsername(claims *auth.IDTokenClaims) (string, error) {
+	base := claims.PreferredUsername
+	if at := strings.Index(base, "@"); at >= 0 {
+		base = base[:at]
+	}
+	if base == "" {
+		base = strings.SplitN(claims.Email, "@", 2)[0]
+	}
+	base = usernameInvalidChars.ReplaceAllString(base, "")
+	if len(base) < 3 {
+		base = "user" + base
+	}
+	if len(base) > 40 {
+		base = base[:40]
+	}
+
+	candidate := base
+	for attempt := 0; attempt < 5; attempt++ {
+		var count int64
+		if err := database.DB.Model(&models.User{}).Where("username = ?", candidate).Count(&count).Error; err != nil {
+			return "", fmt.Errorf("failed to check username: %w", err)
+		}
+		if count == 0 && !models.IsReservedUsername(candidate) {
+			return candidate, nil
+		}
+		suffix := make([]byte, 3)
+		if _, err := rand.Read(suffix); err != nil {
+			return "", err
+		}
+		candidate = base + "-" + hex.EncodeToString(suffix)
+	}
+	return "", errors.New("failed to find an available username")
+}
+
+// syncGroups 按用户组更新管理员状态和计划，对应的映射未配置时保持不变
+func (s *OIDCService) syncGroups(cfg *OIDCConfig, user *models.User, groups []string) error {
+	if len(cfg.AdminGroups) > 0 {
+		isAdmin := false
+		for _, group := range cfg.AdminGroups {
+			if containsString(groups, group) {
+				isAdmin = true
+				break
+			}
+		}
+		if user.IsAdmin != isAdmin {
+			if err := database.DB.Model(user).Update("is_admin", isAdmin).Error; err != nil {
+				return fmt.Errorf("failed to update admin status: %w", err)
+			}
+			user.IsAdmin = isAdmin
+		}
+	}
+
+	// 不属于任何映射的用户组时不降级，计划仍可由管理员手动调整
+	var planType models.PlanType
+	for _, group := range groups {
+		mapped, ok := cfg.PlanGroups[group]
+		if !ok {
+			continue
+		}
+		if _, known := planRanks[mapped]; !known {
+			continue
+		}
+		if planType == "" || planRanks[mapped] > planRanks[planType] {
+			planType = mapped
+		}
+	}
+	if planType == "" {
+		return nil
+	}
+	return s.syncPlan(user.ID, planType)
+}
+
+// syncPlan 将用户的有效订阅设置为指定计划并记录历史，没有订阅时直接创建
+func (s *OIDCService) syncPlan(userID uuid.UUID, planType models.PlanType) error {
+	var subscription models.UserSubscription
+	err := database.DB.Where("user_id = ? AND status = ?", userID, models.StatusActive).First(&subscription).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("failed to get user plan: %w", err)
+	}
+	exists := err == nil
+	if exists && subscription.PlanType == planType {
+		return nil
+	}
+
+	fromPlan := models.PlanCommunity
+	if exists {
+		fromPlan = subscription.PlanType
+	}
+	now := time.Now()
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if exists {
+			if err := tx.Model(&subscription).Updates(map[string]interface{}{
+				"plan_type":  planType,
+				"expires_at": nil,
+			}).Error; err != nil {
+				return fmt.Errorf("failed to update subscription: %w", err)
+			}
+		} else {
+			subscription = models.UserSubscription{
+				UserID:    userID,
+				PlanType:  planType,
+				Status:    models.StatusActive,
+				StartedAt: now,
+			}
+			if err := tx.Create(&subscription).Error; err != nil {
+				return fmt.Errorf("failed to create subscription: %w", err)
+			}
+		}
+		return tx.Create(&models.PlanUpgradeHistory{
+			UserID:       userID,
+			FromPlan:     fromPlan,
+			ToPlan:       planType,
+			ChangeReason: oidcPlanReason,
+			EffectiveAt:  now,
+			Status:       models.StatusActive,
+		}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	// 更新文章过期时间，失败时只记录日志，与手动变更计划一致
+	if err := NewPlanService().UpdateArticleExpirations(userID, planType); err != nil {
+		log.Printf("Warning: failed to update article expirations after SSO plan change: %v", err)
+	}
+	return nil
+}
+
+// splitGroups 解析逗号分隔的用户组列表
+func splitGroups(value string) []string {
+	var groups []string
+	for _, group := range strings.Split(value, ",") {
+		if group = strings.TrimSpace(group); group != "" {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
+
+// containsString 检查切片中是否包含指定字符串
+func containsString(values []string, target string) bool {
+	for _, value := range values {
+		if value == target {
+			return true
+		}
+	}
+	return false
+}
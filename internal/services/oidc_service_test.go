@@ -0,0 +1,368 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"anywebsites/internal/auth"
+	"anywebsites/internal/database"
+	"anywebsites/internal/models"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	mockClientID    = "anywebsites"
+	mockRedirectURL = "https://anywebsites.example.com/auth/oidc/callback"
+)
+
+// mockAuthorization 模拟用户在身份提供方登录后与授权码绑定的信息
+type mockAuthorization struct {
+	challenge string
+	nonce     string
+	claims    jwt.MapClaims
+}
+
+// mockIdP 本地模拟的身份提供方：发现文档、JWKS 和校验 PKCE 的令牌端点
+type mockIdP struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mutex sync.Mutex
+	codes map[string]mockAuthorization
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &mockIdP{key: key, codes: make(map[string]mockAuthorization)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(auth.JWKSet{Keys: []auth.JWK{{
+			KeyType:   "RSA",
+			KeyID:     "mock-key",
+			Use:       "sig",
+			Algorithm: "RS256",
+			N:         base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", idp.token)
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+// authorize 模拟用户在授权页面登录，返回回调中的 state 和授权码
+func (idp *mockIdP) authorize(t *testing.T, authURL string, claims jwt.MapClaims) (string, string) {
+	t.Helper()
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+	if query.Get("client_id") != mockClientID || query.Get("redirect_uri") != mockRedirectURL || query.Get("code_challenge_method") != "S256" {
+		t.Fatalf("授权请求参数不正确: %s", parsed.RawQuery)
+	}
+
+	code, _ := auth.RandomOIDCToken()
+	idp.mutex.Lock()
+	idp.codes[code] = mockAuthorization{challenge: query.Get("code_challenge"), nonce: query.Get("nonce"), claims: claims}
+	idp.mutex.Unlock()
+	return query.Get("state"), code
+}
+
+// token 令牌端点：授权码只能使用一次，code_verifier 必须与授权时的 code_challenge 匹配
+func (idp *mockIdP) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	idp.mutex.Lock()
+	authorization, ok := idp.codes[r.PostForm.Get("code")]
+	delete(idp.codes, r.PostForm.Get("code"))
+	idp.mutex.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || r.PostForm.Get("client_id") != mockClientID || r.PostForm.Get("redirect_uri") != mockRedirectURL ||
+		base64.RawURLEncoding.EncodeToString(sum[:]) != authorization.challenge {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":   idp.server.URL,
+		"aud":   mockClientID,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+		"nonce": authorization.nonce,
+	}
+	for key, value := range authorization.claims {
+		claims[key] = value
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "mock-key"
+	idToken, err := token.SignedString(idp.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "mock-access-token",
+		"token_type":   "Bearer",
+		"id_token":     idToken,
+		"expires_in":   3600,
+	})
+}
+
+// login 走完整的授权码流程
+func (idp *mockIdP) login(t *testing.T, service *OIDCService, claims jwt.MapClaims) (*models.User, error) {
+	t.Helper()
+	begin, err := service.Begin(context.Background(), OIDCTargetAdmin)
+	if err != nil {
+		t.Fatalf("开始登录失败: %v", err)
+	}
+	state, code := idp.authorize(t, begin.URL, claims)
+	if state != begin.State {
+		t.Fatalf("state 不一致: %s != %s", state, begin.State)
+	}
+	user, _, err := service.Complete(context.Background(), state, code)
+	return user, err
+}
+
+// setupOIDCTestDB 创建用户、身份绑定和订阅相关的表
+func setupOIDCTestDB(t *testing.T) {
+	db := useTestDB(t, &models.User{}, &models.UserIdentity{}, &models.OIDCPendingLogin{})
+	// 订阅表的默认值使用了 PostgreSQL 函数，这里手动建表
+	for _, statement := range []string{
+		userSubscriptionsTable,
+		`CREATE TABLE plan_upgrade_histories (id TEXT PRIMARY KEY, user_id TEXT NOT NULL, from_plan TEXT, to_plan TEXT NOT NULL,
+			change_reason TEXT, effective_at DATETIME NOT NULL, status TEXT NOT NULL, created_at DATETIME)`,
+	} {
+		if err := db.Exec(statement).Error; err != nil {
+			t.Fatalf("创建表失败: %v", err)
+		}
+	}
+}
+
+// ssoSettings 返回已缓存 sso 分类设置的设置服务
+func ssoSettings(issuer string, overrides map[string]string) *SettingsService {
+	values := map[string]string{
+		"oidc_enabled":        "true",
+		"oidc_issuer":         issuer,
+		"oidc_client_id":      mockClientID,
+		"oidc_client_secret":  "",
+		"oidc_redirect_url":   mockRedirectURL,
+		"oidc_scopes":         "openid profile email groups",
+		"oidc_groups_claim":   "groups",
+		"oidc_admin_groups":   "admins",
+		"oidc_plan_groups":    `{"staff": "developer", "paying": "enterprise"}`,
+		"oidc_auto_provision": "true",
+	}
+	for key, value := range overrides {
+		values[key] = value
+	}
+
+	cache := make(map[string]*models.SystemSetting, len(values))
+	for key, value := range values {
+		cache["sso."+key] = &models.SystemSetting{Category: "sso", Key: key, Value: value}
+	}
+	return &SettingsService{cache: cache, cacheExpiry: time.Hour, lastUpdate: time.Now()}
+}
+
+// activePlan 获取用户的有效订阅计划
+func activePlan(t *testing.T, user *models.User) models.PlanType {
+	t.Helper()
+	var subscription models.UserSubscription
+	if err := database.DB.Where("user_id = ? AND status = ?", user.ID, models.StatusActive).First(&subscription).Error; err != nil {
+		t.Fatalf("获取订阅失败: %v", err)
+	}
+	return subscription.PlanType
+}
+
+func TestOIDCProvisioning(t *testing.T) {
+	setupOIDCTestDB(t)
+	idp := newMockIdP(t)
+	service := NewOIDCService(ssoSettings(idp.server.URL, nil))
+
+	user, err := idp.login(t, service, jwt.MapClaims{
+		"sub":                "carol-1",
+		"email":              "carol@example.com",
+		"email_verified":     true,
+		"preferred_username": "carol",
+		"groups":             []string{"staff", "admins", "paying"},
+	})
+	if err != nil {
+		t.Fatalf("首次登录应自动创建用户: %v", err)
+	}
+	if user.Username != "carol" || !user.IsAdmin || auth.CheckPassword("", user.Password) {
+		t.Errorf("自动创建的用户不正确: %+v", user)
+	}
+	if plan := activePlan(t, user); plan != models.PlanEnterprise {
+		t.Errorf("属于多个用户组时应取最高的计划, 实际 %s", plan)
+	}
+
+	// 离开管理员用户组后取消管理员，没有匹配计划的用户组时不降级
+	again, err := idp.login(t, service, jwt.MapClaims{
+		"sub":            "carol-1",
+		"email":          "carol@corp.example.com",
+		"email_verified": true,
+		"groups":         []string{"contractors"},
+	})
+	if err != nil {
+		t.Fatalf("再次登录失败: %v", err)
+	}
+	if again.ID != user.ID || again.IsAdmin {
+		t.Errorf("应按 issuer + sub 找到同一用户并取消管理员, 实际 %+v", again)
+	}
+	if plan := activePlan(t, again); plan != models.PlanEnterprise {
+		t.Errorf("没有匹配的用户组时不应修改计划, 实际 %s", plan)
+	}
+
+	// 用户名已被占用时追加后缀
+	other, err := idp.login(t, service, jwt.MapClaims{
+		"sub":                "carol-2",
+		"email":              "carol.two@example.com",
+		"email_verified":     true,
+		"preferred_username": "carol",
+		"groups":             []string{"staff"},
+	})
+	if err != nil {
+		t.Fatalf("创建第二个用户失败: %v", err)
+	}
+	if other.ID == user.ID || other.Username == "carol" || other.IsAdmin {
+		t.Errorf("第二个用户不正确: %+v", other)
+	}
+	if plan := activePlan(t, other); plan != models.PlanDeveloper {
+		t.Errorf("计划应为 developer, 实际 %s", plan)
+	}
+}
+
+func TestOIDCLinkByVerifiedEmail(t *testing.T) {
+	setupOIDCTestDB(t)
+	idp := newMockIdP(t)
+	service := NewOIDCService(ssoSettings(idp.server.URL, map[string]string{"oidc_admin_groups": ""}))
+
+	password, _ := auth.HashPassword("password")
+	existing := &models.User{Username: "dave", Email: "Dave@Example.com", Password: password, IsActive: true, IsAdmin: true}
+	if err := database.DB.Create(existing).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// 未验证的邮箱不能绑定已有用户
+	if _, err := idp.login(t, service, jwt.MapClaims{"sub": "dave-1", "email": "dave@example.com", "email_verified": false}); !errors.Is(err, ErrSSOEmailNotVerified) {
+		t.Fatalf("期望 ErrSSOEmailNotVerified, 实际 %v", err)
+	}
+
+	user, err := idp.login(t, service, jwt.MapClaims{"sub": "dave-1", "email": "dave@example.com", "email_verified": true})
+	if err != nil {
+		t.Fatalf("已验证的邮箱应绑定已有用户: %v", err)
+	}
+	if user.ID != existing.ID || !user.IsAdmin {
+		t.Errorf("应绑定到已有用户且未配置管理员用户组时保持管理员状态, 实际 %+v", user)
+	}
+	var identities int64
+	database.DB.Model(&models.UserIdentity{}).Where("user_id = ?", existing.ID).Count(&identities)
+	if identities != 1 {
+		t.Errorf("应创建一条外部身份绑定, 实际 %d", identities)
+	}
+
+	// 禁用的用户不能通过单点登录
+	database.DB.Model(existing).Update("is_active", false)
+	if _, err := idp.login(t, service, jwt.MapClaims{"sub": "dave-1"}); !errors.Is(err, ErrUserInactive) {
+		t.Errorf("期望 ErrUserInactive, 实际 %v", err)
+	}
+}
+
+func TestOIDCRejectsInvalidLogins(t *testing.T) {
+	setupOIDCTestDB(t)
+	idp := newMockIdP(t)
+	service := NewOIDCService(ssoSettings(idp.server.URL, map[string]string{"oidc_auto_provision": "false"}))
+
+	if _, _, err := service.Complete(context.Background(), "unknown", "code"); !errors.Is(err, ErrInvalidSSOState) {
+		t.Errorf("未知 state 应返回 ErrInvalidSSOState, 实际 %v", err)
+	}
+
+	// state 只能使用一次
+	begin, err := service.Begin(context.Background(), OIDCTargetAPI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, code := idp.authorize(t, begin.URL, jwt.MapClaims{"sub": "erin-1", "email": "erin@example.com", "email_verified": true})
+	if _, target, err := service.Complete(context.Background(), state, code); !errors.Is(err, ErrSSONoAccount) || target != OIDCTargetAPI {
+		t.Errorf("关闭自动创建时应返回 ErrSSONoAccount, 实际 %v %s", err, target)
+	}
+	if _, _, err := service.Complete(context.Background(), state, code); !errors.Is(err, ErrInvalidSSOState) {
+		t.Errorf("重复使用 state 应返回 ErrInvalidSSOState, 实际 %v", err)
+	}
+
+	// 身份提供方返回的 nonce 与本次登录不一致
+	if _, err := idp.login(t, service, jwt.MapClaims{"sub": "erin-1", "nonce": "replayed"}); !errors.Is(err, auth.ErrOIDCNonce) {
+		t.Errorf("期望 ErrOIDCNonce, 实际 %v", err)
+	}
+
+	disabled := NewOIDCService(ssoSettings(idp.server.URL, map[string]string{"oidc_enabled": "false"}))
+	if disabled.Enabled() {
+		t.Error("关闭后不应显示单点登录")
+	}
+	if _, err := disabled.Begin(context.Background(), OIDCTargetAdmin); !errors.Is(err, ErrSSODisabled) {
+		t.Errorf("期望 ErrSSODisabled, 实际 %v", err)
+	}
+}
+
+func TestOIDCCallbackOnAnotherInstance(t *testing.T) {
+	setupOIDCTestDB(t)
+	idp := newMockIdP(t)
+	settings := ssoSettings(idp.server.URL, nil)
+	first, second := NewOIDCService(settings), NewOIDCService(settings)
+
+	// 由一个实例发起，另一个实例处理回调
+	begin, err := first.Begin(context.Background(), OIDCTargetAPI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, code := idp.authorize(t, begin.URL, jwt.MapClaims{"sub": "frank-1", "email": "frank@example.com", "email_verified": true})
+	user, target, err := second.Complete(context.Background(), state, code)
+	if err != nil || target != OIDCTargetAPI || user.Email != "frank@example.com" {
+		t.Fatalf("其他实例应能完成登录: %v %s %+v", err, target, user)
+	}
+	if _, _, err := first.Complete(context.Background(), state, code); !errors.Is(err, ErrInvalidSSOState) {
+		t.Errorf("已在其他实例使用的 state 应返回 ErrInvalidSSOState, 实际 %v", err)
+	}
+
+	// 过期的登录不能完成
+	begin, err = first.Begin(context.Background(), OIDCTargetAdmin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	database.DB.Model(&models.OIDCPendingLogin{}).Where("state = ?", begin.State).Update("expires_at", time.Now().Add(-time.Minute))
+	state, code = idp.authorize(t, begin.URL, jwt.MapClaims{"sub": "frank-1"})
+	if _, _, err := second.Complete(context.Background(), state, code); !errors.Is(err, ErrInvalidSSOState) {
+		t.Errorf("过期的 state 应返回 ErrInvalidSSOState, 实际 %v", err)
+	}
+}
@@ -0,0 +1,398 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"anywebsites/internal/database"
+	"anywebsites/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// hourlyAnalyticsMaxDays 按小时统计时最多查询的天数
+const hourlyAnalyticsMaxDays = 7
+
+var (
+	// ErrInvalidAnalyticsRange 时间范围参数无效
+	ErrInvalidAnalyticsRange = errors.New("invalid time range, use range=<days>d or from/to dates (YYYY-MM-DD)")
+	// ErrAnalyticsRangeExceedsPlan 时间范围超出计划可查询的天数
+	ErrAnalyticsRangeExceedsPlan = errors.New("time range exceeds the analytics lookback of your plan")
+	// ErrAnalyticsGranularityNotAllowed 当前计划不支持该粒度
+	ErrAnalyticsGranularityNotAllowed = errors.New("granularity is not available on your plan")
+	// ErrHourlyRangeTooLong 按小时统计的时间范围过长
+	ErrHourlyRangeTooLong = fmt.Errorf("hourly granularity is limited to %d days", hourlyAnalyticsMaxDays)
+	// ErrAnalyticsContentNotFound 内容不存在或不属于该用户
+	ErrAnalyticsContentNotFound = errors.New("content not found")
+	// ErrRealtimeAnalyticsNotAllowed 当前计划不支持实时访问推送
+	ErrRealtimeAnalyticsNotAllowed = errors.New("real-time analytics is not available on your plan")
+)
+
+// AnalyticsRangeParams 统计接口的时间范围参数，From/To 优先于 Range
+type AnalyticsRangeParams struct {
+	Range       string // 最近 N 天，格式如 7d
+	From        string // 起始日期 YYYY-MM-DD
+	To          string // 结束日期 YYYY-MM-DD，默认今天
+	Granularity string // day 或 hour，默认 day
+}
+
+// AnalyticsQuery 解析并按计划校验后的查询范围，From 和 To 为本地时区零点且都包含在内
+type AnalyticsQuery struct {
+	From        time.Time
+	To          time.Time
+	Granularity models.AnalyticsGranularity
+}
+
+// OwnerAnalyticsService 用户查看自己内容的访问统计，数据来自按天汇总的表
+type OwnerAnalyticsService struct {
+	planService     *PlanService
+	settingsService *SettingsService
+}
+
+// NewOwnerAnalyticsService 创建用户访问统计服务
+func NewOwnerAnalyticsService(settingsService *SettingsService) *OwnerAnalyticsService {
+	return &OwnerAnalyticsService{
+		planService:     NewPlanService(),
+		settingsService: settingsService,
+	}
+}
+
+// ResolveQuery 解析时间范围参数并按用户计划检查可查询的天数和粒度
+func (s *OwnerAnalyticsService) ResolveQuery(userID uuid.UUID, params AnalyticsRangeParams) (*AnalyticsQuery, error) {
+	planConfig, err := s.userPlanConfig(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return resolveAnalyticsQuery(params, planConfig, time.Now())
+}
+
+// CheckRealtime 检查用户的计划是否可以订阅实时访问推送
+func (s *OwnerAnalyticsService) CheckRealtime(userID uuid.UUID) error {
+	planConfig, err := s.userPlanConfig(userID)
+	if err != nil {
+		return err
+	}
+	if !planConfig.RealtimeAnalytics {
+		return ErrRealtimeAnalyticsNotAllowed
+	}
+	return nil
+}
+
+// userPlanConfig 获取用户当前订阅的计划配置
+func (s *OwnerAnalyticsService) userPlanConfig(userID uuid.UUID) (*models.PlanConfig, error) {
+	subscription, err := s.planService.GetUserPlan(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user plan: %w", err)
+	}
+	return s.planService.GetPlanConfig(subscription.PlanType)
+}
+
+// Overview 用户所有内容的访问统计，包含访问量最高的页面
+func (s *OwnerAnalyticsService) Overview(userID uuid.UUID, query *AnalyticsQuery) (*models.OwnerAnalyticsReport, error) {
+	report, err := s.buildReport(userID, nil, query)
+	if err != nil {
+		return nil, err
+	}
+
+	err = database.DB.Table("analytics_daily ad").
+		Select("ad.content_id, c.title, SUM(ad.views) as views").
+		Joins("JOIN contents c ON c.id = ad.content_id").
+		Where("ad.user_id = ? AND ad.day BETWEEN ? AND ?", userID, query.fromDate(), query.toDate()).
+		Group("ad.content_id, c.title").
+		Order("views DESC").
+		Limit(10).
+		Scan(&report.TopPages).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get top pages: %w", err)
+	}
+
+	return report, nil
+}
+
+// ContentReport 单个内容的访问统计，内容必须属于该用户
+func (s *OwnerAnalyticsService) ContentReport(userID, contentID uuid.UUID, query *AnalyticsQuery) (*models.OwnerAnalyticsReport, error) {
+	var count int64
+	if err := database.DB.Model(&models.Content{}).Where("id = ? AND user_id = ? AND is_active = ?", contentID, userID, true).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, ErrAnalyticsContentNotFound
+	}
+
+	return s.buildReport(userID, &contentID, query)
+}
+
+// buildReport 统计流量趋势、国家、来源、推广活动和终端，contentID 为空时统计用户的全部内容
+func (s *OwnerAnalyticsService) buildReport(userID uuid.UUID, contentID *uuid.UUID, query *AnalyticsQuery) (*models.OwnerAnalyticsReport, error) {
+	report := &models.OwnerAnalyticsReport{
+		From:        query.fromDate(),
+		To:          query.toDate(),
+		Granularity: query.Granularity,
+	}
+
+	counts, err := s.trafficCounts(userID, contentID, query)
+	if err != nil {
+		return nil, err
+	}
+	report.Traffic = fillTrafficBuckets(query, counts)
+	for _, bucket := range report.Traffic {
+		report.TotalViews += bucket.Views
+	}
+
+	// 跨天和跨内容的独立访客数不能直接相加，合并每天的草图估算
+	var sketches [][]byte
+	daily := database.DB.Model(&models.AnalyticsDaily{}).
+		Where("user_id = ? AND day BETWEEN ? AND ? AND visitor_sketch IS NOT NULL", userID, query.fromDate(), query.toDate())
+	if contentID != nil {
+		daily = daily.Where("content_id = ?", *contentID)
+	}
+	if err := daily.Pluck("visitor_sketch", &sketches).Error; err != nil {
+		return nil, fmt.Errorf("failed to get visitor sketches: %w", err)
+	}
+	report.UniqueVisitors = EstimateUniqueVisitors(sketches)
+
+	breakdown := database.DB.Model(&models.AnalyticsDailyBreakdown{}).
+		Where("user_id = ? AND day BETWEEN ? AND ?", userID, query.fromDate(), query.toDate())
+	if contentID != nil {
+		breakdown = breakdown.Where("content_id = ?", *contentID)
+	}
+
+	err = breakdown.Session(&gorm.Session{}).
+		Select("country, SUM(views) as count").
+		Where("country != ''").
+		Group("country").
+		Order("count DESC").
+		Limit(10).
+		Find(&report.Countries).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get country stats: %w", err)
+	}
+
+	err = breakdown.Session(&gorm.Session{}).
+		Select("referer_host as referer, SUM(views) as count").
+		Where("referer_host != ''").
+		Group("referer_host").
+		Order("count DESC").
+		Limit(10).
+		Find(&report.Referers).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get referer stats: %w", err)
+	}
+
+	err = breakdown.Session(&gorm.Session{}).
+		Select("referer_category, SUM(views) as count").
+		Group("referer_category").
+		Order("count DESC").
+		Find(&report.RefererCategories).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get referer category stats: %w", err)
+	}
+
+	campaigns := database.DB.Model(&models.AnalyticsDailyCampaign{}).
+		Where("user_id = ? AND day BETWEEN ? AND ?", userID, query.fromDate(), query.toDate())
+	if contentID != nil {
+		campaigns = campaigns.Where("content_id = ?", *contentID)
+	}
+	err = campaigns.
+		Select("utm_source, utm_medium, utm_campaign, SUM(views) as count").
+		Group("utm_source, utm_medium, utm_campaign").
+		Order("count DESC").
+		Limit(10).
+		Find(&report.Campaigns).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get campaign stats: %w", err)
+	}
+
+	err = breakdown.Session(&gorm.Session{}).
+		Select("device_class, SUM(views) as count").
+		Group("device_class").
+		Order("count DESC").
+		Find(&report.Devices).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get device stats: %w", err)
+	}
+
+	err = breakdown.Session(&gorm.Session{}).
+		Select("browser, SUM(views) as count").
+		Where("browser != ''").
+		Group("browser").
+		Order("count DESC").
+		Limit(10).
+		Find(&report.Browsers).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get browser stats: %w", err)
+	}
+
+	err = breakdown.Session(&gorm.Session{}).
+		Select("os, SUM(views) as count").
+		Where("os != ''").
+		Group("os").
+		Order("count DESC").
+		Limit(10).
+		Find(&report.OSes).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to get operating system stats: %w", err)
+	}
+
+	return report, nil
+}
+
+// trafficCounts 按时间桶统计访问量，返回以 analyticsBucketKey 为键的结果
+// 按天的数据来自汇总表，多个内容的独立 IP 为各内容独立 IP 之和；按小时的数据来自原始访问记录，与汇总表一样按设置排除爬虫
+func (s *OwnerAnalyticsService) trafficCounts(userID uuid.UUID, contentID *uuid.UUID, query *AnalyticsQuery) (map[string]models.TrafficStats, error) {
+	var rows []struct {
+		Bucket    time.Time
+		Views     int64
+		UniqueIPs int64 `gorm:"column:unique_ips"`
+	}
+
+	var err error
+	if query.Granularity == models.AnalyticsGranularityHour {
+		db := database.DB.Table("content_analytics ca").
+			Select("date_trunc('hour', ca.access_time) as bucket, COUNT(*) as views, COUNT(DISTINCT "+visitorKeySQL+") as unique_ips").
+			Joins("JOIN contents c ON c.id = ca.content_id").
+			Where("c.user_id = ? AND ca.access_time >= ?::date AND ca.access_time < ?::date + 1", userID, query.fromDate(), query.toDate())
+		if contentID != nil {
+			db = db.Where("ca.content_id = ?", *contentID)
+		}
+		if s.settingsService.GetBoolValue("analytics", "exclude_bots", true) {
+			db = db.Where("ca.is_bot = ?", false)
+		}
+		err = db.Group("bucket").Scan(&rows).Error
+	} else {
+		db := database.DB.Model(&models.AnalyticsDaily{}).
+			Select("day as bucket, SUM(views) as views, SUM(unique_ips) as unique_ips").
+			Where("user_id = ? AND day BETWEEN ? AND ?", userID, query.fromDate(), query.toDate())
+		if contentID != nil {
+			db = db.Where("content_id = ?", *contentID)
+		}
+		err = db.Group("day").Scan(&rows).Error
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get traffic stats: %w", err)
+	}
+
+	counts := make(map[string]models.TrafficStats, len(rows))
+	for _, row := range rows {
+		key := analyticsBucketKey(row.Bucket, query.Granularity)
+		counts[key] = models.TrafficStats{Date: key, Views: row.Views, UniqueIPs: row.UniqueIPs}
+	}
+	return counts, nil
+}
+
+func (q *AnalyticsQuery) fromDate() string {
+	return q.From.Format("2006-01-02")
+}
+
+func (q *AnalyticsQuery) toDate() string {
+	return q.To.Format("2006-01-02")
+}
+
+// days 查询范围包含的天数
+func (q *AnalyticsQuery) days() int {
+	return int(analyticsWallClock(q.To).Sub(analyticsWallClock(q.From)).Hours()/24) + 1
+}
+
+// resolveAnalyticsQuery 解析时间范围参数，结束日期晚于今天时按今天处理
+func resolveAnalyticsQuery(params AnalyticsRangeParams, planConfig *models.PlanConfig, now time.Time) (*AnalyticsQuery, error) {
+	today := truncateDay(now)
+	query := &AnalyticsQuery{To: today, Granularity: models.AnalyticsGranularityDay}
+
+	switch models.AnalyticsGranularity(params.Granularity) {
+	case "", models.AnalyticsGranularityDay:
+	case models.AnalyticsGranularityHour:
+		if planConfig.AnalyticsGranularity != models.AnalyticsGranularityHour {
+			return nil, ErrAnalyticsGranularityNotAllowed
+		}
+		query.Granularity = models.AnalyticsGranularityHour
+	default:
+		return nil, ErrInvalidAnalyticsRange
+	}
+
+	if params.From != "" || params.To != "" {
+		if params.From == "" {
+			return nil, ErrInvalidAnalyticsRange
+		}
+		from, err := time.ParseInLocation("2006-01-02", params.From, time.Local)
+		if err != nil {
+			return nil, ErrInvalidAnalyticsRange
+		}
+		if params.To != "" {
+			to, err := time.ParseInLocation("2006-01-02", params.To, time.Local)
+			if err != nil {
+				return nil, ErrInvalidAnalyticsRange
+			}
+			if to.Before(today) {
+				query.To = to
+			}
+		}
+		if from.After(query.To) {
+			return nil, ErrInvalidAnalyticsRange
+		}
+		query.From = from
+	} else {
+		rangeParam := params.Range
+		if rangeParam == "" {
+			rangeParam = "7d"
+			if query.Granularity == models.AnalyticsGranularityHour {
+				rangeParam = "1d"
+			}
+		}
+		days, err := strconv.Atoi(strings.TrimSuffix(rangeParam, "d"))
+		if err != nil || !strings.HasSuffix(rangeParam, "d") || days < 1 {
+			return nil, ErrInvalidAnalyticsRange
+		}
+		query.From = today.AddDate(0, 0, -(days - 1))
+	}
+
+	if planConfig.AnalyticsLookbackDays >= 0 {
+		earliest := today.AddDate(0, 0, -(planConfig.AnalyticsLookbackDays - 1))
+		if query.From.Before(earliest) {
+			return nil, ErrAnalyticsRangeExceedsPlan
+		}
+	}
+	if query.Granularity == models.AnalyticsGranularityHour && query.days() > hourlyAnalyticsMaxDays {
+		return nil, ErrHourlyRangeTooLong
+	}
+
+	return query, nil
+}
+
+// fillTrafficBuckets 生成查询范围内的所有时间桶，没有访问的时间桶补零
+func fillTrafficBuckets(query *AnalyticsQuery, counts map[string]models.TrafficStats) []models.TrafficStats {
+	step := 24 * time.Hour
+	if query.Granularity == models.AnalyticsGranularityHour {
+		step = time.Hour
+	}
+
+	end := analyticsWallClock(query.To).Add(24 * time.Hour)
+	stats := make([]models.TrafficStats, 0, int(end.Sub(analyticsWallClock(query.From))/step))
+	for bucket := analyticsWallClock(query.From); bucket.Before(end); bucket = bucket.Add(step) {
+		key := analyticsBucketKey(bucket, query.Granularity)
+		stat, ok := counts[key]
+		if !ok {
+			stat = models.TrafficStats{Date: key}
+		}
+		stats = append(stats, stat)
+	}
+	return stats
+}
+
+// analyticsBucketKey 时间桶的显示格式，按天为 2006-01-02，按小时为 2006-01-02 15:00
+func analyticsBucketKey(t time.Time, granularity models.AnalyticsGranularity) string {
+	if granularity == models.AnalyticsGranularityHour {
+		return t.Format("2006-01-02 15:00")
+	}
+	return t.Format("2006-01-02")
+}
+
+// analyticsWallClock 以 UTC 表示同样的年月日时分，按固定步长生成时间桶时不受夏令时影响
+// 数据库中不带时区的时间读出后同样是 UTC，两边的格式化结果一致
+func analyticsWallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC)
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"anywebsites/internal/models"
+)
+
+func TestResolveAnalyticsQuery(t *testing.T) {
+	now := time.Date(2024, 6, 30, 15, 0, 0, 0, time.Local)
+	dayPlan := &models.PlanConfig{AnalyticsLookbackDays: 7, AnalyticsGranularity: models.AnalyticsGranularityDay}
+	hourPlan := &models.PlanConfig{AnalyticsLookbackDays: 30, AnalyticsGranularity: models.AnalyticsGranularityHour}
+	unlimitedPlan := &models.PlanConfig{AnalyticsLookbackDays: -1, AnalyticsGranularity: models.AnalyticsGranularityHour}
+
+	tests := []struct {
+		name        string
+		params      AnalyticsRangeParams
+		plan        *models.PlanConfig
+		wantFrom    string
+		wantTo      string
+		granularity models.AnalyticsGranularity
+		wantErr     error
+	}{
+		{"默认最近7天", AnalyticsRangeParams{}, dayPlan, "2024-06-24", "2024-06-30", models.AnalyticsGranularityDay, nil},
+		{"range 参数", AnalyticsRangeParams{Range: "3d"}, dayPlan, "2024-06-28", "2024-06-30", models.AnalyticsGranularityDay, nil},
+		{"超出计划天数", AnalyticsRangeParams{Range: "8d"}, dayPlan, "", "", "", ErrAnalyticsRangeExceedsPlan},
+		{"无限制计划", AnalyticsRangeParams{Range: "1000d"}, unlimitedPlan, "2021-10-05", "2024-06-30", models.AnalyticsGranularityDay, nil},
+		{"无效 range", AnalyticsRangeParams{Range: "7w"}, dayPlan, "", "", "", ErrInvalidAnalyticsRange},
+		{"零天", AnalyticsRangeParams{Range: "0d"}, dayPlan, "", "", "", ErrInvalidAnalyticsRange},
+		{"from 和 to", AnalyticsRangeParams{From: "2024-06-10", To: "2024-06-12"}, hourPlan, "2024-06-10", "2024-06-12", models.AnalyticsGranularityDay, nil},
+		{"to 晚于今天按今天处理", AnalyticsRangeParams{From: "2024-06-29", To: "2024-07-05"}, dayPlan, "2024-06-29", "2024-06-30", models.AnalyticsGranularityDay, nil},
+		{"缺少 from", AnalyticsRangeParams{To: "2024-06-12"}, dayPlan, "", "", "", ErrInvalidAnalyticsRange},
+		{"from 晚于 to", AnalyticsRangeParams{From: "2024-06-12", To: "2024-06-10"}, hourPlan, "", "", "", ErrInvalidAnalyticsRange},
+		{"日期格式错误", AnalyticsRangeParams{From: "06/10/2024"}, dayPlan, "", "", "", ErrInvalidAnalyticsRange},
+		{"按小时默认1天", AnalyticsRangeParams{Granularity: "hour"}, hourPlan, "2024-06-30", "2024-06-30", models.AnalyticsGranularityHour, nil},
+		{"计划不支持按小时", AnalyticsRangeParams{Granularity: "hour"}, dayPlan, "", "", "", ErrAnalyticsGranularityNotAllowed},
+		{"按小时超过7天", AnalyticsRangeParams{Range: "8d", Granularity: "hour"}, hourPlan, "", "", "", ErrHourlyRangeTooLong},
+		{"未知粒度", AnalyticsRangeParams{Granularity: "minute"}, hourPlan, "", "", "", ErrInvalidAnalyticsRange},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := resolveAnalyticsQuery(tt.params, tt.plan, now)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("期望错误 %v, 实际 %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("不应返回错误: %v", err)
+			}
+			if query.fromDate() != tt.wantFrom || query.toDate() != tt.wantTo {
+				t.Errorf("期望 %s ~ %s, 实际 %s ~ %s", tt.wantFrom, tt.wantTo, query.fromDate(), query.toDate())
+			}
+			if query.Granularity != tt.granularity {
+				t.Errorf("期望粒度 %s, 实际 %s", tt.granularity, query.Granularity)
+			}
+		})
+	}
+}
+
+func TestFillTrafficBuckets(t *testing.T) {
+	daily := &AnalyticsQuery{
+		From:        time.Date(2024, 3, 9, 0, 0, 0, 0, time.Local),
+		To:          time.Date(2024, 3, 11, 0, 0, 0, 0, time.Local),
+		Granularity: models.AnalyticsGranularityDay,
+	}
+	stats := fillTrafficBuckets(daily, map[string]models.TrafficStats{
+		"2024-03-10": {Date: "2024-03-10", Views: 5, UniqueIPs: 2},
+	})
+	if len(stats) != 3 {
+		t.Fatalf("期望 3 个时间桶, 实际 %d", len(stats))
+	}
+	if stats[0].Date != "2024-03-09" || stats[0].Views != 0 {
+		t.Errorf("没有访问的日期应补零, 实际 %+v", stats[0])
+	}
+	if stats[1].Views != 5 || stats[1].UniqueIPs != 2 {
+		t.Errorf("期望 2024-03-10 有 5 次访问, 实际 %+v", stats[1])
+	}
+	if stats[2].Date != "2024-03-11" {
+		t.Errorf("最后一个时间桶期望 2024-03-11, 实际 %s", stats[2].Date)
+	}
+
+	hourly := &AnalyticsQuery{From: daily.From, To: daily.From, Granularity: models.AnalyticsGranularityHour}
+	stats = fillTrafficBuckets(hourly, map[string]models.TrafficStats{
+		"2024-03-09 13:00": {Date: "2024-03-09 13:00", Views: 3},
+	})
+	if len(stats) != 24 {
+		t.Fatalf("按小时期望 24 个时间桶, 实际 %d", len(stats))
+	}
+	if stats[13].Date != "2024-03-09 13:00" || stats[13].Views != 3 {
+		t.Errorf("期望 13 点有 3 次访问, 实际 %+v", stats[13])
+	}
+	if stats[23].Date != "2024-03-09 23:00" {
+		t.Errorf("最后一个时间桶期望 23:00, 实际 %s", stats[23].Date)
+	}
+}
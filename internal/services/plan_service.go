@@ -271,13 +271,19 @@ func (s *PlanService) CheckUsageLimits(userID uuid.UUID) (*UsageLimitStatus, err
 		return nil, fmt.Errorf("failed to get usage statistics: %w", err)
 	}
 
+	storageUsedBytes, err := getStorageUsedBytes(database.DB, userID)
+	if err != nil {
+		return nil, err
+	}
+
 	status := &UsageLimitStatus{
 		PlanType:            config.Type,
 		MonthlyUploadLimit:  config.MonthlyUploadLimit,
 		StorageLimitMB:      config.StorageLimitMB,
 		APIRateLimitPerHour: config.APIRateLimitPerHour,
 		ArticlesUploaded:    usage.ArticlesUploaded,
-		StorageUsedMB:       usage.StorageUsedMB,
+		StorageUsedMB:       bytesToMB(storageUsedBytes),
+		StorageUsedBytes:    storageUsedBytes,
 		APICallsMade:        usage.APICallsMade,
 		CanUploadArticle:    true,
 		CanMakeAPICall:      true,
@@ -289,15 +295,25 @@ func (s *PlanService) CheckUsageLimits(userID uuid.UUID) (*UsageLimitStatus, err
 		if config.MonthlyUploadLimit > 0 && usage.ArticlesUploaded >= config.MonthlyUploadLimit {
 			status.CanUploadArticle = false
 		}
-		if config.StorageLimitMB > 0 && usage.StorageUsedMB >= config.StorageLimitMB {
+		if config.StorageLimitMB > 0 && storageUsedBytes >= config.StorageLimitMB*bytesPerMB {
 			status.HasStorageSpace = false
 		}
-		// API 频率限制需要在中间件中实现
+		// API 频率限制由 middleware.RateLimitMiddleware 按小时滑动窗口执行
 	}
 
 	return status, nil
 }
 
+// CanCreatePrivateContent 检查用户计划是否支持私有内容（社区版仅支持公开内容）
+func (s *PlanService) CanCreatePrivateContent(userID uuid.UUID) (bool, error) {
+	subscription, err := s.GetUserPlan(userID)
+	if err != nil {
+		return false, err
+	}
+
+	return subscription.PlanType != models.PlanCommunity, nil
+}
+
 // GetPlanHistory 获取用户计划变更历史
 func (s *PlanService) GetPlanHistory(userID uuid.UUID, histories *[]models.PlanUpgradeHistory) error {
 	err := database.DB.Where("user_id = ?", userID).
@@ -320,8 +336,20 @@ type UsageLimitStatus struct {
 	APIRateLimitPerHour int             `json:"api_rate_limit_per_hour"`
 	ArticlesUploaded    int             `json:"articles_uploaded"`
 	StorageUsedMB       int64           `json:"storage_used_mb"`
+	StorageUsedBytes    int64           `json:"storage_used_bytes"`
 	APICallsMade        int             `json:"api_calls_made"`
 	CanUploadArticle    bool            `json:"can_upload_article"`
 	CanMakeAPICall      bool            `json:"can_make_api_call"`
 	HasStorageSpace     bool            `json:"has_storage_space"`
 }
+
+// checkStorage 检查增加 deltaBytes 后是否超出存储空间限制（企业版和 -1 表示无限制）
+func (u *UsageLimitStatus) checkStorage(deltaBytes int64) error {
+	if deltaBytes <= 0 || u.PlanType == models.PlanEnterprise || u.StorageLimitMB <= 0 {
+		return nil
+	}
+	if u.StorageUsedBytes+deltaBytes > u.StorageLimitMB*bytesPerMB {
+		return fmt.Errorf("%w (%d/%d MB)", ErrStorageLimitExceeded, bytesToMB(u.StorageUsedBytes+deltaBytes), u.StorageLimitMB)
+	}
+	return nil
+}
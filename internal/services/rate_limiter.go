@@ -0,0 +1,188 @@
+package services
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"anywebsites/internal/config"
+
+	"github.com/google/uuid"
+)
+
+// RateLimitResult 单次限流检查结果
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration
+}
+
+// RateLimitStore 限流计数存储，默认使用内存实现
+// 多实例部署时可基于 RedisConfig 提供 Redis 实现（两个窗口计数分别对应 INCR + EXPIRE 的键）
+type RateLimitStore interface {
+	// Allow 检查 key 在滑动窗口内的请求数是否低于 limit，允许时计数加一
+	Allow(key string, limit int, window time.Duration, now time.Time) (*RateLimitResult, error)
+}
+
+// windowCounter 滑动窗口计数器，保存当前和上一个固定窗口的请求数
+type windowCounter struct {
+	start    time.Time
+	current  int
+	previous int
+}
+
+// MemoryRateLimitStore 基于内存的滑动窗口计数存储
+type MemoryRateLimitStore struct {
+	counters  map[string]*windowCounter
+	mutex     sync.Mutex
+	lastSweep time.Time
+}
+
+// NewMemoryRateLimitStore 创建内存限流存储
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		counters: make(map[string]*windowCounter),
+	}
+}
+
+// Allow 使用滑动窗口计数算法：上一窗口的计数按剩余时间比例加权后与当前窗口计数相加
+func (s *MemoryRateLimitStore) Allow(key string, limit int, window time.Duration, now time.Time) (*RateLimitResult, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.sweep(window, now)
+
+	windowStart := now.Truncate(window)
+	counter, exists := s.counters[key]
+	if !exists {
+		counter = &windowCounter{start: windowStart}
+		s.counters[key] = counter
+	}
+	if !counter.start.Equal(windowStart) {
+		if windowStart.Sub(counter.start) == window {
+			counter.previous = counter.current
+		} else {
+			counter.previous = 0
+		}
+		counter.current = 0
+		counter.start = windowStart
+	}
+
+	elapsed := now.Sub(windowStart)
+	weight := 1 - float64(elapsed)/float64(window)
+	estimated := float64(counter.previous)*weight + float64(counter.current)
+
+	result := &RateLimitResult{Limit: limit}
+	if estimated >= float64(limit) {
+		result.RetryAfter = retryAfter(counter, limit, window, elapsed, estimated)
+		return result, nil
+	}
+
+	counter.current++
+	result.Allowed = true
+	result.Remaining = int(math.Max(0, math.Floor(float64(limit)-estimated-1)))
+	return result, nil
+}
+
+// retryAfter 估算计数降到限制以下所需的等待时间，最长到当前窗口结束
+func retryAfter(counter *windowCounter, limit int, window, elapsed time.Duration, estimated float64) time.Duration {
+	untilNextWindow := window - elapsed
+	wait := untilNextWindow
+	if counter.previous > 0 && counter.current < limit {
+		// 上一窗口权重随时间线性下降，计算降到 limit-1 以下的时间
+		excess := estimated - float64(limit) + 1
+		wait = time.Duration(excess / float64(counter.previous) * float64(window))
+		if wait > untilNextWindow {
+			wait = untilNextWindow
+		}
+	}
+	if wait < time.Second {
+		wait = time.Second
+	}
+	return wait
+}
+
+// sweep 定期清理两个窗口内没有请求的计数器
+func (s *MemoryRateLimitStore) sweep(window time.Duration, now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	cutoff := now.Truncate(window).Add(-window)
+	for key, counter := range s.counters {
+		if counter.start.Before(cutoff) {
+			delete(s.counters, key)
+		}
+	}
+}
+
+// cachedRateLimit 缓存的用户限流额度
+type cachedRateLimit struct {
+	limit     int
+	expiresAt time.Time
+}
+
+// RateLimitService 按用户计划限制 API 调用频率
+type RateLimitService struct {
+	store        RateLimitStore
+	usage        *APIUsageRecorder
+	planService  *PlanService
+	window       time.Duration
+	defaultLimit int
+
+	limits     map[uuid.UUID]*cachedRateLimit
+	limitMutex sync.RWMutex
+	limitTTL   time.Duration
+}
+
+// NewRateLimitService 创建 API 限流服务，计划额度查询失败时使用 RateLimitConfig.Requests
+// 通过限流的调用由 usage 累加后批量写入使用统计
+func NewRateLimitService(cfg *config.Config, store RateLimitStore, usage *APIUsageRecorder) *RateLimitService {
+	return &RateLimitService{
+		store:        store,
+		usage:        usage,
+		planService:  NewPlanService(),
+		window:       time.Hour,
+		defaultLimit: cfg.RateLimit.Requests,
+		limits:       make(map[uuid.UUID]*cachedRateLimit),
+		limitTTL:     5 * time.Minute,
+	}
+}
+
+// Allow 检查用户是否还能调用 API，limit 为 -1 时表示不限制，返回 nil 结果
+func (s *RateLimitService) Allow(userID uuid.UUID) (*RateLimitResult, error) {
+	limit := s.getLimit(userID)
+	if limit < 0 {
+		return nil, nil
+	}
+	return s.store.Allow("api:"+userID.String(), limit, s.window, time.Now())
+}
+
+// RecordAPICall 累加用户当月的 API 调用次数，由 APIUsageRecorder 定期批量写入
+func (s *RateLimitService) RecordAPICall(userID uuid.UUID) {
+	s.usage.Record(userID)
+}
+
+// getLimit 获取用户每小时的 API 调用额度，结果缓存一段时间以减少数据库查询
+func (s *RateLimitService) getLimit(userID uuid.UUID) int {
+	s.limitMutex.RLock()
+	cached, exists := s.limits[userID]
+	s.limitMutex.RUnlock()
+	if exists && time.Now().Before(cached.expiresAt) {
+		return cached.limit
+	}
+
+	limit := s.defaultLimit
+	if subscription, err := s.planService.GetUserPlan(userID); err == nil {
+		if planConfig, err := s.planService.GetPlanConfig(subscription.PlanType); err == nil {
+			limit = planConfig.APIRateLimitPerHour
+		}
+	}
+
+	s.limitMutex.Lock()
+	s.limits[userID] = &cachedRateLimit{limit: limit, expiresAt: time.Now().Add(s.limitTTL)}
+	s.limitMutex.Unlock()
+
+	return limit
+}
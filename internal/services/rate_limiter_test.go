@@ -0,0 +1,66 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryRateLimitStore_Allow(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	window := time.Hour
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 3; i++ {
+		result, err := store.Allow("user", 3, window, start.Add(time.Duration(i)*time.Minute))
+		if err != nil {
+			t.Fatalf("不期望错误: %v", err)
+		}
+		if !result.Allowed {
+			t.Fatalf("第 %d 次请求应该被允许", i+1)
+		}
+		if want := 2 - i; result.Remaining != want {
+			t.Errorf("第 %d 次请求剩余次数期望 %d，实际 %d", i+1, want, result.Remaining)
+		}
+	}
+
+	result, _ := store.Allow("user", 3, window, start.Add(10*time.Minute))
+	if result.Allowed {
+		t.Fatal("超过限制的请求应该被拒绝")
+	}
+	if result.RetryAfter <= 0 || result.RetryAfter > 50*time.Minute {
+		t.Errorf("RetryAfter 应该在当前窗口结束之前，实际 %v", result.RetryAfter)
+	}
+
+	// 其他用户不受影响
+	if result, _ := store.Allow("other", 3, window, start.Add(10*time.Minute)); !result.Allowed {
+		t.Error("其他用户的请求应该被允许")
+	}
+}
+
+func TestMemoryRateLimitStore_SlidingWindow(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	window := time.Hour
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	// 上一个窗口用满 10 次
+	for i := 0; i < 10; i++ {
+		store.Allow("user", 10, window, start.Add(50*time.Minute))
+	}
+
+	// 下一个窗口开始 15 分钟时，上一窗口仍按 75% 计入（7.5 次），还能再请求 3 次
+	next := start.Add(75 * time.Minute)
+	allowed := 0
+	for i := 0; i < 5; i++ {
+		if result, _ := store.Allow("user", 10, window, next); result.Allowed {
+			allowed++
+		}
+	}
+	if allowed != 3 {
+		t.Errorf("期望允许 3 次请求，实际 %d 次", allowed)
+	}
+
+	// 间隔超过一个窗口后计数清零
+	if result, _ := store.Allow("user", 10, window, start.Add(3*time.Hour)); !result.Allowed || result.Remaining != 9 {
+		t.Errorf("间隔两个窗口后应重新计数，实际 %+v", result)
+	}
+}
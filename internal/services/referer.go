@@ -0,0 +1,86 @@
+package services
+
+import (
+	"net/url"
+	"strings"
+
+	"anywebsites/internal/models"
+)
+
+// searchDomains 搜索引擎的域名，以 .* 结尾的匹配任意国家或地区后缀（如 google.co.uk）
+var searchDomains = []string{
+	"google.*", "bing.com", "baidu.com", "yahoo.*", "duckduckgo.com", "yandex.*",
+	"sogou.com", "so.com", "sm.cn", "naver.com", "ecosia.org", "search.brave.com",
+}
+
+// socialDomains 社交网络和社区的域名，包括它们的短链接域名
+var socialDomains = []string{
+	"facebook.com", "fb.com", "instagram.com", "twitter.com", "x.com", "t.co",
+	"linkedin.com", "lnkd.in", "reddit.com", "pinterest.*", "youtube.com", "tiktok.com",
+	"weibo.com", "weibo.cn", "t.cn", "zhihu.com", "douban.com", "weixin.qq.com",
+	"news.ycombinator.com", "telegram.org", "t.me", "discord.com", "mastodon.social",
+}
+
+// RefererInfo 来源的主机名和分类
+type RefererInfo struct {
+	Host     string
+	Category string
+}
+
+// ClassifyReferer 解析来源的主机名并分类：没有来源为 direct，来自 internalHosts 中的域名为 internal，
+// 搜索引擎为 search，社交网络为 social，其他网站为 referral
+func ClassifyReferer(referer string, internalHosts ...string) RefererInfo {
+	host := refererHost(referer)
+	if host == "" {
+		return RefererInfo{Category: models.RefererCategoryDirect}
+	}
+
+	info := RefererInfo{Host: host, Category: models.RefererCategoryReferral}
+	for _, internal := range internalHosts {
+		if internal != "" && host == NormalizeDomain(internal) {
+			info.Category = models.RefererCategoryInternal
+			return info
+		}
+	}
+
+	name := strings.TrimPrefix(host, "www.")
+	switch {
+	case matchesDomain(name, searchDomains):
+		info.Category = models.RefererCategorySearch
+	case matchesDomain(name, socialDomains):
+		info.Category = models.RefererCategorySocial
+	}
+	return info
+}
+
+// matchesDomain 判断主机名是否为列表中的域名或其子域名
+func matchesDomain(host string, domains []string) bool {
+	labels := strings.Split(host, ".")
+	for _, domain := range domains {
+		if name, ok := strings.CutSuffix(domain, ".*"); ok {
+			// 任意后缀：name 之后还有一到两级（com、co.uk）
+			for i, label := range labels {
+				if label == name && len(labels)-i-1 >= 1 && len(labels)-i-1 <= 2 {
+					return true
+				}
+			}
+			continue
+		}
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// refererHost 提取来源 URL 的主机名（小写），与汇总表的 referer_host 规则一致，直接访问或无法解析时为空
+func refererHost(referer string) string {
+	if referer == "" {
+		return ""
+	}
+	u, err := url.Parse(referer)
+	if err != nil || u.Scheme == "" {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
@@ -0,0 +1,49 @@
+package services
+
+import (
+	"testing"
+
+	"anywebsites/internal/models"
+)
+
+func TestRefererHost(t *testing.T) {
+	tests := map[string]string{
+		"":                                   "",
+		"https://www.Google.com/search?q=go": "www.google.com",
+		"http://user@example.com:8080/page":  "example.com",
+		"not a url":                          "",
+	}
+	for referer, want := range tests {
+		if got := refererHost(referer); got != want {
+			t.Errorf("refererHost(%q) 期望 %q, 实际 %q", referer, want, got)
+		}
+	}
+}
+
+func TestClassifyReferer(t *testing.T) {
+	tests := []struct {
+		referer  string
+		host     string
+		category string
+	}{
+		{"", "", models.RefererCategoryDirect},
+		{"not a url", "", models.RefererCategoryDirect},
+		{"https://www.google.com/search?q=go", "www.google.com", models.RefererCategorySearch},
+		{"https://www.google.co.uk/search?q=go", "www.google.co.uk", models.RefererCategorySearch},
+		{"https://cn.bing.com/search?q=go", "cn.bing.com", models.RefererCategorySearch},
+		{"https://m.facebook.com/", "m.facebook.com", models.RefererCategorySocial},
+		{"https://t.co/abc", "t.co", models.RefererCategorySocial},
+		{"https://news.ycombinator.com/item?id=1", "news.ycombinator.com", models.RefererCategorySocial},
+		{"https://anywebsites.gslb.vip/admin", "anywebsites.gslb.vip", models.RefererCategoryInternal},
+		{"https://blog.example.com/post", "blog.example.com", models.RefererCategoryInternal},
+		{"https://google.blog.example.com/", "google.blog.example.com", models.RefererCategoryReferral},
+		{"https://notreddit.com/", "notreddit.com", models.RefererCategoryReferral},
+		{"https://example.org/links", "example.org", models.RefererCategoryReferral},
+	}
+	for _, tt := range tests {
+		got := ClassifyReferer(tt.referer, "anywebsites.gslb.vip", "blog.example.com:443")
+		if got.Host != tt.host || got.Category != tt.category {
+			t.Errorf("ClassifyReferer(%q) 期望 %q/%q, 实际 %q/%q", tt.referer, tt.host, tt.category, got.Host, got.Category)
+		}
+	}
+}
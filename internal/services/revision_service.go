@@ -0,0 +1,295 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"anywebsites/internal/database"
+	"anywebsites/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrRevisionNotFound 修订不存在
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// RevisionService 内容修订历史服务
+type RevisionService struct {
+	planService *PlanService
+}
+
+// NewRevisionService 创建修订历史服务实例
+func NewRevisionService() *RevisionService {
+	return &RevisionService{
+		planService: NewPlanService(),
+	}
+}
+
+// RevisionDiff 两个修订之间的差异
+type RevisionDiff struct {
+	From               int        `json:"from"`
+	To                 int        `json:"to"`
+	TitleChanged       bool       `json:"title_changed"`
+	DescriptionChanged bool       `json:"description_changed"`
+	Lines              []DiffLine `json:"lines"`
+}
+
+// SaveContent 保存更新后的内容并写入修订，previous 为更新前的内容
+// 内容变大时检查所有者的存储空间限制，管理后台的修改不受限制
+func (s *RevisionService) SaveContent(previous, updated *models.Content, editorID uuid.UUID, source models.RevisionSource) error {
+	tx := database.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := s.applySize(tx, previous, updated, source != models.RevisionSourceAdmin); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := saveContentRow(tx, updated, false); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to update content: %w", err)
+	}
+
+	if _, err := s.record(tx, previous, updated, editorID, source, nil); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// applySize 重新计算更新后内容的大小，并按变化量调整所有者的存储用量
+func (s *RevisionService) applySize(tx *gorm.DB, previous, updated *models.Content, enforce bool) error {
+	updated.FileSize = contentSize(updated)
+	delta := updated.FileSize - previous.FileSize
+	if delta == 0 || !previous.IsActive {
+		return nil
+	}
+
+	if enforce && delta > 0 {
+		status, err := s.planService.CheckUsageLimits(updated.UserID)
+		if err != nil {
+			return fmt.Errorf("failed to check usage limits: %w", err)
+		}
+		if err := status.checkStorage(delta); err != nil {
+			return err
+		}
+	}
+
+	if err := updateUsageStatistics(tx, updated.UserID, 0, delta, 0); err != nil {
+		return fmt.Errorf("failed to update usage statistics: %w", err)
+	}
+	return nil
+}
+
+// record 在事务中记录一次内容更新
+// 内容第一次被修改时会先把原始内容保存为第 1 个修订
+func (s *RevisionService) record(tx *gorm.DB, previous, updated *models.Content, editorID uuid.UUID, source models.RevisionSource, restoredFrom *int) (*models.ContentRevision, error) {
+	var latest models.ContentRevision
+	err := tx.Where("content_id = ?", updated.ID).Order("revision DESC").First(&latest).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to get latest revision: %w", err)
+	}
+
+	next := latest.Revision + 1
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		original := &models.ContentRevision{
+			ContentID:   previous.ID,
+			Revision:    1,
+			Title:       previous.Title,
+			Description: previous.Description,
+			Content:     previous.Content,
+			Source:      models.RevisionSourceOriginal,
+			CreatedAt:   previous.UpdatedAt,
+		}
+		if err := tx.Create(original).Error; err != nil {
+			return nil, fmt.Errorf("failed to create original revision: %w", err)
+		}
+		next = 2
+	}
+
+	revision := &models.ContentRevision{
+		ContentID:    updated.ID,
+		Revision:     next,
+		Title:        updated.Title,
+		Description:  updated.Description,
+		Content:      updated.Content,
+		Source:       source,
+		RestoredFrom: restoredFrom,
+	}
+	if editorID != uuid.Nil {
+		revision.EditorID = &editorID
+	}
+	if err := tx.Create(revision).Error; err != nil {
+		return nil, fmt.Errorf("failed to create revision: %w", err)
+	}
+
+	if err := s.prune(tx, updated.UserID, updated.ID, next); err != nil {
+		return nil, err
+	}
+
+	return revision, nil
+}
+
+// prune 按内容所有者计划的保留数量删除最旧的修订
+func (s *RevisionService) prune(tx *gorm.DB, ownerID, contentID uuid.UUID, latest int) error {
+	subscription, err := s.planService.GetUserPlan(ownerID)
+	if err != nil {
+		return err
+	}
+	config, err := s.planService.GetPlanConfig(subscription.PlanType)
+	if err != nil {
+		return err
+	}
+	if config.RevisionRetention < 0 {
+		return nil
+	}
+
+	// 至少保留当前修订
+	keep := config.RevisionRetention
+	if keep < 1 {
+		keep = 1
+	}
+	if err := tx.Where("content_id = ? AND revision <= ?", contentID, latest-keep).
+		Delete(&models.ContentRevision{}).Error; err != nil {
+		return fmt.Errorf("failed to prune revisions: %w", err)
+	}
+	return nil
+}
+
+// List 获取内容的修订列表（不含正文），按修订号倒序
+func (s *RevisionService) List(userID, contentID uuid.UUID) ([]models.ContentRevision, error) {
+	if _, err := s.getOwnedContent(userID, contentID); err != nil {
+		return nil, err
+	}
+
+	var revisions []models.ContentRevision
+	err := database.DB.Select("id", "content_id", "revision", "title", "description", "editor_id", "source", "restored_from", "created_at").
+		Where("content_id = ?", contentID).
+		Order("revision DESC").
+		Find(&revisions).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list revisions: %w", err)
+	}
+
+	return revisions, nil
+}
+
+// Get 获取指定修订
+func (s *RevisionService) Get(userID, contentID uuid.UUID, revision int) (*models.ContentRevision, error) {
+	if _, err := s.getOwnedContent(userID, contentID); err != nil {
+		return nil, err
+	}
+	return s.getRevision(database.DB, contentID, revision)
+}
+
+// Diff 比较两个修订的差异
+func (s *RevisionService) Diff(userID, contentID uuid.UUID, from, to int) (*RevisionDiff, error) {
+	if _, err := s.getOwnedContent(userID, contentID); err != nil {
+		return nil, err
+	}
+
+	fromRevision, err := s.getRevision(database.DB, contentID, from)
+	if err != nil {
+		return nil, err
+	}
+	toRevision, err := s.getRevision(database.DB, contentID, to)
+	if err != nil {
+		return nil, err
+	}
+
+	lines, err := diffLines(fromRevision.Content, toRevision.Content)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RevisionDiff{
+		From:               from,
+		To:                 to,
+		TitleChanged:       fromRevision.Title != toRevision.Title,
+		DescriptionChanged: fromRevision.Description != toRevision.Description,
+		Lines:              lines,
+	}, nil
+}
+
+// Restore 将历史修订恢复为当前内容，恢复操作本身会记录为新的修订
+func (s *RevisionService) Restore(userID, contentID uuid.UUID, revision int) (*models.Content, error) {
+	tx := database.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var content models.Content
+	if err := tx.Where("id = ? AND user_id = ? AND is_active = ?", contentID, userID, true).First(&content).Error; err != nil {
+		tx.Rollback()
+		return nil, errors.New("content not found")
+	}
+	if err := loadBody(&content); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	target, err := s.getRevision(tx, contentID, revision)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	previous := content
+	content.Title = target.Title
+	content.Description = target.Description
+	content.Content = target.Content
+
+	if err := s.applySize(tx, &previous, &content, true); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := saveContentRow(tx, &content, false); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("failed to restore content: %w", err)
+	}
+
+	if _, err := s.record(tx, &previous, &content, userID, models.RevisionSourceRestore, &revision); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return &content, nil
+}
+
+// getOwnedContent 获取属于该用户的内容
+func (s *RevisionService) getOwnedContent(userID, contentID uuid.UUID) (*models.Content, error) {
+	var content models.Content
+	if err := database.DB.Where("id = ? AND user_id = ? AND is_active = ?", contentID, userID, true).First(&content).Error; err != nil {
+		return nil, errors.New("content not found")
+	}
+	return &content, nil
+}
+
+// getRevision 获取内容的指定修订
+func (s *RevisionService) getRevision(db *gorm.DB, contentID uuid.UUID, revision int) (*models.ContentRevision, error) {
+	var rev models.ContentRevision
+	if err := db.Where("content_id = ? AND revision = ?", contentID, revision).First(&rev).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRevisionNotFound
+		}
+		return nil, err
+	}
+	return &rev, nil
+}
@@ -0,0 +1,241 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+
+	"anywebsites/internal/config"
+	"anywebsites/internal/models"
+
+	"github.com/google/uuid"
+	"golang.org/x/net/html"
+)
+
+// dangerousElements 任何清理策略下都连同内容一起移除的元素
+// SVG 动画元素可以把 href 等属性改成 javascript: 链接，属性检查无法覆盖，直接移除
+var dangerousElements = map[string]bool{
+	"script": true, "object": true, "embed": true, "applet": true, "base": true,
+	"iframe": true, "frame": true, "frameset": true,
+	"animate": true, "set": true, "animatetransform": true, "animatemotion": true, "animatecolor": true,
+}
+
+// foreignElements 进入 SVG 或 MathML 命名空间的元素，其中的 style 按标记解析而不是原样文本
+var foreignElements = map[string]bool{"svg": true, "math": true}
+
+// strictDroppedElements strict 策略下额外连同内容一起移除的元素，其中的文本不应作为正文显示
+var strictDroppedElements = map[string]bool{
+	"style": true, "noscript": true, "template": true, "svg": true, "math": true,
+	"textarea": true, "select": true, "xmp": true, "noembed": true, "noframes": true, "plaintext": true,
+}
+
+// strictAllowedTags strict 策略允许保留的标签，其余标签移除但保留其中的文本
+var strictAllowedTags = map[string]bool{
+	"html": true, "head": true, "body": true, "title": true, "meta": true,
+	"div": true, "span": true, "p": true, "br": true, "hr": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"ul": true, "ol": true, "li": true, "dl": true, "dt": true, "dd": true,
+	"a": true, "img": true, "strong": true, "b": true, "em": true, "i": true, "u": true, "s": true,
+	"small": true, "sub": true, "sup": true, "mark": true, "abbr": true, "cite": true, "q": true, "time": true,
+	"blockquote": true, "pre": true, "code": true, "kbd": true,
+	"table": true, "thead": true, "tbody": true, "tfoot": true, "tr": true, "th": true, "td": true, "caption": true,
+	"figure": true, "figcaption": true, "section": true, "article": true, "header": true, "footer": true,
+	"nav": true, "main": true, "aside": true, "details": true, "summary": true,
+}
+
+// strictGlobalAttrs strict 策略下所有标签允许的属性
+var strictGlobalAttrs = map[string]bool{"class": true, "id": true, "title": true, "lang": true, "dir": true}
+
+// strictTagAttrs strict 策略下特定标签额外允许的属性
+var strictTagAttrs = map[string]map[string]bool{
+	"a":          {"href": true, "name": true, "target": true, "rel": true},
+	"img":        {"src": true, "alt": true, "width": true, "height": true},
+	"meta":       {"charset": true, "name": true, "content": true},
+	"td":         {"colspan": true, "rowspan": true, "align": true},
+	"th":         {"colspan": true, "rowspan": true, "align": true, "scope": true},
+	"ol":         {"start": true, "type": true},
+	"time":       {"datetime": true},
+	"q":          {"cite": true},
+	"blockquote": {"cite": true},
+	"details":    {"open": true},
+}
+
+// urlAttrs 值为 URL 的属性，需要校验协议
+var urlAttrs = map[string]bool{
+	"href": true, "src": true, "action": true, "formaction": true, "xlink:href": true,
+	"data": true, "poster": true, "background": true, "cite": true, "srcset": true,
+}
+
+// safeURLSchemes 链接允许使用的协议
+var safeURLSchemes = map[string]bool{"http": true, "https": true, "mailto": true, "tel": true, "ftp": true}
+
+// HTMLSanitizer 按用户计划的策略清理上传的 HTML
+type HTMLSanitizer struct {
+	enabled     bool
+	planService *PlanService
+}
+
+// NewHTMLSanitizer 创建 HTML 清理器，ContentSecurityConfig.SanitizeHTML 关闭时不做任何处理
+func NewHTMLSanitizer(cfg *config.Config) *HTMLSanitizer {
+	return &HTMLSanitizer{
+		enabled:     cfg.ContentSecurity.SanitizeHTML,
+		planService: NewPlanService(),
+	}
+}
+
+// Sanitize 使用用户计划的 HTML 策略清理正文
+func (s *HTMLSanitizer) Sanitize(userID uuid.UUID, body string) (string, error) {
+	if !s.enabled {
+		return body, nil
+	}
+
+	subscription, err := s.planService.GetUserPlan(userID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get user plan: %w", err)
+	}
+	planConfig, err := s.planService.GetPlanConfig(subscription.PlanType)
+	if err != nil {
+		return "", err
+	}
+
+	return SanitizeHTML(body, planConfig.HTMLPolicy), nil
+}
+
+// SanitizeHTML 按策略清理 HTML，未知策略按 none 处理
+// 输出由分词结果重新序列化：文本重新转义，只有 HTML 命名空间中 style 元素的内容原样保留
+func SanitizeHTML(body string, policy models.HTMLPolicy) string {
+	if policy != models.HTMLPolicyStripScripts && policy != models.HTMLPolicyStrict {
+		return body
+	}
+	strict := policy == models.HTMLPolicyStrict
+
+	var out strings.Builder
+	tokenizer := html.NewTokenizer(strings.NewReader(body))
+
+	// 被移除元素的标签名和嵌套深度，期间的所有内容都丢弃
+	skipTag, skipDepth := "", 0
+	inStyle := false
+	// 未闭合的 svg、math 层数，大于 0 时处于外部内容中
+	foreignDepth := 0
+
+	for {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			// 读取结束（io.EOF）或遇到无法解析的内容，已输出的部分都是安全的
+			return out.String()
+		}
+		token := tokenizer.Token()
+
+		if skipDepth > 0 {
+			switch {
+			case tokenType == html.StartTagToken && token.Data == skipTag:
+				skipDepth++
+			case tokenType == html.EndTagToken && token.Data == skipTag:
+				skipDepth--
+			}
+			continue
+		}
+
+		switch tokenType {
+		case html.DoctypeToken:
+			out.WriteString(token.String())
+		case html.CommentToken:
+			// 注释可能包含 IE 条件注释，直接移除
+		case html.TextToken:
+			if inStyle {
+				out.WriteString(token.Data)
+			} else {
+				out.WriteString(html.EscapeString(token.Data))
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			inStyle = false
+			// 外部内容中的 style 由浏览器按标记解析，其中的标签可能跳出 svg 成为 HTML 元素，连同内容一起移除
+			foreignStyle := foreignDepth > 0 && token.Data == "style"
+			if foreignStyle && tokenType == html.StartTagToken {
+				tokenizer.NextIsNotRawText()
+			}
+			if foreignStyle || dangerousElements[token.Data] || (strict && strictDroppedElements[token.Data]) {
+				if tokenType == html.StartTagToken {
+					skipTag, skipDepth = token.Data, 1
+				}
+				continue
+			}
+			if strict && !strictAllowedTags[token.Data] {
+				continue
+			}
+			token.Attr = sanitizeAttrs(token.Data, token.Attr, strict)
+			out.WriteString(token.String())
+			inStyle = tokenType == html.StartTagToken && token.Data == "style"
+			if tokenType == html.StartTagToken && foreignElements[token.Data] {
+				foreignDepth++
+			}
+		case html.EndTagToken:
+			inStyle = false
+			if foreignElements[token.Data] && foreignDepth > 0 {
+				foreignDepth--
+			}
+			if dangerousElements[token.Data] || (strict && !strictAllowedTags[token.Data]) {
+				continue
+			}
+			out.WriteString(token.String())
+		}
+	}
+}
+
+// sanitizeAttrs 移除事件属性和不安全的 URL，strict 策略下只保留白名单中的属性
+func sanitizeAttrs(tag string, attrs []html.Attribute, strict bool) []html.Attribute {
+	kept := make([]html.Attribute, 0, len(attrs))
+	for _, attr := range attrs {
+		key := strings.ToLower(attr.Key)
+		if attr.Namespace != "" {
+			key = strings.ToLower(attr.Namespace) + ":" + key
+		}
+
+		if strings.HasPrefix(key, "on") || key == "http-equiv" || key == "srcdoc" {
+			continue
+		}
+		if strict && !strictGlobalAttrs[key] && !strictTagAttrs[tag][key] {
+			continue
+		}
+		if urlAttrs[key] && !isSafeURL(attr.Val, key == "src") {
+			continue
+		}
+		if key == "style" && isUnsafeStyle(attr.Val) {
+			continue
+		}
+		kept = append(kept, attr)
+	}
+	return kept
+}
+
+// isSafeURL 检查 URL 的协议，相对地址始终允许；allowDataImage 为 true 时允许 data:image/ 图片
+func isSafeURL(value string, allowDataImage bool) bool {
+	// 浏览器解析 URL 时会忽略控制字符和空白，比较前同样去除
+	normalized := strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, strings.ToLower(value))
+
+	colon := strings.IndexByte(normalized, ':')
+	if colon < 0 || strings.ContainsAny(normalized[:colon], "/?#") {
+		return true
+	}
+
+	scheme := normalized[:colon]
+	if safeURLSchemes[scheme] {
+		return true
+	}
+	return allowDataImage && strings.HasPrefix(normalized, "data:image/")
+}
+
+// isUnsafeStyle 检查内联样式中可执行脚本的旧式写法
+func isUnsafeStyle(value string) bool {
+	normalized := strings.ToLower(strings.Join(strings.Fields(value), ""))
+	for _, pattern := range []string{"expression(", "javascript:", "vbscript:", "behavior:", "-moz-binding"} {
+		if strings.Contains(normalized, pattern) {
+			return true
+		}
+	}
+	return false
+}
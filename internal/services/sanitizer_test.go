@@ -0,0 +1,73 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"anywebsites/internal/models"
+)
+
+func TestSanitizeHTML_None(t *testing.T) {
+	input := `<script>alert(1)</script><p onclick="x()">hi</p>`
+	if got := SanitizeHTML(input, models.HTMLPolicyNone); got != input {
+		t.Errorf("none 策略不应修改正文，实际 %q", got)
+	}
+	if got := SanitizeHTML(input, ""); got != input {
+		t.Errorf("未设置策略时不应修改正文，实际 %q", got)
+	}
+}
+
+func TestSanitizeHTML_StripScripts(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"移除脚本", `<p>a</p><script>alert("x")</script><p>b</p>`, `<p>a</p><p>b</p>`},
+		{"移除事件属性", `<img src="a.png" onerror="alert(1)">`, `<img src="a.png">`},
+		{"移除 javascript 链接", `<a href="javascript:alert(1)">x</a>`, `<a>x</a>`},
+		{"编码和空白混淆的链接", `<a href="  jav&#x09;ascript:alert(1)">x</a>`, `<a>x</a>`},
+		{"保留普通链接", `<a href="https://example.com/?a=1&amp;b=2">x</a>`, `<a href="https://example.com/?a=1&amp;b=2">x</a>`},
+		{"保留相对链接", `<a href="/docs/a:b">x</a>`, `<a href="/docs/a:b">x</a>`},
+		{"移除 iframe", `<iframe src="x"><p>fallback</p></iframe>after`, `after`},
+		{"移除嵌套 object", `<object data="x"><object data="y"></object>inner</object>after`, `after`},
+		{"保留样式", `<style>p > a { color: red; }</style>`, `<style>p > a { color: red; }</style>`},
+		{"移除危险样式属性", `<div style="width: expression(alert(1))">x</div>`, `<div>x</div>`},
+		{"移除注释", `a<!--[if IE]><script>x</script><![endif]-->b`, `ab`},
+		{"移除 meta 刷新", `<meta http-equiv="refresh" content="0;url=https://evil">`, `<meta content="0;url=https://evil">`},
+		{"允许 data 图片", `<img src="data:image/png;base64,AAAA">`, `<img src="data:image/png;base64,AAAA">`},
+		{"禁止 data 链接", `<a href="data:text/html,<script>x</script>">x</a>`, `<a>x</a>`},
+		{"移除 svg 中按标记解析的 style", `<svg><style><img src=x onerror=alert(1)></style></svg>`, `<svg></svg>`},
+		{"svg 之后的 style 恢复原样文本", `<svg></svg><style>a > b {}</style>`, `<svg></svg><style>a > b {}</style>`},
+		{"移除 math 中的 style", `<math><style><img src=x onerror=alert(1)></style></math>`, `<math></math>`},
+		{"移除 svg 动画", `<svg><a><animate attributeName=href values=javascript:alert(1) />x</a></svg>`, `<svg><a>x</a></svg>`},
+		{"移除 svg set", `<svg><a><set attributeName="xlink:href" to="javascript:alert(1)"></set>x</a></svg>`, `<svg><a>x</a></svg>`},
+	}
+
+	for _, tt := range tests {
+		if got := SanitizeHTML(tt.input, models.HTMLPolicyStripScripts); got != tt.want {
+			t.Errorf("%s: SanitizeHTML(%q) = %q，期望 %q", tt.name, tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestSanitizeHTML_Strict(t *testing.T) {
+	input := `<!DOCTYPE html><html><head><title>T</title><style>body{}</style></head>` +
+		`<body><div class="c" style="color:red" data-x="1"><form action="/x"><input name="q">文本</form>` +
+		`<a href="https://example.com" target="_blank">链接</a><svg><text>矢量</text></svg></div></body></html>`
+	want := `<!DOCTYPE html><html><head><title>T</title></head>` +
+		`<body><div class="c">文本<a href="https://example.com" target="_blank">链接</a></div></body></html>`
+
+	if got := SanitizeHTML(input, models.HTMLPolicyStrict); got != want {
+		t.Errorf("strict 策略清理结果 = %q，期望 %q", got, want)
+	}
+}
+
+func TestSanitizeHTML_EscapesText(t *testing.T) {
+	// 原样文本元素中的标签在输出时必须转义，避免重新解析后变成真实标签
+	input := `<noscript><p title="</noscript><img src=x onerror=alert(1)>"></noscript>`
+	got := SanitizeHTML(input, models.HTMLPolicyStripScripts)
+	if strings.Contains(got, "onerror") || strings.Contains(got, "<p") {
+		t.Errorf("清理结果中仍有可执行内容: %q", got)
+	}
+}
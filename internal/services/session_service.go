@@ -0,0 +1,241 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"anywebsites/internal/auth"
+	"anywebsites/internal/database"
+	"anywebsites/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidRefreshToken 刷新 Token 无效、已过期或会话已吊销
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused 已轮换的刷新 Token 被再次使用，整个会话已被吊销
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected, session revoked")
+	// ErrSessionRevoked 访问 Token 所属的会话已吊销或用户已禁用
+	ErrSessionRevoked = errors.New("session revoked or user inactive")
+	// ErrUserInactive 用户不存在或已禁用
+	ErrUserInactive = errors.New("user not found or inactive")
+)
+
+// SessionClient 创建会话的客户端信息
+type SessionClient struct {
+	UserAgent string
+	IPAddress string
+}
+
+// TokenPair 一次签发的访问 Token 和刷新 Token
+type TokenPair struct {
+	SessionID    uuid.UUID
+	AccessToken  string
+	RefreshToken string
+}
+
+// SessionService 服务端会话服务，负责签发、轮换和吊销 Token
+type SessionService struct{}
+
+// NewSessionService 创建会话服务实例
+func NewSessionService() *SessionService {
+	return &SessionService{}
+}
+
+// Create 用户登录时创建新会话并签发 Token
+func (s *SessionService) Create(user *models.User, client SessionClient) (*TokenPair, error) {
+	id := uuid.New()
+	pair, err := issueTokens(user, id)
+	if err != nil {
+		return nil, err
+	}
+
+	session := newSession(id, id, user.ID, client)
+	if err := database.DB.Create(session).Error; err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+	return pair, nil
+}
+
+// Rotate 使用刷新 Token 换取新的 Token，旧的刷新 Token 随即失效
+// 已轮换的刷新 Token 再次出现说明可能已泄露，吊销它所属的整个会话
+func (s *SessionService) Rotate(refreshToken string, client SessionClient) (*models.User, *TokenPair, error) {
+	claims, err := auth.ValidateRefreshToken(refreshToken)
+	if err != nil {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+	tokenID, err := uuid.Parse(claims.ID)
+	if err != nil {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+
+	var session models.UserSession
+	if err := database.DB.Where("id = ? AND user_id = ?", tokenID, claims.UserID).First(&session).Error; err != nil {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+	if session.IsRevoked() {
+		return nil, nil, ErrInvalidRefreshToken
+	}
+	if session.IsRotated() {
+		s.revokeReusedFamily(&session)
+		return nil, nil, ErrRefreshTokenReused
+	}
+
+	var user models.User
+	if err := database.DB.Where("id = ? AND is_active = ?", session.UserID, true).First(&user).Error; err != nil {
+		return nil, nil, ErrUserInactive
+	}
+
+	nextID := uuid.New()
+	pair, err := issueTokens(&user, nextID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(newSession(nextID, session.FamilyID, user.ID, client)).Error; err != nil {
+			return fmt.Errorf("failed to create session: %w", err)
+		}
+		// 只有尚未轮换的记录才能更新，并发使用同一个刷新 Token 时只有一个请求成功
+		result := tx.Model(&models.UserSession{}).
+			Where("id = ? AND replaced_by IS NULL AND revoked_at IS NULL", session.ID).
+			Update("replaced_by", nextID)
+		if result.Error != nil {
+			return fmt.Errorf("failed to rotate session: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrRefreshTokenReused
+		}
+		return nil
+	})
+	if errors.Is(err, ErrRefreshTokenReused) {
+		s.revokeReusedFamily(&session)
+		return nil, nil, err
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &user, pair, nil
+}
+
+// Validate 校验访问 Token 所属的会话未被吊销且用户仍然有效，返回用户的最新信息
+func (s *SessionService) Validate(claims *auth.Claims) (*models.User, error) {
+	if claims.SessionID == uuid.Nil {
+		return nil, ErrSessionRevoked
+	}
+
+	var count int64
+	if err := database.DB.Model(&models.UserSession{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", claims.SessionID, claims.UserID).
+		Count(&count).Error; err != nil {
+		return nil, fmt.Errorf("failed to check session: %w", err)
+	}
+	if count == 0 {
+		return nil, ErrSessionRevoked
+	}
+
+	var user models.User
+	if err := database.DB.Where("id = ? AND is_active = ?", claims.UserID, true).First(&user).Error; err != nil {
+		return nil, ErrSessionRevoked
+	}
+	return &user, nil
+}
+
+// CheckActive 检查会话未被吊销且用户仍然有效，用于长连接在推送期间定期复查
+func (s *SessionService) CheckActive(userID, sessionID uuid.UUID) (*models.User, error) {
+	return s.Validate(&auth.Claims{UserID: userID, SessionID: sessionID})
+}
+
+// Revoke 吊销会话记录所属的整个会话（退出登录）
+func (s *SessionService) Revoke(sessionID uuid.UUID) error {
+	var session models.UserSession
+	if err := database.DB.Select("family_id").Where("id = ?", sessionID).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to find session: %w", err)
+	}
+	_, err := revokeSessions(database.DB.Where("family_id = ?", session.FamilyID))
+	return err
+}
+
+// RevokeAllForUser 吊销用户的全部会话，返回吊销的记录数
+func (s *SessionService) RevokeAllForUser(userID uuid.UUID) (int64, error) {
+	return revokeSessions(database.DB.Where("user_id = ?", userID))
+}
+
+// RevokeOtherSessions 吊销用户除 keepSessionID 所属会话以外的全部会话
+func (s *SessionService) RevokeOtherSessions(userID, keepSessionID uuid.UUID) (int64, error) {
+	var session models.UserSession
+	if err := database.DB.Select("family_id").Where("id = ? AND user_id = ?", keepSessionID, userID).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return s.RevokeAllForUser(userID)
+		}
+		return 0, fmt.Errorf("failed to find session: %w", err)
+	}
+	return revokeSessions(database.DB.Where("user_id = ? AND family_id <> ?", userID, session.FamilyID))
+}
+
+// revokeReusedFamily 检测到刷新 Token 重复使用时吊销整个会话
+func (s *SessionService) revokeReusedFamily(session *models.UserSession) {
+	log.Printf("Refresh token reuse detected for user %s, revoking session %s", session.UserID, session.FamilyID)
+	if _, err := revokeSessions(database.DB.Where("family_id = ?", session.FamilyID)); err != nil {
+		log.Printf("Failed to revoke session %s: %v", session.FamilyID, err)
+	}
+}
+
+// revokeSessions 吊销查询条件匹配的全部未吊销记录
+func revokeSessions(query *gorm.DB) (int64, error) {
+	result := query.Model(&models.UserSession{}).
+		Where("revoked_at IS NULL").
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to revoke sessions: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// pruneExpiredSessions 删除已过期的会话记录，过期的刷新 Token 本身已无法通过校验
+func pruneExpiredSessions() (int64, error) {
+	result := database.DB.Where("expires_at < ?", time.Now()).Delete(&models.UserSession{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("failed to prune expired sessions: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// issueTokens 签发访问 Token 和刷新 Token，sessionID 同时作为刷新 Token 的 jti
+func issueTokens(user *models.User, sessionID uuid.UUID) (*TokenPair, error) {
+	accessToken, err := auth.GenerateToken(user.ID, user.Username, user.IsAdmin, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate access token: %w", err)
+	}
+
+	refreshToken, err := auth.GenerateRefreshToken(user.ID, user.Username, user.IsAdmin, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+
+	return &TokenPair{
+		SessionID:    sessionID,
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+	}, nil
+}
+
+// newSession 创建会话记录，过期时间与刷新 Token 一致
+func newSession(id, familyID, userID uuid.UUID, client SessionClient) *models.UserSession {
+	return &models.UserSession{
+		ID:        id,
+		FamilyID:  familyID,
+		UserID:    userID,
+		UserAgent: truncateString(client.UserAgent, 255),
+		IPAddress: truncateString(client.IPAddress, 45),
+		ExpiresAt: time.Now().Add(auth.RefreshTokenTTL),
+	}
+}
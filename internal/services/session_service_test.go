@@ -0,0 +1,112 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"anywebsites/internal/auth"
+	"anywebsites/internal/config"
+	"anywebsites/internal/database"
+	"anywebsites/internal/models"
+)
+
+// setupSessionTestDB 创建用户和会话表，返回测试用户
+func setupSessionTestDB(t *testing.T) *models.User {
+	db := useTestDB(t, &models.User{}, &models.UserSession{})
+	auth.InitJWT(&config.Config{JWT: config.JWTConfig{Secret: "test-secret"}})
+
+	user := &models.User{Username: "alice", Email: "alice@example.com", Password: "x", IsActive: true}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+	return user
+}
+
+func validateAccessToken(t *testing.T, service *SessionService, token string) error {
+	t.Helper()
+	claims, err := auth.ValidateToken(token)
+	if err != nil {
+		t.Fatalf("访问 Token 无效: %v", err)
+	}
+	_, err = service.Validate(claims)
+	return err
+}
+
+func TestSessionRotation(t *testing.T) {
+	user := setupSessionTestDB(t)
+	service := NewSessionService()
+
+	first, err := service.Create(user, SessionClient{UserAgent: "test", IPAddress: "203.0.113.1"})
+	if err != nil {
+		t.Fatalf("创建会话失败: %v", err)
+	}
+	if err := validateAccessToken(t, service, first.AccessToken); err != nil {
+		t.Fatalf("新会话的访问 Token 应该有效: %v", err)
+	}
+	if _, err := auth.ValidateToken(first.RefreshToken); err == nil {
+		t.Error("刷新 Token 不能当作访问 Token 使用")
+	}
+
+	_, second, err := service.Rotate(first.RefreshToken, SessionClient{})
+	if err != nil {
+		t.Fatalf("轮换失败: %v", err)
+	}
+	if second.RefreshToken == first.RefreshToken || second.SessionID == first.SessionID {
+		t.Error("轮换后应该签发新的刷新 Token")
+	}
+
+	// 已轮换的刷新 Token 再次使用时吊销整个会话
+	if _, _, err := service.Rotate(first.RefreshToken, SessionClient{}); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("期望 ErrRefreshTokenReused, 实际 %v", err)
+	}
+	if _, _, err := service.Rotate(second.RefreshToken, SessionClient{}); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("会话吊销后新的刷新 Token 也应失效, 实际 %v", err)
+	}
+	for _, token := range []string{first.AccessToken, second.AccessToken} {
+		if err := validateAccessToken(t, service, token); !errors.Is(err, ErrSessionRevoked) {
+			t.Errorf("会话吊销后访问 Token 应失效, 实际 %v", err)
+		}
+	}
+}
+
+func TestSessionRevocation(t *testing.T) {
+	user := setupSessionTestDB(t)
+	service := NewSessionService()
+
+	laptop, err := service.Create(user, SessionClient{})
+	if err != nil {
+		t.Fatalf("创建会话失败: %v", err)
+	}
+	phone, err := service.Create(user, SessionClient{})
+	if err != nil {
+		t.Fatalf("创建会话失败: %v", err)
+	}
+
+	// 保留当前会话，吊销其他会话
+	if revoked, err := service.RevokeOtherSessions(user.ID, laptop.SessionID); err != nil || revoked != 1 {
+		t.Fatalf("期望吊销 1 条记录, 实际 %d, %v", revoked, err)
+	}
+	if err := validateAccessToken(t, service, laptop.AccessToken); err != nil {
+		t.Errorf("当前会话应该保留: %v", err)
+	}
+	if err := validateAccessToken(t, service, phone.AccessToken); !errors.Is(err, ErrSessionRevoked) {
+		t.Errorf("其他会话应该被吊销, 实际 %v", err)
+	}
+
+	// 禁用用户后已有会话立即失效，刷新也会失败
+	database.DB.Model(user).Update("is_active", false)
+	if err := validateAccessToken(t, service, laptop.AccessToken); !errors.Is(err, ErrSessionRevoked) {
+		t.Errorf("禁用用户后访问 Token 应失效, 实际 %v", err)
+	}
+	if _, _, err := service.Rotate(laptop.RefreshToken, SessionClient{}); !errors.Is(err, ErrUserInactive) {
+		t.Errorf("禁用用户后刷新应失败, 实际 %v", err)
+	}
+
+	database.DB.Model(user).Update("is_active", true)
+	if err := service.Revoke(laptop.SessionID); err != nil {
+		t.Fatalf("退出登录失败: %v", err)
+	}
+	if err := validateAccessToken(t, service, laptop.AccessToken); !errors.Is(err, ErrSessionRevoked) {
+		t.Errorf("退出登录后访问 Token 应失效, 实际 %v", err)
+	}
+}
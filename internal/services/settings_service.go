@@ -1,7 +1,9 @@
 package services
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/url"
 	"sync"
 	"time"
 
@@ -416,6 +418,10 @@ func (s *SettingsService) validateSetting(category, key string, value interface{
 		return s.validateUploadSetting(key, value)
 	case "security":
 		return s.validateSecuritySetting(key, value)
+	case "analytics":
+		return s.validateAnalyticsSetting(key, value)
+	case "sso":
+		return s.validateSSOSetting(key, value)
 	}
 
 	return nil
@@ -486,6 +492,18 @@ func (s *SettingsService) validateUploadSetting(key string, value interface{}) e
 		if _, ok := value.(string); !ok {
 			return fmt.Errorf("upload path must be a string")
 		}
+	case "anonymous_enabled":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("anonymous_enabled must be a boolean")
+		}
+	case "anonymous_daily_quota", "anonymous_max_size":
+		if n, ok := value.(int); !ok || n < 0 {
+			return fmt.Errorf("%s must be a non-negative integer", key)
+		}
+	case "anonymous_expiry_hours":
+		if hours, ok := value.(int); !ok || hours < 1 || hours > 24*7 {
+			return fmt.Errorf("anonymous expiry must be between 1 and 168 hours")
+		}
 	}
 	return nil
 }
@@ -509,6 +527,87 @@ func (s *SettingsService) validateSecuritySetting(key string, value interface{})
 		} else {
 			return fmt.Errorf("rate limit requests must be an integer")
 		}
+	case "require_admin_2fa":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("require_admin_2fa must be a boolean")
+		}
+	}
+	return nil
+}
+
+// validateAnalyticsSetting 验证访问统计设置
+func (s *SettingsService) validateAnalyticsSetting(key string, value interface{}) error {
+	switch key {
+	case "raw_retention_days":
+		// 处理JSON解析时的float64类型
+		var days int
+		switch v := value.(type) {
+		case int:
+			days = v
+		case float64:
+			days = int(v)
+		default:
+			return fmt.Errorf("raw retention days must be an integer")
+		}
+		if days < 0 || days > 3650 {
+			return fmt.Errorf("raw retention days must be between 0 and 3650")
+		}
+	case "exclude_bots":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("exclude_bots must be a boolean")
+		}
+	}
+	return nil
+}
+
+// validateSSOSetting 验证单点登录设置
+func (s *SettingsService) validateSSOSetting(key string, value interface{}) error {
+	switch key {
+	case "oidc_enabled", "oidc_auto_provision":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s must be a boolean", key)
+		}
+	case "oidc_issuer", "oidc_redirect_url":
+		text, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s must be a string", key)
+		}
+		if text == "" {
+			return nil
+		}
+		parsed, err := url.Parse(text)
+		if err != nil || parsed.Host == "" || (parsed.Scheme != "https" && parsed.Scheme != "http") {
+			return fmt.Errorf("%s must be an absolute http(s) URL", key)
+		}
+	case "oidc_client_id", "oidc_client_secret", "oidc_scopes", "oidc_groups_claim", "oidc_admin_groups":
+		if _, ok := value.(string); !ok {
+			return fmt.Errorf("%s must be a string", key)
+		}
+	case "oidc_plan_groups":
+		// 可以是对象，也可以是对象的 JSON 字符串
+		var mapping map[string]string
+		switch v := value.(type) {
+		case string:
+			if err := json.Unmarshal([]byte(v), &mapping); err != nil {
+				return fmt.Errorf("oidc_plan_groups must be a JSON object of group to plan type")
+			}
+		case map[string]interface{}:
+			mapping = make(map[string]string, len(v))
+			for group, plan := range v {
+				planType, ok := plan.(string)
+				if !ok {
+					return fmt.Errorf("plan type for group %s must be a string", group)
+				}
+				mapping[group] = planType
+			}
+		default:
+			return fmt.Errorf("oidc_plan_groups must be a JSON object of group to plan type")
+		}
+		for group, plan := range mapping {
+			if _, ok := planRanks[models.PlanType(plan)]; !ok {
+				return fmt.Errorf("unknown plan type %q for group %s", plan, group)
+			}
+		}
 	}
 	return nil
 }
@@ -0,0 +1,219 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"anywebsites/internal/database"
+	"anywebsites/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// bytesPerMB 存储限制以 MB 配置，用量按字节统计
+const bytesPerMB = 1 << 20
+
+// StorageService 存储空间用量服务，用量只统计有效（未删除）的内容
+type StorageService struct {
+	planService *PlanService
+}
+
+// NewStorageService 创建存储用量服务实例
+func NewStorageService() *StorageService {
+	return &StorageService{
+		planService: NewPlanService(),
+	}
+}
+
+// UsedBytes 获取用户当前占用的存储空间（字节）
+func (s *StorageService) UsedBytes(userID uuid.UUID) (int64, error) {
+	return getStorageUsedBytes(database.DB, userID)
+}
+
+// CheckQuota 检查用户增加 deltaBytes 后是否超出计划的存储空间限制
+func (s *StorageService) CheckQuota(userID uuid.UUID, deltaBytes int64) error {
+	if deltaBytes <= 0 {
+		return nil
+	}
+	status, err := s.planService.CheckUsageLimits(userID)
+	if err != nil {
+		return fmt.Errorf("failed to check usage limits: %w", err)
+	}
+	return status.checkStorage(deltaBytes)
+}
+
+// Create 创建内容并计入所有者的上传数和存储用量，不检查计划限制（管理后台使用）
+func (s *StorageService) Create(content *models.Content) error {
+	content.FileSize = contentSize(content)
+
+	tx := database.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := saveContentRow(tx, content, true); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to create content: %w", err)
+	}
+
+	if err := updateUsageStatistics(tx, content.UserID, 1, content.FileSize, 0); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to update usage statistics: %w", err)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// LoadBody 读取内容正文（正文可能保存在 blob 存储中）
+func (s *StorageService) LoadBody(content *models.Content) error {
+	return loadBody(content)
+}
+
+// DeleteBodies 删除已硬删除内容在 blob 存储中的正文
+func (s *StorageService) DeleteBodies(contents []models.Content) {
+	deleteBodies(contents)
+}
+
+// SetContentsActive 批量删除或恢复内容，并相应扣减或计入所有者的存储用量，返回受影响的内容数
+func (s *StorageService) SetContentsActive(contentIDs []uuid.UUID, active bool) (int64, error) {
+	if len(contentIDs) == 0 {
+		return 0, nil
+	}
+	return setContentsActive(active, "id IN ?", contentIDs)
+}
+
+// Reconcile 根据 contents 表重新计算所有用户的存储用量，修正计数偏差，返回被修正的用户数
+func (s *StorageService) Reconcile() (int64, error) {
+	// 单页内容的大小以正文字节数为准（正文在 blob 存储中的内容在写入时已记录大小）
+	if err := database.DB.Exec(`
+		UPDATE contents SET file_size = octet_length(content)
+		WHERE COALESCE(file_path, '') = '' AND COALESCE(storage_key, '') = '' AND file_size <> octet_length(content)
+	`).Error; err != nil {
+		return 0, fmt.Errorf("failed to refresh content sizes: %w", err)
+	}
+
+	// 每条语句在数据库中原子执行，避免与并发上传交错时写回过期的合计值
+	upserted := database.DB.Exec(`
+		INSERT INTO storage_usages (user_id, used_bytes, updated_at)
+		SELECT user_id, SUM(file_size), NOW() FROM contents WHERE is_active = TRUE GROUP BY user_id
+		ON CONFLICT (user_id) DO UPDATE SET used_bytes = EXCLUDED.used_bytes, updated_at = NOW()
+		WHERE storage_usages.used_bytes <> EXCLUDED.used_bytes
+	`)
+	if upserted.Error != nil {
+		return 0, fmt.Errorf("failed to reconcile storage usage: %w", upserted.Error)
+	}
+
+	cleared := database.DB.Exec(`
+		UPDATE storage_usages SET used_bytes = 0, updated_at = NOW()
+		WHERE used_bytes <> 0 AND NOT EXISTS (
+			SELECT 1 FROM contents WHERE contents.user_id = storage_usages.user_id AND contents.is_active = TRUE
+		)
+	`)
+	if cleared.Error != nil {
+		return 0, fmt.Errorf("failed to reset storage usage: %w", cleared.Error)
+	}
+
+	// 同步当月使用统计中的存储快照
+	if err := database.DB.Exec(`
+		UPDATE usage_statistics SET storage_used_mb = (s.used_bytes + ?) / ?, updated_at = NOW()
+		FROM storage_usages s
+		WHERE usage_statistics.user_id = s.user_id AND usage_statistics.month_year = ?
+			AND usage_statistics.storage_used_mb <> (s.used_bytes + ?) / ?
+	`, bytesPerMB-1, bytesPerMB, models.GetCurrentMonthYear(), bytesPerMB-1, bytesPerMB).Error; err != nil {
+		return 0, fmt.Errorf("failed to sync usage statistics: %w", err)
+	}
+
+	return upserted.RowsAffected + cleared.RowsAffected, nil
+}
+
+// setContentsActive 修改满足条件的内容的启用状态，按所有者扣减（删除）或计入（恢复）存储用量
+func setContentsActive(active bool, query interface{}, args ...interface{}) (int64, error) {
+	tx := database.DB.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	// 锁定状态需要变化的内容，防止并发删除重复扣减
+	var contents []models.Content
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id", "user_id", "file_size").
+		Where(query, args...).
+		Where("is_active = ?", !active).
+		Find(&contents).Error; err != nil {
+		tx.Rollback()
+		return 0, fmt.Errorf("failed to find contents: %w", err)
+	}
+	if len(contents) == 0 {
+		tx.Rollback()
+		return 0, nil
+	}
+
+	ids := make([]uuid.UUID, len(contents))
+	totals := make(map[uuid.UUID]int64)
+	for i, content := range contents {
+		ids[i] = content.ID
+		totals[content.UserID] += content.FileSize
+	}
+
+	updates := map[string]interface{}{"is_active": active, "deleted_at": nil}
+	if !active {
+		updates["deleted_at"] = time.Now()
+	}
+	if err := tx.Model(&models.Content{}).Where("id IN ?", ids).Updates(updates).Error; err != nil {
+		tx.Rollback()
+		return 0, fmt.Errorf("failed to update contents: %w", err)
+	}
+
+	for userID, total := range totals {
+		delta := total
+		if !active {
+			delta = -total
+		}
+		if err := updateUsageStatistics(tx, userID, 0, delta, 0); err != nil {
+			tx.Rollback()
+			return 0, fmt.Errorf("failed to update usage statistics: %w", err)
+		}
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return int64(len(contents)), nil
+}
+
+// getStorageUsedBytes 读取用户的存储用量，没有记录时为 0
+func getStorageUsedBytes(db *gorm.DB, userID uuid.UUID) (int64, error) {
+	var usage models.StorageUsage
+	if err := db.Where("user_id = ?", userID).First(&usage).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to get storage usage: %w", err)
+	}
+	return usage.UsedBytes, nil
+}
+
+// contentSize 计算内容占用的字节数，站点包使用上传时记录的解压后大小
+func contentSize(content *models.Content) int64 {
+	if content.IsBundle() {
+		return content.FileSize
+	}
+	return int64(len(content.Content))
+}
+
+// bytesToMB 字节数换算为 MB，向上取整
+func bytesToMB(bytes int64) int64 {
+	return (bytes + bytesPerMB - 1) / bytesPerMB
+}
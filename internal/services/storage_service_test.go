@@ -0,0 +1,68 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"anywebsites/internal/models"
+)
+
+func TestBytesToMB(t *testing.T) {
+	tests := []struct {
+		bytes int64
+		want  int64
+	}{
+		{0, 0},
+		{1, 1},
+		{bytesPerMB, 1},
+		{bytesPerMB + 1, 2},
+		{10 * bytesPerMB, 10},
+	}
+
+	for _, tt := range tests {
+		if got := bytesToMB(tt.bytes); got != tt.want {
+			t.Errorf("bytesToMB(%d) = %d，期望 %d", tt.bytes, got, tt.want)
+		}
+	}
+}
+
+func TestContentSize(t *testing.T) {
+	page := &models.Content{Content: "<p>你好</p>"}
+	if got := contentSize(page); got != int64(len("<p>你好</p>")) {
+		t.Errorf("单页内容大小 = %d，期望按 UTF-8 字节数计算", got)
+	}
+
+	bundle := &models.Content{FilePath: "/uploads/bundles/x", FileSize: 4096}
+	if got := contentSize(bundle); got != 4096 {
+		t.Errorf("站点包大小 = %d，期望使用 FileSize 4096", got)
+	}
+}
+
+func TestUsageLimitStatus_CheckStorage(t *testing.T) {
+	status := &UsageLimitStatus{
+		PlanType:         models.PlanCommunity,
+		StorageLimitMB:   1,
+		StorageUsedBytes: bytesPerMB - 100,
+	}
+
+	if err := status.checkStorage(100); err != nil {
+		t.Errorf("刚好用满限制时不应拒绝: %v", err)
+	}
+	if err := status.checkStorage(101); !errors.Is(err, ErrStorageLimitExceeded) {
+		t.Errorf("超出限制时应返回 ErrStorageLimitExceeded，实际 %v", err)
+	}
+	if err := status.checkStorage(-500); err != nil {
+		t.Errorf("内容变小时不应拒绝: %v", err)
+	}
+
+	status.StorageLimitMB = -1
+	if err := status.checkStorage(10 * bytesPerMB); err != nil {
+		t.Errorf("无限制计划不应拒绝: %v", err)
+	}
+
+	status.StorageLimitMB = 1
+	status.PlanType = models.PlanEnterprise
+	if err := status.checkStorage(10 * bytesPerMB); err != nil {
+		t.Errorf("企业版不应拒绝: %v", err)
+	}
+}
@@ -0,0 +1,34 @@
+package services
+
+import (
+	"testing"
+
+	"anywebsites/internal/database"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// userSubscriptionsTable 订阅表的默认值使用了 PostgreSQL 函数，测试中手动建表
+const userSubscriptionsTable = `CREATE TABLE user_subscriptions (id TEXT PRIMARY KEY, user_id TEXT NOT NULL, plan_type TEXT NOT NULL,
+	status TEXT NOT NULL, started_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP, expires_at DATETIME,
+	auto_renew BOOLEAN NOT NULL DEFAULT FALSE, payment_method TEXT, created_at DATETIME, updated_at DATETIME)`
+
+// useTestDB 使用内存数据库替换全局数据库连接，迁移给定的模型，测试结束后恢复
+func useTestDB(t *testing.T, models ...interface{}) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	if len(models) > 0 {
+		if err := db.AutoMigrate(models...); err != nil {
+			t.Fatalf("迁移表结构失败: %v", err)
+		}
+	}
+
+	previous := database.DB
+	database.DB = db
+	t.Cleanup(func() { database.DB = previous })
+	return db
+}
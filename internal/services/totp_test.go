@@ -0,0 +1,71 @@
+package services
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret RFC 6238 附录 B 中 SHA-1 测试向量的密钥 "12345678901234567890"
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	// 附录 B 的 8 位验证码取后 6 位
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		code, err := totpCode(rfc6238Secret, totpStep(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("计算验证码失败: %v", err)
+		}
+		if code != tt.code {
+			t.Errorf("T=%d 验证码 = %s，期望 %s", tt.unix, code, tt.code)
+		}
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := totpStep(now)
+
+	previous, _ := totpCode(rfc6238Secret, step-1)
+	if matched, ok := verifyTOTP(rfc6238Secret, previous, now, 0); !ok || matched != step-1 {
+		t.Errorf("上一个时间步的验证码应该通过, 实际 %d %v", matched, ok)
+	}
+
+	// 已使用过的时间步不能再次通过
+	if _, ok := verifyTOTP(rfc6238Secret, previous, now, step-1); ok {
+		t.Error("已使用的验证码不应再次通过")
+	}
+
+	expired, _ := totpCode(rfc6238Secret, step-2)
+	if _, ok := verifyTOTP(rfc6238Secret, expired, now, 0); ok {
+		t.Error("超出时钟偏差的验证码不应通过")
+	}
+	if _, ok := verifyTOTP(rfc6238Secret, "12345", now, 0); ok {
+		t.Error("位数不对的验证码不应通过")
+	}
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	uri, err := url.Parse(totpProvisioningURI("AnyWebsites", "alice@example.com", rfc6238Secret))
+	if err != nil {
+		t.Fatalf("URI 无法解析: %v", err)
+	}
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/AnyWebsites:alice@example.com" {
+		t.Errorf("URI 格式不正确: %s", uri)
+	}
+	query := uri.Query()
+	if query.Get("secret") != rfc6238Secret || query.Get("issuer") != "AnyWebsites" || query.Get("digits") != "6" {
+		t.Errorf("URI 参数不正确: %s", uri.RawQuery)
+	}
+}
@@ -0,0 +1,591 @@
+package services
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"anywebsites/internal/auth"
+	"anywebsites/internal/database"
+	"anywebsites/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// 两步验证参数
+const (
+	totpIssuer           = "AnyWebsites" // 验证器应用中显示的服务名称
+	recoveryCodeCount    = 10
+	maxTwoFactorFailures = 5               // 连续输错验证码达到该次数后锁定
+	twoFactorLockout     = 5 * time.Minute // 首次锁定时长，之后每次输错翻倍
+	maxTwoFactorLockout  = 24 * time.Hour  // 锁定时长上限
+)
+
+var (
+	// ErrTwoFactorNotEnabled 用户未启用两步验证
+	ErrTwoFactorNotEnabled = errors.New("two-factor authentication is not enabled")
+	// ErrTwoFactorAlreadyEnabled 用户已启用两步验证
+	ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	// ErrTwoFactorNotSetUp 启用前没有先生成密钥
+	ErrTwoFactorNotSetUp = errors.New("two-factor setup has not been started")
+	// ErrTwoFactorMandatory 系统要求管理员必须启用两步验证
+	ErrTwoFactorMandatory = errors.New("two-factor authentication is mandatory for administrators")
+	// ErrInvalidPassword 关闭两步验证时密码不正确
+	ErrInvalidPassword = errors.New("invalid password")
+	// ErrInvalidTwoFactorCode 验证码或恢复码不正确、已使用
+	ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+	// ErrInvalidChallenge 登录挑战无效、已过期或已完成
+	ErrInvalidChallenge = errors.New("invalid or expired two-factor challenge")
+	// ErrTooManyAttempts 连续输错验证码次数过多，账户的两步验证暂时锁定
+	ErrTooManyAttempts = errors.New("too many invalid two-factor codes, please try again later")
+)
+
+// TwoFactorSetup 启用两步验证前返回的密钥，URI 用于生成二维码，密钥用于手动输入
+type TwoFactorSetup struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+// TwoFactorStatus 用户的两步验证状态
+type TwoFactorStatus struct {
+	Enabled                bool  `json:"enabled"`
+	Mandatory              bool  `json:"mandatory"` // 管理员被强制启用，不能关闭
+	RecoveryCodesRemaining int64 `json:"recovery_codes_remaining"`
+}
+
+// TwoFactorChallenge 密码验证通过后返回的第二步登录挑战
+type TwoFactorChallenge struct {
+	MFARequired        bool   `json:"mfa_required"`
+	MFAToken           string `json:"mfa_token"`
+	EnrollmentRequired bool   `json:"mfa_enrollment_required"` // 需要先绑定验证器
+	ExpiresIn          int    `json:"expires_in"`
+}
+
+// challengeState 登录挑战的状态，挑战完成后不能再次使用
+type challengeState struct {
+	completed bool
+	expiresAt time.Time
+}
+
+// TwoFactorService 两步验证服务：TOTP 绑定、恢复码和登录的第二步
+// 输错次数按用户记录在数据库中，重新登录或换一个实例都不会清零；TOTP 密钥加密保存
+type TwoFactorService struct {
+	settingsService *SettingsService
+	kek             *auth.KeyEncryptionKey // 加密数据库中的 TOTP 密钥
+
+	mutex      sync.Mutex
+	challenges map[string]*challengeState // 按挑战 Token 的 jti 索引
+}
+
+// NewTwoFactorService 创建两步验证服务，settingsService 为空时不强制管理员启用
+func NewTwoFactorService(settingsService *SettingsService, kek *auth.KeyEncryptionKey) *TwoFactorService {
+	return &TwoFactorService{
+		settingsService: settingsService,
+		kek:             kek,
+		challenges:      make(map[string]*challengeState),
+	}
+}
+
+// totpSecretKeyID 加密 TOTP 密钥时的附加数据，密文不能挪到其他用户上使用
+func totpSecretKeyID(userID uuid.UUID) string {
+	return "totp:" + userID.String()
+}
+
+// secret 解密用户保存的 TOTP 密钥，加密前保存的明文原样返回
+func (s *TwoFactorService) secret(user *models.User) (string, error) {
+	secret, err := s.kek.Decrypt(totpSecretKeyID(user.ID), user.TOTPSecret)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt TOTP secret: %w", err)
+	}
+	return secret, nil
+}
+
+// EncryptLegacySecrets 加密启用 TOTP 密钥加密之前保存的明文密钥
+// 只更新仍为明文的记录，多个实例同时启动时不会互相覆盖
+func (s *TwoFactorService) EncryptLegacySecrets() error {
+	var users []models.User
+	if err := database.DB.Select("id", "totp_secret").Where("totp_secret <> ''").Find(&users).Error; err != nil {
+		return fmt.Errorf("failed to find TOTP secrets: %w", err)
+	}
+
+	encryptedCount := 0
+	for _, user := range users {
+		if auth.IsEncryptedKey(user.TOTPSecret) {
+			continue
+		}
+		encrypted, err := s.kek.Encrypt(totpSecretKeyID(user.ID), user.TOTPSecret)
+		if err != nil {
+			return fmt.Errorf("failed to encrypt TOTP secret: %w", err)
+		}
+		if err := database.DB.Model(&models.User{}).
+			Where("id = ? AND totp_secret = ?", user.ID, user.TOTPSecret).
+			Update("totp_secret", encrypted).Error; err != nil {
+			return fmt.Errorf("failed to encrypt TOTP secret: %w", err)
+		}
+		encryptedCount++
+	}
+	if encryptedCount > 0 {
+		log.Printf("Encrypted %d TOTP secrets", encryptedCount)
+	}
+	return nil
+}
+
+// mandatoryFor 检查系统设置是否要求该用户启用两步验证
+func (s *TwoFactorService) mandatoryFor(user *models.User) bool {
+	if !user.IsAdmin || s.settingsService == nil {
+		return false
+	}
+	return s.settingsService.GetBoolValue("security", "require_admin_2fa", false)
+}
+
+// Required 检查用户登录时是否需要第二步：已启用两步验证，或者是被强制启用的管理员
+func (s *TwoFactorService) Required(user *models.User) bool {
+	return user.TOTPEnabled || s.mandatoryFor(user)
+}
+
+// Status 获取用户的两步验证状态
+func (s *TwoFactorService) Status(user *models.User) (*TwoFactorStatus, error) {
+	status := &TwoFactorStatus{Enabled: user.TOTPEnabled, Mandatory: s.mandatoryFor(user)}
+	if !user.TOTPEnabled {
+		return status, nil
+	}
+	if err := database.DB.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", user.ID).
+		Count(&status.RecoveryCodesRemaining).Error; err != nil {
+		return nil, fmt.Errorf("failed to count recovery codes: %w", err)
+	}
+	return status, nil
+}
+
+// Setup 生成新的 TOTP 密钥，用户用验证码确认后才会启用
+func (s *TwoFactorService) Setup(user *models.User) (*TwoFactorSetup, error) {
+	if user.TOTPEnabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	encrypted, err := s.kek.Encrypt(totpSecretKeyID(user.ID), secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt TOTP secret: %w", err)
+	}
+	if err := database.DB.Model(user).Update("totp_secret", encrypted).Error; err != nil {
+		return nil, fmt.Errorf("failed to save TOTP secret: %w", err)
+	}
+	user.TOTPSecret = encrypted
+
+	return newTwoFactorSetup(user.Username, secret), nil
+}
+
+// PendingSetup 返回已生成但尚未确认的密钥，没有或无法解密时返回 nil
+func (s *TwoFactorService) PendingSetup(user *models.User) *TwoFactorSetup {
+	if user.TOTPEnabled || user.TOTPSecret == "" {
+		return nil
+	}
+	secret, err := s.secret(user)
+	if err != nil {
+		log.Printf("Failed to load pending TOTP secret of user %s: %v", user.ID, err)
+		return nil
+	}
+	return newTwoFactorSetup(user.Username, secret)
+}
+
+func newTwoFactorSetup(username, secret string) *TwoFactorSetup {
+	return &TwoFactorSetup{
+		Secret: secret,
+		URI:    totpProvisioningURI(totpIssuer, username, secret),
+	}
+}
+
+// Enable 使用验证器生成的验证码确认密钥并启用两步验证，返回新的恢复码明文
+func (s *TwoFactorService) Enable(user *models.User, code string) ([]string, error) {
+	if user.TOTPEnabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrTwoFactorNotSetUp
+	}
+	if err := s.checkLockout(user); err != nil {
+		return nil, err
+	}
+
+	secret, err := s.secret(user)
+	if err != nil {
+		return nil, err
+	}
+	step, ok := verifyTOTP(secret, normalizeTwoFactorCode(code), time.Now(), user.TOTPLastStep)
+	if !ok {
+		return nil, s.recordFailure(user)
+	}
+
+	var codes []string
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.User{}).
+			Where("id = ? AND totp_enabled = ?", user.ID, false).
+			Updates(map[string]interface{}{
+				"totp_enabled":         true,
+				"totp_last_step":       step,
+				"totp_failed_attempts": 0,
+				"totp_locked_until":    nil,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrTwoFactorAlreadyEnabled
+		}
+
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		if errors.Is(err, ErrTwoFactorAlreadyEnabled) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to enable two-factor authentication: %w", err)
+	}
+
+	user.TOTPEnabled = true
+	user.TOTPLastStep = step
+	user.TOTPFailedAttempts = 0
+	user.TOTPLockedUntil = nil
+	return codes, nil
+}
+
+// Disable 关闭两步验证，需要当前密码和验证码（或恢复码），被强制启用的管理员不能关闭
+func (s *TwoFactorService) Disable(user *models.User, password, code string) error {
+	if !user.TOTPEnabled {
+		return ErrTwoFactorNotEnabled
+	}
+	if s.mandatoryFor(user) {
+		return ErrTwoFactorMandatory
+	}
+	if !auth.CheckPassword(password, user.Password) {
+		return ErrInvalidPassword
+	}
+	if err := s.Verify(user, code); err != nil {
+		return err
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Updates(map[string]interface{}{
+			"totp_secret":    "",
+			"totp_enabled":   false,
+			"totp_last_step": 0,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("failed to disable two-factor authentication: %w", err)
+	}
+	return nil
+}
+
+// RegenerateRecoveryCodes 验证后生成新的恢复码，旧的恢复码全部作废
+func (s *TwoFactorService) RegenerateRecoveryCodes(user *models.User, code string) ([]string, error) {
+	if err := s.Verify(user, code); err != nil {
+		return nil, err
+	}
+
+	var codes []string
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to regenerate recovery codes: %w", err)
+	}
+	return codes, nil
+}
+
+// Verify 校验 TOTP 验证码或恢复码，两者都只能使用一次
+// 登录、关闭两步验证和重新生成恢复码共用同一个输错计数，锁定期间直接拒绝
+func (s *TwoFactorService) Verify(user *models.User, code string) error {
+	if !user.TOTPEnabled {
+		return ErrTwoFactorNotEnabled
+	}
+	if err := s.checkLockout(user); err != nil {
+		return err
+	}
+
+	err := s.verifyCode(user, code)
+	if errors.Is(err, ErrInvalidTwoFactorCode) {
+		return s.recordFailure(user)
+	}
+	if err != nil {
+		return err
+	}
+	return s.resetFailures(user)
+}
+
+// verifyCode 校验并消耗 TOTP 验证码或恢复码
+func (s *TwoFactorService) verifyCode(user *models.User, code string) error {
+	code = normalizeTwoFactorCode(code)
+	if len(code) == totpDigits {
+		secret, err := s.secret(user)
+		if err != nil {
+			return err
+		}
+		step, ok := verifyTOTP(secret, code, time.Now(), user.TOTPLastStep)
+		if !ok {
+			return ErrInvalidTwoFactorCode
+		}
+		// 条件更新，并发请求中同一验证码只有一个能通过
+		result := database.DB.Model(&models.User{}).
+			Where("id = ? AND totp_last_step < ?", user.ID, step).
+			Update("totp_last_step", step)
+		if result.Error != nil {
+			return fmt.Errorf("failed to record TOTP step: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidTwoFactorCode
+		}
+		user.TOTPLastStep = step
+		return nil
+	}
+
+	result := database.DB.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, hashAPIKey(code)).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return fmt.Errorf("failed to use recovery code: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// checkLockout 检查用户的两步验证是否因连续输错而锁定
+func (s *TwoFactorService) checkLockout(user *models.User) error {
+	if user.TOTPLockedUntil != nil && time.Now().Before(*user.TOTPLockedUntil) {
+		return ErrTooManyAttempts
+	}
+	return nil
+}
+
+// recordFailure 累加用户连续输错的次数，达到上限后锁定，之后每次输错锁定时长翻倍
+// 返回本次校验应返回的错误
+func (s *TwoFactorService) recordFailure(user *models.User) error {
+	// 原子累加，并发的错误请求不会少计
+	result := database.DB.Model(&models.User{}).
+		Where("id = ?", user.ID).
+		UpdateColumn("totp_failed_attempts", gorm.Expr("totp_failed_attempts + 1"))
+	if result.Error != nil {
+		return fmt.Errorf("failed to record two-factor failure: %w", result.Error)
+	}
+
+	var failures int
+	if err := database.DB.Model(&models.User{}).
+		Where("id = ?", user.ID).
+		Select("totp_failed_attempts").
+		Scan(&failures).Error; err != nil {
+		return fmt.Errorf("failed to record two-factor failure: %w", err)
+	}
+	user.TOTPFailedAttempts = failures
+	if failures < maxTwoFactorFailures {
+		return ErrInvalidTwoFactorCode
+	}
+
+	lockedUntil := time.Now().Add(twoFactorLockoutFor(failures))
+	if err := database.DB.Model(&models.User{}).
+		Where("id = ?", user.ID).
+		UpdateColumn("totp_locked_until", lockedUntil).Error; err != nil {
+		return fmt.Errorf("failed to lock two-factor authentication: %w", err)
+	}
+	user.TOTPLockedUntil = &lockedUntil
+	return ErrTooManyAttempts
+}
+
+// resetFailures 验证通过后清零输错次数
+func (s *TwoFactorService) resetFailures(user *models.User) error {
+	if user.TOTPFailedAttempts == 0 && user.TOTPLockedUntil == nil {
+		return nil
+	}
+	if err := database.DB.Model(&models.User{}).
+		Where("id = ?", user.ID).
+		UpdateColumns(map[string]interface{}{"totp_failed_attempts": 0, "totp_locked_until": nil}).Error; err != nil {
+		return fmt.Errorf("failed to reset two-factor failures: %w", err)
+	}
+	user.TOTPFailedAttempts = 0
+	user.TOTPLockedUntil = nil
+	return nil
+}
+
+// twoFactorLockoutFor 连续输错 failures 次后的锁定时长
+func twoFactorLockoutFor(failures int) time.Duration {
+	lockout := twoFactorLockout
+	for i := maxTwoFactorFailures; i < failures && lockout < maxTwoFactorLockout; i++ {
+		lockout *= 2
+	}
+	if lockout > maxTwoFactorLockout {
+		lockout = maxTwoFactorLockout
+	}
+	return lockout
+}
+
+// CreateChallenge 为通过密码验证的用户签发登录挑战
+func (s *TwoFactorService) CreateChallenge(user *models.User) (*TwoFactorChallenge, error) {
+	token, err := auth.GenerateChallengeToken(user.ID, uuid.New())
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate challenge token: %w", err)
+	}
+
+	return &TwoFactorChallenge{
+		MFARequired:        true,
+		MFAToken:           token,
+		EnrollmentRequired: !user.TOTPEnabled,
+		ExpiresIn:          int(auth.ChallengeTokenTTL.Seconds()),
+	}, nil
+}
+
+// ChallengeUser 返回登录挑战对应的用户
+func (s *TwoFactorService) ChallengeUser(token string) (*models.User, error) {
+	claims, err := auth.ValidateChallengeToken(token)
+	if err != nil {
+		return nil, ErrInvalidChallenge
+	}
+	return s.challengeUser(claims)
+}
+
+func (s *TwoFactorService) challengeUser(claims *auth.Claims) (*models.User, error) {
+	var user models.User
+	if err := database.DB.Where("id = ? AND is_active = ?", claims.UserID, true).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidChallenge
+		}
+		return nil, fmt.Errorf("database error: %w", err)
+	}
+	return &user, nil
+}
+
+// ChallengeSetup 被强制启用两步验证的用户在登录过程中绑定验证器
+// 已有未确认的密钥时继续使用，刷新页面不会让已扫描的二维码失效
+func (s *TwoFactorService) ChallengeSetup(token string) (*TwoFactorSetup, error) {
+	user, err := s.ChallengeUser(token)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	if setup := s.PendingSetup(user); setup != nil {
+		return setup, nil
+	}
+	return s.Setup(user)
+}
+
+// CompleteChallenge 校验登录挑战的验证码，成功后返回用户
+// 登录过程中首次绑定验证器时同时启用两步验证，并返回新的恢复码
+// 输错次数记在用户上，重新输入密码获取新的挑战不会增加可尝试的次数
+func (s *TwoFactorService) CompleteChallenge(token, code string) (*models.User, []string, error) {
+	claims, err := auth.ValidateChallengeToken(token)
+	if err != nil {
+		return nil, nil, ErrInvalidChallenge
+	}
+	if err := s.checkChallenge(claims); err != nil {
+		return nil, nil, err
+	}
+
+	user, err := s.challengeUser(claims)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var codes []string
+	switch {
+	case user.TOTPEnabled:
+		err = s.Verify(user, code)
+	case s.mandatoryFor(user):
+		codes, err = s.Enable(user, code)
+	default:
+		// 签发挑战之后关闭了强制设置，重新登录即可
+		err = ErrInvalidChallenge
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	s.completeChallenge(claims.ID)
+	return user, codes, nil
+}
+
+// checkChallenge 检查登录挑战是否已完成
+func (s *TwoFactorService) checkChallenge(claims *auth.Claims) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	for id, state := range s.challenges {
+		if now.After(state.expiresAt) {
+			delete(s.challenges, id)
+		}
+	}
+
+	state, ok := s.challenges[claims.ID]
+	if !ok {
+		state = &challengeState{expiresAt: claims.ExpiresAt.Time}
+		s.challenges[claims.ID] = state
+	}
+	if state.completed {
+		return ErrInvalidChallenge
+	}
+	return nil
+}
+
+func (s *TwoFactorService) completeChallenge(challengeID string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if state, ok := s.challenges[challengeID]; ok {
+		state.completed = true
+	}
+}
+
+// replaceRecoveryCodes 删除用户的旧恢复码并生成新的一组，只保存哈希
+func replaceRecoveryCodes(tx *gorm.DB, userID uuid.UUID) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	records := make([]models.RecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+		records = append(records, models.RecoveryCode{UserID: userID, CodeHash: hashAPIKey(normalizeTwoFactorCode(code))})
+	}
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// generateRecoveryCode 生成 xxxxx-xxxxx 格式的恢复码
+func generateRecoveryCode() (string, error) {
+	bytes := make([]byte, 7)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", fmt.Errorf("failed to generate recovery code: %w", err)
+	}
+	code := strings.ToLower(totpEncoding.EncodeToString(bytes))[:10]
+	return code[:5] + "-" + code[5:], nil
+}
+
+// normalizeTwoFactorCode 去掉用户输入中的空格和连字符，恢复码不区分大小写
+func normalizeTwoFactorCode(code string) string {
+	code = strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(code))
+	return strings.ToLower(code)
+}
@@ -0,0 +1,268 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"anywebsites/internal/auth"
+	"anywebsites/internal/config"
+	"anywebsites/internal/database"
+	"anywebsites/internal/models"
+)
+
+// setupTwoFactorTestDB 创建用户和恢复码表，返回密码为 password 的测试用户
+func setupTwoFactorTestDB(t *testing.T, isAdmin bool) *models.User {
+	db := useTestDB(t, &models.User{}, &models.RecoveryCode{})
+	auth.InitJWT(&config.Config{JWT: config.JWTConfig{Secret: "test-secret"}})
+
+	password, err := auth.HashPassword("password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &models.User{Username: "alice", Email: "alice@example.com", Password: password, IsActive: true, IsAdmin: isAdmin}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatalf("创建用户失败: %v", err)
+	}
+	return user
+}
+
+// requireAdminTwoFactor 返回已缓存 security.require_admin_2fa 设置的设置服务
+func requireAdminTwoFactor(enabled bool) *SettingsService {
+	value := "false"
+	if enabled {
+		value = "true"
+	}
+	return &SettingsService{
+		cache: map[string]*models.SystemSetting{
+			"security.require_admin_2fa": {Category: "security", Key: "require_admin_2fa", Value: value, ValueType: "boolean"},
+		},
+		cacheExpiry: time.Hour,
+		lastUpdate:  time.Now(),
+	}
+}
+
+// testTOTPKeyEncryptionKey 测试用的 TOTP 密钥加密密钥
+func testTOTPKeyEncryptionKey(t *testing.T) *auth.KeyEncryptionKey {
+	t.Helper()
+	kek, err := auth.ParseKeyEncryptionKey(testKeyEncryptionKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kek
+}
+
+// currentTOTPCode 计算当前时间步之后 offset 个时间步的验证码
+func currentTOTPCode(t *testing.T, secret string, offset int64) string {
+	t.Helper()
+	code, err := totpCode(secret, totpStep(time.Now())+offset)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+func TestTwoFactorEnrollment(t *testing.T) {
+	user := setupTwoFactorTestDB(t, false)
+	service := NewTwoFactorService(nil, testTOTPKeyEncryptionKey(t))
+
+	if service.Required(user) {
+		t.Fatal("未启用两步验证的普通用户不需要第二步")
+	}
+
+	setup, err := service.Setup(user)
+	if err != nil {
+		t.Fatalf("生成密钥失败: %v", err)
+	}
+	if !strings.HasPrefix(setup.URI, "otpauth://totp/") || !strings.Contains(setup.URI, setup.Secret) {
+		t.Errorf("URI 格式不正确: %s", setup.URI)
+	}
+	if _, err := service.Enable(user, "abcdef"); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Errorf("错误的验证码不能启用, 实际 %v", err)
+	}
+
+	code := currentTOTPCode(t, setup.Secret, 0)
+	recoveryCodes, err := service.Enable(user, code)
+	if err != nil {
+		t.Fatalf("启用失败: %v", err)
+	}
+	if len(recoveryCodes) != recoveryCodeCount {
+		t.Errorf("应生成 %d 个恢复码, 实际 %d", recoveryCodeCount, len(recoveryCodes))
+	}
+	if !service.Required(user) {
+		t.Error("启用后登录需要第二步")
+	}
+
+	// 启用时使用的验证码不能再用于登录，下一个时间步的验证码可以
+	if err := service.Verify(user, code); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Errorf("同一验证码不能重复使用, 实际 %v", err)
+	}
+	if err := service.Verify(user, currentTOTPCode(t, setup.Secret, 1)); err != nil {
+		t.Errorf("新的验证码应该通过: %v", err)
+	}
+
+	// 恢复码不区分大小写，只能使用一次
+	if err := service.Verify(user, strings.ToUpper(recoveryCodes[0])); err != nil {
+		t.Errorf("恢复码应该通过: %v", err)
+	}
+	if err := service.Verify(user, recoveryCodes[0]); !errors.Is(err, ErrInvalidTwoFactorCode) {
+		t.Errorf("恢复码不能重复使用, 实际 %v", err)
+	}
+	status, err := service.Status(user)
+	if err != nil || status.RecoveryCodesRemaining != recoveryCodeCount-1 {
+		t.Errorf("剩余恢复码应为 %d, 实际 %+v, %v", recoveryCodeCount-1, status, err)
+	}
+
+	if err := service.Disable(user, "wrong", recoveryCodes[1]); !errors.Is(err, ErrInvalidPassword) {
+		t.Errorf("密码错误时不能关闭, 实际 %v", err)
+	}
+	if err := service.Disable(user, "password", recoveryCodes[1]); err != nil {
+		t.Fatalf("关闭失败: %v", err)
+	}
+	var count int64
+	database.DB.Model(&models.RecoveryCode{}).Count(&count)
+	if count != 0 {
+		t.Errorf("关闭后恢复码应被删除, 剩余 %d", count)
+	}
+}
+
+func TestTwoFactorChallenge(t *testing.T) {
+	admin := setupTwoFactorTestDB(t, true)
+	service := NewTwoFactorService(requireAdminTwoFactor(true), testTOTPKeyEncryptionKey(t))
+
+	if !service.Required(admin) {
+		t.Fatal("强制启用时管理员登录需要第二步")
+	}
+	challenge, err := service.CreateChallenge(admin)
+	if err != nil {
+		t.Fatalf("签发挑战失败: %v", err)
+	}
+	if !challenge.EnrollmentRequired {
+		t.Error("未绑定验证器的管理员需要在登录中绑定")
+	}
+	if _, err := auth.ValidateToken(challenge.MFAToken); err == nil {
+		t.Error("挑战 Token 不能当作访问 Token 使用")
+	}
+
+	setup, err := service.ChallengeSetup(challenge.MFAToken)
+	if err != nil {
+		t.Fatalf("获取密钥失败: %v", err)
+	}
+	if again, err := service.ChallengeSetup(challenge.MFAToken); err != nil || again.Secret != setup.Secret {
+		t.Errorf("刷新页面不应更换未确认的密钥, %v", err)
+	}
+
+	// 连续输错后锁定用户，重新登录获取新的挑战也不能继续尝试
+	for i := 1; i < maxTwoFactorFailures; i++ {
+		if _, _, err := service.CompleteChallenge(challenge.MFAToken, "abcdef"); !errors.Is(err, ErrInvalidTwoFactorCode) {
+			t.Fatalf("期望 ErrInvalidTwoFactorCode, 实际 %v", err)
+		}
+	}
+	if _, _, err := service.CompleteChallenge(challenge.MFAToken, "abcdef"); !errors.Is(err, ErrTooManyAttempts) {
+		t.Fatalf("第 %d 次输错后应锁定, 实际 %v", maxTwoFactorFailures, err)
+	}
+	challenge, err = service.CreateChallenge(admin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := currentTOTPCode(t, setup.Secret, 0)
+	if _, _, err := service.CompleteChallenge(challenge.MFAToken, code); !errors.Is(err, ErrTooManyAttempts) {
+		t.Fatalf("锁定期间新的挑战也应拒绝, 实际 %v", err)
+	}
+
+	// 锁定到期后使用正确的验证码完成绑定并返回恢复码，输错次数清零
+	if err := database.DB.Model(&models.User{}).Where("id = ?", admin.ID).
+		Update("totp_locked_until", time.Now().Add(-time.Second)).Error; err != nil {
+		t.Fatal(err)
+	}
+	user, recoveryCodes, err := service.CompleteChallenge(challenge.MFAToken, code)
+	if err != nil {
+		t.Fatalf("完成挑战失败: %v", err)
+	}
+	if user.ID != admin.ID || !user.TOTPEnabled || len(recoveryCodes) != recoveryCodeCount {
+		t.Errorf("登录中绑定后应启用两步验证并返回恢复码, 实际 %v %d", user.TOTPEnabled, len(recoveryCodes))
+	}
+	var stored models.User
+	database.DB.First(&stored, "id = ?", admin.ID)
+	if stored.TOTPFailedAttempts != 0 || stored.TOTPLockedUntil != nil {
+		t.Errorf("验证通过后应清零输错次数, 实际 %d %v", stored.TOTPFailedAttempts, stored.TOTPLockedUntil)
+	}
+	if _, _, err := service.CompleteChallenge(challenge.MFAToken, recoveryCodes[0]); !errors.Is(err, ErrInvalidChallenge) {
+		t.Errorf("已完成的挑战不能再次使用, 实际 %v", err)
+	}
+
+	if err := service.Disable(user, "password", recoveryCodes[0]); !errors.Is(err, ErrTwoFactorMandatory) {
+		t.Errorf("强制启用时管理员不能关闭, 实际 %v", err)
+	}
+}
+
+func TestTwoFactorLockoutAcrossOperations(t *testing.T) {
+	user := setupTwoFactorTestDB(t, false)
+	service := NewTwoFactorService(nil, testTOTPKeyEncryptionKey(t))
+
+	setup, err := service.Setup(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.Enable(user, currentTOTPCode(t, setup.Secret, 0)); err != nil {
+		t.Fatalf("启用失败: %v", err)
+	}
+
+	// 关闭两步验证和重新生成恢复码与登录共用输错计数
+	for i := 1; i < maxTwoFactorFailures; i++ {
+		if _, err := service.RegenerateRecoveryCodes(user, "abcdef"); !errors.Is(err, ErrInvalidTwoFactorCode) {
+			t.Fatalf("期望 ErrInvalidTwoFactorCode, 实际 %v", err)
+		}
+	}
+	if err := service.Disable(user, "password", "abcdef"); !errors.Is(err, ErrTooManyAttempts) {
+		t.Fatalf("第 %d 次输错后应锁定, 实际 %v", maxTwoFactorFailures, err)
+	}
+	if err := service.Disable(user, "password", currentTOTPCode(t, setup.Secret, 1)); !errors.Is(err, ErrTooManyAttempts) {
+		t.Errorf("锁定期间正确的验证码也应拒绝, 实际 %v", err)
+	}
+
+	var stored models.User
+	database.DB.First(&stored, "id = ?", user.ID)
+	if stored.TOTPLockedUntil == nil || time.Until(*stored.TOTPLockedUntil) <= twoFactorLockout-time.Minute {
+		t.Errorf("锁定时间应保存在数据库中, 实际 %v", stored.TOTPLockedUntil)
+	}
+
+	if got := twoFactorLockoutFor(maxTwoFactorFailures + 2); got != 4*twoFactorLockout {
+		t.Errorf("锁定后每次输错时长应翻倍, 实际 %v", got)
+	}
+	if got := twoFactorLockoutFor(100); got != maxTwoFactorLockout {
+		t.Errorf("锁定时长不应超过上限, 实际 %v", got)
+	}
+}
+
+func TestTwoFactorSecretEncryption(t *testing.T) {
+	user := setupTwoFactorTestDB(t, false)
+	service := NewTwoFactorService(nil, testTOTPKeyEncryptionKey(t))
+
+	setup, err := service.Setup(user)
+	if err != nil {
+		t.Fatalf("生成密钥失败: %v", err)
+	}
+	var stored models.User
+	database.DB.First(&stored, "id = ?", user.ID)
+	if !auth.IsEncryptedKey(stored.TOTPSecret) || strings.Contains(stored.TOTPSecret, setup.Secret) {
+		t.Fatalf("保存的 TOTP 密钥应该是密文: %s", stored.TOTPSecret)
+	}
+	if pending := service.PendingSetup(&stored); pending == nil || pending.Secret != setup.Secret {
+		t.Errorf("未确认的密钥应解密后返回, 实际 %+v", pending)
+	}
+
+	// 加密前保存的明文密钥在启动时加密，加密后仍可校验
+	database.DB.Model(&models.User{}).Where("id = ?", user.ID).Update("totp_secret", setup.Secret)
+	if err := service.EncryptLegacySecrets(); err != nil {
+		t.Fatalf("加密明文密钥失败: %v", err)
+	}
+	database.DB.First(&stored, "id = ?", user.ID)
+	if !auth.IsEncryptedKey(stored.TOTPSecret) {
+		t.Fatalf("明文密钥应被加密: %s", stored.TOTPSecret)
+	}
+	if _, err := service.Enable(&stored, currentTOTPCode(t, setup.Secret, 0)); err != nil {
+		t.Errorf("加密后的密钥应能启用: %v", err)
+	}
+}
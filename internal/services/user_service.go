@@ -16,13 +16,15 @@ import (
 
 // UserService 用户服务
 type UserService struct {
-	db *gorm.DB
+	db       *gorm.DB
+	sessions *SessionService
 }
 
 // NewUserService 创建用户服务实例
 func NewUserService(db *gorm.DB) *UserService {
 	return &UserService{
-		db: db,
+		db:       db,
+		sessions: NewSessionService(),
 	}
 }
 
@@ -41,18 +43,32 @@ type LoginRequest struct {
 
 // LoginResponse 登录响应结构
 type LoginResponse struct {
-	User         *models.User `json:"user"`
-	AccessToken  string       `json:"access_token"`
-	RefreshToken string       `json:"refresh_token"`
+	User          *models.User `json:"user"`
+	AccessToken   string       `json:"access_token"`
+	RefreshToken  string       `json:"refresh_token"`
+	RecoveryCodes []string     `json:"recovery_codes,omitempty"` // 登录时首次启用两步验证生成的恢复码
+}
+
+// TwoFactorLoginRequest 登录第二步请求结构
+type TwoFactorLoginRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"` // TOTP 验证码或恢复码
 }
 
 // RefreshRequest 刷新令牌请求结构
 type RefreshRequest struct {
 	RefreshToken string `json:"refresh_token" binding:"required"`
+
+	Client SessionClient `json:"-"` // 由处理器根据请求填写
 }
 
 // Register 用户注册
 func (s *UserService) Register(req *RegisterRequest) (*models.User, error) {
+	// 系统账户的用户名不能注册
+	if models.IsReservedUsername(req.Username) {
+		return nil, errors.New("username is reserved")
+	}
+
 	// 检查用户名是否已存在
 	var existingUser models.User
 	if err := database.DB.Where("username = ?", req.Username).First(&existingUser).Error; err == nil {
@@ -86,8 +102,8 @@ func (s *UserService) Register(req *RegisterRequest) (*models.User, error) {
 	return user, nil
 }
 
-// Login 用户登录
-func (s *UserService) Login(req *LoginRequest) (*LoginResponse, error) {
+// Authenticate 验证用户名和密码，启用了两步验证的用户还需要完成第二步才能创建会话
+func (s *UserService) Authenticate(req *LoginRequest) (*models.User, error) {
 	var user models.User
 	if err := database.DB.Where("username = ? AND is_active = ?", req.Username, true).First(&user).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
@@ -101,56 +117,47 @@ func (s *UserService) Login(req *LoginRequest) (*LoginResponse, error) {
 		return nil, errors.New("invalid username or password")
 	}
 
-	// 生成 JWT Token
-	accessToken, err := auth.GenerateToken(user.ID, user.Username, user.IsAdmin)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate access token: %w", err)
-	}
+	return &user, nil
+}
 
-	refreshToken, err := auth.GenerateRefreshToken(user.ID, user.Username, user.IsAdmin)
+// StartSession 为通过验证的用户创建会话并生成 JWT Token
+func (s *UserService) StartSession(user *models.User, client SessionClient) (*LoginResponse, error) {
+	tokens, err := s.sessions.Create(user, client)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+		return nil, err
 	}
 
 	return &LoginResponse{
-		User:         &user,
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
+		User:         user,
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
 	}, nil
 }
 
-// RefreshToken 刷新访问令牌
+// RefreshToken 刷新访问令牌，刷新令牌每次使用后轮换，旧的刷新令牌随即失效
 func (s *UserService) RefreshToken(req *RefreshRequest) (*LoginResponse, error) {
-	claims, err := auth.ValidateRefreshToken(req.RefreshToken)
-	if err != nil {
-		return nil, errors.New("invalid refresh token")
-	}
-
-	// 验证用户是否仍然有效
-	var user models.User
-	if err := database.DB.Where("id = ? AND is_active = ?", claims.UserID, true).First(&user).Error; err != nil {
-		return nil, errors.New("user not found or inactive")
-	}
-
-	// 生成新的访问令牌
-	accessToken, err := auth.GenerateToken(user.ID, user.Username, user.IsAdmin)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate access token: %w", err)
-	}
-
-	// 生成新的刷新令牌
-	refreshToken, err := auth.GenerateRefreshToken(user.ID, user.Username, user.IsAdmin)
+	user, tokens, err := s.sessions.Rotate(req.RefreshToken, req.Client)
 	if err != nil {
-		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+		return nil, err
 	}
 
 	return &LoginResponse{
-		User:         &user,
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
+		User:         user,
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
 	}, nil
 }
 
+// Logout 退出当前会话
+func (s *UserService) Logout(sessionID uuid.UUID) error {
+	return s.sessions.Revoke(sessionID)
+}
+
+// LogoutAll 退出用户在所有设备上的会话，返回吊销的记录数
+func (s *UserService) LogoutAll(userID uuid.UUID) (int64, error) {
+	return s.sessions.RevokeAllForUser(userID)
+}
+
 // GetUserByID 根据 ID 获取用户
 func (s *UserService) GetUserByID(userID uuid.UUID) (*models.User, error) {
 	var user models.User
@@ -163,23 +170,6 @@ func (s *UserService) GetUserByID(userID uuid.UUID) (*models.User, error) {
 	return &user, nil
 }
 
-// RegenerateAPIKey 重新生成 API 密钥
-func (s *UserService) RegenerateAPIKey(userID uuid.UUID) (string, error) {
-	var user models.User
-	if err := database.DB.Where("id = ? AND is_active = ?", userID, true).First(&user).Error; err != nil {
-		return "", errors.New("user not found")
-	}
-
-	// 生成新的 API 密钥
-	newAPIKey := uuid.New().String() + uuid.New().String()
-
-	if err := database.DB.Model(&user).Update("api_key", newAPIKey).Error; err != nil {
-		return "", fmt.Errorf("failed to update API key: %w", err)
-	}
-
-	return newAPIKey, nil
-}
-
 // UpdateProfile 更新用户资料
 func (s *UserService) UpdateProfile(userID uuid.UUID, username, email string) (*models.User, error) {
 	var user models.User
@@ -214,8 +204,8 @@ func (s *UserService) UpdateProfile(userID uuid.UUID, username, email string) (*
 	return &user, nil
 }
 
-// ChangePassword 修改密码
-func (s *UserService) ChangePassword(userID uuid.UUID, oldPassword, newPassword string) error {
+// ChangePassword 修改密码，成功后吊销除当前会话以外的全部会话
+func (s *UserService) ChangePassword(userID, currentSessionID uuid.UUID, oldPassword, newPassword string) error {
 	var user models.User
 	if err := database.DB.Where("id = ? AND is_active = ?", userID, true).First(&user).Error; err != nil {
 		return errors.New("user not found")
@@ -237,11 +227,20 @@ func (s *UserService) ChangePassword(userID uuid.UUID, oldPassword, newPassword
 		return fmt.Errorf("failed to update password: %w", err)
 	}
 
+	if _, err := s.sessions.RevokeOtherSessions(userID, currentSessionID); err != nil {
+		return err
+	}
+
 	return nil
 }
 
 // UpgradeUserPlan 升级用户计划
 func (s *UserService) UpgradeUserPlan(userID string, newPlanType string, expiresAt *time.Time) error {
+	userUUID, err := validatePlanChange(userID, newPlanType)
+	if err != nil {
+		return err
+	}
+
 	// 获取用户当前信息
 	var user models.User
 	if err := s.db.First(&user, "id = ?", userID).Error; err != nil {
@@ -251,12 +250,6 @@ func (s *UserService) UpgradeUserPlan(userID string, newPlanType string, expires
 	// 获取新计划的保留天数
 	retentionDays := s.getPlanRetentionDays(newPlanType)
 
-	// 转换 userID 为 UUID
-	userUUID, err := uuid.Parse(userID)
-	if err != nil {
-		return fmt.Errorf("无效的用户ID: %v", err)
-	}
-
 	// 开始事务
 	tx := s.db.Begin()
 	defer func() {
@@ -313,6 +306,10 @@ func (s *UserService) UpgradeUserPlan(userID string, newPlanType string, expires
 
 // DowngradeUserPlan 降级用户计划
 func (s *UserService) DowngradeUserPlan(userID string, newPlanType string) error {
+	if _, err := validatePlanChange(userID, newPlanType); err != nil {
+		return err
+	}
+
 	// 获取用户当前信息
 	var user models.User
 	if err := s.db.First(&user, "id = ?", userID).Error; err != nil {
@@ -407,6 +404,18 @@ func (s *UserService) updateUserContentExpiration(tx *gorm.DB, userID string, re
 }
 
 // getPlanRetentionDays 获取计划的文章保留天数
+// validatePlanChange 校验用户 ID 和计划类型，在查询数据库之前拒绝无效的参数
+func validatePlanChange(userID string, planType string) (uuid.UUID, error) {
+	userUUID, err := uuid.Parse(userID)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("无效的用户ID: %v", err)
+	}
+	if _, ok := planRanks[models.PlanType(planType)]; !ok {
+		return uuid.Nil, fmt.Errorf("无效的计划类型: %s", planType)
+	}
+	return userUUID, nil
+}
+
 func (s *UserService) getPlanRetentionDays(planType string) int {
 	switch planType {
 	case "community":
@@ -8,24 +8,30 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
-	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
-func setupUserTestDB() *gorm.DB {
-	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
-	if err != nil {
-		panic("failed to connect database")
+// setupUserTestDB 创建用户、订阅和内容表
+func setupUserTestDB(t *testing.T) *gorm.DB {
+	db := useTestDB(t, &models.User{})
+	// 内容表的默认值使用了 PostgreSQL 函数，这里手动建表
+	for _, statement := range []string{
+		userSubscriptionsTable,
+		`CREATE TABLE contents (id TEXT PRIMARY KEY, user_id TEXT NOT NULL, title TEXT, description TEXT, content TEXT NOT NULL,
+			content_type TEXT DEFAULT 'text/html', visibility TEXT NOT NULL DEFAULT 'public', access_code_hash TEXT,
+			storage_key TEXT, content_hash TEXT, cache_max_age INTEGER, file_path TEXT, file_size INTEGER DEFAULT 0,
+			expires_at DATETIME, is_active BOOLEAN DEFAULT TRUE, deleted_at DATETIME, access_count INTEGER DEFAULT 0,
+			created_at DATETIME, updated_at DATETIME)`,
+	} {
+		if err := db.Exec(statement).Error; err != nil {
+			t.Fatalf("创建表失败: %v", err)
+		}
 	}
-
-	// 自动迁移表结构
-	db.AutoMigrate(&models.User{}, &models.UserSubscription{}, &models.Content{})
-
 	return db
 }
 
 func TestUserService_UpgradeUserPlan(t *testing.T) {
-	db := setupUserTestDB()
+	db := setupUserTestDB(t)
 	service := NewUserService(db)
 
 	// 创建测试用户
@@ -34,7 +40,6 @@ func TestUserService_UpgradeUserPlan(t *testing.T) {
 		ID:       userID,
 		Username: "testuser",
 		Email:    "test@example.com",
-		APIKey:   "test-api-key",
 		IsActive: true,
 	}
 	db.Create(&user)
@@ -73,7 +78,7 @@ func TestUserService_UpgradeUserPlan(t *testing.T) {
 	err = db.Where("user_id = ?", userID).First(&subscription).Error
 	assert.NoError(t, err)
 	assert.Equal(t, models.PlanType("developer"), subscription.PlanType)
-	assert.Equal(t, "active", subscription.Status)
+	assert.Equal(t, models.StatusActive, subscription.Status)
 	assert.NotNil(t, subscription.ExpiresAt)
 
 	// 验证内容过期时间已更新
@@ -90,7 +95,7 @@ func TestUserService_UpgradeUserPlan(t *testing.T) {
 }
 
 func TestUserService_DowngradeUserPlan(t *testing.T) {
-	db := setupUserTestDB()
+	db := setupUserTestDB(t)
 	service := NewUserService(db)
 
 	// 创建测试用户
@@ -99,7 +104,6 @@ func TestUserService_DowngradeUserPlan(t *testing.T) {
 		ID:       userID,
 		Username: "testuser",
 		Email:    "test@example.com",
-		APIKey:   "test-api-key",
 		IsActive: true,
 	}
 	db.Create(&user)
@@ -139,7 +143,7 @@ func TestUserService_DowngradeUserPlan(t *testing.T) {
 	err = db.Where("user_id = ?", userID).First(&updatedSubscription).Error
 	assert.NoError(t, err)
 	assert.Equal(t, models.PlanType("developer"), updatedSubscription.PlanType)
-	assert.Equal(t, "active", updatedSubscription.Status)
+	assert.Equal(t, models.StatusActive, updatedSubscription.Status)
 
 	// 验证内容过期时间已更新
 	var updatedContents []models.Content
@@ -154,7 +158,7 @@ func TestUserService_DowngradeUserPlan(t *testing.T) {
 }
 
 func TestUserService_GetPlanRetentionDays(t *testing.T) {
-	db := setupUserTestDB()
+	db := setupUserTestDB(t)
 	service := NewUserService(db)
 
 	tests := []struct {
@@ -178,7 +182,7 @@ func TestUserService_GetPlanRetentionDays(t *testing.T) {
 }
 
 func TestUserService_UpdateUserContentExpiration(t *testing.T) {
-	db := setupUserTestDB()
+	db := setupUserTestDB(t)
 	service := NewUserService(db)
 
 	// 创建测试用户
@@ -187,7 +191,6 @@ func TestUserService_UpdateUserContentExpiration(t *testing.T) {
 		ID:       userID,
 		Username: "testuser",
 		Email:    "test@example.com",
-		APIKey:   "test-api-key",
 		IsActive: true,
 	}
 	db.Create(&user)
@@ -233,7 +236,7 @@ func TestUserService_UpdateUserContentExpiration(t *testing.T) {
 }
 
 func TestUserService_InvalidUserID(t *testing.T) {
-	db := setupUserTestDB()
+	db := setupUserTestDB(t)
 	service := NewUserService(db)
 
 	// 测试无效的用户ID
@@ -247,7 +250,7 @@ func TestUserService_InvalidUserID(t *testing.T) {
 }
 
 func TestUserService_NonExistentUser(t *testing.T) {
-	db := setupUserTestDB()
+	db := setupUserTestDB(t)
 	service := NewUserService(db)
 
 	// 测试不存在的用户
@@ -258,11 +261,11 @@ func TestUserService_NonExistentUser(t *testing.T) {
 
 	err = service.DowngradeUserPlan(nonExistentUserID.String(), "community")
 	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "用户订阅不存在")
+	assert.Contains(t, err.Error(), "用户不存在")
 }
 
 func TestUserService_InvalidPlanType(t *testing.T) {
-	db := setupUserTestDB()
+	db := setupUserTestDB(t)
 	service := NewUserService(db)
 
 	// 创建测试用户
@@ -271,7 +274,6 @@ func TestUserService_InvalidPlanType(t *testing.T) {
 		ID:       userID,
 		Username: "testuser",
 		Email:    "test@example.com",
-		APIKey:   "test-api-key",
 		IsActive: true,
 	}
 	db.Create(&user)
@@ -293,3 +295,13 @@ func TestUserService_InvalidPlanType(t *testing.T) {
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "无效的计划类型")
 }
+
+func TestUserService_RegisterReservedUsername(t *testing.T) {
+	setupUserTestDB(t)
+	service := NewUserService(nil)
+
+	for _, username := range []string{"anonymous", "Anonymous"} {
+		_, err := service.Register(&RegisterRequest{Username: username, Email: username + "@example.com", Password: "secret123"})
+		assert.EqualError(t, err, "username is reserved")
+	}
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"strings"
+
+	"anywebsites/internal/models"
+)
+
+// UserAgentInfo 从 User-Agent 解析出的浏览器、操作系统和设备类型
+type UserAgentInfo struct {
+	Browser    string
+	OS         string
+	DeviceType string
+	IsBot      bool
+}
+
+// botSignatures 爬虫、监控和命令行工具 User-Agent 中的特征字符串（小写）
+var botSignatures = []string{
+	"bot", "crawler", "spider", "slurp", "curl/", "wget/", "python-requests", "python-urllib",
+	"go-http-client", "okhttp", "java/", "libwww", "httpclient", "scrapy", "headless",
+	"phantomjs", "lighthouse", "pingdom", "uptime", "facebookexternalhit", "embedly",
+}
+
+// uaSignature User-Agent 中任一特征字符串出现时识别为 name
+type uaSignature struct {
+	name     string
+	patterns []string
+}
+
+// browserSignatures 按顺序匹配，基于 Chromium 的浏览器都带有 Chrome 和 Safari 标记，需要排在前面
+var browserSignatures = []uaSignature{
+	{"Edge", []string{"edg/", "edge/", "edga/", "edgios/"}},
+	{"Opera", []string{"opr/", "opera"}},
+	{"Samsung Internet", []string{"samsungbrowser"}},
+	{"Yandex", []string{"yabrowser"}},
+	{"UC Browser", []string{"ucbrowser"}},
+	{"WeChat", []string{"micromessenger"}},
+	{"Firefox", []string{"firefox/", "fxios/"}},
+	{"Chrome", []string{"crios/", "chrome/", "chromium/"}},
+	{"Internet Explorer", []string{"msie ", "trident/"}},
+}
+
+// osSignatures 按顺序匹配，Windows Phone 和 iOS 需要排在 Windows 和 macOS 前面
+var osSignatures = []uaSignature{
+	{"Windows Phone", []string{"windows phone"}},
+	{"Windows", []string{"windows"}},
+	{"iOS", []string{"iphone", "ipad", "ipod"}},
+	{"Android", []string{"android"}},
+	{"Chrome OS", []string{"cros "}},
+	{"macOS", []string{"mac os x", "macintosh"}},
+	{"Linux", []string{"linux", "x11"}},
+}
+
+// ParseUserAgent 解析 User-Agent，无法识别的浏览器和系统为 Other，空字符串的设备类型为 unknown
+func ParseUserAgent(userAgent string) UserAgentInfo {
+	ua := strings.ToLower(strings.TrimSpace(userAgent))
+	if ua == "" {
+		return UserAgentInfo{DeviceType: models.DeviceClassUnknown}
+	}
+
+	info := UserAgentInfo{
+		Browser: matchSignature(ua, browserSignatures, "Other"),
+		OS:      matchSignature(ua, osSignatures, "Other"),
+		IsBot:   isBotUserAgent(ua),
+	}
+	// Safari 只能在排除其他 WebKit 浏览器后识别
+	if info.Browser == "Other" && strings.Contains(ua, "safari/") && strings.Contains(ua, "version/") {
+		info.Browser = "Safari"
+	}
+
+	switch {
+	case info.IsBot:
+		info.DeviceType = models.DeviceClassBot
+	case containsAny(ua, "ipad", "tablet", "kindle", "silk/", "playbook") ||
+		(strings.Contains(ua, "android") && !strings.Contains(ua, "mobile")):
+		info.DeviceType = models.DeviceClassTablet
+	case containsAny(ua, "mobi", "iphone", "ipod", "windows phone", "blackberry", "opera mini"):
+		info.DeviceType = models.DeviceClassMobile
+	default:
+		info.DeviceType = models.DeviceClassDesktop
+	}
+	return info
+}
+
+// IsBotUserAgent 判断 User-Agent 是否来自爬虫或自动化工具
+func IsBotUserAgent(userAgent string) bool {
+	return isBotUserAgent(strings.ToLower(userAgent))
+}
+
+func isBotUserAgent(ua string) bool {
+	return containsAny(ua, botSignatures...)
+}
+
+func matchSignature(ua string, signatures []uaSignature, fallback string) string {
+	for _, signature := range signatures {
+		if containsAny(ua, signature.patterns...) {
+			return signature.name
+		}
+	}
+	return fallback
+}
+
+func containsAny(s string, substrings ...string) bool {
+	for _, sub := range substrings {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
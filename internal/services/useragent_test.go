@@ -0,0 +1,96 @@
+package services
+
+import (
+	"testing"
+
+	"anywebsites/internal/models"
+)
+
+func TestParseUserAgent(t *testing.T) {
+	tests := []struct {
+		name      string
+		userAgent string
+		want      UserAgentInfo
+	}{
+		{
+			"Windows 上的 Chrome",
+			"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+			UserAgentInfo{Browser: "Chrome", OS: "Windows", DeviceType: models.DeviceClassDesktop},
+		},
+		{
+			"Windows 上的 Edge",
+			"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.2210.91",
+			UserAgentInfo{Browser: "Edge", OS: "Windows", DeviceType: models.DeviceClassDesktop},
+		},
+		{
+			"macOS 上的 Safari",
+			"Mozilla/5.0 (Macintosh; Intel Mac OS X 14_2) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.2 Safari/605.1.15",
+			UserAgentInfo{Browser: "Safari", OS: "macOS", DeviceType: models.DeviceClassDesktop},
+		},
+		{
+			"iPhone 上的 Safari",
+			"Mozilla/5.0 (iPhone; CPU iPhone OS 17_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.2 Mobile/15E148 Safari/604.1",
+			UserAgentInfo{Browser: "Safari", OS: "iOS", DeviceType: models.DeviceClassMobile},
+		},
+		{
+			"iPad 上的 Chrome",
+			"Mozilla/5.0 (iPad; CPU OS 17_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/120.0.6099.119 Mobile/15E148 Safari/604.1",
+			UserAgentInfo{Browser: "Chrome", OS: "iOS", DeviceType: models.DeviceClassTablet},
+		},
+		{
+			"Android 手机上的 Firefox",
+			"Mozilla/5.0 (Android 14; Mobile; rv:121.0) Gecko/121.0 Firefox/121.0",
+			UserAgentInfo{Browser: "Firefox", OS: "Android", DeviceType: models.DeviceClassMobile},
+		},
+		{
+			"Android 平板",
+			"Mozilla/5.0 (Linux; Android 13; SM-X700) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+			UserAgentInfo{Browser: "Chrome", OS: "Android", DeviceType: models.DeviceClassTablet},
+		},
+		{
+			"Linux 上的 Firefox",
+			"Mozilla/5.0 (X11; Linux x86_64; rv:121.0) Gecko/20100101 Firefox/121.0",
+			UserAgentInfo{Browser: "Firefox", OS: "Linux", DeviceType: models.DeviceClassDesktop},
+		},
+		{
+			"微信内置浏览器",
+			"Mozilla/5.0 (Linux; Android 12; Mobile) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/107.0 Mobile Safari/537.36 MicroMessenger/8.0.43",
+			UserAgentInfo{Browser: "WeChat", OS: "Android", DeviceType: models.DeviceClassMobile},
+		},
+		{
+			"Googlebot",
+			"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			UserAgentInfo{Browser: "Other", OS: "Other", DeviceType: models.DeviceClassBot, IsBot: true},
+		},
+		{
+			"curl",
+			"curl/8.4.0",
+			UserAgentInfo{Browser: "Other", OS: "Other", DeviceType: models.DeviceClassBot, IsBot: true},
+		},
+		{
+			"空 User-Agent",
+			"",
+			UserAgentInfo{DeviceType: models.DeviceClassUnknown},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseUserAgent(tt.userAgent); got != tt.want {
+				t.Errorf("期望 %+v, 实际 %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestIsBotUserAgent(t *testing.T) {
+	if !IsBotUserAgent("Mozilla/5.0 (compatible; bingbot/2.0)") {
+		t.Error("bingbot 应识别为爬虫")
+	}
+	if !IsBotUserAgent("Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) HeadlessChrome/120.0.0.0 Safari/537.36") {
+		t.Error("无头浏览器应识别为爬虫")
+	}
+	if IsBotUserAgent("Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:121.0) Gecko/20100101 Firefox/121.0") {
+		t.Error("普通浏览器不应识别为爬虫")
+	}
+}
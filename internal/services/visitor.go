@@ -0,0 +1,119 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"anywebsites/internal/config"
+	"anywebsites/internal/database"
+)
+
+// visitorSaltBytes 每日盐值的长度
+const visitorSaltBytes = 32
+
+// VisitorSalts 按天轮换的访客标识盐值，过期的盐值被删除后无法再由 IP 和 User-Agent 还原访客标识
+type VisitorSalts struct {
+	mutex  sync.Mutex
+	salts  map[string][]byte
+	loader func(day string) ([]byte, error)
+}
+
+func newVisitorSalts(loader func(day string) ([]byte, error)) *VisitorSalts {
+	return &VisitorSalts{
+		salts:  make(map[string][]byte),
+		loader: loader,
+	}
+}
+
+// VisitorID 由 IP、User-Agent 和访问当天的盐值计算访客标识，同一天内同一终端的标识相同
+func (v *VisitorSalts) VisitorID(clientIP, userAgent string, accessTime time.Time) string {
+	salt := v.salt(accessTime.Format("2006-01-02"))
+
+	hash := sha256.New()
+	hash.Write(salt)
+	hash.Write([]byte(clientIP))
+	hash.Write([]byte{0})
+	hash.Write([]byte(userAgent))
+	return hex.EncodeToString(hash.Sum(nil))[:32]
+}
+
+// salt 获取某一天的盐值，内存中只保留今天和前一天的盐值
+func (v *VisitorSalts) salt(day string) []byte {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	if salt, ok := v.salts[day]; ok {
+		return salt
+	}
+
+	salt, err := v.loader(day)
+	if err != nil {
+		// 数据库不可用时使用仅在本进程有效的盐值，访客标识在多实例间可能不一致
+		log.Printf("Failed to load visitor salt for %s: %v", day, err)
+		salt = randomSalt()
+	}
+
+	if len(v.salts) >= 2 {
+		for cached := range v.salts {
+			if cached < day {
+				delete(v.salts, cached)
+			}
+		}
+	}
+	v.salts[day] = salt
+	return salt
+}
+
+// loadVisitorSalt 从数据库获取某一天的盐值，不存在时生成；多个实例共享同一个盐值
+// 同时删除前一天之前的盐值
+func loadVisitorSalt(day string) ([]byte, error) {
+	salt := hex.EncodeToString(randomSalt())
+	if err := database.DB.Exec("INSERT INTO analytics_salts (day, salt) VALUES (?::date, ?) ON CONFLICT (day) DO NOTHING", day, salt).Error; err != nil {
+		return nil, fmt.Errorf("failed to create visitor salt: %w", err)
+	}
+	if err := database.DB.Raw("SELECT salt FROM analytics_salts WHERE day = ?::date", day).Row().Scan(&salt); err != nil {
+		return nil, fmt.Errorf("failed to read visitor salt: %w", err)
+	}
+	if err := database.DB.Exec("DELETE FROM analytics_salts WHERE day < ?::date - 1", day).Error; err != nil {
+		log.Printf("Failed to delete expired visitor salts: %v", err)
+	}
+	return hex.DecodeString(salt)
+}
+
+// memoryVisitorSalt 每次生成新的盐值，用于不连接数据库的场景
+func memoryVisitorSalt(day string) ([]byte, error) {
+	return randomSalt(), nil
+}
+
+func randomSalt() []byte {
+	salt := make([]byte, visitorSaltBytes)
+	if _, err := rand.Read(salt); err != nil {
+		panic(fmt.Sprintf("failed to generate visitor salt: %v", err))
+	}
+	return salt
+}
+
+// anonymizeIP 按配置处理要保存的 IP 地址：full 原样保存，truncate 保留 IPv4 的 /24 或 IPv6 的 /48，none 不保存
+func anonymizeIP(clientIP, mode string) string {
+	switch mode {
+	case config.IPStorageNone:
+		return ""
+	case config.IPStorageTruncate:
+		ip := net.ParseIP(clientIP)
+		if ip == nil {
+			return ""
+		}
+		if v4 := ip.To4(); v4 != nil {
+			return v4.Mask(net.CIDRMask(24, 32)).String()
+		}
+		return ip.Mask(net.CIDRMask(48, 128)).String()
+	default:
+		return clientIP
+	}
+}
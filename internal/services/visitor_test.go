@@ -0,0 +1,66 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"anywebsites/internal/config"
+)
+
+func TestVisitorIDRotatesDaily(t *testing.T) {
+	salts := newVisitorSalts(memoryVisitorSalt)
+	ua := "Mozilla/5.0 (Windows NT 10.0; Win64; x64) Chrome/120.0.0.0"
+	morning := time.Date(2024, 5, 6, 8, 0, 0, 0, time.Local)
+	evening := time.Date(2024, 5, 6, 22, 0, 0, 0, time.Local)
+
+	id := salts.VisitorID("203.0.113.7", ua, morning)
+	if len(id) != 32 {
+		t.Fatalf("访客标识期望 32 个字符, 实际 %q", id)
+	}
+	if got := salts.VisitorID("203.0.113.7", ua, evening); got != id {
+		t.Errorf("同一天同一终端的访客标识应该相同: %s != %s", got, id)
+	}
+	if got := salts.VisitorID("203.0.113.7", "curl/8.0", morning); got == id {
+		t.Error("同一 IP 不同 User-Agent 的访客标识应该不同")
+	}
+	if got := salts.VisitorID("203.0.113.8", ua, morning); got == id {
+		t.Error("不同 IP 的访客标识应该不同")
+	}
+	if got := salts.VisitorID("203.0.113.7", ua, morning.AddDate(0, 0, 1)); got == id {
+		t.Error("第二天的访客标识应该使用新的盐值")
+	}
+}
+
+func TestVisitorSaltsKeepTwoDays(t *testing.T) {
+	salts := newVisitorSalts(memoryVisitorSalt)
+	day := time.Date(2024, 5, 6, 12, 0, 0, 0, time.Local)
+	for i := 0; i < 5; i++ {
+		salts.VisitorID("203.0.113.7", "ua", day.AddDate(0, 0, i))
+	}
+	if len(salts.salts) > 2 {
+		t.Errorf("内存中最多保留两天的盐值, 实际 %d 天", len(salts.salts))
+	}
+}
+
+func TestAnonymizeIP(t *testing.T) {
+	tests := []struct {
+		name string
+		ip   string
+		mode string
+		want string
+	}{
+		{"完整保存", "203.0.113.7", config.IPStorageFull, "203.0.113.7"},
+		{"IPv4 截断为 /24", "203.0.113.7", config.IPStorageTruncate, "203.0.113.0"},
+		{"IPv6 截断为 /48", "2001:db8:1234:5678::1", config.IPStorageTruncate, "2001:db8:1234::"},
+		{"无法解析的地址不保存", "unknown", config.IPStorageTruncate, ""},
+		{"不保存", "203.0.113.7", config.IPStorageNone, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := anonymizeIP(tt.ip, tt.mode); got != tt.want {
+				t.Errorf("期望 %q, 实际 %q", tt.want, got)
+			}
+		})
+	}
+}
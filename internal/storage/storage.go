@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"anywebsites/internal/config"
+)
+
+// ErrNotFound 对象不存在
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore 内容正文的对象存储
+type BlobStore interface {
+	// Put 写入对象，已存在时覆盖
+	Put(key string, data []byte) error
+	// Get 读取对象，不存在时返回 ErrNotFound
+	Get(key string) ([]byte, error)
+	// Delete 删除对象，对象不存在时不返回错误
+	Delete(key string) error
+}
+
+// Store 全局正文存储，为 nil 时正文保存在 contents 表中
+var Store BlobStore
+
+// Init 根据配置初始化全局正文存储
+func Init(cfg *config.Config) error {
+	store, err := New(cfg)
+	if err != nil {
+		return err
+	}
+	Store = store
+	return nil
+}
+
+// New 根据配置创建正文存储，database 后端返回 nil
+func New(cfg *config.Config) (BlobStore, error) {
+	switch cfg.Storage.Backend {
+	case "", "local":
+		return NewLocalStore(filepath.Join(cfg.Upload.Path, "blobs"))
+	case "s3":
+		return NewS3Store(cfg.Storage)
+	case "database":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend: %s", cfg.Storage.Backend)
+	}
+}
+
+// validateKey 检查对象键，不允许空键、绝对路径和 .. 路径段
+func validateKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || path.Clean(key) != key {
+		return fmt.Errorf("invalid blob key: %q", key)
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == ".." {
+			return fmt.Errorf("invalid blob key: %q", key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"anywebsites/internal/config"
+)
+
+func TestValidateKey(t *testing.T) {
+	valid := []string{"contents/abc.html", "a", "contents/2024/x.html"}
+	invalid := []string{"", "/abs", "../escape", "contents/../../etc/passwd", "contents//x", "contents/./x"}
+
+	for _, key := range valid {
+		if err := validateKey(key); err != nil {
+			t.Errorf("validateKey(%q) 应该合法: %v", key, err)
+		}
+	}
+	for _, key := range invalid {
+		if err := validateKey(key); err == nil {
+			t.Errorf("validateKey(%q) 应该不合法", key)
+		}
+	}
+}
+
+// testBlobStore 所有后端共用的读写删除测试
+func testBlobStore(t *testing.T, store BlobStore) {
+	t.Helper()
+
+	if _, err := store.Get("contents/missing.html"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("读取不存在的对象应返回 ErrNotFound，实际 %v", err)
+	}
+
+	body := []byte("<html><body>你好</body></html>")
+	if err := store.Put("contents/a.html", body); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	got, err := store.Get("contents/a.html")
+	if err != nil {
+		t.Fatalf("读取失败: %v", err)
+	}
+	if string(got) != string(body) {
+		t.Errorf("读取内容 = %q，期望 %q", got, body)
+	}
+
+	if err := store.Put("contents/a.html", []byte("updated")); err != nil {
+		t.Fatalf("覆盖写入失败: %v", err)
+	}
+	if got, _ := store.Get("contents/a.html"); string(got) != "updated" {
+		t.Errorf("覆盖后内容 = %q，期望 updated", got)
+	}
+
+	if err := store.Delete("contents/a.html"); err != nil {
+		t.Fatalf("删除失败: %v", err)
+	}
+	if _, err := store.Get("contents/a.html"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("删除后读取应返回 ErrNotFound，实际 %v", err)
+	}
+	if err := store.Delete("contents/a.html"); err != nil {
+		t.Errorf("重复删除不应出错: %v", err)
+	}
+}
+
+func TestLocalStore(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("创建本地存储失败: %v", err)
+	}
+	testBlobStore(t, store)
+
+	if err := store.Put("../outside.html", []byte("x")); err == nil {
+		t.Error("不应允许写入存储目录之外")
+	}
+}
+
+// fakeS3 模拟 S3 兼容服务，校验签名后在内存中保存对象
+type fakeS3 struct {
+	mutex     sync.Mutex
+	objects   map[string][]byte
+	bucket    string
+	accessKey string
+	secretKey string
+	region    string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	if r.Header.Get("X-Amz-Content-Sha256") != sha256Hex(body) {
+		http.Error(w, "XAmzContentSHA256Mismatch", http.StatusBadRequest)
+		return
+	}
+	if !f.verifySignature(r) {
+		http.Error(w, "SignatureDoesNotMatch", http.StatusForbidden)
+		return
+	}
+
+	prefix := "/" + f.bucket + "/"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		http.Error(w, "NoSuchBucket", http.StatusNotFound)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, prefix)
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		f.objects[key] = body
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet:
+		data, exists := f.objects[key]
+		if !exists {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// verifySignature 用服务端保存的密钥重新签名并比较
+func (f *fakeS3) verifySignature(r *http.Request) bool {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential="+f.accessKey+"/") {
+		return false
+	}
+	amzDate, err := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		return false
+	}
+
+	clone := r.Clone(r.Context())
+	clone.URL.Host = r.Host
+	signer := &S3Store{region: f.region, accessKey: f.accessKey, secretKey: f.secretKey, now: func() time.Time { return amzDate }}
+	signer.sign(clone, r.Header.Get("X-Amz-Content-Sha256"))
+	return clone.Header.Get("Authorization") == auth
+}
+
+func newTestS3(t *testing.T) (*S3Store, *fakeS3) {
+	fake := &fakeS3{
+		objects:   make(map[string][]byte),
+		bucket:    "anywebsites",
+		accessKey: "minio",
+		secretKey: "minio-secret",
+		region:    "us-east-1",
+	}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	store, err := NewS3Store(config.StorageConfig{
+		S3Endpoint:  server.URL,
+		S3Bucket:    fake.bucket,
+		S3Region:    fake.region,
+		S3AccessKey: fake.accessKey,
+		S3SecretKey: fake.secretKey,
+		S3PathStyle: true,
+	})
+	if err != nil {
+		t.Fatalf("创建 S3 存储失败: %v", err)
+	}
+	return store, fake
+}
+
+func TestS3Store(t *testing.T) {
+	store, fake := newTestS3(t)
+	testBlobStore(t, store)
+
+	if err := store.Put("contents/b.html", []byte("hello")); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if string(fake.objects["contents/b.html"]) != "hello" {
+		t.Errorf("对象未按路径风格写入 bucket")
+	}
+}
+
+func TestS3Store_WrongSecret(t *testing.T) {
+	store, _ := newTestS3(t)
+	store.secretKey = "wrong"
+
+	if err := store.Put("contents/a.html", []byte("x")); err == nil {
+		t.Error("密钥错误时写入应失败")
+	}
+}
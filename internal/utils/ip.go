@@ -1,153 +1,328 @@
 package utils
 
 import (
+	"fmt"
 	"net"
+	"net/http"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
-// GetRealClientIP 获取真实的客户端IP地址
-// 支持从代理服务器（如nginx）传递的真实IP
-func GetRealClientIP(c *gin.Context) string {
-	// 1. 首先检查 X-Real-IP 头部（nginx proxy_set_header X-Real-IP $remote_addr;）
-	if realIP := c.GetHeader("X-Real-IP"); realIP != "" {
-		if ip := parseIP(realIP); ip != "" {
-			return ip
-		}
+// ClientIPKey 请求上下文中保存客户端 IP 的键，由 middleware.ClientIPMiddleware 写入
+const ClientIPKey = "client_ip"
+
+// SecureRequestKey 请求上下文中保存请求是否经过 HTTPS 的键，由 middleware.ClientIPMiddleware 写入
+const SecureRequestKey = "secure_request"
+
+// CloudflareProxies 受信任代理列表中代表 Cloudflare 全部回源 IP 段的名称
+const CloudflareProxies = "cloudflare"
+
+// 受信任代理用来转发客户端地址和协议的头部，只读取部署时配置的一种，另一种可能由客户端伪造
+const (
+	// ProxyHeaderXForwarded X-Forwarded-For、X-Real-IP 和 X-Forwarded-Proto（默认）
+	ProxyHeaderXForwarded = "x-forwarded"
+	// ProxyHeaderForwarded RFC 7239 Forwarded
+	ProxyHeaderForwarded = "forwarded"
+)
+
+// cloudflareRanges Cloudflare 回源使用的 IP 段，见 https://www.cloudflare.com/ips/
+var cloudflareRanges = []string{
+	"173.245.48.0/20", "103.21.244.0/22", "103.22.200.0/22", "103.31.4.0/22",
+	"141.101.64.0/18", "108.162.192.0/18", "190.93.240.0/20", "188.114.96.0/20",
+	"197.234.240.0/22", "198.41.128.0/17", "162.158.0.0/15", "104.16.0.0/13",
+	"104.24.0.0/14", "172.64.0.0/13", "131.0.72.0/22",
+	"2400:cb00::/32", "2606:4700::/32", "2803:f800::/32", "2405:b500::/32",
+	"2405:8100::/32", "2a06:98c0::/29", "2c0f:f248::/32",
+}
+
+// defaultResolver 不信任任何代理，没有经过 ClientIPMiddleware 的请求只使用直接连接的地址
+var defaultResolver = &ClientIPResolver{}
+
+// ClientIPResolver 解析客户端 IP：只有直接连接的对端属于受信任的代理时才读取转发头部，
+// 并从右向左跳过转发链中受信任的代理，第一个不受信任的地址即为客户端
+type ClientIPResolver struct {
+	trusted    []*net.IPNet
+	cloudflare []*net.IPNet // 只有受信任列表包含 cloudflare 时才读取 CF-Connecting-IP
+	forwarded  bool         // 读取 Forwarded 而不是 X-Forwarded-* 头部
+}
+
+// NewClientIPResolver 创建解析器，trustedProxies 的每一项可以是 CIDR、单个 IP 或 cloudflare，
+// proxyHeader 为 ProxyHeaderXForwarded 或 ProxyHeaderForwarded，为空时使用 ProxyHeaderXForwarded
+func NewClientIPResolver(trustedProxies []string, proxyHeader string) (*ClientIPResolver, error) {
+	resolver := &ClientIPResolver{}
+	switch strings.ToLower(strings.TrimSpace(proxyHeader)) {
+	case "", ProxyHeaderXForwarded:
+	case ProxyHeaderForwarded:
+		resolver.forwarded = true
+	default:
+		return nil, fmt.Errorf("invalid trusted proxy header %q", proxyHeader)
 	}
 
-	// 2. 检查 X-Forwarded-For 头部（可能包含多个IP，第一个是真实客户端IP）
-	if forwardedFor := c.GetHeader("X-Forwarded-For"); forwardedFor != "" {
-		// X-Forwarded-For 格式: client, proxy1, proxy2
-		ips := strings.Split(forwardedFor, ",")
-		for _, ip := range ips {
-			ip = strings.TrimSpace(ip)
-			if parsedIP := parseIP(ip); parsedIP != "" && !isPrivateIP(parsedIP) {
-				return parsedIP
+	for _, proxy := range trustedProxies {
+		proxy = strings.TrimSpace(proxy)
+		if strings.EqualFold(proxy, CloudflareProxies) {
+			for _, cidr := range cloudflareRanges {
+				_, network, _ := net.ParseCIDR(cidr)
+				resolver.cloudflare = append(resolver.cloudflare, network)
 			}
+			resolver.trusted = append(resolver.trusted, resolver.cloudflare...)
+			continue
 		}
-	}
 
-	// 3. 检查 CF-Connecting-IP 头部（Cloudflare）
-	if cfIP := c.GetHeader("CF-Connecting-IP"); cfIP != "" {
-		if ip := parseIP(cfIP); ip != "" {
-			return ip
+		network, err := parseNetwork(proxy)
+		if err != nil {
+			return nil, err
 		}
+		resolver.trusted = append(resolver.trusted, network)
 	}
+	return resolver, nil
+}
 
-	// 4. 检查 X-Forwarded 头部
-	if forwarded := c.GetHeader("X-Forwarded"); forwarded != "" {
-		// 解析 X-Forwarded 头部，格式可能是: for=192.0.2.60;proto=http;by=203.0.113.43
-		if ip := parseForwardedHeader(forwarded); ip != "" {
-			return ip
+// parseNetwork 解析 CIDR，单个 IP 视为只包含该地址的网段
+func parseNetwork(value string) (*net.IPNet, error) {
+	if strings.Contains(value, "/") {
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", value, err)
 		}
+		return network, nil
 	}
 
-	// 5. 检查 Forwarded 头部（RFC 7239 标准）
-	if forwarded := c.GetHeader("Forwarded"); forwarded != "" {
-		if ip := parseForwardedHeader(forwarded); ip != "" {
-			return ip
-		}
+	ip := normalizeIP(net.ParseIP(value))
+	if ip == nil {
+		return nil, fmt.Errorf("invalid trusted proxy %q", value)
 	}
-
-	// 6. 最后使用 Gin 的默认 ClientIP 方法
-	return c.ClientIP()
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)}, nil
 }
 
-// parseIP 解析并验证IP地址
-func parseIP(ipStr string) string {
-	ip := strings.TrimSpace(ipStr)
-	if net.ParseIP(ip) != nil {
-		return ip
+// ClientIP 返回请求的客户端 IP，按配置读取 Forwarded 或 X-Forwarded-For、X-Real-IP，
+// 转发链经过 Cloudflare 时使用 CF-Connecting-IP
+func (r *ClientIPResolver) ClientIP(req *http.Request) string {
+	peer := remoteIP(req.RemoteAddr)
+	if peer == nil {
+		return strings.TrimSpace(req.RemoteAddr)
 	}
-	return ""
-}
-
-// isPrivateIP 检查是否为私有IP地址
-func isPrivateIP(ipStr string) bool {
-	ip := net.ParseIP(ipStr)
-	if ip == nil {
-		return false
+	if !r.isTrusted(peer) {
+		return peer.String()
 	}
 
-	// IPv4 私有地址范围
-	private4 := []string{
-		"10.0.0.0/8",
-		"172.16.0.0/12",
-		"192.168.0.0/16",
-		"127.0.0.0/8", // 本地回环
+	var hops []net.IP
+	chained := true
+	if r.forwarded {
+		hops = parseForwarded(req.Header.Values("Forwarded"))
+	} else if values := req.Header.Values("X-Forwarded-For"); len(values) > 0 {
+		hops = parseForwardedFor(values)
+	} else {
+		chained = false
 	}
 
-	for _, cidr := range private4 {
-		_, network, err := net.ParseCIDR(cidr)
-		if err != nil {
-			continue
+	client := peer
+	for {
+		if !r.isTrusted(client) {
+			return client.String()
 		}
-		if network.Contains(ip) {
-			return true
+		// Cloudflare 会覆盖客户端传入的 CF-Connecting-IP
+		if r.isCloudflare(client) {
+			if ip := normalizeIP(net.ParseIP(strings.TrimSpace(req.Header.Get("CF-Connecting-IP")))); ip != nil {
+				return ip.String()
+			}
+		}
+		if len(hops) == 0 {
+			break
 		}
+		next := hops[len(hops)-1]
+		hops = hops[:len(hops)-1]
+		if next == nil {
+			// unknown 或混淆的节点名，无法继续向前追溯
+			break
+		}
+		client = next
 	}
 
-	// IPv6 私有地址
-	if ip.To4() == nil { // IPv6
-		// 检查本地回环
-		if ip.IsLoopback() {
-			return true
+	// 没有 X-Forwarded-For 时使用受信任代理设置的 X-Real-IP
+	if !r.forwarded && !chained {
+		if ip := normalizeIP(net.ParseIP(strings.TrimSpace(req.Header.Get("X-Real-IP")))); ip != nil {
+			return ip.String()
 		}
-		// 检查链路本地地址
-		if ip.IsLinkLocalUnicast() {
-			return true
+	}
+	return client.String()
+}
+
+// IsSecure 检查客户端是否通过 HTTPS 访问：直接的 TLS 连接，或受信任代理按配置在 X-Forwarded-Proto
+// 或 Forwarded 的 proto 中转发的最初协议为 https
+func (r *ClientIPResolver) IsSecure(req *http.Request) bool {
+	if req.TLS != nil {
+		return true
+	}
+	peer := remoteIP(req.RemoteAddr)
+	if peer == nil || !r.isTrusted(peer) {
+		return false
+	}
+
+	if r.forwarded {
+		values := req.Header.Values("Forwarded")
+		if len(values) == 0 {
+			return false
 		}
-		// 检查唯一本地地址 (fc00::/7)
-		if len(ip) == 16 && (ip[0]&0xfe) == 0xfc {
-			return true
+		first := splitQuoted(values[0], ',')[0]
+		for _, pair := range splitQuoted(first, ';') {
+			name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+			if ok && strings.EqualFold(strings.TrimSpace(name), "proto") {
+				return strings.EqualFold(unquote(strings.TrimSpace(value)), "https")
+			}
 		}
+		return false
 	}
+	proto, _, _ := strings.Cut(req.Header.Get("X-Forwarded-Proto"), ",")
+	return strings.EqualFold(strings.TrimSpace(proto), "https")
+}
+
+func (r *ClientIPResolver) isTrusted(ip net.IP) bool {
+	return containsIP(r.trusted, ip)
+}
 
+func (r *ClientIPResolver) isCloudflare(ip net.IP) bool {
+	return containsIP(r.cloudflare, ip)
+}
+
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
 	return false
 }
 
-// parseForwardedHeader 解析 Forwarded 或 X-Forwarded 头部
-func parseForwardedHeader(forwarded string) string {
-	// 简单解析 for= 参数
-	parts := strings.Split(forwarded, ";")
-	for _, part := range parts {
-		part = strings.TrimSpace(part)
-		if strings.HasPrefix(part, "for=") {
-			forValue := strings.TrimPrefix(part, "for=")
-			// 移除可能的引号
-			forValue = strings.Trim(forValue, "\"")
-			// 可能包含端口号，需要分离
-			if strings.Contains(forValue, ":") {
-				host, _, err := net.SplitHostPort(forValue)
-				if err == nil {
-					forValue = host
-				}
+// normalizeIP IPv4 地址统一为 4 字节形式，包括 IPv4 映射的 IPv6 地址
+func normalizeIP(ip net.IP) net.IP {
+	if v4 := ip.To4(); v4 != nil {
+		return v4
+	}
+	return ip
+}
+
+// remoteIP 解析 RemoteAddr 中的 IP
+func remoteIP(remoteAddr string) net.IP {
+	host, _, err := net.SplitHostPort(strings.TrimSpace(remoteAddr))
+	if err != nil {
+		host = strings.TrimSpace(remoteAddr)
+	}
+	return normalizeIP(net.ParseIP(host))
+}
+
+// parseForwardedFor 解析 X-Forwarded-For，多个头部按出现顺序连接，无法解析的地址为 nil
+func parseForwardedFor(values []string) []net.IP {
+	var hops []net.IP
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				hops = append(hops, parseNodeAddress(item))
 			}
-			if ip := parseIP(forValue); ip != "" {
-				return ip
+		}
+	}
+	return hops
+}
+
+// parseForwarded 按 RFC 7239 解析 Forwarded 头部每个节点的 for 参数，
+// 参数名不区分大小写，值可以是带引号的字符串；没有 for 参数或值为 unknown、混淆名称的节点为 nil
+func parseForwarded(values []string) []net.IP {
+	var hops []net.IP
+	for _, value := range values {
+		for _, element := range splitQuoted(value, ',') {
+			if strings.TrimSpace(element) == "" {
+				continue
+			}
+			var hop net.IP
+			for _, pair := range splitQuoted(element, ';') {
+				name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(strings.TrimSpace(name), "for") {
+					hop = parseNodeAddress(unquote(strings.TrimSpace(value)))
+				}
 			}
+			hops = append(hops, hop)
 		}
 	}
-	return ""
+	return hops
+}
+
+// parseNodeAddress 解析节点地址：1.2.3.4、1.2.3.4:80、[2001:db8::1] 或 [2001:db8::1]:80
+func parseNodeAddress(node string) net.IP {
+	if host, _, err := net.SplitHostPort(node); err == nil {
+		node = host
+	}
+	node = strings.TrimSuffix(strings.TrimPrefix(node, "["), "]")
+	return normalizeIP(net.ParseIP(node))
+}
+
+// splitQuoted 按分隔符拆分，忽略引号内的分隔符
+func splitQuoted(value string, sep byte) []string {
+	var parts []string
+	quoted, escaped, start := false, false, 0
+	for i := 0; i < len(value); i++ {
+		switch {
+		case escaped:
+			escaped = false
+		case quoted && value[i] == '\\':
+			escaped = true
+		case value[i] == '"':
+			quoted = !quoted
+		case !quoted && value[i] == sep:
+			parts = append(parts, value[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, value[start:])
+}
+
+// unquote 去掉引号并处理转义
+func unquote(value string) string {
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return value
+	}
+	var b strings.Builder
+	for i := 1; i < len(value)-1; i++ {
+		if value[i] == '\\' && i+1 < len(value)-1 {
+			i++
+		}
+		b.WriteByte(value[i])
+	}
+	return b.String()
+}
+
+// GetRealClientIP 获取真实的客户端IP地址
+// 使用 ClientIPMiddleware 按受信任代理配置解析的结果，未经过该中间件时只使用直接连接的地址
+func GetRealClientIP(c *gin.Context) string {
+	if ip := c.GetString(ClientIPKey); ip != "" {
+		return ip
+	}
+	return defaultResolver.ClientIP(c.Request)
+}
+
+// IsSecureRequest 检查请求是否经过 HTTPS，用于设置 Cookie 的 Secure 属性
+// 使用 ClientIPMiddleware 按受信任代理配置判断的结果，未经过该中间件时只检查直接的 TLS 连接
+func IsSecureRequest(c *gin.Context) bool {
+	if secure, ok := c.Get(SecureRequestKey); ok {
+		return secure.(bool)
+	}
+	return defaultResolver.IsSecure(c.Request)
 }
 
 // GetClientIPInfo 获取客户端IP信息，包括是否通过代理
 func GetClientIPInfo(c *gin.Context) map[string]interface{} {
 	realIP := GetRealClientIP(c)
-	ginIP := c.ClientIP()
-	
+	peerIP := defaultResolver.ClientIP(c.Request)
+
 	info := map[string]interface{}{
-		"real_ip":     realIP,
-		"gin_ip":      ginIP,
-		"is_proxied":  realIP != ginIP,
+		"real_ip":    realIP,
+		"peer_ip":    peerIP,
+		"is_proxied": realIP != peerIP,
 		"headers": map[string]string{
-			"X-Real-IP":         c.GetHeader("X-Real-IP"),
-			"X-Forwarded-For":   c.GetHeader("X-Forwarded-For"),
-			"CF-Connecting-IP":  c.GetHeader("CF-Connecting-IP"),
-			"X-Forwarded":       c.GetHeader("X-Forwarded"),
-			"Forwarded":         c.GetHeader("Forwarded"),
+			"X-Real-IP":        c.GetHeader("X-Real-IP"),
+			"X-Forwarded-For":  c.GetHeader("X-Forwarded-For"),
+			"CF-Connecting-IP": c.GetHeader("CF-Connecting-IP"),
+			"Forwarded":        c.GetHeader("Forwarded"),
 		},
 	}
 
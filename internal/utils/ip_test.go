@@ -0,0 +1,201 @@
+package utils
+
+import (
+	"crypto/tls"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIPResolver(t *testing.T) {
+	proxies := []string{"10.0.0.0/8", "192.0.2.1", CloudflareProxies}
+	resolver, err := NewClientIPResolver(proxies, ProxyHeaderXForwarded)
+	if err != nil {
+		t.Fatalf("创建解析器失败: %v", err)
+	}
+	forwardedResolver, err := NewClientIPResolver(proxies, ProxyHeaderForwarded)
+	if err != nil {
+		t.Fatalf("创建解析器失败: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		peer      string
+		headers   map[string][]string
+		forwarded bool // 使用读取 Forwarded 的解析器
+		want      string
+	}{
+		{
+			name:    "不受信任的对端忽略所有转发头部",
+			peer:    "203.0.113.9:4000",
+			headers: map[string][]string{"X-Forwarded-For": {"198.51.100.1"}, "X-Real-IP": {"198.51.100.2"}, "CF-Connecting-IP": {"198.51.100.3"}},
+			want:    "203.0.113.9",
+		},
+		{
+			name:    "跳过受信任的代理，伪造的最左侧地址被忽略",
+			peer:    "10.0.0.2:4000",
+			headers: map[string][]string{"X-Forwarded-For": {"1.1.1.1, 198.51.100.7, 10.0.0.5"}},
+			want:    "198.51.100.7",
+		},
+		{
+			name:    "多个 X-Forwarded-For 头部按顺序连接",
+			peer:    "10.0.0.2:4000",
+			headers: map[string][]string{"X-Forwarded-For": {"198.51.100.7", "192.0.2.1"}},
+			want:    "198.51.100.7",
+		},
+		{
+			name:    "全部为受信任代理时返回最左侧地址",
+			peer:    "10.0.0.2:4000",
+			headers: map[string][]string{"X-Forwarded-For": {"10.1.1.1, 10.0.0.5"}},
+			want:    "10.1.1.1",
+		},
+		{
+			name:    "没有转发链时使用 X-Real-IP",
+			peer:    "10.0.0.2:4000",
+			headers: map[string][]string{"X-Real-IP": {"198.51.100.8"}},
+			want:    "198.51.100.8",
+		},
+		{
+			name:    "经过受信任代理转发的客户端伪造 Forwarded 被忽略",
+			peer:    "10.0.0.2:4000",
+			headers: map[string][]string{"Forwarded": {"for=1.1.1.1"}, "X-Forwarded-For": {"198.51.100.1"}},
+			want:    "198.51.100.1",
+		},
+		{
+			name:    "只有伪造的 Forwarded 时使用 X-Real-IP",
+			peer:    "10.0.0.2:4000",
+			headers: map[string][]string{"Forwarded": {"for=1.1.1.1"}, "X-Real-IP": {"198.51.100.2"}},
+			want:    "198.51.100.2",
+		},
+		{
+			name:      "配置为 Forwarded 时读取 Forwarded",
+			peer:      "10.0.0.2:4000",
+			headers:   map[string][]string{"Forwarded": {`for=198.51.100.9;proto=https, For="[2001:db8:cafe::17]:4711"`}, "X-Forwarded-For": {"198.51.100.1"}},
+			forwarded: true,
+			want:      "2001:db8:cafe::17",
+		},
+		{
+			name:      "配置为 Forwarded 时忽略 X-Forwarded-For 和 X-Real-IP",
+			peer:      "10.0.0.2:4000",
+			headers:   map[string][]string{"X-Forwarded-For": {"1.1.1.1"}, "X-Real-IP": {"1.1.1.2"}},
+			forwarded: true,
+			want:      "10.0.0.2",
+		},
+		{
+			name:      "Forwarded 带引号的参数中包含分隔符",
+			peer:      "10.0.0.2:4000",
+			headers:   map[string][]string{"Forwarded": {`for=198.51.100.10;by="a;b,c", for=10.0.0.9`}},
+			forwarded: true,
+			want:      "198.51.100.10",
+		},
+		{
+			name:      "Forwarded 中的 unknown 节点停止追溯",
+			peer:      "10.0.0.2:4000",
+			headers:   map[string][]string{"Forwarded": {"for=198.51.100.11, for=unknown, for=10.0.0.9"}},
+			forwarded: true,
+			want:      "10.0.0.9",
+		},
+		{
+			name:    "直接来自 Cloudflare 时使用 CF-Connecting-IP",
+			peer:    "173.245.48.10:4000",
+			headers: map[string][]string{"CF-Connecting-IP": {"198.51.100.12"}, "X-Forwarded-For": {"1.1.1.1"}},
+			want:    "198.51.100.12",
+		},
+		{
+			name:    "经过内部代理转发的 Cloudflare 请求",
+			peer:    "10.0.0.2:4000",
+			headers: map[string][]string{"CF-Connecting-IP": {"198.51.100.13"}, "X-Forwarded-For": {"198.51.100.13, 2606:4700::1"}},
+			want:    "198.51.100.13",
+		},
+		{
+			name:    "不经过 Cloudflare 时忽略 CF-Connecting-IP",
+			peer:    "10.0.0.2:4000",
+			headers: map[string][]string{"CF-Connecting-IP": {"1.1.1.1"}, "X-Forwarded-For": {"198.51.100.14"}},
+			want:    "198.51.100.14",
+		},
+		{
+			name:    "IPv4 映射的 IPv6 对端",
+			peer:    "[::ffff:10.0.0.2]:4000",
+			headers: map[string][]string{"X-Forwarded-For": {"198.51.100.15:5555"}},
+			want:    "198.51.100.15",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.peer
+			for name, values := range tt.headers {
+				for _, value := range values {
+					req.Header.Add(name, value)
+				}
+			}
+			r := resolver
+			if tt.forwarded {
+				r = forwardedResolver
+			}
+			if got := r.ClientIP(req); got != tt.want {
+				t.Errorf("期望 %s, 实际 %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestNewClientIPResolverInvalidProxy(t *testing.T) {
+	for _, proxy := range []string{"10.0.0.0/33", "not-an-ip"} {
+		if _, err := NewClientIPResolver([]string{proxy}, ProxyHeaderXForwarded); err == nil {
+			t.Errorf("%q 应该返回错误", proxy)
+		}
+	}
+	if _, err := NewClientIPResolver(nil, "x-real-ip"); err == nil {
+		t.Error("未知的转发头部应该返回错误")
+	}
+}
+
+func TestClientIPResolverIsSecure(t *testing.T) {
+	resolver, err := NewClientIPResolver([]string{"10.0.0.0/8"}, ProxyHeaderXForwarded)
+	if err != nil {
+		t.Fatalf("创建解析器失败: %v", err)
+	}
+	forwardedResolver, err := NewClientIPResolver([]string{"10.0.0.0/8"}, ProxyHeaderForwarded)
+	if err != nil {
+		t.Fatalf("创建解析器失败: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		peer      string
+		tls       bool
+		headers   map[string]string
+		forwarded bool
+		want      bool
+	}{
+		{name: "直接的 TLS 连接", peer: "203.0.113.9:4000", tls: true, want: true},
+		{name: "直接的 HTTP 连接", peer: "203.0.113.9:4000", want: false},
+		{name: "不受信任的对端伪造 X-Forwarded-Proto", peer: "203.0.113.9:4000", headers: map[string]string{"X-Forwarded-Proto": "https"}, want: false},
+		{name: "受信任代理转发 HTTPS", peer: "10.0.0.2:4000", headers: map[string]string{"X-Forwarded-Proto": "https"}, want: true},
+		{name: "多个代理时取最初的协议", peer: "10.0.0.2:4000", headers: map[string]string{"X-Forwarded-Proto": "http, https"}, want: false},
+		{name: "经过受信任代理转发的客户端伪造 Forwarded 被忽略", peer: "10.0.0.2:4000", headers: map[string]string{"Forwarded": `for=198.51.100.7;proto="https"`, "X-Forwarded-Proto": "http"}, want: false},
+		{name: "配置为 Forwarded 时读取 proto", peer: "10.0.0.2:4000", headers: map[string]string{"Forwarded": `for=198.51.100.7;proto="https"`, "X-Forwarded-Proto": "http"}, forwarded: true, want: true},
+		{name: "配置为 Forwarded 时忽略 X-Forwarded-Proto", peer: "10.0.0.2:4000", headers: map[string]string{"X-Forwarded-Proto": "https"}, forwarded: true, want: false},
+		{name: "受信任代理未转发协议", peer: "10.0.0.2:4000", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.peer
+			if tt.tls {
+				req.TLS = &tls.ConnectionState{}
+			}
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			r := resolver
+			if tt.forwarded {
+				r = forwardedResolver
+			}
+			if got := r.IsSecure(req); got != tt.want {
+				t.Errorf("期望 %v, 实际 %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,14 @@
+-- 添加可见性和访问码字段到 contents 表
+ALTER TABLE contents ADD COLUMN IF NOT EXISTS visibility VARCHAR(20) NOT NULL DEFAULT 'public';
+ALTER TABLE contents ADD COLUMN IF NOT EXISTS access_code_hash VARCHAR(255);
+
+-- 限制可见性取值
+ALTER TABLE contents ADD CONSTRAINT chk_contents_visibility
+    CHECK (visibility IN ('public', 'access_code', 'owner_only'));
+
+-- 添加索引以提高查询性能
+CREATE INDEX IF NOT EXISTS idx_contents_visibility ON contents(visibility);
+
+-- 添加注释
+COMMENT ON COLUMN contents.visibility IS '可见性：public 公开，access_code 需要访问码，owner_only 仅所有者可见';
+COMMENT ON COLUMN contents.access_code_hash IS '访问码的 bcrypt 哈希，仅 access_code 可见性使用';
@@ -0,0 +1,24 @@
+-- 创建自定义域名表
+CREATE TABLE IF NOT EXISTS custom_domains (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    domain VARCHAR(253) NOT NULL UNIQUE,
+    content_id UUID REFERENCES contents(id) ON DELETE SET NULL,
+    verification_token VARCHAR(64) NOT NULL,
+    is_verified BOOLEAN NOT NULL DEFAULT false,
+    verified_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- 创建索引
+CREATE INDEX IF NOT EXISTS idx_custom_domains_user_id ON custom_domains(user_id);
+CREATE INDEX IF NOT EXISTS idx_custom_domains_verified ON custom_domains(domain, is_verified);
+
+CREATE TRIGGER update_custom_domains_updated_at BEFORE UPDATE ON custom_domains
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- 添加注释
+COMMENT ON TABLE custom_domains IS '用户自定义域名表';
+COMMENT ON COLUMN custom_domains.content_id IS '域名根路径展示的内容，NULL表示未绑定';
+COMMENT ON COLUMN custom_domains.verification_token IS 'DNS TXT 验证令牌，记录名为 _anywebsites-challenge.<domain>';
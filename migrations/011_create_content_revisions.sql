@@ -0,0 +1,32 @@
+-- 创建内容修订历史表
+CREATE TABLE IF NOT EXISTS content_revisions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    content_id UUID NOT NULL REFERENCES contents(id) ON DELETE CASCADE,
+    revision INTEGER NOT NULL,
+    title VARCHAR(255),
+    description VARCHAR(500),
+    content TEXT NOT NULL,
+    editor_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    source VARCHAR(20) NOT NULL,
+    restored_from INTEGER,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    CONSTRAINT chk_content_revisions_source CHECK (source IN ('original', 'api', 'admin', 'restore'))
+);
+
+-- 创建索引
+CREATE UNIQUE INDEX IF NOT EXISTS idx_content_revisions_content_revision ON content_revisions(content_id, revision);
+
+-- 计划配置增加修订保留数量
+ALTER TABLE plan_configs ADD COLUMN IF NOT EXISTS revision_retention INTEGER NOT NULL DEFAULT 10;
+
+UPDATE plan_configs SET revision_retention = 5 WHERE type = 'community';
+UPDATE plan_configs SET revision_retention = 20 WHERE type = 'developer';
+UPDATE plan_configs SET revision_retention = 50 WHERE type = 'pro';
+UPDATE plan_configs SET revision_retention = 200 WHERE type = 'max';
+UPDATE plan_configs SET revision_retention = -1 WHERE type = 'enterprise';
+
+-- 添加注释
+COMMENT ON TABLE content_revisions IS '内容修订历史表，最新修订即当前内容';
+COMMENT ON COLUMN content_revisions.source IS '修订来源：original 原始内容，api 接口更新，admin 后台更新，restore 恢复';
+COMMENT ON COLUMN content_revisions.restored_from IS '恢复操作来源的修订号';
+COMMENT ON COLUMN plan_configs.revision_retention IS '每个内容保留的修订数量，-1表示无限制';
@@ -0,0 +1,34 @@
+-- 创建 API 密钥表，支持每个用户多个带权限范围的密钥
+CREATE EXTENSION IF NOT EXISTS pgcrypto;
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    prefix VARCHAR(16) NOT NULL,
+    key_hash VARCHAR(64) NOT NULL UNIQUE,
+    scopes VARCHAR(50) NOT NULL,
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- 创建索引
+CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys(user_id);
+
+-- 迁移 users.api_key 中已有的密钥，保留全部权限
+INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, created_at)
+SELECT id, 'default', LEFT(api_key, 8), encode(digest(api_key, 'sha256'), 'hex'), 'read,write,delete', created_at
+FROM users
+WHERE api_key IS NOT NULL AND api_key <> ''
+ON CONFLICT (key_hash) DO NOTHING;
+
+-- 删除旧的单密钥字段
+DROP INDEX IF EXISTS idx_users_api_key;
+ALTER TABLE users DROP COLUMN IF EXISTS api_key;
+
+-- 添加注释
+COMMENT ON TABLE api_keys IS '用户 API 密钥表，仅保存密钥的 SHA-256 哈希';
+COMMENT ON COLUMN api_keys.prefix IS '密钥明文前缀，用于在列表中识别密钥';
+COMMENT ON COLUMN api_keys.scopes IS '逗号分隔的权限范围：read, write, delete';
+COMMENT ON COLUMN api_keys.revoked_at IS '吊销时间，非空表示密钥已失效';
@@ -0,0 +1,36 @@
+-- 匿名上传：系统账户、上传记录和相关设置
+CREATE EXTENSION IF NOT EXISTS pgcrypto;
+
+-- 创建匿名内容归属的系统账户（禁用状态，密码不是合法的 bcrypt 哈希，无法登录）
+INSERT INTO users (id, username, email, password, is_active, is_admin, created_at, updated_at)
+VALUES (gen_random_uuid(), 'anonymous', 'anonymous@anywebsites.local', '!', FALSE, FALSE, NOW(), NOW())
+ON CONFLICT (username) DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS anonymous_uploads (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    content_id UUID NOT NULL UNIQUE REFERENCES contents(id) ON DELETE CASCADE,
+    ip_address VARCHAR(45) NOT NULL,
+    deletion_token_hash VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- 创建索引
+CREATE INDEX IF NOT EXISTS idx_anonymous_uploads_ip_time ON anonymous_uploads(ip_address, created_at);
+
+-- 匿名上传设置，默认关闭
+INSERT INTO system_settings (id, category, key, value, default_value, value_type, description, is_required, is_active)
+SELECT gen_random_uuid(), s.category, s.key, s.value, s.value, s.value_type, s.description, FALSE, TRUE
+FROM (VALUES
+    ('upload', 'anonymous_enabled', 'false', 'boolean', '允许未登录用户上传 HTML 内容'),
+    ('upload', 'anonymous_daily_quota', '5', 'integer', '每个 IP 每 24 小时的匿名上传次数'),
+    ('upload', 'anonymous_expiry_hours', '24', 'integer', '匿名内容的有效期（小时）'),
+    ('upload', 'anonymous_max_size', '524288', 'integer', '匿名上传内容的最大字节数')
+) AS s(category, key, value, value_type, description)
+WHERE NOT EXISTS (
+    SELECT 1 FROM system_settings existing WHERE existing.category = s.category AND existing.key = s.key
+);
+
+-- 添加注释
+COMMENT ON TABLE anonymous_uploads IS '匿名上传记录表，用于 IP 配额统计和凭令牌删除';
+COMMENT ON COLUMN anonymous_uploads.ip_address IS '上传者的客户端 IP';
+COMMENT ON COLUMN anonymous_uploads.deletion_token_hash IS '删除令牌的 SHA-256 哈希，明文只在上传时返回一次';
@@ -0,0 +1,30 @@
+-- 按字节统计用户存储空间用量
+CREATE TABLE IF NOT EXISTS storage_usages (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    used_bytes BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- 补全单页内容的文件大小（站点包在上传时已记录解压后的大小）
+UPDATE contents
+SET file_size = octet_length(content)
+WHERE COALESCE(file_path, '') = '' AND file_size <> octet_length(content);
+
+-- 根据现有的有效内容初始化用量
+INSERT INTO storage_usages (user_id, used_bytes, updated_at)
+SELECT user_id, SUM(file_size), NOW()
+FROM contents
+WHERE is_active = TRUE
+GROUP BY user_id
+ON CONFLICT (user_id) DO UPDATE SET used_bytes = EXCLUDED.used_bytes, updated_at = NOW();
+
+-- 同步当月使用统计中的存储快照（MB，向上取整）
+UPDATE usage_statistics u
+SET storage_used_mb = (s.used_bytes + 1048575) / 1048576
+FROM storage_usages s
+WHERE u.user_id = s.user_id AND u.month_year = to_char(NOW(), 'YYYY-MM');
+
+-- 添加注释
+COMMENT ON TABLE storage_usages IS '用户存储空间用量表，只统计有效（未删除）的内容';
+COMMENT ON COLUMN storage_usages.used_bytes IS '有效内容的总字节数，由清理任务定期与 contents 表核对';
+COMMENT ON COLUMN usage_statistics.storage_used_mb IS '当月最近一次更新时的存储用量快照(MB)';
@@ -0,0 +1,5 @@
+-- 内容正文可保存在外部 blob 存储（本地目录或 S3），数据库中只保留存储键
+ALTER TABLE contents ADD COLUMN IF NOT EXISTS storage_key VARCHAR(255);
+
+-- 添加注释
+COMMENT ON COLUMN contents.storage_key IS '正文在 blob 存储中的键，为空时正文保存在 content 列；已有数据使用 cmd/migrate-bodies 迁移';
@@ -0,0 +1,20 @@
+-- 内容页 HTTP 缓存：正文哈希用于 ETag，缓存时间可按计划和单个内容配置
+ALTER TABLE contents ADD COLUMN IF NOT EXISTS content_hash VARCHAR(64);
+ALTER TABLE contents ADD COLUMN IF NOT EXISTS cache_max_age INTEGER;
+
+ALTER TABLE plan_configs ADD COLUMN IF NOT EXISTS cache_max_age INTEGER NOT NULL DEFAULT 300;
+
+UPDATE plan_configs SET cache_max_age = 300 WHERE type = 'community';
+UPDATE plan_configs SET cache_max_age = 600 WHERE type = 'developer';
+UPDATE plan_configs SET cache_max_age = 3600 WHERE type = 'pro';
+UPDATE plan_configs SET cache_max_age = 3600 WHERE type = 'max';
+UPDATE plan_configs SET cache_max_age = 86400 WHERE type = 'enterprise';
+
+-- 为保存在数据库中的正文计算哈希，blob 存储中的正文在首次访问时计算
+UPDATE contents SET content_hash = encode(sha256(convert_to(content, 'UTF8')), 'hex')
+WHERE COALESCE(file_path, '') = '' AND COALESCE(storage_key, '') = '' AND content_hash IS NULL;
+
+-- 添加注释
+COMMENT ON COLUMN contents.content_hash IS '正文 SHA-256，用作 /view 的强 ETag';
+COMMENT ON COLUMN contents.cache_max_age IS '浏览器缓存秒数，为空时使用计划默认值，0 表示每次重新验证';
+COMMENT ON COLUMN plan_configs.cache_max_age IS '内容页默认的浏览器缓存秒数，0 表示每次重新验证';
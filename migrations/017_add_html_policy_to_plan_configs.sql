@@ -0,0 +1,15 @@
+-- 上传 HTML 的清理策略（HTML_SANITIZE 开启时生效）：none 不清理，strip_scripts 移除脚本，strict 只保留白名单标签
+ALTER TABLE plan_configs ADD COLUMN IF NOT EXISTS html_policy VARCHAR(20) NOT NULL DEFAULT 'none';
+
+UPDATE plan_configs SET html_policy = 'strict' WHERE type = 'community';
+UPDATE plan_configs SET html_policy = 'strip_scripts' WHERE type = 'developer';
+UPDATE plan_configs SET html_policy = 'strip_scripts' WHERE type = 'pro';
+UPDATE plan_configs SET html_policy = 'none' WHERE type = 'max';
+UPDATE plan_configs SET html_policy = 'none' WHERE type = 'enterprise';
+
+-- 限制策略取值
+ALTER TABLE plan_configs ADD CONSTRAINT chk_plan_configs_html_policy
+    CHECK (html_policy IN ('none', 'strip_scripts', 'strict'));
+
+-- 添加注释
+COMMENT ON COLUMN plan_configs.html_policy IS '上传 HTML 的清理策略：none 不清理，strip_scripts 移除脚本和事件属性，strict 只保留白名单标签和属性';
@@ -0,0 +1,59 @@
+-- 访问统计按天预聚合，管理后台统计页面查询汇总表而不是原始访问记录
+-- 汇总表由 AnalyticsRollupService 定期重算，首次启动时会从现有访问记录补齐历史数据
+CREATE TABLE IF NOT EXISTS analytics_daily (
+    content_id UUID NOT NULL REFERENCES contents(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    user_id UUID NOT NULL,
+    views BIGINT NOT NULL DEFAULT 0,
+    unique_ips BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (content_id, day)
+);
+
+CREATE TABLE IF NOT EXISTS analytics_daily_breakdowns (
+    content_id UUID NOT NULL REFERENCES contents(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    user_id UUID NOT NULL,
+    country VARCHAR(100) NOT NULL DEFAULT '',
+    region VARCHAR(100) NOT NULL DEFAULT '',
+    city VARCHAR(100) NOT NULL DEFAULT '',
+    referer_host VARCHAR(255) NOT NULL DEFAULT '',
+    device_class VARCHAR(20) NOT NULL DEFAULT '',
+    views BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (content_id, day, country, region, city, referer_host, device_class)
+);
+
+-- 全站每日汇总：独立 IP 不能由各内容的独立 IP 相加得到，单独统计
+CREATE TABLE IF NOT EXISTS analytics_daily_totals (
+    day DATE PRIMARY KEY,
+    views BIGINT NOT NULL DEFAULT 0,
+    unique_ips BIGINT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- 创建索引
+CREATE INDEX IF NOT EXISTS idx_analytics_daily_day ON analytics_daily(day);
+CREATE INDEX IF NOT EXISTS idx_analytics_daily_user_day ON analytics_daily(user_id, day);
+CREATE INDEX IF NOT EXISTS idx_analytics_daily_breakdowns_day ON analytics_daily_breakdowns(day);
+CREATE INDEX IF NOT EXISTS idx_analytics_daily_breakdowns_user_day ON analytics_daily_breakdowns(user_id, day);
+
+-- 统计设置分类和原始访问记录保留天数
+INSERT INTO system_setting_categories (id, name, display_name, description, icon, sort_order)
+SELECT gen_random_uuid(), 'analytics', '访问统计设置', '访问统计汇总和原始记录保留策略', 'bi-graph-up', 7
+WHERE NOT EXISTS (SELECT 1 FROM system_setting_categories WHERE name = 'analytics');
+
+INSERT INTO system_settings (id, category, key, value, default_value, value_type, description, is_required, is_active)
+SELECT gen_random_uuid(), s.category, s.key, s.value, s.value, s.value_type, s.description, FALSE, TRUE
+FROM (VALUES
+    ('analytics', 'raw_retention_days', '90', 'integer', '原始访问记录保留天数，已汇总的更早记录由清理任务删除，0 表示永久保留')
+) AS s(category, key, value, value_type, description)
+WHERE NOT EXISTS (
+    SELECT 1 FROM system_settings existing WHERE existing.category = s.category AND existing.key = s.key
+);
+
+-- 添加注释
+COMMENT ON TABLE analytics_daily IS '每个内容每天的访问量和独立 IP 数';
+COMMENT ON TABLE analytics_daily_breakdowns IS '每个内容每天按地区、来源域名和设备类型拆分的访问量';
+COMMENT ON TABLE analytics_daily_totals IS '全站每天的访问量和独立 IP 数，updated_at 晚于当天结束说明该天已完整汇总';
+COMMENT ON COLUMN analytics_daily_breakdowns.referer_host IS '来源 URL 的主机名（小写），直接访问为空';
+COMMENT ON COLUMN analytics_daily_breakdowns.device_class IS '根据 User-Agent 判断的设备类型：desktop、mobile、tablet、bot 或 unknown';
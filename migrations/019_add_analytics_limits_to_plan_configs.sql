@@ -0,0 +1,17 @@
+-- 用户访问统计接口的计划限制：可查询的天数和最细时间粒度
+ALTER TABLE plan_configs ADD COLUMN IF NOT EXISTS analytics_lookback_days INTEGER NOT NULL DEFAULT 7;
+ALTER TABLE plan_configs ADD COLUMN IF NOT EXISTS analytics_granularity VARCHAR(10) NOT NULL DEFAULT 'day';
+
+UPDATE plan_configs SET analytics_lookback_days = 7, analytics_granularity = 'day' WHERE type = 'community';
+UPDATE plan_configs SET analytics_lookback_days = 30, analytics_granularity = 'hour' WHERE type = 'developer';
+UPDATE plan_configs SET analytics_lookback_days = 90, analytics_granularity = 'hour' WHERE type = 'pro';
+UPDATE plan_configs SET analytics_lookback_days = 365, analytics_granularity = 'hour' WHERE type = 'max';
+UPDATE plan_configs SET analytics_lookback_days = -1, analytics_granularity = 'hour' WHERE type = 'enterprise';
+
+-- 限制粒度取值
+ALTER TABLE plan_configs ADD CONSTRAINT chk_plan_configs_analytics_granularity
+    CHECK (analytics_granularity IN ('day', 'hour'));
+
+-- 添加注释
+COMMENT ON COLUMN plan_configs.analytics_lookback_days IS '访问统计接口可查询的天数（含今天），-1 表示无限制';
+COMMENT ON COLUMN plan_configs.analytics_granularity IS '访问统计接口可用的最细粒度：day 按天，hour 按小时（最多 7 天，仅限原始记录保留期内）';
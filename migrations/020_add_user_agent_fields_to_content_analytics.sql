@@ -0,0 +1,39 @@
+-- 访问记录的终端信息：入库时由 User-Agent 解析
+ALTER TABLE content_analytics ADD COLUMN IF NOT EXISTS browser VARCHAR(50) NOT NULL DEFAULT '';
+ALTER TABLE content_analytics ADD COLUMN IF NOT EXISTS os VARCHAR(50) NOT NULL DEFAULT '';
+ALTER TABLE content_analytics ADD COLUMN IF NOT EXISTS device_type VARCHAR(20) NOT NULL DEFAULT '';
+ALTER TABLE content_analytics ADD COLUMN IF NOT EXISTS is_bot BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- 按与解析器相同的规则补全已有记录的设备类型和爬虫标记，浏览器和操作系统留空
+UPDATE content_analytics SET
+    is_bot = COALESCE(user_agent, '') ~* '(bot|crawler|spider|slurp|curl/|wget/|python-requests|python-urllib|go-http-client|okhttp|java/|libwww|httpclient|scrapy|headless|phantomjs|lighthouse|pingdom|uptime|facebookexternalhit|embedly)',
+    device_type = CASE
+        WHEN COALESCE(user_agent, '') = '' THEN 'unknown'
+        WHEN user_agent ~* '(bot|crawler|spider|slurp|curl/|wget/|python-requests|python-urllib|go-http-client|okhttp|java/|libwww|httpclient|scrapy|headless|phantomjs|lighthouse|pingdom|uptime|facebookexternalhit|embedly)' THEN 'bot'
+        WHEN user_agent ~* '(ipad|tablet|kindle|silk/|playbook)' OR (user_agent ~* 'android' AND user_agent !~* 'mobile') THEN 'tablet'
+        WHEN user_agent ~* '(mobi|iphone|ipod|windows phone|blackberry|opera mini)' THEN 'mobile'
+        ELSE 'desktop'
+    END
+WHERE device_type = '';
+
+-- 按天汇总增加浏览器和操作系统维度
+ALTER TABLE analytics_daily_breakdowns ADD COLUMN IF NOT EXISTS browser VARCHAR(50) NOT NULL DEFAULT '';
+ALTER TABLE analytics_daily_breakdowns ADD COLUMN IF NOT EXISTS os VARCHAR(50) NOT NULL DEFAULT '';
+ALTER TABLE analytics_daily_breakdowns DROP CONSTRAINT IF EXISTS analytics_daily_breakdowns_pkey;
+ALTER TABLE analytics_daily_breakdowns ADD PRIMARY KEY (content_id, day, country, region, city, referer_host, device_class, browser, os);
+
+-- 爬虫访问是否计入访问量，默认不计入
+INSERT INTO system_settings (id, category, key, value, default_value, value_type, description, is_required, is_active)
+SELECT gen_random_uuid(), s.category, s.key, s.value, s.value, s.value_type, s.description, FALSE, TRUE
+FROM (VALUES
+    ('analytics', 'exclude_bots', 'true', 'boolean', '爬虫和自动化工具的访问不计入访问次数和统计汇总（原始记录仍会保存）')
+) AS s(category, key, value, value_type, description)
+WHERE NOT EXISTS (
+    SELECT 1 FROM system_settings existing WHERE existing.category = s.category AND existing.key = s.key
+);
+
+-- 添加注释
+COMMENT ON COLUMN content_analytics.browser IS '浏览器名称，无法识别时为 Other';
+COMMENT ON COLUMN content_analytics.os IS '操作系统名称，无法识别时为 Other';
+COMMENT ON COLUMN content_analytics.device_type IS '设备类型：desktop、mobile、tablet、bot 或 unknown';
+COMMENT ON COLUMN content_analytics.is_bot IS '是否为爬虫或自动化工具的访问';
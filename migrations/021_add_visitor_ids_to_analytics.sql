@@ -0,0 +1,20 @@
+-- 独立访客按 IP 和 User-Agent 加每日盐值的哈希去重，原始 IP 可按 ANALYTICS_IP_STORAGE 截断或不保存
+ALTER TABLE content_analytics ADD COLUMN IF NOT EXISTS visitor_id VARCHAR(32) NOT NULL DEFAULT '';
+
+-- 每日盐值：所有实例共享，只保留今天和前一天，删除后无法再由 IP 还原访客标识
+CREATE TABLE IF NOT EXISTS analytics_salts (
+    day DATE PRIMARY KEY,
+    salt VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- 每天的访客 HyperLogLog 草图，用于合并估算跨天的独立访客数
+ALTER TABLE analytics_daily ADD COLUMN IF NOT EXISTS visitor_sketch BYTEA;
+ALTER TABLE analytics_daily_totals ADD COLUMN IF NOT EXISTS visitor_sketch BYTEA;
+
+-- 添加注释
+COMMENT ON COLUMN content_analytics.visitor_id IS 'IP 和 User-Agent 加当天盐值的 SHA-256 哈希前 32 位，早于该字段的记录为空';
+COMMENT ON TABLE analytics_salts IS '计算访客标识的每日盐值，只保留今天和前一天';
+COMMENT ON COLUMN analytics_daily.unique_ips IS '当天的独立访客数（按访客标识去重，旧记录按 IP）';
+COMMENT ON COLUMN analytics_daily.visitor_sketch IS '当天访客的 HyperLogLog 草图（1024 个寄存器）';
+COMMENT ON COLUMN analytics_daily_totals.visitor_sketch IS '全站当天访客的 HyperLogLog 草图（1024 个寄存器）';
@@ -0,0 +1,7 @@
+-- 实时访问推送：Max 和 Enterprise 计划的用户可以订阅自己内容的实时访问（对应 Max 计划的 Real-time monitoring 功能）
+ALTER TABLE plan_configs ADD COLUMN IF NOT EXISTS realtime_analytics BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE plan_configs SET realtime_analytics = TRUE WHERE type IN ('max', 'enterprise');
+
+-- 添加注释
+COMMENT ON COLUMN plan_configs.realtime_analytics IS '是否可以通过 SSE 订阅自己内容的实时访问和每分钟访问量';
@@ -0,0 +1,51 @@
+-- 访问来源分类和 UTM 推广活动参数：入库时由来源 URL 和内容访问地址的查询字符串解析
+ALTER TABLE content_analytics ADD COLUMN IF NOT EXISTS referer_category VARCHAR(20) NOT NULL DEFAULT '';
+ALTER TABLE content_analytics ADD COLUMN IF NOT EXISTS utm_source VARCHAR(100) NOT NULL DEFAULT '';
+ALTER TABLE content_analytics ADD COLUMN IF NOT EXISTS utm_medium VARCHAR(100) NOT NULL DEFAULT '';
+ALTER TABLE content_analytics ADD COLUMN IF NOT EXISTS utm_campaign VARCHAR(100) NOT NULL DEFAULT '';
+
+-- 按天汇总增加来源分类维度
+ALTER TABLE analytics_daily_breakdowns ADD COLUMN IF NOT EXISTS referer_category VARCHAR(20) NOT NULL DEFAULT '';
+ALTER TABLE analytics_daily_breakdowns DROP CONSTRAINT IF EXISTS analytics_daily_breakdowns_pkey;
+ALTER TABLE analytics_daily_breakdowns ADD PRIMARY KEY (content_id, day, country, region, city, referer_host, referer_category, device_class, browser, os);
+
+-- 按与解析器相同的域名列表补全已有记录的来源分类；站内访问依赖请求的 Host，已有记录无法判断，按外部网站处理
+UPDATE content_analytics SET referer_category = CASE
+        WHEN COALESCE(lower(substring(referer FROM '^[A-Za-z][A-Za-z0-9+.-]*://(?:[^@/#?]*@)?([^:/#?]+)')), '') = '' THEN 'direct'
+        WHEN lower(substring(referer FROM '^[A-Za-z][A-Za-z0-9+.-]*://(?:[^@/#?]*@)?([^:/#?]+)')) ~ '(^|\.)((google|yahoo|yandex)(\.[a-z0-9-]+){1,2}|bing\.com|baidu\.com|duckduckgo\.com|sogou\.com|so\.com|sm\.cn|naver\.com|ecosia\.org|search\.brave\.com)$' THEN 'search'
+        WHEN lower(substring(referer FROM '^[A-Za-z][A-Za-z0-9+.-]*://(?:[^@/#?]*@)?([^:/#?]+)')) ~ '(^|\.)(pinterest(\.[a-z0-9-]+){1,2}|facebook\.com|fb\.com|instagram\.com|twitter\.com|x\.com|t\.co|linkedin\.com|lnkd\.in|reddit\.com|youtube\.com|tiktok\.com|weibo\.com|weibo\.cn|t\.cn|zhihu\.com|douban\.com|weixin\.qq\.com|news\.ycombinator\.com|telegram\.org|t\.me|discord\.com|mastodon\.social)$' THEN 'social'
+        ELSE 'referral'
+    END
+WHERE referer_category = '';
+
+UPDATE analytics_daily_breakdowns SET referer_category = CASE
+        WHEN referer_host = '' THEN 'direct'
+        WHEN referer_host ~ '(^|\.)((google|yahoo|yandex)(\.[a-z0-9-]+){1,2}|bing\.com|baidu\.com|duckduckgo\.com|sogou\.com|so\.com|sm\.cn|naver\.com|ecosia\.org|search\.brave\.com)$' THEN 'search'
+        WHEN referer_host ~ '(^|\.)(pinterest(\.[a-z0-9-]+){1,2}|facebook\.com|fb\.com|instagram\.com|twitter\.com|x\.com|t\.co|linkedin\.com|lnkd\.in|reddit\.com|youtube\.com|tiktok\.com|weibo\.com|weibo\.cn|t\.cn|zhihu\.com|douban\.com|weixin\.qq\.com|news\.ycombinator\.com|telegram\.org|t\.me|discord\.com|mastodon\.social)$' THEN 'social'
+        ELSE 'referral'
+    END
+WHERE referer_category = '';
+
+-- 每个内容每天按 UTM 参数拆分的访问量，只包含带有 UTM 参数的访问
+CREATE TABLE IF NOT EXISTS analytics_daily_campaigns (
+    content_id UUID NOT NULL REFERENCES contents(id) ON DELETE CASCADE,
+    day DATE NOT NULL,
+    user_id UUID NOT NULL,
+    utm_source VARCHAR(100) NOT NULL DEFAULT '',
+    utm_medium VARCHAR(100) NOT NULL DEFAULT '',
+    utm_campaign VARCHAR(100) NOT NULL DEFAULT '',
+    views BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (content_id, day, utm_source, utm_medium, utm_campaign)
+);
+
+-- 创建索引
+CREATE INDEX IF NOT EXISTS idx_analytics_daily_campaigns_day ON analytics_daily_campaigns(day);
+CREATE INDEX IF NOT EXISTS idx_analytics_daily_campaigns_user_day ON analytics_daily_campaigns(user_id, day);
+
+-- 添加注释
+COMMENT ON COLUMN content_analytics.referer_category IS '来源分类：direct、search、social、internal 或 referral';
+COMMENT ON COLUMN content_analytics.utm_source IS '访问地址中的 utm_source 参数';
+COMMENT ON COLUMN content_analytics.utm_medium IS '访问地址中的 utm_medium 参数';
+COMMENT ON COLUMN content_analytics.utm_campaign IS '访问地址中的 utm_campaign 参数';
+COMMENT ON COLUMN analytics_daily_breakdowns.referer_category IS '来源分类：direct、search、social、internal 或 referral';
+COMMENT ON TABLE analytics_daily_campaigns IS '每个内容每天按 UTM 推广活动参数拆分的访问量';
@@ -0,0 +1,24 @@
+-- 创建服务端会话表：每个刷新 Token 一条记录，主键即 Token 的 jti
+CREATE TABLE IF NOT EXISTS user_sessions (
+    id UUID PRIMARY KEY,
+    family_id UUID NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    user_agent VARCHAR(255) NOT NULL DEFAULT '',
+    ip_address VARCHAR(45) NOT NULL DEFAULT '',
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    replaced_by UUID,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- 创建索引
+CREATE INDEX IF NOT EXISTS idx_user_sessions_family_id ON user_sessions(family_id);
+CREATE INDEX IF NOT EXISTS idx_user_sessions_user_id ON user_sessions(user_id);
+CREATE INDEX IF NOT EXISTS idx_user_sessions_expires_at ON user_sessions(expires_at);
+
+-- 添加注释
+COMMENT ON TABLE user_sessions IS '服务端会话表，用于刷新 Token 轮换和吊销';
+COMMENT ON COLUMN user_sessions.id IS '刷新 Token 的 jti，访问 Token 的 sid 指向签发时的记录';
+COMMENT ON COLUMN user_sessions.family_id IS '同一次登录轮换产生的记录共用的会话 ID';
+COMMENT ON COLUMN user_sessions.replaced_by IS '轮换后的新记录 ID，非空表示该刷新 Token 已使用';
+COMMENT ON COLUMN user_sessions.revoked_at IS '吊销时间，非空表示会话已失效';
@@ -0,0 +1,19 @@
+-- 创建 JWT 签名密钥表，非对称密钥由服务启动时生成并定期轮换
+CREATE TABLE IF NOT EXISTS jwt_signing_keys (
+    id VARCHAR(64) PRIMARY KEY,
+    algorithm VARCHAR(10) NOT NULL,
+    private_key TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    retired_at TIMESTAMP WITH TIME ZONE,
+    expires_at TIMESTAMP WITH TIME ZONE
+);
+
+-- 创建索引
+CREATE INDEX IF NOT EXISTS idx_jwt_signing_keys_expires_at ON jwt_signing_keys(expires_at);
+
+-- 添加注释
+COMMENT ON TABLE jwt_signing_keys IS 'JWT 非对称签名密钥，公钥通过 /.well-known/jwks.json 公开';
+COMMENT ON COLUMN jwt_signing_keys.id IS '公钥的 RFC 7638 指纹，即 Token 头部的 kid';
+COMMENT ON COLUMN jwt_signing_keys.private_key IS 'PKCS#8 PEM 格式的私钥';
+COMMENT ON COLUMN jwt_signing_keys.retired_at IS '停止签发的时间，为空表示当前签名密钥';
+COMMENT ON COLUMN jwt_signing_keys.expires_at IS '停止校验的时间，之后从 JWKS 中移除';
@@ -0,0 +1,34 @@
+-- 两步验证：用户 TOTP 密钥、恢复码和强制管理员启用的设置
+CREATE EXTENSION IF NOT EXISTS pgcrypto;
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_secret VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_enabled BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_last_step BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS user_recovery_codes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash VARCHAR(64) NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- 创建索引
+CREATE INDEX IF NOT EXISTS idx_user_recovery_codes_user_id ON user_recovery_codes(user_id);
+
+-- 强制管理员启用两步验证，默认关闭
+INSERT INTO system_settings (id, category, key, value, default_value, value_type, description, is_required, is_active)
+SELECT gen_random_uuid(), s.category, s.key, s.value, s.value, s.value_type, s.description, FALSE, TRUE
+FROM (VALUES
+    ('security', 'require_admin_2fa', 'false', 'boolean', '要求管理员账户启用两步验证后才能登录')
+) AS s(category, key, value, value_type, description)
+WHERE NOT EXISTS (
+    SELECT 1 FROM system_settings existing WHERE existing.category = s.category AND existing.key = s.key
+);
+
+-- 添加注释
+COMMENT ON COLUMN users.totp_secret IS 'TOTP 密钥（base32），设置中或已启用';
+COMMENT ON COLUMN users.totp_enabled IS '是否已启用两步验证';
+COMMENT ON COLUMN users.totp_last_step IS '最近一次验证通过的 TOTP 时间步，防止同一验证码重复使用';
+COMMENT ON TABLE user_recovery_codes IS '两步验证恢复码，每个只能使用一次';
+COMMENT ON COLUMN user_recovery_codes.code_hash IS '恢复码的 SHA-256 哈希，明文只在生成时返回一次';
@@ -0,0 +1,45 @@
+-- 单点登录：外部身份与本地用户的绑定，以及 OIDC 设置
+CREATE EXTENSION IF NOT EXISTS pgcrypto;
+
+CREATE TABLE IF NOT EXISTS user_identities (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    issuer VARCHAR(255) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    email VARCHAR(100) NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    last_login_at TIMESTAMP WITH TIME ZONE
+);
+
+-- 创建索引
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_identities_issuer_subject ON user_identities(issuer, subject);
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities(user_id);
+
+-- 单点登录设置分类
+INSERT INTO system_setting_categories (id, name, display_name, description, icon, sort_order)
+SELECT gen_random_uuid(), 'sso', '单点登录设置', 'OpenID Connect 身份提供方、用户自动创建和用户组映射', 'bi-box-arrow-in-right', 8
+WHERE NOT EXISTS (SELECT 1 FROM system_setting_categories WHERE name = 'sso');
+
+INSERT INTO system_settings (id, category, key, value, default_value, value_type, description, is_required, is_active)
+SELECT gen_random_uuid(), s.category, s.key, s.value, s.value, s.value_type, s.description, FALSE, TRUE
+FROM (VALUES
+    ('sso', 'oidc_enabled', 'false', 'boolean', '是否启用 OpenID Connect 单点登录'),
+    ('sso', 'oidc_issuer', '', 'string', '身份提供方的 Issuer 地址，从 /.well-known/openid-configuration 读取端点'),
+    ('sso', 'oidc_client_id', '', 'string', '在身份提供方注册的客户端 ID'),
+    ('sso', 'oidc_client_secret', '', 'string', '客户端密钥，公共客户端留空，仅使用 PKCE'),
+    ('sso', 'oidc_redirect_url', '', 'string', '回调地址，如 https://example.com/auth/oidc/callback'),
+    ('sso', 'oidc_scopes', 'openid profile email groups', 'string', '请求的 scope，空格分隔'),
+    ('sso', 'oidc_groups_claim', 'groups', 'string', 'ID Token 中用户组的 claim 名称'),
+    ('sso', 'oidc_admin_groups', '', 'string', '映射为管理员的用户组，逗号分隔；留空时不修改管理员状态'),
+    ('sso', 'oidc_plan_groups', '{}', 'json', '用户组到计划类型的映射，如 {"engineering": "enterprise"}，匹配多个时取最高的计划'),
+    ('sso', 'oidc_auto_provision', 'true', 'boolean', '首次登录且没有对应本地用户时自动创建用户')
+) AS s(category, key, value, value_type, description)
+WHERE NOT EXISTS (
+    SELECT 1 FROM system_settings existing WHERE existing.category = s.category AND existing.key = s.key
+);
+
+-- 添加注释
+COMMENT ON TABLE user_identities IS '外部身份提供方账户与本地用户的绑定';
+COMMENT ON COLUMN user_identities.issuer IS '身份提供方 Issuer';
+COMMENT ON COLUMN user_identities.subject IS 'ID Token 的 sub，与 issuer 一起唯一标识外部账户';
+COMMENT ON COLUMN user_identities.email IS '最近一次登录时 ID Token 中的邮箱';
@@ -0,0 +1,7 @@
+-- 两步验证输错锁定：按用户记录连续输错次数，重新登录获取新的挑战不会清零
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_failed_attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_locked_until TIMESTAMP WITH TIME ZONE;
+
+-- 添加注释
+COMMENT ON COLUMN users.totp_failed_attempts IS '连续输错两步验证码的次数，验证通过后清零';
+COMMENT ON COLUMN users.totp_locked_until IS '输错次数过多时锁定到该时间，锁定时长随输错次数翻倍';
@@ -0,0 +1,9 @@
+-- 自定义域名只在验证后唯一：未验证的声明不再占用域名，验证通过的用户接管该域名
+ALTER TABLE custom_domains DROP CONSTRAINT IF EXISTS custom_domains_domain_key;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_custom_domains_domain_verified ON custom_domains(domain) WHERE is_verified;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_custom_domains_user_domain ON custom_domains(user_id, domain);
+CREATE INDEX IF NOT EXISTS idx_custom_domains_unverified_created_at ON custom_domains(created_at) WHERE NOT is_verified;
+
+-- 添加注释
+COMMENT ON COLUMN custom_domains.is_verified IS '是否已通过 DNS TXT 验证，同一域名只能有一条已验证记录，未验证的记录 7 天后删除';
@@ -0,0 +1,18 @@
+-- 单点登录跳转期间的 PKCE 和 nonce 保存在数据库中，回调可以由任意实例处理
+CREATE TABLE IF NOT EXISTS oidc_pending_logins (
+    state VARCHAR(64) PRIMARY KEY,
+    issuer VARCHAR(255) NOT NULL,
+    verifier VARCHAR(128) NOT NULL,
+    nonce VARCHAR(64) NOT NULL,
+    target VARCHAR(20) NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- 创建索引
+CREATE INDEX IF NOT EXISTS idx_oidc_pending_logins_expires_at ON oidc_pending_logins(expires_at);
+
+-- 添加注释
+COMMENT ON TABLE oidc_pending_logins IS '跳转到身份提供方后尚未完成的单点登录，回调时删除，state 只能使用一次';
+COMMENT ON COLUMN oidc_pending_logins.verifier IS 'PKCE code_verifier';
+COMMENT ON COLUMN oidc_pending_logins.target IS '完成登录后进入的位置：admin 或 api';
@@ -0,0 +1,2 @@
+-- 签名私钥使用 JWT_KEY_ENCRYPTION_KEY 加密保存，已有的明文私钥由服务启动加载时加密
+COMMENT ON COLUMN jwt_signing_keys.private_key IS 'AES-256-GCM 加密的 PKCS#8 PEM 私钥，以 enc:v1: 开头；没有前缀的是加密前保存的明文，加载时自动加密';
@@ -0,0 +1,13 @@
+-- 系统账户标记：匿名上传的归属账户按该标记识别，不再只看用户名
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_system BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- 只标记 013 创建的账户（禁用且密码不是 bcrypt 哈希），同名的普通用户不会成为系统账户，匿名上传会拒绝执行
+UPDATE users SET is_system = TRUE
+WHERE username = 'anonymous' AND email = 'anonymous@anywebsites.local' AND password = '!' AND is_active = FALSE;
+
+-- 系统账户不能被启用
+ALTER TABLE users DROP CONSTRAINT IF EXISTS chk_users_system_inactive;
+ALTER TABLE users ADD CONSTRAINT chk_users_system_inactive CHECK (NOT is_system OR NOT is_active);
+
+-- 添加注释
+COMMENT ON COLUMN users.is_system IS '系统账户（如匿名上传内容的归属账户），始终禁用且无法登录';
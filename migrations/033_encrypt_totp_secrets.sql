@@ -0,0 +1,5 @@
+-- TOTP 密钥使用 JWT_KEY_ENCRYPTION_KEY 加密保存，密文比 base32 密钥长，扩大列长度；已有的明文密钥由服务启动时加密
+ALTER TABLE users ALTER COLUMN totp_secret TYPE VARCHAR(255);
+
+-- 添加注释
+COMMENT ON COLUMN users.totp_secret IS 'AES-256-GCM 加密的 TOTP 密钥，以 enc:v1: 开头，设置中或已启用；没有前缀的是加密前保存的明文，启动时自动加密';
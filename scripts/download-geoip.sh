@@ -12,6 +12,38 @@ echo "正在下载 MaxMind GeoLite2-City 数据库..."
 GEOIP_DIR="data/geoip"
 CITY_DB_FILE="$GEOIP_DIR/GeoLite2-City.mmdb"
 
+# download_edition 下载并解压一个 MaxMind 数据库，先写入临时文件再重命名，
+# 运行中的服务检测到文件变化后会自动重新加载，不会读到写了一半的文件
+download_edition() {
+    local edition="$1"
+    local target="$GEOIP_DIR/$edition.mmdb"
+    local tmp_dir
+    tmp_dir=$(mktemp -d)
+
+    echo "正在下载 $edition..."
+    if ! wget -q "https://download.maxmind.com/app/geoip_download?edition_id=$edition&license_key=$MAXMIND_LICENSE_KEY&suffix=tar.gz" -O "$tmp_dir/$edition.tar.gz"; then
+        echo "下载 $edition 失败"
+        rm -rf "$tmp_dir"
+        return 1
+    fi
+
+    tar -xzf "$tmp_dir/$edition.tar.gz" -C "$tmp_dir"
+    find "$tmp_dir" -name "$edition.mmdb" -exec cp {} "$target.tmp" \;
+    mv -f "$target.tmp" "$target"
+    rm -rf "$tmp_dir"
+    echo "$edition 已更新: $target"
+}
+
+# 设置了许可证密钥时直接下载（可重复执行以更新数据库），DOWNLOAD_ASN=true 时同时下载 ASN 数据库
+if [ -n "$MAXMIND_LICENSE_KEY" ]; then
+    download_edition GeoLite2-City || exit 1
+    if [ "$DOWNLOAD_ASN" = "true" ]; then
+        download_edition GeoLite2-ASN || exit 1
+    fi
+    echo "完成!"
+    exit 0
+fi
+
 if [ ! -f "$CITY_DB_FILE" ]; then
     echo "请按照以下步骤获取 GeoLite2-City 数据库："
     echo ""